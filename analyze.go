@@ -0,0 +1,56 @@
+package prettybuffers
+
+import (
+	"fmt"
+	"strings"
+)
+
+// maxAnalyzedObjects limits how many detected objects Analyze lists
+const maxAnalyzedObjects = 1000
+
+// Analyze returns a plain text report of what the viewer finds in data: its
+// size, format, entropy and hashes, the files embedded in it, the structures
+// of its format and the objects detected in it. It is meant for scripts and
+// quick looks without starting the TUI.
+func Analyze(data []byte) string {
+	m := dumpModel(data, hexViewLayout, defaultConfig())
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Size:      %d bytes\n", len(data))
+	if m.fileType.Name != "" {
+		fmt.Fprintf(&sb, "Type:      %s (%s)\n", m.fileType.Name, m.fileType.MIME)
+	}
+	fmt.Fprintf(&sb, "Entropy:   %.2f bits per byte\n", shannonEntropy(data))
+	if hashes, err := m.hashRange(Range{Start: 0, End: len(data)}); err == nil {
+		for _, d := range hashes.digests() {
+			fmt.Fprintf(&sb, "%-10s %s\n", d[0]+":", d[1])
+		}
+	}
+
+	if len(m.embedded) > 0 {
+		sb.WriteString("\nEmbedded files:\n")
+		for _, e := range m.embedded {
+			fmt.Fprintf(&sb, "  0x%08X  %s\n", e.offset, e.Name)
+		}
+	}
+	if len(m.structures) > 0 {
+		sb.WriteString("\nStructures:\n")
+		for _, s := range m.structures {
+			fmt.Fprintf(&sb, "  0x%08X-0x%08X  %s\n", s.start, s.end-1, s.name)
+		}
+	}
+	if len(m.jsonObjects) > 0 {
+		fmt.Fprintf(&sb, "\nDetected %s:\n", countObjects(m.jsonObjects))
+		for i, o := range m.jsonObjects {
+			if i == maxAnalyzedObjects {
+				fmt.Fprintf(&sb, "  ... %d more\n", len(m.jsonObjects)-i)
+				break
+			}
+			kind := o.kind.String()
+			if o.encoding != "" {
+				kind += ", " + o.encoding
+			}
+			fmt.Fprintf(&sb, "  0x%08X-0x%08X  %s, %d bytes\n", o.startOffset, o.endOffset, kind, o.endOffset-o.startOffset+1)
+		}
+	}
+	return sb.String()
+}
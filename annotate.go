@@ -0,0 +1,170 @@
+package prettybuffers
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/charmbracelet/lipgloss"
+)
+
+// Color is a terminal color: an ANSI color number such as "1" or "208", or a
+// hex value such as "#FF8800"
+type Color string
+
+// annotation is a labeled, colored range of the buffer
+type annotation struct {
+	start int // first byte
+	end   int // one past the last byte
+	label string
+	style lipgloss.Style
+	field *templateField // decodes the value shown, if set
+}
+
+// region is a named part of a detected object, such as a TLS record header
+type region struct {
+	start int // first byte
+	end   int // one past the last byte
+	label string
+}
+
+// regionAt returns the field of a structure covering pos, or else the
+// innermost region of a detected object, or else the structure, or nil.
+// Fields are more specific than the objects detected inside the data of a
+// structure, such as a section of an executable.
+func (m model) regionAt(pos int) *region {
+	if f := m.structureField(pos); f != nil {
+		return f
+	}
+	i := sort.Search(len(m.jsonObjects), func(i int) bool { return m.jsonObjects[i].endOffset >= pos })
+	if i == len(m.jsonObjects) || m.jsonObjects[i].startOffset > pos {
+		return m.structureRegion(pos)
+	}
+	var found *region
+	regions := m.jsonObjects[i].regions
+	for j := range regions {
+		r := &regions[j]
+		if r.start > pos {
+			break
+		}
+		if pos < r.end && (found == nil || r.end-r.start <= found.end-found.start) {
+			found = r
+		}
+	}
+	if found == nil {
+		return m.structureRegion(pos)
+	}
+	return found
+}
+
+// annotateMsg adds an annotation
+type annotateMsg annotation
+
+// clearAnnotationsMsg removes all annotations
+type clearAnnotationsMsg struct{}
+
+// addAnnotation inserts a keeping the list sorted by start offset. Where
+// annotations overlap, the smallest one covering a byte is drawn, and of equal
+// ones the one added last.
+func (m *model) addAnnotation(a annotation) {
+	i := sort.Search(len(m.annotations), func(i int) bool {
+		return m.annotations[i].start > a.start
+	})
+	m.annotations = append(m.annotations, annotation{})
+	copy(m.annotations[i+1:], m.annotations[i:])
+	m.annotations[i] = a
+}
+
+// annotationAt returns the innermost annotation covering pos, or nil
+func (m model) annotationAt(pos int) *annotation {
+	var found *annotation
+	for i := range m.annotations {
+		a := &m.annotations[i]
+		if a.start > pos {
+			break
+		}
+		if pos < a.end && (found == nil || a.end-a.start <= found.end-found.start) {
+			found = a
+		}
+	}
+	return found
+}
+
+// shiftAnnotations moves annotations after bytes were inserted or deleted
+func (m *model) shiftAnnotations(pos, delta int) {
+	shift := func(off int) int {
+		if off < pos {
+			return off
+		}
+		return max(pos, off+delta)
+	}
+
+	kept := m.annotations[:0]
+	for _, a := range m.annotations {
+		a.start, a.end = shift(a.start), shift(a.end)
+		if a.end > a.start {
+			kept = append(kept, a)
+		}
+	}
+	m.annotations = kept
+}
+
+// annotationInfo describes the annotation under the cursor for the footer,
+// or else the detected region, frame or streamed chunk
+func (m model) annotationInfo() string {
+	if !m.cursorActive() {
+		return ""
+	}
+	a := m.annotationAt(m.cursor)
+	if a == nil {
+		if r := m.regionAt(m.cursor); r != nil {
+			return m.theme.Footer.Render(fmt.Sprintf("[%s 0x%X-0x%X]", r.label, r.start, r.end-1)) + " "
+		}
+		if info := m.frameInfo(); info != "" {
+			return m.theme.Footer.Render(info) + " "
+		}
+		if info := m.arrivalInfo(); info != "" {
+			return m.theme.Footer.Render(info) + " "
+		}
+		return ""
+	}
+	label := a.label
+	if raw := m.window(a.start, a.end-a.start); a.field != nil && len(raw) == a.end-a.start {
+		value, _ := templateValue(*a.field, raw, m.byteOrder)
+		label += " = " + value
+	}
+	return a.style.Render(fmt.Sprintf("[%s 0x%X-0x%X]", label, a.start, a.end-1)) + " "
+}
+
+// Annotate marks the bytes from start up to (not including) end with a label
+// and color. Annotated bytes are drawn on the given background color, and the
+// label is shown in the status bar while the cursor is inside the range.
+func (v *Viewer) Annotate(start, end int, label string, color Color) {
+	if end <= start {
+		return
+	}
+	v.program.Send(annotateMsg{
+		start: start,
+		end:   end,
+		label: label,
+		style: lipgloss.NewStyle().Background(lipgloss.Color(color)),
+	})
+}
+
+// ClearAnnotations removes all annotations from this viewer
+func (v *Viewer) ClearAnnotations() {
+	v.program.Send(clearAnnotationsMsg{})
+}
+
+// Annotate marks a range in the TUI started by StartTUI, see Viewer.Annotate
+func Annotate(start, end int, label string, color Color) {
+	if v := defaultViewer(); v != nil {
+		v.Annotate(start, end, label, color)
+	}
+}
+
+// ClearAnnotations removes all annotations from the TUI started by StartTUI
+func ClearAnnotations() {
+	if v := defaultViewer(); v != nil {
+		v.ClearAnnotations()
+	}
+}
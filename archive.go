@@ -0,0 +1,385 @@
+package prettybuffers
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+const (
+	// maxArchiveEntries limits how many entries of an archive are parsed
+	maxArchiveEntries = 1024
+	// zipEOCDSize is the size of the end of central directory record
+	// without its comment, which may be up to 64 KiB long
+	zipEOCDSize = 22
+	// tarBlockSize is the size of tar headers, and what data is padded to
+	tarBlockSize = 512
+)
+
+var (
+	zipMethods = map[uint64]string{
+		0: "stored", 1: "shrunk", 6: "imploded", 8: "deflate", 9: "deflate64", 12: "bzip2", 14: "LZMA",
+		93: "zstd", 95: "xz", 98: "PPMd", 99: "AES encrypted",
+	}
+
+	zipFlags = []flagName{{0x1, "encrypted"}, {0x8, "data descriptor"}, {0x800, "UTF-8"}}
+
+	tarTypes = map[uint64]string{
+		'0': "file", 0: "file", '1': "hard link", '2': "symlink", '3': "character device",
+		'4': "block device", '5': "directory", '6': "FIFO", '7': "contiguous file",
+		'g': "pax global header", 'x': "pax header", 'L': "GNU long name", 'K': "GNU long link name",
+	}
+)
+
+// archiveEntry is the data of a file stored in an archive
+type archiveEntry struct {
+	name  string
+	start int
+	end   int // one past the last byte
+}
+
+// archiveEntries lists the entries of the archive loaded, in file order
+func (m model) archiveEntries() []archiveEntry {
+	var entries []archiveEntry
+	for _, s := range m.structures {
+		if s.entry != "" {
+			entries = append(entries, archiveEntry{name: s.entry, start: s.start, end: s.end})
+		}
+	}
+	return entries
+}
+
+// cmdEntry moves the cursor to the data of an archive entry, given by its
+// name or its number. Without arguments it lists the entries.
+func cmdEntry(m *model, args string) (tea.Cmd, error) {
+	entries := m.archiveEntries()
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("no archive entries, only ZIP and tar archives are parsed")
+	}
+	if args == "" {
+		var list []string
+		for _, e := range entries {
+			list = append(list, fmt.Sprintf("%s at 0x%X", e.name, e.start))
+		}
+		m.status = fmt.Sprintf("%d entries: %s", len(entries), strings.Join(list, ", "))
+		return nil, nil
+	}
+	i := -1
+	for j, e := range entries {
+		if e.name == args {
+			i = j
+			break
+		}
+	}
+	if n, err := strconv.Atoi(args); i < 0 && err == nil && n >= 1 && n <= len(entries) {
+		i = n - 1
+	}
+	if i < 0 {
+		return nil, fmt.Errorf("no entry %q", args)
+	}
+	e := entries[i]
+	m.moveCursor(e.start - m.cursor)
+	m.status = fmt.Sprintf("Entry %d of %d, %s: %d bytes at 0x%08X", i+1, len(entries), e.name, e.end-e.start, e.start)
+	return nil, nil
+}
+
+// completeEntries offers the names of the archive entries
+func completeEntries(m *model, args string) []string {
+	var names []string
+	for _, e := range m.archiveEntries() {
+		names = append(names, e.name)
+	}
+	return matchingPrefix(names, args)
+}
+
+// dosTime formats an MS-DOS date and time as stored in ZIP headers
+func dosTime(date, t uint64) string {
+	return fmt.Sprintf("%04d-%02d-%02d %02d:%02d:%02d", 1980+date>>9, date>>5&0xf, date&0x1f, t>>11, t>>5&0x3f, t&0x1f*2)
+}
+
+// zipEntry is what the central directory tells about an entry
+type zipEntry struct {
+	local int // offset of the local file header
+	csize uint64
+	usize uint64
+}
+
+// parseZIP parses the local file headers, the data of each entry, the
+// central directory and the end of central directory record. Without the
+// latter, as when the archive is cut off, the local file headers are read
+// one after another.
+func parseZIP(read func(off, n int) []byte, size int) []structure {
+	var headers, data []structure
+	tail := max(0, size-zipEOCDSize-0xffff)
+	eocd := bytes.LastIndex(read(tail, size-tail), []byte("PK\x05\x06"))
+	if eocd >= 0 && tail+eocd+zipEOCDSize <= size {
+		eocd += tail
+		b, _ := newStructBuilder(read, eocd, zipEOCDSize, binary.LittleEndian, "End of central directory")
+		b.raw("signature", 4)
+		b.dec("disk number", 2)
+		b.dec("central directory disk", 2)
+		b.dec("entries on disk", 2)
+		count := b.dec("entries", 2)
+		b.dec("central directory size", 4)
+		cdOffset := b.hex("central directory offset", 4)
+		comment := b.dec("comment length", 2)
+		s := b.done()
+		if c := min(int(comment), size-eocd-zipEOCDSize); c > 0 {
+			s.end += c
+			s.fields = append(s.fields, region{start: eocd + zipEOCDSize, end: s.end,
+				label: "End of central directory comment = " + truncateText(string(read(eocd+zipEOCDSize, c)))})
+		}
+		headers = append(headers, s)
+
+		pos := int(cdOffset)
+		for i := 0; i < min(int(count), maxArchiveEntries); i++ {
+			s, entry, ok := parseZIPCentralHeader(read, pos)
+			if !ok {
+				break
+			}
+			headers = append(headers, s)
+			pos = s.end
+			if local, _, ok := parseZIPLocalHeader(read, size, entry.local, &entry, &data); ok {
+				headers = append(headers, local...)
+			}
+		}
+		if len(headers) > 1 {
+			return append(headers, data...)
+		}
+	}
+
+	// Walk the local file headers
+	pos := 0
+	for i := 0; i < maxArchiveEntries; i++ {
+		local, next, ok := parseZIPLocalHeader(read, size, pos, nil, &data)
+		if !ok {
+			break
+		}
+		headers = append(headers, local...)
+		if next < 0 {
+			break
+		}
+		pos = next
+	}
+	return append(headers, data...)
+}
+
+// parseZIPCentralHeader parses the central directory header at off
+func parseZIPCentralHeader(read func(off, n int) []byte, off int) (structure, zipEntry, bool) {
+	fixed := read(off, 46)
+	if len(fixed) < 46 || string(fixed[:4]) != "PK\x01\x02" {
+		return structure{}, zipEntry{}, false
+	}
+	nameLen, extraLen, commentLen := int(binary.LittleEndian.Uint16(fixed[28:])), int(binary.LittleEndian.Uint16(fixed[30:])), int(binary.LittleEndian.Uint16(fixed[32:]))
+	name := sanitizeString(string(read(off+46, nameLen)))
+	b, ok := newStructBuilder(read, off, 46+nameLen+extraLen+commentLen, binary.LittleEndian, "Central directory header "+name)
+	if !ok {
+		return structure{}, zipEntry{}, false
+	}
+	b.raw("signature", 4)
+	b.hex("version made by", 2)
+	b.hex("version needed", 2)
+	b.flags("flags", 2, zipFlags)
+	b.enum("compression", 2, zipMethods)
+	t, date := b.uint(2), binary.LittleEndian.Uint16(fixed[14:])
+	b.add("last modified", 4, dosTime(uint64(date), t))
+	b.hex("CRC-32", 4)
+	csize := b.dec("compressed size", 4)
+	usize := b.dec("uncompressed size", 4)
+	b.dec("name length", 2)
+	b.dec("extra length", 2)
+	b.dec("comment length", 2)
+	b.dec("disk number", 2)
+	b.hex("internal attributes", 2)
+	b.hex("external attributes", 4)
+	local := b.hex("local header offset", 4)
+	b.add("name", nameLen, name)
+	if extraLen > 0 {
+		b.raw("extra field", extraLen)
+	}
+	if commentLen > 0 {
+		b.add("comment", commentLen, truncateText(string(b.data[b.pos:b.pos+commentLen])))
+	}
+	return b.done(), zipEntry{local: int(local), csize: csize, usize: usize}, true
+}
+
+// parseZIPLocalHeader parses the local file header at off, adding the data
+// of the entry to data. The sizes are taken from the central directory entry
+// if known, as the header may defer them to a data descriptor after the data.
+// It returns the header and the data descriptor, and where the next entry
+// starts, or -1 if that is unknown.
+func parseZIPLocalHeader(read func(off, n int) []byte, size, off int, known *zipEntry, data *[]structure) ([]structure, int, bool) {
+	fixed := read(off, 30)
+	if len(fixed) < 30 || string(fixed[:4]) != "PK\x03\x04" {
+		return nil, 0, false
+	}
+	nameLen, extraLen := int(binary.LittleEndian.Uint16(fixed[26:])), int(binary.LittleEndian.Uint16(fixed[28:]))
+	name := sanitizeString(string(read(off+30, nameLen)))
+	b, ok := newStructBuilder(read, off, 30+nameLen+extraLen, binary.LittleEndian, "Local file header "+name)
+	if !ok {
+		return nil, 0, false
+	}
+	b.raw("signature", 4)
+	b.hex("version needed", 2)
+	flags := b.flags("flags", 2, zipFlags)
+	method := b.enum("compression", 2, zipMethods)
+	t, date := b.uint(2), binary.LittleEndian.Uint16(fixed[12:])
+	b.add("last modified", 4, dosTime(uint64(date), t))
+	b.hex("CRC-32", 4)
+	csize := b.dec("compressed size", 4)
+	usize := b.dec("uncompressed size", 4)
+	b.dec("name length", 2)
+	b.dec("extra length", 2)
+	b.add("name", nameLen, name)
+	if extraLen > 0 {
+		b.raw("extra field", extraLen)
+	}
+	header := b.done()
+	structures := []structure{header}
+
+	start := header.end
+	if known != nil {
+		csize, usize = known.csize, known.usize
+	} else if flags&0x8 != 0 {
+		// The sizes are only known from the data descriptor after the data
+		return structures, -1, true
+	}
+	end := start + min(int(csize), size-start)
+	if end > start {
+		method, ok := zipMethods[method]
+		if !ok {
+			method = "unknown method"
+		}
+		desc := fmt.Sprintf("Entry %s, %s, %d bytes", name, method, csize)
+		if csize != usize {
+			desc += fmt.Sprintf(", %d uncompressed", usize)
+		}
+		*data = append(*data, structure{start: start, end: end, name: desc, entry: name})
+	}
+	next := start + int(csize)
+	if flags&0x8 != 0 {
+		descSize := 12
+		if bytes.Equal(read(next, 4), []byte("PK\x07\x08")) {
+			descSize = 16
+		}
+		if b, ok := newStructBuilder(read, next, descSize, binary.LittleEndian, "Data descriptor "+name); ok {
+			if descSize == 16 {
+				b.raw("signature", 4)
+			}
+			b.hex("CRC-32", 4)
+			b.dec("compressed size", 4)
+			b.dec("uncompressed size", 4)
+			structures = append(structures, b.done())
+		}
+		next += descSize
+	}
+	return structures, next, true
+}
+
+// tarNumber reads a numeric tar header field, in octal or, for large values,
+// in base-256 with the high bit of the first byte set
+func tarNumber(raw []byte) uint64 {
+	if len(raw) > 0 && raw[0]&0x80 != 0 {
+		var v uint64
+		for i, c := range raw {
+			if i == 0 {
+				c &= 0x7f
+			}
+			v = v<<8 | uint64(c)
+		}
+		return v
+	}
+	v, _ := strconv.ParseUint(strings.Trim(string(raw), " \x00"), 8, 64)
+	return v
+}
+
+// octal adds a numeric tar header field and returns its value
+func (b *structBuilder) octal(name string, size int) uint64 {
+	v := tarNumber(b.data[b.pos : b.pos+size])
+	b.add(name, size, fmt.Sprintf("%d (0%o)", v, v))
+	return v
+}
+
+// paxPath returns the path set by the records of a pax extended header
+func paxPath(records []byte) string {
+	for len(records) > 0 {
+		length, rest, ok := bytes.Cut(records, []byte(" "))
+		n, err := strconv.Atoi(string(length))
+		if !ok || err != nil || n <= len(length) || n > len(records) {
+			return ""
+		}
+		if key, value, _ := bytes.Cut(rest[:n-len(length)-1], []byte("=")); string(key) == "path" {
+			return strings.TrimSuffix(string(value), "\n")
+		}
+		records = records[n:]
+	}
+	return ""
+}
+
+// parseTar parses the header block of each entry, and its data
+func parseTar(read func(off, n int) []byte, size int) []structure {
+	var structures []structure
+	longName := ""
+	pos := 0
+	for i := 0; i < maxArchiveEntries; i++ {
+		block := read(pos, tarBlockSize)
+		if len(block) < tarBlockSize || bytes.Count(block, []byte{0}) == tarBlockSize {
+			// Two zero blocks end the archive
+			break
+		}
+		name := cString(block[:100])
+		if prefix := cString(block[345:500]); prefix != "" && string(block[257:262]) == "ustar" {
+			name = prefix + "/" + name
+		}
+		if longName != "" {
+			name, longName = longName, ""
+		}
+		b, _ := newStructBuilder(read, pos, tarBlockSize, binary.BigEndian, "Tar header "+name)
+		b.str("name", 100)
+		b.octal("mode", 8)
+		b.octal("uid", 8)
+		b.octal("gid", 8)
+		length := b.octal("size", 12)
+		mtime := tarNumber(block[136:148])
+		b.add("mtime", 12, time.Unix(int64(mtime), 0).UTC().Format("2006-01-02 15:04:05"))
+		b.octal("checksum", 8)
+		typ := b.enum("type", 1, tarTypes)
+		b.str("link name", 100)
+		b.str("magic", 6)
+		b.str("version", 2)
+		b.str("user name", 32)
+		b.str("group name", 32)
+		b.octal("device major", 8)
+		b.octal("device minor", 8)
+		b.str("prefix", 155)
+		b.raw("padding", 12)
+		structures = append(structures, b.done())
+
+		start := pos + tarBlockSize
+		end := start + min(int(length), size-start)
+		switch typ {
+		case 'L':
+			longName = cString(read(start, end-start))
+		case 'x':
+			longName = sanitizeString(paxPath(read(start, end-start)))
+		}
+		if end > start {
+			s := structure{start: start, end: end, name: fmt.Sprintf("Entry %s, %d bytes", name, length), entry: name}
+			if typ == 'L' || typ == 'K' || typ == 'x' || typ == 'g' {
+				// Metadata for the next entry or the whole archive
+				s.name, s.entry = fmt.Sprintf("%s for %s, %d bytes", tarTypes[typ], name, length), ""
+			}
+			structures = append(structures, s)
+		}
+		pos = start + int((length+tarBlockSize-1)/tarBlockSize*tarBlockSize)
+		if pos >= size {
+			break
+		}
+	}
+	return structures
+}
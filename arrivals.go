@@ -0,0 +1,149 @@
+package prettybuffers
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/charmbracelet/lipgloss"
+)
+
+// arrival records when a chunk of streamed data arrived
+type arrival struct {
+	start int // offset of the first byte of the chunk
+	at    time.Time
+}
+
+// timeMode is how the arrival of streamed chunks is shown
+type timeMode int
+
+const (
+	timesHidden timeMode = iota
+	// timesRelative shows the time since the chunk before
+	timesRelative
+	// timesAbsolute shows the time of day
+	timesAbsolute
+)
+
+// chunkStartStyle marks the first byte of each streamed chunk while their
+// times are shown
+var chunkStartStyle = lipgloss.NewStyle().Underline(true).Bold(true)
+
+// appendStreamed appends data that arrived at the given time, recording
+// where its chunk starts
+func (m *model) appendStreamed(data []byte, at time.Time) {
+	start := m.size()
+	m.appendData(data)
+	if m.size() == start+len(data) && len(data) > 0 {
+		m.arrivals = append(m.arrivals, arrival{start: start, at: at})
+	}
+}
+
+// isChunkStart reports whether a streamed chunk starts at pos and the times
+// of chunks are shown
+func (m model) isChunkStart(pos int) bool {
+	if m.times == timesHidden {
+		return false
+	}
+	i := sort.Search(len(m.arrivals), func(i int) bool { return m.arrivals[i].start >= pos })
+	return i < len(m.arrivals) && m.arrivals[i].start == pos
+}
+
+// cycleTimes switches between hiding the times of streamed chunks and
+// showing them relative to the chunk before or as the time of day
+func (m *model) cycleTimes() {
+	m.times = (m.times + 1) % (timesAbsolute + 1)
+	if !m.fixedBytesPerRow {
+		m.autoBytesPerRow()
+	}
+	switch {
+	case m.times == timesHidden:
+		m.status = "Hiding when chunks arrived"
+	case len(m.arrivals) == 0:
+		m.status = "No chunks were streamed in yet, see ShowReader and AppendBytes"
+	case m.times == timesRelative:
+		m.status = fmt.Sprintf("Showing when each of %d chunks arrived, after the one before", len(m.arrivals))
+	default:
+		m.status = fmt.Sprintf("Showing when each of %d chunks arrived, as the time of day", len(m.arrivals))
+	}
+}
+
+// timeColumn returns the column showing the arrival of chunks as set
+func (m model) timeColumn() TimeColumn {
+	return TimeColumn{Absolute: m.times == timesAbsolute, arrivals: m.arrivals}
+}
+
+// TimeColumn shows when the streamed chunks starting in each row arrived,
+// such as those read by ShowReader or appended by AppendBytes. Where several
+// start in a row, their number is shown along with the time of the first,
+// or the longest delay before one of them.
+type TimeColumn struct {
+	// Absolute shows the time of day instead of the time since the chunk
+	// before
+	Absolute bool
+	arrivals []arrival
+}
+
+// Header implements ColumnRenderer
+func (TimeColumn) Header() string { return "Arrived" }
+
+// Width implements ColumnRenderer
+func (TimeColumn) Width(int) int { return lipgloss.Width("15:04:05.000000 ×99") }
+
+// RenderRow implements ColumnRenderer
+func (c TimeColumn) RenderRow(data []byte, offset int) string {
+	i := sort.Search(len(c.arrivals), func(i int) bool { return c.arrivals[i].start >= offset })
+	n := 0
+	for j := i; j < len(c.arrivals) && c.arrivals[j].start < offset+len(data); j++ {
+		n++
+	}
+	if n == 0 {
+		return ""
+	}
+	var text string
+	if c.Absolute {
+		text = c.arrivals[i].at.Format("15:04:05.000000")
+	} else {
+		longest := time.Duration(0)
+		for j := max(i, 1); j < i+n; j++ {
+			if d := c.arrivals[j].at.Sub(c.arrivals[j-1].at); d > longest {
+				longest = d
+			}
+		}
+		text = formatDelay(longest)
+	}
+	if n > 1 {
+		text += fmt.Sprintf(" ×%d", n)
+	}
+	return text
+}
+
+func (c TimeColumn) renderStyled(m model, data []byte, offset int) string {
+	return m.theme.Offset.Render(c.RenderRow(data, offset))
+}
+
+// arrivalInfo describes the streamed chunk under the cursor for the footer
+// while the times of chunks are shown
+func (m model) arrivalInfo() string {
+	i := sort.Search(len(m.arrivals), func(i int) bool { return m.arrivals[i].start > m.cursor }) - 1
+	if m.times == timesHidden || i < 0 {
+		return ""
+	}
+	a := m.arrivals[i]
+	info := fmt.Sprintf("[chunk %d/%d at %s", i+1, len(m.arrivals), a.at.Format("15:04:05.000000"))
+	if i > 0 {
+		info += ", " + formatDelay(a.at.Sub(m.arrivals[i-1].at)) + " after the one before"
+	}
+	return info + "]"
+}
+
+// formatDelay formats the time between two chunks, e.g. +12.5ms
+func formatDelay(d time.Duration) string {
+	switch {
+	case d < time.Millisecond:
+		return fmt.Sprintf("+%dµs", d.Microseconds())
+	case d < time.Second:
+		return fmt.Sprintf("+%.1fms", float64(d)/float64(time.Millisecond))
+	}
+	return fmt.Sprintf("+%.3fs", d.Seconds())
+}
@@ -0,0 +1,131 @@
+package prettybuffers
+
+import (
+	"encoding/base64"
+	"strings"
+	"unicode/utf8"
+)
+
+// minBase64Length is the shortest run of base64 characters that is decoded
+const minBase64Length = 24
+
+// isBase64Char reports whether b belongs to the standard or URL-safe alphabet
+func isBase64Char(b byte) bool {
+	return b >= 'A' && b <= 'Z' || b >= 'a' && b <= 'z' || b >= '0' && b <= '9' ||
+		b == '+' || b == '/' || b == '-' || b == '_'
+}
+
+// decodeBase64 decodes a run of base64 characters, with or without padding,
+// in the standard or URL-safe alphabet
+func decodeBase64(run []byte) ([]byte, bool) {
+	text := strings.TrimRight(string(run), "=")
+	enc := base64.RawStdEncoding
+	if strings.ContainsAny(text, "-_") {
+		if strings.ContainsAny(text, "+/") {
+			return nil, false
+		}
+		enc = base64.RawURLEncoding
+	}
+	decoded, err := enc.DecodeString(text)
+	return decoded, err == nil
+}
+
+// looksLikeBase64 reports whether a run mixes the kinds of characters found
+// in encoded data, to tell it apart from long words and identifiers
+func looksLikeBase64(run []byte) bool {
+	var upper, lower, digit bool
+	for _, b := range run {
+		switch {
+		case b >= 'A' && b <= 'Z':
+			upper = true
+		case b >= 'a' && b <= 'z':
+			lower = true
+		case b >= '0' && b <= '9':
+			digit = true
+		}
+	}
+	return upper && lower && digit
+}
+
+// scanBase64Objects finds long runs of base64 in data starting at from,
+// skipping the ranges of the given objects, and runs detection on what they
+// decode to. Like scanJSONObjects it returns the offset of a run that may
+// continue in appended data.
+func scanBase64Objects(data []byte, from int, skip []jsonObject, b *decodeBudget) ([]jsonObject, int) {
+	var objects []jsonObject
+	resume := len(data)
+	next := 0 // index into skip of the next object at or after i
+	for i := from; i < len(data); i++ {
+		for next < len(skip) && skip[next].endOffset < i {
+			next++
+		}
+		end := len(data)
+		if next < len(skip) {
+			if skip[next].startOffset <= i {
+				i = skip[next].endOffset
+				continue
+			}
+			end = skip[next].startOffset
+		}
+		if !isBase64Char(data[i]) || (i > 0 && isBase64Char(data[i-1])) {
+			continue
+		}
+
+		j := i
+		for j < end && isBase64Char(data[j]) {
+			j++
+		}
+		for pad := 0; pad < 2 && j < end && data[j] == '='; pad++ {
+			j++
+		}
+		if j >= len(data) {
+			resume = min(resume, i)
+		}
+		run := data[i:j]
+		if len(run) < minBase64Length || !looksLikeBase64(run) {
+			i = j - 1
+			continue
+		}
+		decoded, ok := decodeBase64(run)
+		if !ok {
+			i = j - 1
+			continue
+		}
+		nested := b.scan(decoded)
+		objects = append(objects, jsonObject{
+			startOffset: i,
+			endOffset:   j - 1,
+			data:        run,
+			decoded:     decoded,
+			kind:        objectBase64,
+			nested:      nested,
+		})
+		i = j - 1
+	}
+	return objects, resume
+}
+
+// base64Lines shows the encoded text in lines of bytesPerLine characters,
+// followed by a preview of the decoded bytes
+func (o jsonObject) base64Lines(bytesPerLine int) []string {
+	var lines []string
+	perLine := max(1, bytesPerLine)
+	for start := 0; start < len(o.data); start += perLine {
+		lines = append(lines, string(o.data[start:min(start+perLine, len(o.data))]))
+	}
+	return append(lines, o.decodedLines("base64", bytesPerLine)...)
+}
+
+// isText reports whether data is valid UTF-8 without control characters
+// other than whitespace
+func isText(data []byte) bool {
+	if !utf8.Valid(data) {
+		return false
+	}
+	for _, b := range data {
+		if b < 32 && b != '\t' && b != '\n' && b != '\r' || b == 127 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,90 @@
+package prettybuffers
+
+import (
+	"bytes"
+	"encoding/base64"
+	"testing"
+	"time"
+)
+
+func TestScanBase64Objects(t *testing.T) {
+	token := base64.StdEncoding.EncodeToString([]byte(`{"sub":"1234567890","name":"Alice"}`))
+	urlSafe := base64.RawURLEncoding.EncodeToString([]byte("\xfb\xff\xfe binary 2024 \xfb\xff"))
+	tests := []struct {
+		name   string
+		data   string
+		want   []string // runs found
+		nested bool     // whether the first run decodes to JSON
+		resume int      // -1 for len(data)
+	}{
+		{"padded JSON", "\x00" + token + "\x00", []string{token}, true, -1},
+		{"unpadded", "a=" + "SGVsbG8sIHdvcmxkISBIZWxsbyBhZ2Fpbg" + " ", []string{"SGVsbG8sIHdvcmxkISBIZWxsbyBhZ2Fpbg"}, false, -1},
+		{"URL-safe", " " + urlSafe + " ", []string{urlSafe}, false, -1},
+		{"two runs", token + " " + token + " ", []string{token, token}, true, -1},
+		{"mixed alphabets", " +/" + urlSafe + " ", nil, false, -1},
+		{"too short", " dGVzdDEyMw== ", nil, false, -1},
+		{"identifier", " thisIsAVeryLongIdentifierName ", nil, false, -1},
+		{"invalid length", " SGVsbG8sIHdvcmxkISBIZWxsbyBhZ2Fpb ", nil, false, -1},
+		{"truncated", "\x00" + token[:len(token)-4], []string{token[:len(token)-4]}, false, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := []byte(tt.data)
+			objects, resume := scanBase64Objects(data, 0, nil, newDecodeBudget())
+			var got []string
+			for _, o := range objects {
+				got = append(got, string(o.data))
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("found %q, want %q", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("run %d is %q, want %q", i, got[i], tt.want[i])
+				}
+			}
+			if len(objects) > 0 {
+				nested := len(objects[0].nested) == 1 && objects[0].nested[0].kind == objectJSON
+				if nested != tt.nested {
+					t.Errorf("decoded JSON found is %v, want %v", nested, tt.nested)
+				}
+			}
+			want := tt.resume
+			if want < 0 {
+				want = len(data)
+			}
+			if resume != want {
+				t.Errorf("resume is %d, want %d", resume, want)
+			}
+		})
+	}
+}
+
+// TestScanBase64ObjectsSkip makes sure that runs inside the objects to skip
+// are left alone and that runs next to them still end there
+func TestScanBase64ObjectsSkip(t *testing.T) {
+	run := "SGVsbG8sIHdvcmxkISBIZWxsbyBhZ2Fpbg"
+	data := []byte(`{"k":"` + run + `"} ` + run + " ")
+	skip := []jsonObject{{startOffset: 0, endOffset: len(run) + 7}}
+	objects, _ := scanBase64Objects(data, 0, skip, newDecodeBudget())
+	if len(objects) != 1 || objects[0].startOffset != len(run)+9 {
+		t.Fatalf("found %d runs, want the one after the skipped object", len(objects))
+	}
+}
+
+// TestScanBase64ObjectsLarge makes sure that long runs and many short ones
+// are scanned in linear time
+func TestScanBase64ObjectsLarge(t *testing.T) {
+	inputs := map[string][]byte{
+		"one run":    []byte(base64.StdEncoding.EncodeToString(bytes.Repeat([]byte("binary\x00\xff"), 1<<17))),
+		"short runs": bytes.Repeat([]byte("aB3dE6gH9jK2mN5pQ8sT1v "), 1<<15),
+		"words":      bytes.Repeat([]byte("identifierWithoutDigits "), 1<<15),
+	}
+	for name, data := range inputs {
+		start := time.Now()
+		scanBase64Objects(data, 0, nil, newDecodeBudget())
+		if elapsed := time.Since(start); elapsed > 5*time.Second {
+			t.Errorf("%s: scanning %d bytes took %v", name, len(data), elapsed)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package prettybuffers
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/key"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// bitView holds the state of the bit view, which shows the hex column as
+// the eight bits of each byte with a cursor on a single bit
+type bitView struct {
+	active bool
+	bit    int // of the cursor byte counted from the left, 0 for the most significant
+}
+
+// showsBits reports whether the bit view can be shown in a layout, which
+// needs a hex column and no JSON column
+func showsBits(l Layout) bool {
+	return len(l.Renderers) == 0 && containsColumn(l.Columns, ColumnHex) && !containsColumn(l.Columns, ColumnJSON)
+}
+
+// toggleBitView switches between bytes and bits in the hex column
+func (m *model) toggleBitView() {
+	if !m.bits.active && !showsBits(m.layout) {
+		m.status = "The bit view needs a layout with a hex column and no JSON column"
+		return
+	}
+	m.bits.active = !m.bits.active
+	if !m.fixedBytesPerRow {
+		m.autoBytesPerRow()
+	}
+	m.moveCursor(0)
+	if m.bits.active {
+		m.status = "Showing bits"
+	} else {
+		m.status = "Showing bytes"
+	}
+}
+
+// updateBits handles the keys that act on bits rather than bytes in the bit
+// view. It reports whether msg was one of them.
+func (m *model) updateBits(msg tea.KeyMsg) bool {
+	switch {
+	case key.Matches(msg, m.keys.Left):
+		m.moveBits(-m.takeCount())
+	case key.Matches(msg, m.keys.Right):
+		m.moveBits(m.takeCount())
+	case key.Matches(msg, m.keys.FlipBit):
+		m.count = 0
+		m.flipBit()
+	default:
+		return false
+	}
+	return true
+}
+
+// moveBits moves the bit cursor by delta bits, across bytes if needed
+func (m *model) moveBits(delta int) {
+	pos := max(0, min(m.cursor*8+m.bits.bit+delta, (m.size()-1)*8+7))
+	m.moveCursor(pos/8 - m.cursor)
+	m.bits.bit = pos % 8
+}
+
+// flipBit inverts the bit under the cursor
+func (m *model) flipBit() {
+	if !m.requireWritable("Editing") || !m.requireMemory("Editing") {
+		return
+	}
+	if m.cursor < 0 || m.cursor >= len(m.data) {
+		return
+	}
+	old := m.data[m.cursor]
+	m.setByte(m.cursor, old^m.bitMask())
+	m.status = fmt.Sprintf("Bit %d of 0x%08X flipped: 0x%02X is now 0x%02X", 7-m.bits.bit, m.cursor, old, m.data[m.cursor])
+}
+
+// bitMask returns the mask of the bit under the cursor within its byte
+func (m model) bitMask() byte {
+	return 0x80 >> m.bits.bit
+}
+
+// bitHelp describes the bit view for the footer
+func (m model) bitHelp() string {
+	value := 0
+	if b := m.window(m.cursor, 1); len(b) == 1 && b[0]&m.bitMask() != 0 {
+		value = 1
+	}
+	return fmt.Sprintf("-- BITS -- %s bit %d = %d. '%s' to flip, '%s' to show bytes.",
+		strings.TrimSpace(m.formatOffset(m.cursor)), 7-m.bits.bit, value, m.keys.FlipBit.Help().Key, m.keys.BitView.Help().Key)
+}
+
+// bitColumn shows the hex column in the bit view, with the cursor on one
+// bit of the cursor byte
+type bitColumn struct {
+	BinaryColumn
+}
+
+// Header implements ColumnRenderer
+func (bitColumn) Header() string { return "Bits" }
+
+func (bitColumn) renderStyled(m model, data []byte, offset int) string {
+	return binaryRadix.render(m.bytesPerRow, func(i int) string {
+		switch {
+		case i >= len(data):
+			return m.highlight(offset+i, strings.Repeat(" ", binaryRadix.digits), m.theme.Hex)
+		case offset+i != m.cursor:
+			return m.highlight(offset+i, fmt.Sprintf("%08b", data[i]), m.theme.Hex)
+		}
+		// The other bits of the cursor byte are underlined
+		var sb strings.Builder
+		for bit, digit := range fmt.Sprintf("%08b", data[i]) {
+			if bit == m.bits.bit {
+				sb.WriteString(m.theme.Cursor.Render(string(digit)))
+			} else {
+				sb.WriteString(m.theme.Hex.Underline(true).Render(string(digit)))
+			}
+		}
+		return sb.String()
+	})
+}
@@ -0,0 +1,90 @@
+//go:build pcap
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"time"
+
+	"github.com/fipso/prettybuffers"
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/pcap"
+)
+
+// Colors of the two directions of a conversation
+const (
+	forwardColor  prettybuffers.Color = "22"
+	backwardColor prettybuffers.Color = "53"
+)
+
+// runCapture captures packets live and streams their payloads into the
+// viewer, e.g. prettybuffers capture -i eth0 -f 'tcp port 8080'
+func runCapture(args []string) error {
+	flags := flag.NewFlagSet("capture", flag.ExitOnError)
+	iface := flags.String("i", "", "interface to capture on")
+	filter := flags.String("f", "", "BPF filter, e.g. 'tcp port 8080'")
+	snaplen := flags.Int("s", 65535, "bytes to capture of each packet")
+	promisc := flags.Bool("p", false, "put the interface into promiscuous mode")
+	_ = flags.Parse(args)
+	if *iface == "" {
+		return errors.New("usage: prettybuffers capture -i <interface> [-f <filter>] [-s <snaplen>] [-p]")
+	}
+
+	// Time out reads so that the handle can be closed once the viewer exits
+	handle, err := pcap.OpenLive(*iface, int32(*snaplen), *promisc, 250*time.Millisecond)
+	if err != nil {
+		return err
+	}
+	defer handle.Close()
+	if *filter != "" {
+		if err := handle.SetBPFFilter(*filter); err != nil {
+			return fmt.Errorf("filter %q: %w", *filter, err)
+		}
+	}
+
+	viewer, err := prettybuffers.StartTUI()
+	if err != nil {
+		return err
+	}
+	go streamPackets(viewer, gopacket.NewPacketSource(handle, handle.LinkType()))
+	return viewer.Wait()
+}
+
+// streamPackets appends the payload of each packet to the viewer as a chunk
+// labeled with its endpoints. Packets without a payload, such as bare TCP
+// acknowledgements, are skipped.
+func streamPackets(viewer *prettybuffers.Viewer, source *gopacket.PacketSource) {
+	for packet := range source.Packets() {
+		app := packet.ApplicationLayer()
+		if app == nil || len(app.Payload()) == 0 {
+			continue
+		}
+		label, color := packetLabel(packet)
+		viewer.AppendChunk(app.Payload(), fmt.Sprintf("%s, %d bytes", label, len(app.Payload())), color)
+	}
+}
+
+// packetLabel describes where a packet went, e.g. "TCP 10.0.0.1:8080 →
+// 10.0.0.2:51234", in a color telling the directions of a conversation apart
+func packetLabel(packet gopacket.Packet) (string, prettybuffers.Color) {
+	network := packet.NetworkLayer()
+	if network == nil {
+		return "packet", forwardColor
+	}
+	flow := network.NetworkFlow()
+	src, dst, protocol := flow.Src().String(), flow.Dst().String(), network.LayerType().String()
+	if transport := packet.TransportLayer(); transport != nil {
+		// Ports tell the directions apart even between addresses on one host
+		flow = transport.TransportFlow()
+		src += ":" + flow.Src().String()
+		dst += ":" + flow.Dst().String()
+		protocol = transport.LayerType().String()
+	}
+	color := forwardColor
+	if flow.Dst().LessThan(flow.Src()) {
+		color = backwardColor
+	}
+	return fmt.Sprintf("%s %s → %s", protocol, src, dst), color
+}
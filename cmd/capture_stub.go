@@ -0,0 +1,11 @@
+//go:build !pcap
+
+package main
+
+import "errors"
+
+// runCapture reports that live capture isn't built in, as it needs cgo and
+// libpcap
+func runCapture([]string) error {
+	return errors.New("capture: built without packet capture support, rebuild with -tags pcap (needs libpcap)")
+}
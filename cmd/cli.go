@@ -0,0 +1,310 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/fipso/prettybuffers"
+)
+
+// options are the flags shared by the subcommands, each using those that
+// apply to it
+type options struct {
+	file        string
+	offset      string
+	layout      string
+	bytesPerRow int
+	search      string
+	theme       string
+	readOnly    bool
+	base        string
+	lenientJSON bool
+	payloads    bool
+	maxBuffer   int
+}
+
+// newFlagSet returns the flags of a subcommand, parsed into o
+func newFlagSet(name string, o *options) *flag.FlagSet {
+	flags := flag.NewFlagSet(name, flag.ExitOnError)
+	flags.StringVar(&o.file, "file", "", "file to open, instead of the file argument")
+	flags.StringVar(&o.offset, "offset", "", "offset to move the cursor to, or to dump and analyze from, e.g. 0x100")
+	flags.StringVar(&o.layout, "layout", "", `layout by name, e.g. "Smart View"`)
+	flags.IntVar(&o.bytesPerRow, "bytes-per-row", 0, "bytes shown in each row, 0 to fit the terminal")
+	flags.StringVar(&o.search, "search", "", "text to search for; prefix with hex:, itext: or regex: for other searches")
+	flags.StringVar(&o.theme, "theme", "", "color theme by name, e.g. Light")
+	flags.BoolVar(&o.readOnly, "readonly", false, "disable editing and saving")
+	flags.StringVar(&o.base, "base", "", "address of the first byte, shown in the offset column, e.g. 0x08000000")
+	flags.BoolVar(&o.lenientJSON, "lenient-json", false, "also detect text that only looks like JSON, e.g. with trailing commas")
+	flags.BoolVar(&o.payloads, "payloads-only", false, "show only the detected objects in the Smart View, skipping the bytes between them")
+	flags.IntVar(&o.maxBuffer, "max-buffer-size", 0, "keep only the last this many bytes of streamed input, 0 to keep everything")
+	flags.Usage = func() {
+		fmt.Fprint(flags.Output(), usage)
+		flags.PrintDefaults()
+	}
+	return flags
+}
+
+// viewerOptions converts the flags to options of the viewer
+func (o options) viewerOptions() ([]prettybuffers.Option, error) {
+	opts := []prettybuffers.Option{prettybuffers.WithReadOnly(o.readOnly), prettybuffers.WithStrictJSON(!o.lenientJSON),
+		prettybuffers.WithPayloadsOnly(o.payloads)}
+	if o.layout != "" {
+		i, err := layoutIndex(o.layout)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, prettybuffers.WithInitialLayout(i))
+	}
+	if o.theme != "" {
+		theme, ok := themeByName(o.theme)
+		if !ok {
+			return nil, fmt.Errorf("unknown theme %q", o.theme)
+		}
+		opts = append(opts, prettybuffers.WithTheme(theme))
+	}
+	if o.bytesPerRow < 0 {
+		return nil, fmt.Errorf("invalid --bytes-per-row %d", o.bytesPerRow)
+	}
+	if o.bytesPerRow > 0 {
+		opts = append(opts, prettybuffers.WithBytesPerRow(o.bytesPerRow))
+	}
+	if o.maxBuffer < 0 {
+		return nil, fmt.Errorf("invalid --max-buffer-size %d", o.maxBuffer)
+	}
+	opts = append(opts, prettybuffers.WithMaxBufferSize(o.maxBuffer))
+	base, err := o.baseAddress()
+	if err != nil {
+		return nil, err
+	}
+	return append(opts, prettybuffers.WithBaseAddress(base)), nil
+}
+
+// baseAddress parses --base, 0 if not set
+func (o options) baseAddress() (uint64, error) {
+	if o.base == "" {
+		return 0, nil
+	}
+	base, err := strconv.ParseUint(o.base, 0, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid --base %q", o.base)
+	}
+	return base, nil
+}
+
+// layoutIndex finds a layout by name regardless of case
+func layoutIndex(name string) (int, error) {
+	for i, l := range prettybuffers.PredefinedLayouts {
+		if strings.EqualFold(l.Name, name) {
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown layout %q", name)
+}
+
+// themeByName finds a theme regardless of case
+func themeByName(name string) (prettybuffers.Theme, bool) {
+	for _, t := range prettybuffers.PredefinedThemes {
+		if strings.EqualFold(t.Name, name) {
+			return t, true
+		}
+	}
+	return prettybuffers.Theme{}, false
+}
+
+// searchCommand converts --search to a search command, e.g. "hex:FF00" to
+// "search hex FF00"
+func (o options) searchCommand() string {
+	for _, mode := range []string{"hex", "itext", "regex", "text"} {
+		if query, ok := strings.CutPrefix(o.search, mode+":"); ok {
+			return "search " + mode + " " + query
+		}
+	}
+	return "search text " + o.search
+}
+
+// apply moves to --offset and runs --search in a viewer showing the data.
+// The search starts from the offset.
+func (o options) apply(viewer *prettybuffers.Viewer) error {
+	if o.offset != "" {
+		if err := viewer.Exec("goto " + o.offset); err != nil {
+			return err
+		}
+	}
+	if o.search != "" {
+		return viewer.Exec(o.searchCommand())
+	}
+	return nil
+}
+
+// inputPath returns the file named by --file or the only argument, or ""
+func (o options) inputPath(args []string) (string, error) {
+	switch {
+	case len(args) > 1 || o.file != "" && len(args) > 0:
+		return "", errors.New("too many arguments, see prettybuffers help")
+	case o.file != "":
+		return o.file, nil
+	case len(args) == 1:
+		return args[0], nil
+	}
+	return "", nil
+}
+
+// readInput reads the file to dump or analyze, or piped stdin, from --offset
+func (o options) readInput(args []string) ([]byte, error) {
+	path, err := o.inputPath(args)
+	if err != nil {
+		return nil, err
+	}
+	var data []byte
+	switch {
+	case path != "":
+		data, err = os.ReadFile(path)
+	case stdinPiped():
+		data, err = io.ReadAll(os.Stdin)
+	default:
+		return nil, errors.New("no input: name a file or pipe data to stdin")
+	}
+	if err != nil {
+		return nil, err
+	}
+	if o.offset != "" {
+		off, err := strconv.ParseInt(o.offset, 0, 64)
+		if err != nil || off < 0 || off > int64(len(data)) {
+			return nil, fmt.Errorf("invalid --offset %q for %d bytes", o.offset, len(data))
+		}
+		data = data[off:]
+	}
+	return data, nil
+}
+
+// stdinPiped reports whether stdin is a pipe or file rather than a terminal
+func stdinPiped() bool {
+	info, err := os.Stdin.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice == 0
+}
+
+// runView shows a file, piped stdin or else demo data in the viewer
+func runView(o options, args []string) error {
+	path, err := o.inputPath(args)
+	if err != nil {
+		return err
+	}
+	opts, err := o.viewerOptions()
+	if err != nil {
+		return err
+	}
+	piped := path == "" && stdinPiped()
+	if piped {
+		opts = append(opts, prettybuffers.WithTitle("stdin"))
+	}
+
+	// Keys are read from the terminal even if stdin is a pipe
+	viewer, err := prettybuffers.StartTUI(opts...)
+	if err != nil {
+		return err
+	}
+
+	readErr := make(chan error, 1)
+	switch {
+	case path != "":
+		if err := viewer.OpenFile(path); err != nil {
+			_ = viewer.Close()
+			return err
+		}
+		readErr <- o.apply(viewer)
+	case piped:
+		// Stream stdin as it arrives rather than reading it all first. The
+		// offset and search apply once it has been read.
+		go func() {
+			if err := viewer.ShowReader(os.Stdin); err != nil {
+				readErr <- fmt.Errorf("reading stdin: %w", err)
+				return
+			}
+			readErr <- o.apply(viewer)
+		}()
+	default:
+		err := viewer.ShowBytes(generateSampleData(4096))
+		if err == nil {
+			err = o.apply(viewer)
+		}
+		readErr <- err
+	}
+
+	// Keep the program running until the user quits
+	if err := viewer.Wait(); err != nil {
+		return err
+	}
+	select {
+	case err := <-readErr:
+		return err
+	default:
+		// The viewer was closed before stdin ended
+		return nil
+	}
+}
+
+// runDiff compares two files, or two files against their common base
+func runDiff(o options, args []string) error {
+	if len(args) < 2 || len(args) > 3 {
+		return errors.New("usage: prettybuffers diff [flags] [<base>] <left> <right>")
+	}
+	buffers := make([][]byte, len(args))
+	for i, path := range args {
+		var err error
+		if buffers[i], err = os.ReadFile(path); err != nil {
+			return err
+		}
+	}
+	opts, err := o.viewerOptions()
+	if err != nil {
+		return err
+	}
+	viewer, err := prettybuffers.StartTUI(opts...)
+	if err != nil {
+		return err
+	}
+	if len(buffers) == 2 {
+		viewer.ShowDiff(buffers[0], buffers[1])
+	} else {
+		viewer.ShowDiff3(buffers[0], buffers[1], buffers[2])
+	}
+	return viewer.Wait()
+}
+
+// runDump prints the data in the layout chosen, the Hex View by default.
+// Offsets in the dump count from --offset.
+func runDump(o options, args []string) error {
+	data, err := o.readInput(args)
+	if err != nil {
+		return err
+	}
+	layout := 0
+	if o.layout != "" {
+		if layout, err = layoutIndex(o.layout); err != nil {
+			return err
+		}
+	}
+	base, err := o.baseAddress()
+	if err != nil {
+		return err
+	}
+	fmt.Print(prettybuffers.DumpLayout(data, prettybuffers.PredefinedLayouts[layout],
+		prettybuffers.WithBytesPerRow(o.bytesPerRow), prettybuffers.WithBaseAddress(base),
+		prettybuffers.WithStrictJSON(!o.lenientJSON), prettybuffers.WithPayloadsOnly(o.payloads)))
+	return nil
+}
+
+// runAnalyze prints what the viewer detects in the data
+func runAnalyze(o options, args []string) error {
+	data, err := o.readInput(args)
+	if err != nil {
+		return err
+	}
+	fmt.Print(prettybuffers.Analyze(data))
+	return nil
+}
@@ -3,24 +3,72 @@ package main
 import (
 	"fmt"
 	"math/rand"
+	"os"
 	"time"
-
-	"github.com/fipso/prettybuffers"
 )
 
-func main() {
-	// Start the TUI
-	prettybuffers.StartTUI()
+// usage describes the subcommands and flags
+const usage = `Usage:
+  prettybuffers [view] [flags] [file]          view a file, piped stdin or demo data
+  prettybuffers diff [flags] <left> <right>    compare two files byte by byte
+  prettybuffers diff [flags] <base> <left> <right>
+  prettybuffers dump [flags] [file]            print a hex dump of a file or stdin
+  prettybuffers analyze [flags] [file]         print what is detected in a file or stdin
+  prettybuffers capture -i <interface> [-f <filter>]
+  prettybuffers serve [flags] [file]           serve a file or stdin to SSH sessions
+  prettybuffers receive [-listen :7777]        view the buffers pushed by senders
+  prettybuffers send [-to host:7777] [file]    push a file or stdin to a receiver
+
+Flags:
+`
 
-	// Generate some sample data with various byte values
-	data := generateSampleData(4096)
+func main() {
+	if err := run(os.Args[1:]); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
 
-	// Display the data
-	prettybuffers.ShowBytes(data)
+// run dispatches to the subcommand named by the first argument, viewing by
+// default
+func run(args []string) error {
+	name := "view"
+	if len(args) > 0 {
+		switch args[0] {
+		case "view", "diff", "dump", "analyze", "capture", "serve", "receive", "send":
+			name, args = args[0], args[1:]
+		case "help", "-h", "-help", "--help":
+			flags := newFlagSet("help", &options{})
+			flags.SetOutput(os.Stdout)
+			flags.Usage()
+			return nil
+		}
+	}
+	switch name {
+	case "capture":
+		return runCapture(args)
+	case "serve":
+		return runServe(args)
+	case "receive":
+		return runReceive(args)
+	case "send":
+		return runSend(args)
+	}
 
-	// Keep the program running
-	fmt.Println("Press Ctrl+C to exit")
-	select {}
+	var o options
+	flags := newFlagSet(name, &o)
+	// Exits on errors and for -h
+	_ = flags.Parse(args)
+	args = flags.Args()
+	switch name {
+	case "diff":
+		return runDiff(o, args)
+	case "dump":
+		return runDump(o, args)
+	case "analyze":
+		return runAnalyze(o, args)
+	}
+	return runView(o, args)
 }
 
 // generateSampleData creates a byte slice with various patterns for demonstration
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/fipso/prettybuffers"
+)
+
+// defaultRemoteAddress is where receive listens and send connects by default
+const defaultRemoteAddress = "localhost:7777"
+
+// defaultReceiveBuffer is how many bytes receive keeps by default, so that
+// senders pushing for long can't exhaust its memory
+const defaultReceiveBuffer = 64 << 20
+
+// remoteAddress splits an address into its network and address, a unix
+// socket for "unix:/path" and TCP otherwise
+func remoteAddress(addr string) (network, address string) {
+	if path, ok := strings.CutPrefix(addr, "unix:"); ok {
+		return "unix", path
+	}
+	return "tcp", addr
+}
+
+// runReceive shows the buffers pushed by senders as they arrive, e.g.
+// prettybuffers receive -listen :7777
+func runReceive(args []string) error {
+	var o options
+	flags := flag.NewFlagSet("receive", flag.ExitOnError)
+	listen := flags.String("listen", defaultRemoteAddress, "address to listen on, or unix:<path> for a unix socket")
+	flags.StringVar(&o.layout, "layout", "", `layout by name, e.g. "Smart View"`)
+	flags.StringVar(&o.theme, "theme", "", "color theme by name, e.g. Light")
+	flags.IntVar(&o.maxBuffer, "max-buffer-size", defaultReceiveBuffer, "keep only the last this many bytes received, 0 to keep everything")
+	_ = flags.Parse(args)
+	if flags.NArg() > 0 {
+		return errors.New("usage: prettybuffers receive [-listen <addr>|unix:<path>] [-max-buffer-size <bytes>]")
+	}
+	opts, err := o.viewerOptions()
+	if err != nil {
+		return err
+	}
+
+	l, err := net.Listen(remoteAddress(*listen))
+	if err != nil {
+		return err
+	}
+	viewer, err := prettybuffers.StartTUI(append(opts, prettybuffers.WithTitle("receiving on "+*listen))...)
+	if err != nil {
+		l.Close()
+		return err
+	}
+	receiveErr := make(chan error, 1)
+	go func() {
+		receiveErr <- viewer.Receive(l)
+	}()
+	if err := viewer.Wait(); err != nil {
+		return err
+	}
+	return <-receiveErr
+}
+
+// runSend pushes a file, or stdin as it is read, to a receiver, e.g.
+// tail -f app.log | prettybuffers send -to host:7777
+func runSend(args []string) error {
+	flags := flag.NewFlagSet("send", flag.ExitOnError)
+	to := flags.String("to", defaultRemoteAddress, "address of the receiver, or unix:<path> for a unix socket")
+	label := flags.String("label", "", "label of the buffers sent (default the file name or stdin)")
+	_ = flags.Parse(args)
+	if flags.NArg() > 1 {
+		return errors.New("usage: prettybuffers send [-to <addr>|unix:<path>] [-label <label>] [file]")
+	}
+
+	var data []byte
+	if flags.NArg() == 1 {
+		var err error
+		if data, err = os.ReadFile(flags.Arg(0)); err != nil {
+			return err
+		}
+		if *label == "" {
+			*label = filepath.Base(flags.Arg(0))
+		}
+	} else if !stdinPiped() {
+		return errors.New("no input: name a file or pipe data to stdin")
+	} else if *label == "" {
+		*label = "stdin"
+	}
+
+	sender, err := prettybuffers.DialSender(remoteAddress(*to))
+	if err != nil {
+		return err
+	}
+	defer sender.Close()
+	if data != nil {
+		return sender.Send(*label, data)
+	}
+	// Each read is sent as it arrives so that live output shows up live
+	chunk := make([]byte, 32*1024)
+	for {
+		n, err := os.Stdin.Read(chunk)
+		if n > 0 {
+			if err := sender.Send(*label, chunk[:n]); err != nil {
+				return err
+			}
+		}
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("reading stdin: %w", err)
+		}
+	}
+}
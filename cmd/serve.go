@@ -0,0 +1,93 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/signal"
+
+	"github.com/fipso/prettybuffers/sshserve"
+)
+
+// runServe serves a file, piped stdin or demo data over SSH until
+// interrupted, e.g. prettybuffers serve -addr localhost:2222 capture.bin
+func runServe(args []string) error {
+	var o options
+	flags := flag.NewFlagSet("serve", flag.ExitOnError)
+	addr := flags.String("addr", "localhost:2222", "address to listen on")
+	hostKey := flags.String("host-key", "", "host key file, generated if missing (default prettybuffers_ed25519)")
+	authorizedKeys := flags.String("authorized-keys", "", "only let in the keys listed in this authorized_keys file")
+	insecure := flags.Bool("insecure", false, "serve an address other hosts can reach without -authorized-keys")
+	flags.StringVar(&o.layout, "layout", "", `layout by name, e.g. "Smart View"`)
+	flags.StringVar(&o.theme, "theme", "", "color theme by name, e.g. Light")
+	_ = flags.Parse(args)
+	if flags.NArg() > 1 {
+		return errors.New("usage: prettybuffers serve [-addr <addr>] [-host-key <path>] [-authorized-keys <path>] [-insecure] [file]")
+	}
+	if *authorizedKeys == "" && !*insecure && !isLoopback(*addr) {
+		return fmt.Errorf("anyone who can reach %s could connect; pass -authorized-keys, or -insecure to serve it anyway", *addr)
+	}
+	viewerOpts, err := o.viewerOptions()
+	if err != nil {
+		return err
+	}
+
+	opts := []sshserve.Option{sshserve.WithViewerOptions(viewerOpts...)}
+	if *hostKey != "" {
+		opts = append(opts, sshserve.WithHostKeyPath(*hostKey))
+	}
+	if *authorizedKeys != "" {
+		opts = append(opts, sshserve.WithAuthorizedKeys(*authorizedKeys))
+	}
+	server, err := sshserve.Serve(*addr, opts...)
+	if err != nil {
+		return err
+	}
+	defer server.Close()
+	fmt.Fprintf(os.Stderr, "Serving on %s, connect with ssh -p <port> <host>\n", server.Addr())
+
+	readErr := make(chan error, 1)
+	switch {
+	case flags.NArg() == 1:
+		data, err := os.ReadFile(flags.Arg(0))
+		if err != nil {
+			return err
+		}
+		server.ShowBytes(data)
+	case stdinPiped():
+		// Sessions see stdin as it arrives
+		go func() {
+			if _, err := io.Copy(server.Writer(), os.Stdin); err != nil {
+				readErr <- fmt.Errorf("reading stdin: %w", err)
+			}
+		}()
+	default:
+		server.ShowBytes(generateSampleData(4096))
+	}
+
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	select {
+	case <-interrupt:
+		return nil
+	case err := <-readErr:
+		return err
+	}
+}
+
+// isLoopback reports whether addr only listens on the loopback interface,
+// out of reach of other hosts
+func isLoopback(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
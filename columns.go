@@ -0,0 +1,310 @@
+package prettybuffers
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+
+	"github.com/charmbracelet/lipgloss"
+)
+
+// ColumnRenderer renders one column of the row-based views. Implement it to
+// add columns such as checksums or protocol fields to a Layout.
+type ColumnRenderer interface {
+	// Header returns the column heading
+	Header() string
+	// Width returns how many cells the column takes for rows of bytesPerRow bytes
+	Width(bytesPerRow int) int
+	// RenderRow renders the bytes of one row, which start at offset in the
+	// buffer. The last row may hold fewer than bytesPerRow bytes.
+	RenderRow(data []byte, offset int) string
+}
+
+// styledColumn is implemented by the built-in columns, which render with the
+// viewer's theme and highlights instead of plain text
+type styledColumn interface {
+	renderStyled(m model, data []byte, offset int) string
+}
+
+// OffsetColumn shows the offset of each row, e.g. 0x00000010 or 16
+type OffsetColumn struct {
+	// Decimal shows offsets in decimal instead of hexadecimal
+	Decimal bool
+	// Digits is the number of digits offsets are padded to, 8 for
+	// hexadecimal and 10 for decimal if 0
+	Digits int
+	// Base is added to every offset, such as the load address of a
+	// firmware image, see WithBaseAddress
+	Base uint64
+}
+
+// Header implements ColumnRenderer
+func (OffsetColumn) Header() string { return "Offset" }
+
+// Width implements ColumnRenderer
+func (c OffsetColumn) Width(int) int {
+	if c.Decimal {
+		// No narrower than the heading
+		return max(c.digits(), len(c.Header()))
+	}
+	return len("0x") + c.digits()
+}
+
+// RenderRow implements ColumnRenderer
+func (c OffsetColumn) RenderRow(_ []byte, offset int) string {
+	addr := c.Base + uint64(offset)
+	if c.Decimal {
+		return fmt.Sprintf("%*d", c.Width(0), addr)
+	}
+	return fmt.Sprintf("0x%0*X", c.digits(), addr)
+}
+
+// digits returns the number of digits offsets are padded to
+func (c OffsetColumn) digits() int {
+	switch {
+	case c.Digits > 0:
+		return c.Digits
+	case c.Decimal:
+		return 10
+	}
+	return 8
+}
+
+func (c OffsetColumn) renderStyled(m model, data []byte, offset int) string {
+	return m.theme.Offset.Render(c.RenderRow(data, offset))
+}
+
+// HexColumn shows each byte as two hexadecimal digits, or groups of bytes
+// as words, e.g. 01234567 89ABCDEF for 32-bit words
+type HexColumn struct {
+	// GroupSize is the number of bytes shown together as a word, 2, 4 or 8;
+	// 0 or 1 shows every byte on its own
+	GroupSize int
+	// Order is the byte order of the words, big-endian if nil. The bytes of
+	// little-endian words are shown reversed, so that words read as numbers.
+	Order binary.ByteOrder
+}
+
+// Header implements ColumnRenderer
+func (HexColumn) Header() string { return "Hexadecimal" }
+
+// Width implements ColumnRenderer
+func (c HexColumn) Width(bytesPerRow int) int {
+	slots := c.slots(bytesPerRow)
+	return slots*2 + slots/c.groupSize() - 1
+}
+
+// RenderRow implements ColumnRenderer
+func (c HexColumn) RenderRow(data []byte, _ int) string {
+	if c.groupSize() == 1 {
+		return formatHexBytes(data, len(data))
+	}
+	return strings.TrimRight(c.render(c.slots(len(data)), func(i int) string {
+		if i < len(data) {
+			return fmt.Sprintf("%02X", data[i])
+		}
+		return "  "
+	}), " ")
+}
+
+func (c HexColumn) renderStyled(m model, data []byte, offset int) string {
+	return c.render(c.slots(m.bytesPerRow), func(i int) string {
+		switch {
+		case i < len(data):
+			return m.highlight(offset+i, fmt.Sprintf("%02X", data[i]), m.theme.Hex)
+		case i < m.bytesPerRow:
+			// Padding is highlighted when the cursor sits past the end in insert mode
+			return m.highlight(offset+i, "  ", m.theme.Hex)
+		}
+		// Fills the last word of rows that are no multiple of the group size
+		return "  "
+	})
+}
+
+// groupSize returns the number of bytes in each word, 1 for single bytes
+func (c HexColumn) groupSize() int {
+	return max(c.GroupSize, 1)
+}
+
+// slots returns the number of bytes n takes up when rounded up to whole words
+func (c HexColumn) slots(n int) int {
+	g := c.groupSize()
+	return (n + g - 1) / g * g
+}
+
+// render joins the cells of slots bytes, a whole number of words, with a
+// space between words and the bytes of little-endian words reversed
+func (c HexColumn) render(slots int, cell func(i int) string) string {
+	g := c.groupSize()
+	var sb strings.Builder
+	for start := 0; start < slots; start += g {
+		if start > 0 {
+			sb.WriteRune(' ')
+		}
+		for j := 0; j < g; j++ {
+			if c.Order == binary.LittleEndian {
+				sb.WriteString(cell(start + g - 1 - j))
+			} else {
+				sb.WriteString(cell(start + j))
+			}
+		}
+	}
+	return sb.String()
+}
+
+// ASCIIColumn shows printable bytes as characters and others as '.'
+type ASCIIColumn struct{}
+
+// Header implements ColumnRenderer
+func (ASCIIColumn) Header() string { return "ASCII" }
+
+// Width implements ColumnRenderer
+func (ASCIIColumn) Width(bytesPerRow int) int { return bytesPerRow }
+
+// RenderRow implements ColumnRenderer
+func (ASCIIColumn) RenderRow(data []byte, _ int) string {
+	return formatASCIIBytes(data)
+}
+
+func (ASCIIColumn) renderStyled(m model, data []byte, offset int) string {
+	var sb strings.Builder
+	for col := 0; col < m.bytesPerRow; col++ {
+		if col < len(data) {
+			sb.WriteString(m.highlight(offset+col, formatASCIIBytes(data[col:col+1]), m.theme.ASCII))
+		} else {
+			sb.WriteString(m.highlight(offset+col, " ", m.theme.ASCII))
+		}
+	}
+	return sb.String()
+}
+
+// JSONColumn shows the row as text. Layouts listing ColumnJSON in Columns
+// are rendered by the Smart View, which prettifies whole JSON objects instead.
+type JSONColumn struct{}
+
+// Header implements ColumnRenderer
+func (JSONColumn) Header() string { return "Content" }
+
+// Width implements ColumnRenderer
+func (JSONColumn) Width(bytesPerRow int) int { return bytesPerRow }
+
+// RenderRow implements ColumnRenderer
+func (JSONColumn) RenderRow(data []byte, _ int) string {
+	return sanitizeString(string(data))
+}
+
+func (c JSONColumn) renderStyled(m model, data []byte, offset int) string {
+	return m.highlightText(c.RenderRow(data, offset), m.theme.JSON)
+}
+
+// renderer returns the built-in ColumnRenderer for a column type
+func (c ColumnType) renderer() ColumnRenderer {
+	switch c {
+	case ColumnOffset:
+		return OffsetColumn{}
+	case ColumnHex:
+		return HexColumn{}
+	case ColumnASCII:
+		return ASCIIColumn{}
+	case ColumnEntropy:
+		return EntropyColumn{}
+	case ColumnText:
+		return TextColumn{}
+	case ColumnVarint:
+		return VarintColumn{}
+	case ColumnBinary:
+		return BinaryColumn{}
+	case ColumnOctal:
+		return OctalColumn{}
+	case ColumnDecimal:
+		return DecimalColumn{}
+	case ColumnTime:
+		return TimeColumn{}
+	default:
+		return JSONColumn{}
+	}
+}
+
+// renderers returns the columns of the layout, built from Columns unless
+// Renderers is set
+func (l Layout) renderers() []ColumnRenderer {
+	if len(l.Renderers) > 0 {
+		return l.Renderers
+	}
+	renderers := make([]ColumnRenderer, len(l.Columns))
+	for i, c := range l.Columns {
+		renderers[i] = c.renderer()
+	}
+	return renderers
+}
+
+// groupSizes are the word sizes that the GroupBytes key cycles through
+var groupSizes = []int{1, 2, 4, 8}
+
+// setGrouping shows the hex column in words of size bytes and tells so
+func (m *model) setGrouping(size int) {
+	m.groupSize = size
+	if size <= 1 {
+		m.status = "Showing single bytes"
+		return
+	}
+	m.status = fmt.Sprintf("Grouping bytes into %d-bit %s words", size*8, byteOrderName(m.byteOrder))
+}
+
+// cycleGrouping switches to the next larger word size, and back to single
+// bytes after 64-bit words
+func (m *model) cycleGrouping() {
+	next := 1
+	for _, size := range groupSizes {
+		if size > max(m.groupSize, 1) {
+			next = size
+			break
+		}
+	}
+	m.setGrouping(next)
+}
+
+// renderers returns the columns of a layout as shown in the viewer, with the
+// hex column grouped into words if set, see WithByteGrouping, or shown as
+// bits in the bit view, and offsets formatted as set, see WithDecimalOffsets.
+// The times of streamed chunks are added at the end while shown.
+func (m model) renderers(l Layout) []ColumnRenderer {
+	columns := l.renderers()
+	if len(l.Renderers) > 0 {
+		// Columns chosen by the caller are shown as they are
+		return columns
+	}
+	for i, c := range columns {
+		if _, ok := c.(OffsetColumn); ok {
+			columns[i] = m.offsetColumn()
+		}
+		if _, ok := c.(HexColumn); ok {
+			if m.bits.active {
+				columns[i] = bitColumn{}
+			} else {
+				columns[i] = HexColumn{GroupSize: m.groupSize, Order: m.byteOrder}
+			}
+		}
+		if _, ok := c.(TimeColumn); ok {
+			columns[i] = m.timeColumn()
+		}
+	}
+	if m.times != timesHidden && !containsColumn(l.Columns, ColumnTime) {
+		columns = append(columns, m.timeColumn())
+	}
+	return columns
+}
+
+// renderCell renders one column of a row, padded to the column width unless it is the last column
+func (m model) renderCell(c ColumnRenderer, data []byte, offset int, last bool) string {
+	var cell string
+	if s, ok := c.(styledColumn); ok {
+		cell = s.renderStyled(m, data, offset)
+	} else {
+		cell = c.RenderRow(data, offset)
+	}
+	if pad := c.Width(m.bytesPerRow) - lipgloss.Width(cell); pad > 0 && !last {
+		cell += strings.Repeat(" ", pad)
+	}
+	return cell
+}
@@ -0,0 +1,425 @@
+package prettybuffers
+
+import (
+	"encoding/binary"
+	"fmt"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// command is an ex-style command run from the ':' prompt or through Exec
+type command struct {
+	names []string // the first name is shown in completions
+	usage string
+	// complete returns the candidates for the arguments typed so far, may be nil
+	complete func(m *model, args string) []string
+	run      func(m *model, args string) (tea.Cmd, error)
+	files    bool // reads or writes files, which sessions served over SSH may not
+}
+
+// commands lists the available commands. It is filled in init because the
+// help command refers to it.
+var commands []command
+
+func init() {
+	commands = []command{
+		{names: []string{"goto", "go"}, usage: "goto <offset|+n|-n>", run: cmdGoto},
+		{names: []string{"search"}, usage: "search <hex|text|itext|regex> <query>",
+			complete: completeWords("hex", "text", "itext", "regex"), run: cmdSearch},
+		{names: []string{"set"}, usage: "set bytesperrow <n|auto> | set group <1|2|4|8> | set endian <little|big> | set offsets <hex|decimal|compact|full>",
+			complete: completeWords("bytesperrow", "group", "endian", "offsets"), run: cmdSet},
+		{names: []string{"theme"}, usage: "theme <name>", complete: completeThemes, run: cmdTheme},
+		{names: []string{"layout"}, usage: "layout <name>", complete: completeLayouts, run: cmdLayout},
+		{names: []string{"export"}, usage: "export <format> <path>", complete: completeExportFormats, run: cmdExport, files: true},
+		{names: []string{"import"}, usage: "import <hex|base64|xxd> <path>", complete: completeImportFormats, run: cmdImport, files: true},
+		{names: []string{"extract"}, usage: "extract <dir>", run: cmdExtract, files: true},
+		{names: []string{"hash"}, usage: "hash", run: func(m *model, _ string) (tea.Cmd, error) {
+			return nil, m.hashSelection()
+		}},
+		{names: []string{"query", "jq"}, usage: "query <jsonpath>", run: func(m *model, args string) (tea.Cmd, error) {
+			m.startQuery(args)
+			return nil, nil
+		}},
+		{names: []string{"varint"}, usage: "varint", run: func(m *model, _ string) (tea.Cmd, error) {
+			return nil, m.decodeVarintAtCursor()
+		}},
+		{names: []string{"entry"}, usage: "entry [name|n]", complete: completeEntries, run: cmdEntry},
+		{names: []string{"mark"}, usage: `mark <offset>:<length> "label" [type]; ... | mark clear`, run: cmdMark},
+		{names: []string{"template"}, usage: "template <path> [offset] | template clear", run: cmdTemplate, files: true},
+		{names: []string{"websocket", "ws"}, usage: "websocket [offset]", run: cmdWebSocket},
+		{names: []string{"stream"}, usage: "stream [name|n]", complete: completeStreams, run: cmdStream},
+		{names: []string{"open", "e"}, usage: "open <path>", run: cmdOpen, files: true},
+		{names: []string{"write", "w", "save"}, usage: "write [path]", run: cmdWrite, files: true},
+		{names: []string{"quit", "q"}, usage: "quit", run: func(m *model, _ string) (tea.Cmd, error) {
+			return m.quit(), nil
+		}},
+		{names: []string{"help"}, usage: "help", run: cmdHelp},
+	}
+}
+
+// findCommand returns the command called name
+func findCommand(name string) (command, bool) {
+	for _, c := range commands {
+		for _, n := range c.names {
+			if n == name {
+				return c, true
+			}
+		}
+	}
+	return command{}, false
+}
+
+// runCommand executes a command line such as "goto 0x100"
+func (m *model) runCommand(line string) (tea.Cmd, error) {
+	name, args, _ := strings.Cut(strings.TrimSpace(line), " ")
+	if name == "" {
+		return nil, nil
+	}
+	c, ok := findCommand(name)
+	if !ok {
+		return nil, fmt.Errorf("unknown command: %s", name)
+	}
+	if c.files && m.remote {
+		return nil, fmt.Errorf("%s is not available in remote sessions", c.names[0])
+	}
+	return c.run(m, strings.TrimSpace(args))
+}
+
+// completeCommand extends the command line typed so far as far as it is
+// unambiguous, and returns the candidates when there are several
+func (m *model) completeCommand(line string) (string, []string) {
+	name, args, hasArgs := strings.Cut(line, " ")
+	var candidates []string
+	prefix := ""
+	if !hasArgs {
+		for _, c := range commands {
+			if strings.HasPrefix(c.names[0], name) {
+				candidates = append(candidates, c.names[0])
+			}
+		}
+	} else if c, ok := findCommand(name); ok && c.complete != nil {
+		prefix = name + " "
+		candidates = c.complete(m, strings.TrimLeft(args, " "))
+	}
+
+	switch len(candidates) {
+	case 0:
+		return line, nil
+	case 1:
+		return prefix + candidates[0] + " ", nil
+	}
+	common := candidates[0]
+	for _, c := range candidates[1:] {
+		for !strings.HasPrefix(strings.ToLower(c), strings.ToLower(common)) {
+			common = common[:len(common)-1]
+		}
+	}
+	if len(prefix+common) < len(line) {
+		return line, candidates
+	}
+	return prefix + common, candidates
+}
+
+// completeWords returns a completer offering the given words
+func completeWords(words ...string) func(*model, string) []string {
+	return func(_ *model, args string) []string {
+		return matchingPrefix(words, args)
+	}
+}
+
+// matchingPrefix returns the words starting with prefix, ignoring case
+func matchingPrefix(words []string, prefix string) []string {
+	var matches []string
+	for _, w := range words {
+		if strings.HasPrefix(strings.ToLower(w), strings.ToLower(prefix)) {
+			matches = append(matches, w)
+		}
+	}
+	return matches
+}
+
+// completeThemes offers the names of the predefined themes
+func completeThemes(_ *model, args string) []string {
+	names := make([]string, len(PredefinedThemes))
+	for i, t := range PredefinedThemes {
+		names[i] = t.Name
+	}
+	return matchingPrefix(names, args)
+}
+
+// completeLayouts offers the names of the registered layouts
+func completeLayouts(_ *model, args string) []string {
+	var names []string
+	for i := 0; i < layoutCount(); i++ {
+		l, _ := layoutAt(i)
+		names = append(names, l.Name)
+	}
+	return matchingPrefix(names, args)
+}
+
+// completeImportFormats offers the formats that can be imported for the
+// first argument
+func completeImportFormats(_ *model, args string) []string {
+	if strings.Contains(args, " ") {
+		return nil
+	}
+	var names []string
+	for _, f := range exportFormats {
+		if f.decode != nil {
+			names = append(names, f.name)
+		}
+	}
+	return matchingPrefix(names, args)
+}
+
+// completeExportFormats offers the export formats for the first argument
+func completeExportFormats(_ *model, args string) []string {
+	if strings.Contains(args, " ") {
+		return nil
+	}
+	names := make([]string, len(exportFormats))
+	for i, f := range exportFormats {
+		names[i] = f.name
+	}
+	return matchingPrefix(names, args)
+}
+
+// parseOffset parses an offset in decimal, or in hex, octal or binary with
+// a 0x, 0o or 0b prefix
+func parseOffset(s string) (int, error) {
+	n, err := strconv.ParseInt(s, 0, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid offset %q", s)
+	}
+	return int(n), nil
+}
+
+// cmdGoto moves the cursor to an absolute offset, as shown in the offset
+// column and so relative to the base address, or relative to the cursor when
+// the offset starts with + or -
+func cmdGoto(m *model, args string) (tea.Cmd, error) {
+	if args == "" {
+		return nil, fmt.Errorf("usage: goto <offset|+n|-n>")
+	}
+	if args[0] != '+' && args[0] != '-' {
+		off, err := m.parseAddress(args)
+		if err != nil {
+			return nil, err
+		}
+		m.moveCursor(off - m.cursor)
+		return nil, nil
+	}
+	off, err := parseOffset(args)
+	if err != nil {
+		return nil, err
+	}
+	off += m.cursor
+	if off < 0 || off >= m.size() {
+		return nil, fmt.Errorf("offset %d is outside the buffer", off)
+	}
+	m.moveCursor(off - m.cursor)
+	return nil, nil
+}
+
+// cmdSearch runs a search like the '/', 's' and 'r' prompts
+func cmdSearch(m *model, args string) (tea.Cmd, error) {
+	mode, query, _ := strings.Cut(args, " ")
+	switch mode {
+	case "hex":
+		m.startSearch(searchHex, query, false)
+	case "text", "itext":
+		m.startSearch(searchText, query, mode == "itext")
+	case "regex":
+		m.startSearch(searchRegex, query, false)
+	default:
+		return nil, fmt.Errorf("usage: search <hex|text|itext|regex> <query>")
+	}
+	return nil, nil
+}
+
+// cmdSet changes a setting
+func cmdSet(m *model, args string) (tea.Cmd, error) {
+	option, value, _ := strings.Cut(args, " ")
+	value = strings.TrimSpace(value)
+	switch option {
+	case "bytesperrow":
+		if value == "auto" || value == "0" {
+			m.fixedBytesPerRow = false
+			m.autoBytesPerRow()
+			return nil, nil
+		}
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("invalid number of bytes per row %q", value)
+		}
+		m.bytesPerRow = n
+		m.fixedBytesPerRow = true
+		return nil, nil
+	case "group":
+		n, err := strconv.Atoi(value)
+		if err != nil || !slices.Contains(groupSizes, n) {
+			return nil, fmt.Errorf("invalid group size %q, expected 1, 2, 4 or 8", value)
+		}
+		m.setGrouping(n)
+		return nil, nil
+	case "endian":
+		switch value {
+		case "little", "le":
+			m.setByteOrder(binary.LittleEndian)
+		case "big", "be":
+			m.setByteOrder(binary.BigEndian)
+		default:
+			return nil, fmt.Errorf("invalid byte order %q, expected little or big", value)
+		}
+		return nil, nil
+	case "offsets":
+		switch value {
+		case "hex":
+			m.decimalOffsets = false
+		case "decimal", "dec":
+			m.decimalOffsets = true
+		case "compact":
+			m.compactOffsets = true
+		case "full":
+			m.compactOffsets = false
+		default:
+			return nil, fmt.Errorf("invalid offset format %q, expected hex, decimal, compact or full", value)
+		}
+		if !m.fixedBytesPerRow {
+			m.autoBytesPerRow()
+		}
+		return nil, nil
+	}
+	return nil, fmt.Errorf("usage: set bytesperrow <n|auto> | set group <1|2|4|8> | set endian <little|big> | set offsets <hex|decimal|compact|full>")
+}
+
+// cmdTheme switches to a predefined theme by name
+func cmdTheme(m *model, args string) (tea.Cmd, error) {
+	for _, t := range PredefinedThemes {
+		if strings.EqualFold(t.Name, args) {
+			m.setTheme(t)
+			return nil, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown theme %q", args)
+}
+
+// cmdLayout switches to a registered layout by name
+func cmdLayout(m *model, args string) (tea.Cmd, error) {
+	for i := 0; i < layoutCount(); i++ {
+		if l, _ := layoutAt(i); strings.EqualFold(l.Name, args) {
+			m.setLayout(i, l)
+			return nil, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown layout %q", args)
+}
+
+// cmdExport writes the selection, or the whole buffer, to a file
+func cmdExport(m *model, args string) (tea.Cmd, error) {
+	format, path, _ := strings.Cut(args, " ")
+	path = strings.TrimSpace(path)
+	if path == "" {
+		return nil, fmt.Errorf("usage: export <format> <path>")
+	}
+	n, err := m.export(format, path)
+	if err != nil {
+		return nil, err
+	}
+	m.status = fmt.Sprintf("Exported %d bytes as %s to %s", n, format, path)
+	return nil, nil
+}
+
+// cmdExtract writes the detected objects to files in a directory
+func cmdExtract(m *model, args string) (tea.Cmd, error) {
+	dir := strings.TrimSpace(args)
+	if dir == "" {
+		return nil, fmt.Errorf("usage: extract <dir>")
+	}
+	n, err := m.extractObjects(dir)
+	if err != nil {
+		return nil, err
+	}
+	m.status = fmt.Sprintf("Extracted %d objects to %s", n, dir)
+	return nil, nil
+}
+
+// cmdImport loads the bytes of a dump such as xxd output
+func cmdImport(m *model, args string) (tea.Cmd, error) {
+	format, path, _ := strings.Cut(args, " ")
+	path = strings.TrimSpace(path)
+	if path == "" {
+		return nil, fmt.Errorf("usage: import <format> <path>")
+	}
+	n, err := m.importFile(format, path)
+	if err != nil {
+		return nil, err
+	}
+	m.status = fmt.Sprintf("Imported %d bytes from %s dump %s", n, format, path)
+	return nil, nil
+}
+
+// cmdOpen loads a file
+func cmdOpen(m *model, args string) (tea.Cmd, error) {
+	if args == "" {
+		return m.startPicker(), nil
+	}
+	return func() tea.Msg { return loadFile(args) }, nil
+}
+
+// cmdWrite saves the buffer, to the given path if there is one
+func cmdWrite(m *model, args string) (tea.Cmd, error) {
+	if m.readOnly {
+		return nil, fmt.Errorf("saving is disabled in read-only mode")
+	}
+	path := m.path
+	if args != "" {
+		path = args
+	}
+	err := m.save(path)
+	m.reportSave(err)
+	return nil, err
+}
+
+// cmdHelp lists the commands in the status line
+func cmdHelp(m *model, _ string) (tea.Cmd, error) {
+	usages := make([]string, len(commands))
+	for i, c := range commands {
+		usages[i] = c.usage
+	}
+	sort.Strings(usages)
+	m.status = "Commands: " + strings.Join(usages, ", ")
+	return nil, nil
+}
+
+// Exec runs a command in this viewer as if it was typed at the ':' prompt,
+// e.g. "goto 0x100" or "theme light"
+func (v *Viewer) Exec(command string) error {
+	var cmd tea.Cmd
+	var err error
+	v.inspect(func(m *model) {
+		cmd, err = m.runCommand(command)
+	})
+	if cmd != nil {
+		// Run it the way the event loop runs commands returned by Update
+		go func() {
+			if msg := cmd(); msg != nil {
+				v.program.Send(msg)
+			}
+		}()
+	}
+	return err
+}
+
+// Exec runs a command in the TUI started by StartTUI, see Viewer.Exec
+func Exec(command string) error {
+	v := defaultViewer()
+	if v == nil {
+		return ErrNoViewer
+	}
+	return v.Exec(command)
+}
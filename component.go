@@ -0,0 +1,91 @@
+package prettybuffers
+
+import (
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// Model is the viewer as a bubbletea component, for applications that show
+// a hex pane within their own layout instead of handing the whole terminal
+// to StartTUI. Pass it every message the application receives, as it
+// schedules work of its own such as detecting objects in the background.
+// Its size is set with SetSize rather than taken from window size messages,
+// and the Quit key is left to the application.
+type Model struct {
+	m model
+}
+
+// NewModel returns a component configured by opts, showing no data
+func NewModel(opts ...Option) Model {
+	m := initialModel(newConfig(opts))
+	m.component = true
+	return Model{m: m}
+}
+
+// Init implements tea.Model
+func (c Model) Init() tea.Cmd {
+	return nil
+}
+
+// Update implements tea.Model. The returned model is a Model, e.g.
+//
+//	next, cmd := app.hex.Update(msg)
+//	app.hex = next.(prettybuffers.Model)
+func (c Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	if _, ok := msg.(tea.WindowSizeMsg); ok {
+		// The pane is sized by the application, see SetSize
+		return c, nil
+	}
+	next, cmd := c.m.Update(msg)
+	c.m = next.(model)
+	return c, cmd
+}
+
+// View implements tea.Model
+func (c Model) View() string {
+	return c.m.View()
+}
+
+// SetData replaces the buffer shown. The data is not copied, so the caller
+// must not change it while it is shown.
+func (c *Model) SetData(data []byte) {
+	c.m.setData(data)
+	c.m.path = ""
+}
+
+// AppendData appends data to the buffer shown, copying it
+func (c *Model) AppendData(data []byte) {
+	c.m.appendStreamed(append([]byte(nil), data...), time.Now())
+	c.m.discardOldest()
+}
+
+// SetSize sets the width and height of the pane in cells. The number of
+// bytes per row follows the width unless it was fixed by WithBytesPerRow.
+func (c *Model) SetSize(width, height int) {
+	c.m.width = width
+	c.m.height = height
+	c.m.picker.Height = max(1, height-4)
+	if !c.m.fixedBytesPerRow {
+		c.m.autoBytesPerRow()
+	}
+}
+
+// Data returns a copy of the buffer shown, including any edits made by the
+// user
+func (c Model) Data() []byte {
+	return append([]byte(nil), c.m.data...)
+}
+
+// quit tells the host application that the user quits and returns the
+// command that ends the program, or nil for a component, whose application
+// decides when to quit
+func (m *model) quit() tea.Cmd {
+	if m.events.quit != nil {
+		m.events.quit()
+	}
+	if m.component {
+		return nil
+	}
+	return tea.Quit
+}
@@ -0,0 +1,220 @@
+package prettybuffers
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+)
+
+const (
+	// maxDecompressedSize is the most a compressed stream may expand to, to
+	// keep detection quick and safe from decompression bombs
+	maxDecompressedSize = 16 << 20
+	// maxDecompressedTotal is the most the streams found by one scan may
+	// expand to together, including those found in what they decode to
+	maxDecompressedTotal = 64 << 20
+	// minCompressedSize is the smallest stream that is decompressed
+	minCompressedSize = 12
+)
+
+// isZlibHeader reports whether the two bytes are a zlib header using deflate
+// without a preset dictionary
+func isZlibHeader(cmf, flg byte) bool {
+	return cmf == 0x78 && flg&0x20 == 0 && (uint16(cmf)<<8|uint16(flg))%31 == 0
+}
+
+// decodeBudget is how much more one scan may decompress, shared by the
+// streams it finds and those found in what they or other encodings decode to
+type decodeBudget struct {
+	left int
+}
+
+// newDecodeBudget returns the budget of a scan
+func newDecodeBudget() *decodeBudget {
+	return &decodeBudget{left: maxDecompressedTotal}
+}
+
+// scan runs detection on decoded bytes, such as a decompressed stream or a
+// base64 payload, within what is left of the budget
+func (b *decodeBudget) scan(data []byte) []jsonObject {
+	objects, _, _ := scanObjectsWithin(data, 0, DetectionOptions{}, b, nil)
+	return objects
+}
+
+// decompress decodes the gzip or zlib stream at the start of data and
+// returns the decompressed bytes along with the compressed length. It
+// expands no further than b has left.
+func decompress(data []byte, b *decodeBudget) ([]byte, int, string, error) {
+	// bytes.Reader is an io.ByteReader, so the decompressors read no further
+	// than the end of the stream and the compressed length can be told
+	r := bytes.NewReader(data)
+	var dec io.Reader
+	var format string
+	switch {
+	case len(data) >= 3 && data[0] == 0x1f && data[1] == 0x8b && data[2] == 8:
+		zr, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, 0, "", err
+		}
+		zr.Multistream(false)
+		dec, format = zr, "gzip"
+	case len(data) >= 2 && isZlibHeader(data[0], data[1]):
+		zr, err := zlib.NewReader(r)
+		if err != nil {
+			return nil, 0, "", err
+		}
+		dec, format = zr, "zlib"
+	default:
+		return nil, 0, "", fmt.Errorf("no gzip or zlib header")
+	}
+	if b.left <= 0 {
+		return nil, 0, "", fmt.Errorf("%s stream not decompressed, as %d bytes were decompressed already", format, maxDecompressedTotal)
+	}
+
+	limit := min(maxDecompressedSize, b.left)
+	out, err := io.ReadAll(io.LimitReader(dec, int64(limit)+1))
+	// Streams that turn out corrupt, cut off or too large took as much work
+	// as what they expanded to, so they are charged too
+	b.left -= min(len(out), limit)
+	if err != nil {
+		return nil, 0, "", err
+	}
+	if len(out) > limit {
+		return nil, 0, "", fmt.Errorf("%s stream expands to more than %d bytes", format, limit)
+	}
+	return out, len(data) - r.Len(), format, nil
+}
+
+// scanCompressedObjects finds gzip and zlib streams in data starting at from,
+// skipping the ranges of the given objects, and runs detection on what they
+// decompress to. Like scanJSONObjects it returns the offset of a stream that
+// was cut off by the end of data.
+func scanCompressedObjects(data []byte, from int, skip []jsonObject, b *decodeBudget) ([]jsonObject, int) {
+	var objects []jsonObject
+	resume := len(data)
+	next := 0 // index into skip of the next object at or after i
+	for i := from; i+1 < len(data); i++ {
+		for next < len(skip) && skip[next].endOffset < i {
+			next++
+		}
+		if next < len(skip) && skip[next].startOffset <= i {
+			i = skip[next].endOffset
+			continue
+		}
+		if !(data[i] == 0x1f && data[i+1] == 0x8b) && !isZlibHeader(data[i], data[i+1]) {
+			continue
+		}
+		decoded, n, format, err := decompress(data[i:], b)
+		if err == io.ErrUnexpectedEOF {
+			resume = min(resume, i)
+			continue
+		}
+		if err != nil || n < minCompressedSize || (next < len(skip) && i+n > skip[next].startOffset) {
+			continue
+		}
+		nested := b.scan(decoded)
+		objects = append(objects, jsonObject{
+			startOffset: i,
+			endOffset:   i + n - 1,
+			data:        data[i : i+n],
+			decoded:     decoded,
+			kind:        objectCompressed,
+			encoding:    format,
+			nested:      nested,
+		})
+		i += n - 1
+	}
+	return objects, resume
+}
+
+// nestedParent is a buffer left to look inside one of its objects
+type nestedParent struct {
+	src         DataSource
+	data        []byte
+	lazy        bool
+	ownsData    bool
+	unmap       func() error
+	path        string
+	offset      int
+	cursor      int
+	edit        editState
+	annotations []annotation
+	highlights  []highlightGroup
+	label       string // what the nested buffer is, e.g. "gzip at 0x00000010"
+}
+
+// enterNested replaces the buffer with the decoded contents of the base64 or
+// compressed object or HTTP body under the cursor, remembering the buffer to return to
+func (m *model) enterNested() {
+	var obj *jsonObject
+	for i := range m.jsonObjects {
+		o := &m.jsonObjects[i]
+		if o.decoded != nil && o.kind != objectMsgpack && m.cursor >= o.startOffset && m.cursor <= o.endOffset {
+			obj = o
+			break
+		}
+	}
+	if obj == nil {
+		m.status = "Move the cursor onto a base64 or compressed object or HTTP body to open its contents"
+		return
+	}
+
+	encoding := obj.encoding
+	if obj.kind == objectBase64 {
+		encoding = "base64"
+	}
+	parent := nestedParent{
+		src: m.src, data: m.data, lazy: m.lazy, ownsData: m.ownsData, unmap: m.unmap,
+		path: m.path, offset: m.offset, cursor: m.cursor, edit: m.edit,
+		annotations: m.annotations, highlights: m.highlights,
+		label: fmt.Sprintf("%s at 0x%08X", encoding, obj.startOffset),
+	}
+	decoded := obj.decoded
+	// The parent keeps its mapping until it is returned to
+	parents := m.parents
+	m.unmap, m.parents = nil, nil
+	m.setData(decoded)
+	m.parents = append(parents, parent)
+	// Saving must not overwrite the parent's file with the decoded bytes
+	m.path = ""
+	m.offset, m.cursor = 0, 0
+	m.status = fmt.Sprintf("Opened %d decoded bytes, press '%s' to go back", len(decoded), m.keys.LeaveNested.Help().Key)
+}
+
+// leaveNested returns to the buffer the current one was opened from. Changes
+// to the nested buffer are discarded.
+func (m *model) leaveNested() {
+	if len(m.parents) == 0 {
+		return
+	}
+	p := m.parents[len(m.parents)-1]
+	parents := m.parents[:len(m.parents)-1]
+	m.parents = nil
+	m.setSource(sourceMsg{src: p.src, data: p.data, lazy: p.lazy})
+	m.parents = parents
+	m.ownsData, m.unmap, m.path = p.ownsData, p.unmap, p.path
+	m.edit, m.annotations, m.highlights = p.edit, p.annotations, p.highlights
+	m.offset, m.cursor = p.offset, p.cursor
+}
+
+// closeParents releases the buffers the current one was opened from
+func (m *model) closeParents() {
+	for _, p := range m.parents {
+		if p.unmap != nil {
+			_ = p.unmap()
+		}
+	}
+	m.parents = nil
+}
+
+// nestedInfo names the nested buffers being viewed for the header, or
+// returns "" at the top level
+func (m model) nestedInfo() string {
+	info := ""
+	for _, p := range m.parents {
+		info += " > " + p.label
+	}
+	return info
+}
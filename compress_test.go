@@ -0,0 +1,101 @@
+package prettybuffers
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"testing"
+	"time"
+)
+
+// gzipped returns data compressed as a gzip stream
+func gzipped(data []byte) []byte {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	w.Write(data)
+	w.Close()
+	return buf.Bytes()
+}
+
+// zlibbed returns data compressed as a zlib stream
+func zlibbed(data []byte) []byte {
+	var buf bytes.Buffer
+	w := zlib.NewWriter(&buf)
+	w.Write(data)
+	w.Close()
+	return buf.Bytes()
+}
+
+func TestScanCompressedObjects(t *testing.T) {
+	payload := []byte(`{"user":"alice","roles":["admin","dev"]}`)
+	gz, zl := gzipped(payload), zlibbed(payload)
+	tests := []struct {
+		name    string
+		data    []byte
+		formats []string // of the streams found
+		resume  int      // -1 for len(data)
+	}{
+		{"gzip", append(append([]byte("\x00\x01"), gz...), 0xFF), []string{"gzip"}, -1},
+		{"zlib", append(append([]byte("ab"), zl...), "cd"...), []string{"zlib"}, -1},
+		{"both", append(append(append([]byte{}, gz...), 0x00), zl...), []string{"gzip", "zlib"}, -1},
+		{"truncated", append([]byte("\x00"), gz[:len(gz)-10]...), nil, 1},
+		{"corrupt", append(append([]byte{}, zl[:2]...), bytes.Repeat([]byte{0xFF}, 32)...), nil, -1},
+		{"too short", zlibbed(nil), nil, -1},
+		{"header alone", []byte{0x1f, 0x8b}, nil, -1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			objects, resume := scanCompressedObjects(tt.data, 0, nil, newDecodeBudget())
+			var formats []string
+			for _, o := range objects {
+				formats = append(formats, o.encoding)
+				if !bytes.Equal(o.decoded, payload) {
+					t.Errorf("%s stream decodes to %q, want %q", o.encoding, o.decoded, payload)
+				}
+				if len(o.nested) != 1 || o.nested[0].kind != objectJSON {
+					t.Errorf("%s stream holds %d objects, want the JSON", o.encoding, len(o.nested))
+				}
+			}
+			if len(formats) != len(tt.formats) {
+				t.Fatalf("found %q, want %q", formats, tt.formats)
+			}
+			for i := range formats {
+				if formats[i] != tt.formats[i] {
+					t.Errorf("stream %d is %s, want %s", i, formats[i], tt.formats[i])
+				}
+			}
+			want := tt.resume
+			if want < 0 {
+				want = len(tt.data)
+			}
+			if resume != want {
+				t.Errorf("resume is %d, want %d", resume, want)
+			}
+		})
+	}
+}
+
+// TestScanCompressedObjectsBombs makes sure that streams expanding beyond
+// maxDecompressedSize are skipped, and that those cut off before their end
+// are charged to the budget like the others, which let a buffer of them
+// decompress gigabytes
+func TestScanCompressedObjectsBombs(t *testing.T) {
+	bomb := zlibbed(make([]byte, maxDecompressedSize+1))
+	if objects, _ := scanCompressedObjects(bomb, 0, nil, newDecodeBudget()); len(objects) != 0 {
+		t.Errorf("found %d streams expanding to more than %d bytes", len(objects), maxDecompressedSize)
+	}
+
+	// Each expands to 8 MiB before it ends early
+	cut := zlibbed(make([]byte, 8<<20))
+	cut = cut[:len(cut)-16]
+	data := bytes.Repeat(append(cut, 0x00), 64)
+	b := newDecodeBudget()
+	start := time.Now()
+	scanCompressedObjects(data, 0, nil, b)
+	if b.left > 0 {
+		t.Errorf("%d bytes of the budget left after decompressing %d cut off streams", b.left, 64)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("scanning %d cut off streams took %v", 64, elapsed)
+	}
+}
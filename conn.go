@@ -0,0 +1,300 @@
+package prettybuffers
+
+import (
+	"fmt"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// Colors of the chunks mirrored from a connection wrapped with WrapConn, or
+// by Middleware and the interceptors of package grpcmirror
+const (
+	// SentColor marks what this process sent
+	SentColor Color = "22"
+	// ReceivedColor marks what this process received
+	ReceivedColor Color = "53"
+)
+
+// maxChunkBacklog is how many chunks may wait for the event loop of a viewer
+// before further ones are dropped, so that the traffic they are mirrored from
+// never waits for a viewer that can't keep up
+const maxChunkBacklog = 1024
+
+// chunkMsg appends data to the buffer and annotates it as a whole
+type chunkMsg struct {
+	data   []byte
+	label  string
+	style  lipgloss.Style
+	at     time.Time
+	stream string // name of the buffer of its own the chunk also goes to, if any
+}
+
+// newChunkMsg returns the message appending data as a chunk with the given
+// label and color
+func newChunkMsg(data []byte, label string, color Color) chunkMsg {
+	return chunkMsg{
+		data:  data,
+		label: label,
+		style: lipgloss.NewStyle().Background(lipgloss.Color(color)),
+		at:    time.Now(),
+	}
+}
+
+// droppedChunksMsg reports how many chunks were dropped from a full backlog
+type droppedChunksMsg int
+
+// chunkQueue holds the chunks sent to a viewer until its event loop takes
+// them
+type chunkQueue struct {
+	mu      sync.Mutex
+	pending []chunkMsg
+	dropped int           // since the pending chunks were last taken
+	wake    chan struct{} // signaled when chunks are queued
+}
+
+// queue adds a chunk, or drops it once maxChunkBacklog chunks are pending
+func (q *chunkQueue) queue(msg chunkMsg) {
+	q.mu.Lock()
+	if len(q.pending) < maxChunkBacklog {
+		q.pending = append(q.pending, msg)
+	} else {
+		q.dropped++
+	}
+	q.mu.Unlock()
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+// run sends the queued chunks to the program until done is closed
+func (q *chunkQueue) run(p *tea.Program, done <-chan struct{}) {
+	for {
+		select {
+		case <-q.wake:
+		case <-done:
+			return
+		}
+		q.mu.Lock()
+		pending, dropped := q.pending, q.dropped
+		q.pending, q.dropped = nil, 0
+		q.mu.Unlock()
+		for _, msg := range pending {
+			p.Send(msg)
+		}
+		if dropped > 0 {
+			p.Send(droppedChunksMsg(dropped))
+		}
+	}
+}
+
+// appendChunk appends the data of msg and annotates where it landed. Chunks
+// are frames that the NextFrame and PrevFrame keys move between.
+func (m *model) appendChunk(msg chunkMsg) {
+	start := m.size()
+	m.appendStreamed(msg.data, msg.at)
+	if m.size() == start+len(msg.data) {
+		m.addAnnotation(annotation{start: start, end: m.size(), label: msg.label, style: msg.style})
+		m.chunks = append(m.chunks, frame{start: start, end: m.size()})
+		if m.framing == nil {
+			m.resplitFrames()
+		}
+	}
+	m.discardOldest()
+}
+
+// chunkStream holds the chunks of one stream, such as the traffic in one
+// direction of a connection wrapped with WrapConn, to be shown on their own
+type chunkStream struct {
+	name   string
+	prefix []byte // of the buffer before the first stream, for the stream of all chunks
+	chunks []chunkMsg
+	size   int // of the prefix and chunks
+}
+
+// add keeps msg, dropping the oldest chunks beyond maxSize, see
+// WithMaxBufferSize
+func (s *chunkStream) add(msg chunkMsg, maxSize int) {
+	s.chunks = append(s.chunks, msg)
+	s.size += len(msg.data)
+	if maxSize <= 0 {
+		return
+	}
+	if len(s.prefix) > 0 && s.size-len(s.prefix) >= maxSize {
+		s.size -= len(s.prefix)
+		s.prefix = nil
+	}
+	drop := 0
+	for drop < len(s.chunks)-1 && s.size-len(s.chunks[drop].data) >= maxSize {
+		s.size -= len(s.chunks[drop].data)
+		drop++
+	}
+	s.chunks = append([]chunkMsg(nil), s.chunks[drop:]...)
+}
+
+// receiveChunk appends a chunk unless only another stream is shown, and
+// keeps it for showing the streams it belongs to
+func (m *model) receiveChunk(msg chunkMsg) {
+	if msg.stream != "" && m.streams == nil {
+		m.streams = []chunkStream{{name: "all", prefix: append([]byte(nil), m.data...), size: len(m.data)}}
+	}
+	if m.streams != nil {
+		m.streams[0].add(msg, m.maxSize)
+	}
+	if msg.stream != "" {
+		i := slices.IndexFunc(m.streams, func(s chunkStream) bool { return s.name == msg.stream })
+		if i < 1 {
+			m.streams = append(m.streams, chunkStream{name: msg.stream})
+			i = len(m.streams) - 1
+		}
+		m.streams[i].add(msg, m.maxSize)
+	}
+	if m.stream == 0 || m.streams[m.stream].name == msg.stream {
+		m.appendChunk(msg)
+	}
+}
+
+// showStream replaces the buffer with the chunks of the stream at index i
+// of streams, 0 for all of them
+func (m *model) showStream(i int) {
+	streams, s := m.streams, m.streams[i]
+	data := append([]byte(nil), s.prefix...)
+	for _, c := range s.chunks {
+		data = append(data, c.data...)
+	}
+	m.setData(data)
+	m.ownsData = true
+	m.streams, m.stream = streams, i
+	start := len(s.prefix)
+	for _, c := range s.chunks {
+		end := start + len(c.data)
+		m.annotations = append(m.annotations, annotation{start: start, end: end, label: c.label, style: c.style})
+		m.chunks = append(m.chunks, frame{start: start, end: end})
+		m.arrivals = append(m.arrivals, arrival{start: start, at: c.at})
+		start = end
+	}
+	m.resplitFrames()
+	m.discardOldest()
+}
+
+// streamInfo names the stream shown for the header, or returns "" if all
+// of them are
+func (m model) streamInfo() string {
+	if m.stream == 0 {
+		return ""
+	}
+	return " > " + m.streams[m.stream].name
+}
+
+// cmdStream shows only the chunks of one stream, such as what was sent over
+// a connection wrapped with WrapConn, or lists the streams
+func cmdStream(m *model, args string) (tea.Cmd, error) {
+	if m.streams == nil {
+		return nil, fmt.Errorf("no streams, only connections wrapped with WrapConn have them")
+	}
+	if args == "" {
+		var list []string
+		for i, s := range m.streams {
+			list = append(list, fmt.Sprintf("%d %s (%d chunks)", i+1, s.name, len(s.chunks)))
+		}
+		m.status = fmt.Sprintf("%d streams: %s", len(m.streams), strings.Join(list, ", "))
+		return nil, nil
+	}
+	i := slices.IndexFunc(m.streams, func(s chunkStream) bool { return s.name == args })
+	if n, err := strconv.Atoi(args); i < 0 && err == nil && n >= 1 && n <= len(m.streams) {
+		i = n - 1
+	}
+	if i < 0 {
+		return nil, fmt.Errorf("no stream %q", args)
+	}
+	m.showStream(i)
+	m.status = fmt.Sprintf("Stream %d of %d, %s: %d chunks", i+1, len(m.streams), m.streams[i].name, len(m.streams[i].chunks))
+	return nil, nil
+}
+
+// completeStreams offers the names of the streams
+func completeStreams(m *model, args string) []string {
+	var names []string
+	for _, s := range m.streams {
+		names = append(names, s.name)
+	}
+	return matchingPrefix(names, args)
+}
+
+// mirroredConn is a connection whose traffic is appended to a viewer
+type mirroredConn struct {
+	net.Conn
+	v *Viewer // nil for the one started by StartTUI at the time of the traffic
+}
+
+// Read implements net.Conn, mirroring what was received
+func (c mirroredConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	c.mirror(p[:n], "← server", ReceivedColor)
+	return n, err
+}
+
+// Write implements net.Conn, mirroring what was sent
+func (c mirroredConn) Write(p []byte) (int, error) {
+	n, err := c.Conn.Write(p)
+	c.mirror(p[:n], "→ server", SentColor)
+	return n, err
+}
+
+// mirror appends data to the viewer as a chunk labeled with its direction
+func (c mirroredConn) mirror(data []byte, direction string, color Color) {
+	if len(data) == 0 {
+		return
+	}
+	msg := newChunkMsg(append([]byte(nil), data...), fmt.Sprintf("%s, %d bytes", direction, len(data)), color)
+	msg.stream = direction
+	queueChunk(c.v, msg)
+}
+
+// sendChunk appends data, which it takes ownership of, to v as a chunk with
+// the given label. A nil v is the viewer started by StartTUI at the time.
+// Nothing is sent while no viewer is running. It never blocks: chunks are
+// queued for the event loop and dropped once it fell maxChunkBacklog behind.
+func sendChunk(v *Viewer, data []byte, label string, color Color) {
+	if len(data) > 0 {
+		queueChunk(v, newChunkMsg(data, label, color))
+	}
+}
+
+// queueChunk queues msg for v like sendChunk does
+func queueChunk(v *Viewer, msg chunkMsg) {
+	if v == nil {
+		v = defaultViewer()
+	}
+	if v == nil {
+		return
+	}
+	select {
+	case <-v.done:
+		return
+	default:
+	}
+	v.chunks.queue(msg)
+}
+
+// WrapConn returns a connection that appends everything read from and written
+// to c to the buffer of this viewer as it happens. Each chunk is annotated
+// with its direction as seen from the client, "→ server" for writes and
+// "← server" for reads, in a color of its own. The chunks of each direction
+// are also kept on their own, which the stream command switches to.
+func (v *Viewer) WrapConn(c net.Conn) net.Conn {
+	return mirroredConn{Conn: c, v: v}
+}
+
+// WrapConn mirrors the traffic of c into the TUI started by StartTUI, see
+// Viewer.WrapConn. Traffic is not mirrored while no viewer is running.
+func WrapConn(c net.Conn) net.Conn {
+	return mirroredConn{Conn: c}
+}
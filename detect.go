@@ -0,0 +1,230 @@
+package prettybuffers
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// decodedPreviewBytes is how many decoded bytes are shown when they are
+// neither text nor contain detected objects
+const decodedPreviewBytes = 8
+
+// objectScanner finds objects of one kind in data starting at from, skipping
+// the ranges of objects found before. It returns them sorted by offset, along
+// with the offset appended data must be rescanned from.
+type objectScanner func(data []byte, from int, skip []jsonObject) ([]jsonObject, int)
+
+// newObjectScanners returns the scanners of one scan in order of priority,
+// each one only keeping objects that don't overlap those found by the ones
+// before it. What the others find in the bytes of an object can be cycled
+// through, see reinterpret. JSON is detected as opts ask for, and the
+// scanners decompressing data share b, as do those they run detection with
+// on what they decode.
+func newObjectScanners(opts DetectionOptions, b *decodeBudget) []objectScanner {
+	return []objectScanner{
+		// Captures, images, HTTP messages and multipart bodies claim their
+		// contents, which are detected separately where they hold other data
+		func(data []byte, from int, skip []jsonObject) ([]jsonObject, int) {
+			return scanCaptureObjects(data, from, skip, b)
+		},
+		scanImageObjects,
+		func(data []byte, from int, skip []jsonObject) ([]jsonObject, int) {
+			return scanHTTPObjects(data, from, skip, b)
+		},
+		func(data []byte, from int, skip []jsonObject) ([]jsonObject, int) {
+			return scanMultipartObjects(data, from, skip, b)
+		},
+		// Compressed streams may hold stored blocks that look like JSON
+		func(data []byte, from int, skip []jsonObject) ([]jsonObject, int) {
+			return scanCompressedObjects(data, from, skip, b)
+		},
+		scanTLSObjects,
+		// XML and YAML documents may hold JSON in their text
+		scanXMLObjects,
+		scanYAMLObjects,
+		func(data []byte, from int, _ []jsonObject) ([]jsonObject, int) {
+			return scanJSONObjects(data, from, opts)
+		},
+		// Form values may look like base64
+		scanFormObjects,
+		scanMsgpackObjects,
+		scanUTF16Objects,
+		func(data []byte, from int, skip []jsonObject) ([]jsonObject, int) {
+			return scanBase64Objects(data, from, skip, b)
+		},
+	}
+}
+
+// maxDepth returns the deepest nesting of JSON detected
+func (o DetectionOptions) maxDepth() int {
+	if o.MaxDepth > 0 {
+		return o.MaxDepth
+	}
+	return maxJSONDepth
+}
+
+// startChars returns the brackets JSON is detected from
+func (o DetectionOptions) startChars() string {
+	if o.StartChars != "" {
+		return o.StartChars
+	}
+	return "{["
+}
+
+// scanObjects finds JSON objects and the other detected objects in data
+// starting at from, sorted by offset, and the offset appended data must be
+// rescanned from. JSON is detected with the default options, as in the
+// decoded bytes of encodings like base64, where this is used, anything else
+// is likely noise.
+func scanObjects(data []byte, from int) ([]jsonObject, int) {
+	objects, resume, _ := scanObjectsUntil(data, from, DetectionOptions{}, nil)
+	return objects, resume
+}
+
+// detectObjects is scanObjects detecting JSON as configured for the viewer
+func (m model) detectObjects(data []byte, from int) ([]jsonObject, int) {
+	objects, resume, _ := scanObjectsUntil(data, from, m.detectOpts, nil)
+	return objects, resume
+}
+
+// scanObjectsUntil is scanObjects giving up between scanners once stop is
+// closed, reporting whether it got through all of them
+func scanObjectsUntil(data []byte, from int, opts DetectionOptions, stop <-chan struct{}) ([]jsonObject, int, bool) {
+	return scanObjectsWithin(data, from, opts, newDecodeBudget(), stop)
+}
+
+// scanObjectsWithin is scanObjectsUntil decompressing no more than b allows
+func scanObjectsWithin(data []byte, from int, opts DetectionOptions, b *decodeBudget, stop <-chan struct{}) ([]jsonObject, int, bool) {
+	var objects []jsonObject
+	resume := len(data)
+	for _, scan := range newObjectScanners(opts, b) {
+		select {
+		case <-stop:
+			return nil, from, false
+		default:
+		}
+		found, r := scan(data, from, objects)
+		resume = min(resume, r)
+		claimed := len(objects)
+		for _, o := range found {
+			if !overlapsAny(objects[:claimed], o) {
+				objects = append(objects, o)
+			}
+		}
+		sort.Slice(objects, func(i, j int) bool { return objects[i].startOffset < objects[j].startOffset })
+	}
+	for i := range objects {
+		objects[i].prettify()
+	}
+	return objects, resume, true
+}
+
+// countedKinds are the kinds of objects counted separately in the footer
+var countedKinds = []objectKind{objectXML, objectYAML}
+
+// countObjects describes how many objects were found, e.g. "5 objects (2 XML)"
+func countObjects(objects []jsonObject) string {
+	counts := map[objectKind]int{}
+	for _, o := range objects {
+		counts[o.kind]++
+	}
+	var kinds []string
+	for _, k := range countedKinds {
+		if counts[k] > 0 {
+			kinds = append(kinds, fmt.Sprintf("%d %s", counts[k], k))
+		}
+	}
+	info := fmt.Sprintf("%d objects", len(objects))
+	if len(kinds) > 0 {
+		info += " (" + strings.Join(kinds, ", ") + ")"
+	}
+	return info
+}
+
+// objectAt returns the index of the detected object containing pos, or -1
+func (m model) objectAt(pos int) int {
+	i := sort.Search(len(m.jsonObjects), func(i int) bool { return m.jsonObjects[i].endOffset >= pos })
+	if i < len(m.jsonObjects) && m.jsonObjects[i].startOffset <= pos {
+		return i
+	}
+	return -1
+}
+
+// nextObject moves to the start of the next detected object after the
+// cursor, or of the previous one
+func (m *model) nextObject(backwards bool) {
+	var i int
+	if backwards {
+		i = sort.Search(len(m.jsonObjects), func(i int) bool { return m.jsonObjects[i].startOffset >= m.cursor }) - 1
+	} else {
+		i = sort.Search(len(m.jsonObjects), func(i int) bool { return m.jsonObjects[i].startOffset > m.cursor })
+	}
+	if i < 0 || i >= len(m.jsonObjects) {
+		m.status = "No more objects"
+		return
+	}
+	m.jumpToObject(i)
+}
+
+// jumpToObject moves to the start of the detected object at index i, which
+// the Smart View scrolls to the top
+func (m *model) jumpToObject(i int) {
+	obj := m.jsonObjects[i]
+	if m.inSmartView() {
+		m.cursor = obj.startOffset
+		m.offset = obj.startOffset
+	} else {
+		m.moveCursor(obj.startOffset - m.cursor)
+	}
+	m.status = fmt.Sprintf("Object %d/%d: %s at %s, %d bytes", i+1, len(m.jsonObjects), obj.kind,
+		strings.TrimSpace(m.formatOffset(obj.startOffset)), obj.endOffset-obj.startOffset+1)
+}
+
+// overlapsAny reports whether o overlaps any of the objects, which are sorted
+// by offset and don't overlap each other
+func overlapsAny(objects []jsonObject, o jsonObject) bool {
+	i := sort.Search(len(objects), func(i int) bool { return objects[i].endOffset >= o.startOffset })
+	return i < len(objects) && objects[i].startOffset <= o.endOffset
+}
+
+// decodedLines describes the decoded bytes of an object in an encoding like
+// base64 or gzip: the objects detected in them, or else the bytes as text or hex
+func (o jsonObject) decodedLines(encoding string, bytesPerLine int) []string {
+	header := fmt.Sprintf("-> %s, %d bytes decoded", encoding, len(o.decoded))
+	if t, ok := DetectFileType(o.decoded); ok {
+		header += ": " + t.Name
+	}
+	lines := []string{header}
+
+	switch {
+	case len(o.nested) > 0:
+		lines = append(lines, o.nestedLines(bytesPerLine)...)
+	case isText(o.decoded):
+		lines = append(lines, "  "+strconv.QuoteToASCII(string(o.decoded)))
+	default:
+		preview := formatHexBytes(o.decoded[:min(decodedPreviewBytes, len(o.decoded))], decodedPreviewBytes)
+		if len(o.decoded) > decodedPreviewBytes {
+			preview += " ..."
+		}
+		lines = append(lines, "  "+preview)
+	}
+	return lines
+}
+
+// nestedLines returns the lines of the objects detected in the decoded bytes,
+// indented by two spaces
+func (o jsonObject) nestedLines(bytesPerLine int) []string {
+	var lines []string
+	for _, n := range o.nested {
+		nestedLines, err := n.lines(bytesPerLine)
+		if err != nil {
+			nestedLines = []string{sanitizeString(string(n.data))}
+		}
+		for _, line := range nestedLines {
+			lines = append(lines, "  "+line)
+		}
+	}
+	return lines
+}
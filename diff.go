@@ -0,0 +1,286 @@
+package prettybuffers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/key"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// diffChange classifies a position in a diff
+type diffChange int
+
+const (
+	diffSame diffChange = iota
+	// diffChanged is used by two-way diffs
+	diffChanged
+	// diffLeft, diffRight, diffBoth and diffConflict are used by three-way diffs
+	diffLeft
+	diffRight
+	diffBoth
+	diffConflict
+)
+
+// diffState holds the buffers being compared. In a three-way diff the first
+// buffer is the common base.
+type diffState struct {
+	names   []string
+	buffers [][]byte
+	changes int // number of differing positions
+	// json holds the differences of two buffers holding JSON documents,
+	// shown instead of the bytes while showJSON is set
+	json     []jsonDiffEntry
+	showJSON bool
+	back     int // offset to return to when leaving diff mode
+}
+
+// diffMsg starts diff mode with the given buffers
+type diffMsg diffState
+
+// newDiff builds the diff state and counts the differences. Two JSON
+// documents are compared structurally as well.
+func newDiff(names []string, buffers [][]byte) *diffState {
+	d := &diffState{names: names, buffers: buffers}
+	for pos := 0; pos < d.length(); pos++ {
+		if d.classify(pos) != diffSame {
+			d.changes++
+		}
+	}
+	if len(buffers) == 2 && isJSONDocument(buffers[0]) && isJSONDocument(buffers[1]) {
+		if entries, err := diffJSON(buffers[0], buffers[1]); err == nil {
+			d.json, d.showJSON = entries, true
+		}
+	}
+	return d
+}
+
+// isJSONDocument reports whether data is a JSON object or array, give or
+// take surrounding whitespace
+func isJSONDocument(data []byte) bool {
+	data = bytes.TrimSpace(data)
+	return len(data) > 0 && (data[0] == '{' || data[0] == '[') && json.Valid(data)
+}
+
+// length returns the length of the longest buffer
+func (d *diffState) length() int {
+	n := 0
+	for _, b := range d.buffers {
+		n = max(n, len(b))
+	}
+	return n
+}
+
+// byteAt returns the byte of buffer i at pos, or -1 past its end
+func (d *diffState) byteAt(i, pos int) int {
+	if pos < len(d.buffers[i]) {
+		return int(d.buffers[i][pos])
+	}
+	return -1
+}
+
+// classify compares the buffers at pos
+func (d *diffState) classify(pos int) diffChange {
+	if len(d.buffers) == 2 {
+		if d.byteAt(0, pos) != d.byteAt(1, pos) {
+			return diffChanged
+		}
+		return diffSame
+	}
+
+	base, left, right := d.byteAt(0, pos), d.byteAt(1, pos), d.byteAt(2, pos)
+	switch {
+	case left == base && right == base:
+		return diffSame
+	case right == base:
+		return diffLeft
+	case left == base:
+		return diffRight
+	case left == right:
+		return diffBoth
+	default:
+		return diffConflict
+	}
+}
+
+// style returns the style of theme used for buffer i at a position classified
+// as c. The base of a three-way diff is only marked when both sides changed.
+func (d *diffState) style(theme Theme, i int, c diffChange) (lipgloss.Style, bool) {
+	switch c {
+	case diffChanged:
+		return theme.DiffChanged, true
+	case diffLeft:
+		return theme.DiffLeft, i == 1
+	case diffRight:
+		return theme.DiffRight, i == 2
+	case diffBoth:
+		return theme.DiffBoth, i != 0
+	case diffConflict:
+		return theme.DiffConflict, true
+	}
+	return lipgloss.Style{}, false
+}
+
+// diffBytesPerRow returns how many bytes fit in each pane of the diff view
+func (m model) diffBytesPerRow() int {
+	panes := len(m.diff.buffers)
+	// Offset column (11 chars), then per pane a separator (3 chars) and 3 chars per byte
+	n := (m.width - 11 - panes*3) / (panes * 3)
+	if n >= 8 {
+		return (n / 8) * 8
+	}
+	return max(n, 1)
+}
+
+// nextDiff moves the view to the next (or previous) row containing a difference
+func (m *model) nextDiff(backwards bool) {
+	bpr := m.diffBytesPerRow()
+	row := m.offset - (m.offset % bpr)
+	step := bpr
+	if backwards {
+		step = -bpr
+	}
+	for r := row + step; r >= 0 && r < m.diff.length(); r += step {
+		for pos := r; pos < r+bpr; pos++ {
+			if m.diff.classify(pos) != diffSame {
+				m.offset = r
+				return
+			}
+		}
+	}
+	m.status = "No more differences"
+}
+
+// updateDiff handles a key press in diff mode
+func (m *model) updateDiff(msg tea.KeyMsg) tea.Cmd {
+	bpr := m.diffBytesPerRow()
+	rows := m.visibleRows()
+	switch {
+	case key.Matches(msg, m.keys.Quit):
+		return m.quit()
+	case key.Matches(msg, m.keys.Cancel):
+		m.offset = m.diff.back
+		m.diff = nil
+	case key.Matches(msg, m.keys.NextLayout) && m.diff.json != nil:
+		m.diff.showJSON = !m.diff.showJSON
+		m.offset = 0
+	case m.diff.showJSON:
+		m.updateJSONDiff(msg)
+	case key.Matches(msg, m.keys.Up):
+		m.offset = max(0, m.offset-bpr)
+	case key.Matches(msg, m.keys.Down):
+		if m.offset+bpr < m.diff.length() {
+			m.offset += bpr
+		}
+	case key.Matches(msg, m.keys.PageUp):
+		m.offset = max(0, m.offset-bpr*rows)
+	case key.Matches(msg, m.keys.PageDown):
+		m.offset = max(m.offset, min(m.offset+bpr*rows, lastPageStart(m.diff.length(), bpr, rows)))
+	case key.Matches(msg, m.keys.Home):
+		m.offset = 0
+	case key.Matches(msg, m.keys.End):
+		m.offset = max(m.offset, lastPageStart(m.diff.length(), bpr, rows))
+	case key.Matches(msg, m.keys.NextMatch):
+		m.nextDiff(false)
+	case key.Matches(msg, m.keys.PrevMatch):
+		m.nextDiff(true)
+	}
+	return nil
+}
+
+// diffView renders the buffers side by side with differences colored
+func (m model) diffView() string {
+	if m.diff.showJSON {
+		return m.jsonDiffView()
+	}
+	var sb strings.Builder
+	bpr := m.diffBytesPerRow()
+	paneWidth := bpr*3 - 1
+
+	sb.WriteString(m.theme.Header.Render("Diff: "+strings.Join(m.diff.names, " / ")) + "\n\n")
+
+	offsetWidth := m.offsetColumn().Width(0)
+	header := fmt.Sprintf("%-*s", offsetWidth, "Offset")
+	for _, name := range m.diff.names {
+		header += fmt.Sprintf(" | %-*s", paneWidth, name)
+	}
+	sb.WriteString(m.theme.Header.Render(header))
+	sb.WriteString("\n" + strings.Repeat("-", offsetWidth))
+	for range m.diff.names {
+		sb.WriteString("-+-" + strings.Repeat("-", paneWidth))
+	}
+	sb.WriteString("\n")
+
+	rows := m.visibleRows()
+	start := m.offset - (m.offset % bpr)
+	for row := 0; row < rows; row++ {
+		rowStart := start + row*bpr
+		if rowStart >= m.diff.length() {
+			break
+		}
+		sb.WriteString(m.theme.Offset.Render(m.formatOffset(rowStart)))
+		for i := range m.diff.buffers {
+			sb.WriteString(" | ")
+			for col := 0; col < bpr; col++ {
+				pos := rowStart + col
+				if col > 0 {
+					sb.WriteRune(' ')
+				}
+				b := m.diff.byteAt(i, pos)
+				if b < 0 {
+					sb.WriteString("  ")
+					continue
+				}
+				style, ok := m.diff.style(m.theme, i, m.diff.classify(pos))
+				if !ok {
+					style = m.theme.Hex
+				}
+				cell := style.Render(fmt.Sprintf("%02X", b))
+				sb.WriteString(cell)
+			}
+		}
+		sb.WriteString("\n")
+	}
+
+	legend := m.theme.DiffChanged.Render("marked")
+	if len(m.diff.buffers) == 3 {
+		legend = fmt.Sprintf("%s, %s, %s, %s",
+			m.theme.DiffLeft.Render("left only"), m.theme.DiffRight.Render("right only"),
+			m.theme.DiffBoth.Render("both"), m.theme.DiffConflict.Render("conflict"))
+	}
+	jsonHelp := ""
+	if m.diff.json != nil {
+		jsonHelp = fmt.Sprintf(" '%s' for the JSON diff,", m.keys.NextLayout.Help().Key)
+	}
+	sb.WriteString(m.footer(fmt.Sprintf("%d bytes differ (%s). '%s'/'%s' for next/previous difference,%s %s to leave diff.",
+		m.diff.changes, legend, m.keys.NextMatch.Help().Key, m.keys.PrevMatch.Help().Key, jsonHelp, m.keys.Cancel.Help().Key)))
+	return sb.String()
+}
+
+// ShowDiff compares two buffers byte by byte in this viewer
+func (v *Viewer) ShowDiff(left, right []byte) {
+	v.program.Send(diffMsg{names: []string{"left", "right"}, buffers: [][]byte{left, right}})
+}
+
+// ShowDiff3 compares left and right against their common base, coloring
+// which side changed each byte
+func (v *Viewer) ShowDiff3(base, left, right []byte) {
+	v.program.Send(diffMsg{names: []string{"base", "left", "right"}, buffers: [][]byte{base, left, right}})
+}
+
+// ShowDiff compares two buffers in the TUI started by StartTUI
+func ShowDiff(left, right []byte) {
+	if v := defaultViewer(); v != nil {
+		v.ShowDiff(left, right)
+	}
+}
+
+// ShowDiff3 runs a three-way comparison in the TUI started by StartTUI
+func ShowDiff3(base, left, right []byte) {
+	if v := defaultViewer(); v != nil {
+		v.ShowDiff3(base, left, right)
+	}
+}
@@ -0,0 +1,195 @@
+package prettybuffers
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"strings"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/muesli/termenv"
+)
+
+const (
+	// dumpWidth is the terminal width dumps are laid out for
+	dumpWidth = 120
+	// dumpBytesPerRow is how many bytes each row of a dump shows
+	dumpBytesPerRow = 16
+)
+
+// hexViewLayout is the layout of Dump, the same as the Hex View
+var hexViewLayout = Layout{Name: "Hex View", Columns: []ColumnType{ColumnOffset, ColumnHex, ColumnASCII}}
+
+// dumpModel returns a model showing data from its start in the layout, the
+// way the TUI would in a terminal dumpWidth wide but without any styles.
+// Objects are detected as cfg asks for, see WithDetectionOptions.
+func dumpModel(data []byte, layout Layout, cfg config) model {
+	m := initialModel(defaultConfig())
+	m.detectOpts = cfg.detection
+	m.layout = layout
+	m.width = dumpWidth
+	m.bytesPerRow = dumpBytesPerRow
+	m.fixedBytesPerRow = true
+	m.theme = Theme{Name: "Plain"}
+	m.setData(data)
+	m.detectNow()
+	// No byte is under the cursor
+	m.cursor = -1
+	return m
+}
+
+// detectNow finishes detection right away, as there is no event loop to
+// finish it in the background
+func (m *model) detectNow() {
+	if m.detection != nil {
+		m.cancelDetection()
+		m.jsonObjects, m.scanResume = m.detectObjects(m.data, 0)
+		m.resplitFrames()
+	}
+}
+
+// RenderView returns exactly what the TUI shows of data in the layout, in a
+// terminal of the given size with the cursor moved to offset as by the goto
+// command. It is meant for golden-file tests of layouts and for snapshots of
+// views. Styles follow the color profile of lipgloss, which renders plain
+// text when output isn't a terminal, as in tests.
+func RenderView(data []byte, width, height, offset int, layout Layout) string {
+	m := initialModel(defaultConfig())
+	m.layout = layout
+	m.width = width
+	m.height = height
+	m.autoBytesPerRow()
+	m.setData(data)
+	m.detectNow()
+	m.moveCursor(min(max(offset, 0), m.size()-1) - m.cursor)
+	return m.View()
+}
+
+// dumpRows renders all rows of the buffer with their column headings
+func (m model) dumpRows() string {
+	if len(m.layout.Renderers) == 0 && containsColumn(m.layout.Columns, ColumnJSON) {
+		// Objects take as many rows as their prettified lines
+		return m.smartRows(math.MaxInt)
+	}
+	return m.hexRows((m.size() + m.bytesPerRow - 1) / m.bytesPerRow)
+}
+
+// Dump returns data formatted like the Hex View of the TUI, with offsets,
+// hexadecimal and ASCII columns of 16 bytes a row, for logs and tests
+func Dump(data []byte) string {
+	return DumpLayout(data, hexViewLayout)
+}
+
+// DumpLayout returns data formatted in any layout of the TUI. The Smart View
+// shows detected objects prettified, e.g.
+//
+//	fmt.Print(prettybuffers.DumpLayout(data, prettybuffers.PredefinedLayouts[1]))
+//
+// WithBytesPerRow, WithByteGrouping, WithByteOrder, WithDecimalOffsets,
+// WithCompactOffsets, WithBaseAddress, WithPayloadsOnly, WithStrictJSON and
+// WithDetectionOptions apply.
+func DumpLayout(data []byte, layout Layout, opts ...Option) string {
+	var sb strings.Builder
+	fdumpLayout(&sb, data, layout, newConfig(opts))
+	return sb.String()
+}
+
+// Fdump writes data to w formatted like Dump
+func Fdump(w io.Writer, data []byte) {
+	fdumpLayout(w, data, hexViewLayout, defaultConfig())
+}
+
+// fdumpLayout writes data to w formatted like DumpLayout
+func fdumpLayout(w io.Writer, data []byte, layout Layout, cfg config) {
+	if len(data) == 0 {
+		return
+	}
+	m := dumpModel(data, layout, cfg)
+	m.groupSize, m.byteOrder = cfg.groupSize, cfg.byteOrder
+	m.decimalOffsets, m.compactOffsets = cfg.decimal, cfg.compact
+	m.baseAddress = cfg.base
+	m.payloadsOnly = cfg.payloads
+	if cfg.bytesPerRow > 0 {
+		m.bytesPerRow = cfg.bytesPerRow
+	}
+	_, _ = io.WriteString(w, m.dumpRows())
+}
+
+// byteClass sorts b into the classes colored by Theme.ByteClasses: null,
+// whitespace, printable, other ASCII and non-ASCII bytes
+func byteClass(b byte) int {
+	switch {
+	case b == 0:
+		return 0
+	case b == ' ' || b >= '\t' && b <= '\r':
+		return 1
+	case b > ' ' && b < 0x7f:
+		return 2
+	case b < 0x80:
+		return 3
+	}
+	return 4
+}
+
+// Sdump returns data formatted like Dump in ANSI colors, for terminal debug
+// output and logs. Bytes are colored by class, such as null, printable and
+// non-ASCII bytes, and the objects detected in data are shown prettified
+// below the row they end in. WithTheme, WithBytesPerRow, WithStrictJSON and
+// WithDetectionOptions apply; colors are written whether or not the output
+// is a terminal.
+func Sdump(data []byte, opts ...Option) string {
+	cfg := newConfig(opts)
+	m := dumpModel(data, hexViewLayout, cfg)
+	if cfg.bytesPerRow > 0 {
+		m.bytesPerRow = cfg.bytesPerRow
+	}
+	renderer := lipgloss.NewRenderer(io.Discard)
+	renderer.SetColorProfile(termenv.ANSI256)
+	style := func(s lipgloss.Style) lipgloss.Style { return s.Renderer(renderer) }
+	theme := cfg.theme
+	classes := make([]lipgloss.Style, 5)
+	for i := range classes {
+		classes[i] = style(theme.Hex)
+		if i < len(theme.ByteClasses) {
+			classes[i] = style(theme.ByteClasses[i])
+		}
+	}
+
+	var sb strings.Builder
+	hexWidth := HexColumn{}.Width(m.bytesPerRow)
+	sb.WriteString(style(theme.Header).Render(fmt.Sprintf("%-10s | %-*s | %s", "Offset", hexWidth, "Hexadecimal", "ASCII")) + "\n")
+	sb.WriteString(strings.Repeat("-", 10) + "-+-" + strings.Repeat("-", hexWidth) + "-+-" + strings.Repeat("-", m.bytesPerRow) + "\n")
+	objects := m.jsonObjects
+	for off := 0; off < len(data); off += m.bytesPerRow {
+		row := data[off:min(off+m.bytesPerRow, len(data))]
+		var hexPart, asciiPart strings.Builder
+		for start := 0; start < len(row); {
+			// Color runs of bytes of the same class at once
+			class, end := byteClass(row[start]), start+1
+			for end < len(row) && byteClass(row[end]) == class {
+				end++
+			}
+			if start > 0 {
+				hexPart.WriteByte(' ')
+			}
+			hexPart.WriteString(classes[class].Render(formatHexBytes(row[start:end], end-start)))
+			asciiPart.WriteString(classes[class].Render(formatASCIIBytes(row[start:end])))
+			start = end
+		}
+		pad := strings.Repeat(" ", hexWidth-len(row)*3+1)
+		fmt.Fprintf(&sb, "%s | %s%s | %s\n", style(theme.Offset).Render(fmt.Sprintf("0x%08X", off)), hexPart.String(), pad, asciiPart.String())
+
+		// Objects ending in this row follow it
+		for len(objects) > 0 && objects[0].endOffset < off+len(row) {
+			lines, err := objects[0].lines(m.bytesPerRow)
+			if err != nil {
+				lines = []string{sanitizeString(string(objects[0].data))}
+			}
+			for _, line := range lines {
+				fmt.Fprintf(&sb, "%10s | %s\n", "", style(theme.JSON).Render(objects[0].displayLine(line)))
+			}
+			objects = objects[1:]
+		}
+	}
+	return sb.String()
+}
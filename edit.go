@@ -0,0 +1,297 @@
+package prettybuffers
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/key"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// byteEdit records how a byte came to differ from the loaded data
+type byteEdit struct {
+	original byte // value before the first overwrite
+	inserted bool // the byte did not exist in the loaded data
+}
+
+// editState holds the state of the hex editor
+type editState struct {
+	active   bool
+	ascii    bool // typing goes to the ASCII column instead of hex nibbles
+	insert   bool // typing inserts new bytes instead of overwriting
+	lowNext  bool // the high nibble of the cursor byte was typed, the low one is next
+	modified map[int]byteEdit
+	resized  bool // bytes were inserted or deleted since the data was loaded
+}
+
+// dirty reports whether the buffer differs from the loaded data
+func (e editState) dirty() bool {
+	return len(e.modified) > 0 || e.resized
+}
+
+// startEdit enters edit mode with the cursor on the first byte in view
+func (m *model) startEdit() {
+	if !m.requireWritable("Editing") || !m.requireMemory("Editing") {
+		return
+	}
+	if len(m.data) == 0 {
+		m.status = "Nothing to edit"
+		return
+	}
+	m.selection = selection{}
+	m.placeCursorInView()
+	m.edit.active = true
+	m.edit.lowNext = false
+}
+
+// placeCursorInView moves the cursor to the first byte in view unless it is already visible
+func (m *model) placeCursorInView() {
+	rows := m.visibleRows()
+	viewStart := m.offset - (m.offset % m.bytesPerRow)
+	if m.cursor < viewStart || m.cursor >= viewStart+rows*m.bytesPerRow {
+		m.cursor = viewStart
+	}
+	m.cursor = max(0, min(m.cursor, m.cursorLimit()))
+}
+
+// cursorLimit returns the largest valid cursor offset. In insert mode the
+// cursor may sit one past the last byte so that data can be appended.
+func (m model) cursorLimit() int {
+	if m.edit.active && m.edit.insert {
+		return m.size()
+	}
+	return m.size() - 1
+}
+
+// updateEdit handles a key press in edit mode. Printable keys type into the
+// ASCII column; in the hex column only hex digits do, so other keys remain
+// available as commands.
+func (m *model) updateEdit(msg tea.KeyMsg) tea.Cmd {
+	typing := msg.Type == tea.KeyRunes && (m.edit.ascii || isHexDigits(msg.Runes))
+	if !typing {
+		m.edit.lowNext = false
+		switch {
+		case key.Matches(msg, m.keys.Save):
+			m.saveCurrent()
+		case key.Matches(msg, m.keys.Cancel):
+			m.edit.active = false
+			m.cursor = max(0, min(m.cursor, len(m.data)-1))
+		case key.Matches(msg, m.keys.EditColumn):
+			m.edit.ascii = !m.edit.ascii
+		case key.Matches(msg, m.keys.EditInsert):
+			m.edit.insert = !m.edit.insert
+			m.cursor = max(0, min(m.cursor, m.cursorLimit()))
+		case key.Matches(msg, m.keys.EditDelete):
+			if m.cursor < len(m.data) {
+				m.deleteBytes(m.cursor, 1)
+			}
+		case key.Matches(msg, m.keys.Backspace):
+			if m.cursor > 0 {
+				m.deleteBytes(m.cursor-1, 1)
+				m.moveCursor(-1)
+			}
+		case key.Matches(msg, m.keys.Up):
+			m.moveCursor(-m.bytesPerRow)
+		case key.Matches(msg, m.keys.Down):
+			m.moveCursor(m.bytesPerRow)
+		case key.Matches(msg, m.keys.Left):
+			m.moveCursor(-1)
+		case key.Matches(msg, m.keys.Right):
+			m.moveCursor(1)
+		}
+		return nil
+	}
+
+	for _, r := range msg.Runes {
+		if m.edit.ascii {
+			if r < 32 || r > 126 {
+				continue
+			}
+			m.typeByte(byte(r))
+			m.moveCursor(1)
+			continue
+		}
+
+		nibble, err := strconv.ParseUint(string(r), 16, 8)
+		if err != nil {
+			continue
+		}
+		if m.edit.lowNext {
+			m.setByte(m.cursor, m.data[m.cursor]&0xF0|byte(nibble))
+			m.edit.lowNext = false
+			m.moveCursor(1)
+		} else {
+			if m.edit.insert {
+				m.insertBytes(m.cursor, []byte{byte(nibble) << 4})
+			} else {
+				m.setByte(m.cursor, byte(nibble)<<4|m.data[m.cursor]&0x0F)
+			}
+			m.edit.lowNext = true
+		}
+	}
+	return nil
+}
+
+// isHexDigits reports whether every rune is a hexadecimal digit
+func isHexDigits(runes []rune) bool {
+	for _, r := range runes {
+		if _, err := strconv.ParseUint(string(r), 16, 8); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// typeByte writes value at the cursor, inserting a new byte in insert mode
+func (m *model) typeByte(value byte) {
+	if m.edit.insert {
+		m.insertBytes(m.cursor, []byte{value})
+		return
+	}
+	if m.cursor < len(m.data) {
+		m.setByte(m.cursor, value)
+	}
+}
+
+// ownData makes sure data is a private copy before it is modified in place
+func (m *model) ownData() {
+	if !m.ownsData {
+		// Never modify the slice the caller handed us
+		m.data = append([]byte(nil), m.data...)
+		m.ownsData = true
+	}
+}
+
+// setByte overwrites the byte at pos and records the original value
+func (m *model) setByte(pos int, value byte) {
+	m.ownData()
+	if m.edit.modified == nil {
+		m.edit.modified = make(map[int]byteEdit)
+	}
+
+	change, seen := m.edit.modified[pos]
+	if !seen {
+		change = byteEdit{original: m.data[pos]}
+	}
+	if m.events.edit != nil {
+		m.events.edit(pos, m.data[pos], value)
+	}
+	m.data[pos] = value
+	if value == change.original && !change.inserted {
+		delete(m.edit.modified, pos)
+	} else {
+		m.edit.modified[pos] = change
+	}
+	m.edited(pos, 1, 0)
+}
+
+// insertBytes inserts data before pos, shifting everything after it
+func (m *model) insertBytes(pos int, data []byte) {
+	m.ownData()
+	m.data = slices.Insert(m.data, pos, data...)
+	m.shiftOffsets(pos, len(data))
+
+	if m.edit.modified == nil {
+		m.edit.modified = make(map[int]byteEdit)
+	}
+	for i := range data {
+		m.edit.modified[pos+i] = byteEdit{inserted: true}
+	}
+	m.edit.resized = true
+	m.edited(pos, len(data), len(data))
+}
+
+// deleteBytes removes n bytes starting at pos, shifting everything after it
+func (m *model) deleteBytes(pos, n int) {
+	n = min(n, len(m.data)-pos)
+	if n <= 0 {
+		return
+	}
+	m.ownData()
+	m.data = slices.Delete(m.data, pos, pos+n)
+	m.shiftOffsets(pos, -n)
+	m.edit.resized = true
+	m.cursor = max(0, min(m.cursor, m.cursorLimit()))
+	m.edited(pos, 0, -n)
+}
+
+// shiftOffsets keeps offsets stored in the model pointing at the same bytes
+// after delta bytes were inserted (delta > 0) or deleted (delta < 0) at pos
+func (m *model) shiftOffsets(pos, delta int) {
+	shifted := make(map[int]byteEdit, len(m.edit.modified))
+	for off, change := range m.edit.modified {
+		switch {
+		case off < pos:
+			shifted[off] = change
+		case delta < 0 && off < pos-delta:
+			// The byte was deleted
+		default:
+			shifted[off+delta] = change
+		}
+	}
+	m.edit.modified = shifted
+
+	if m.selection.anchor >= pos {
+		m.selection.anchor = max(pos, m.selection.anchor+delta)
+	}
+	m.shiftAnnotations(pos, delta)
+	m.shiftHighlights(pos, delta)
+}
+
+// deleteSelection removes the selected bytes
+func (m *model) deleteSelection() {
+	start, end := m.selection.bounds(m.cursor)
+	end = min(end, len(m.data)-1)
+	m.selection = selection{}
+	m.cursor = start
+	if !m.requireWritable("Deleting") || !m.requireMemory("Deleting") {
+		return
+	}
+	m.deleteBytes(start, end-start+1)
+	m.status = fmt.Sprintf("Deleted %d bytes", end-start+1)
+}
+
+// editHelp describes edit mode for the footer
+func (m model) editHelp() string {
+	column := "hex"
+	if m.edit.ascii {
+		column = "ASCII"
+	}
+	mode := "overwrite"
+	if m.edit.insert {
+		mode = "insert"
+	}
+	return fmt.Sprintf("-- EDIT (%s, %s) -- %s, %d bytes changed. '%s' to switch column, '%s' to toggle insert, '%s' to delete, '%s' to leave.",
+		column, mode, strings.TrimSpace(m.formatOffset(m.cursor)), len(m.edit.modified), m.keys.EditColumn.Help().Key,
+		m.keys.EditInsert.Help().Key, m.keys.EditDelete.Help().Key, m.keys.Cancel.Help().Key)
+}
+
+// Data returns a copy of the buffer shown in this viewer, including any edits
+// made by the user
+func (v *Viewer) Data() []byte {
+	var data []byte
+	v.inspect(func(m *model) {
+		data = append([]byte(nil), m.data...)
+	})
+	return data
+}
+
+// Modified reports whether the user changed, inserted or deleted any bytes in this viewer
+func (v *Viewer) Modified() bool {
+	var modified bool
+	v.inspect(func(m *model) {
+		modified = m.edit.dirty()
+	})
+	return modified
+}
+
+// Data returns a copy of the buffer shown in the TUI started by StartTUI
+func Data() []byte {
+	v := defaultViewer()
+	if v == nil {
+		return nil
+	}
+	return v.Data()
+}
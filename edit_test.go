@@ -0,0 +1,50 @@
+package prettybuffers
+
+import (
+	"bytes"
+	"testing"
+)
+
+// TestRescanEdited checks that rescanning around the edited bytes finds the
+// same objects as scanning the whole buffer again
+func TestRescanEdited(t *testing.T) {
+	filler := bytes.Repeat([]byte("\x00\x01 binary "), 16<<10)
+	data := append(append([]byte(`{"a":1} `), filler...), `{"b":[1,2]} {"c":"d"}`...)
+	tail := len(data) - len(`{"b":[1,2]} {"c":"d"}`)
+	tests := []struct {
+		name string
+		edit func(m *model)
+	}{
+		{"overwrite inside", func(m *model) { m.setByte(tail+6, '3') }},
+		{"break an object", func(m *model) { m.setByte(tail, ' ') }},
+		{"insert before", func(m *model) { m.insertBytes(3, []byte("xyz")) }},
+		{"insert inside", func(m *model) { m.insertBytes(tail+9, []byte(",3")) }},
+		{"delete a brace", func(m *model) { m.deleteBytes(tail+10, 1) }},
+		{"delete across objects", func(m *model) { m.deleteBytes(tail+5, 10) }},
+		{"complete an object", func(m *model) {
+			m.deleteBytes(len(m.data)-1, 1)
+			m.insertBytes(len(m.data), []byte("}"))
+		}},
+		{"edits far apart", func(m *model) {
+			m.insertBytes(1, []byte(" "))
+			m.setByte(len(m.data)-2, 'e')
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := initialModel(config{})
+			m.setData(data)
+			tt.edit(&m)
+			m.rescanEdited()
+			want, _ := m.detectObjects(m.data, 0)
+			if len(m.jsonObjects) != len(want) {
+				t.Fatalf("found %d objects, want %d", len(m.jsonObjects), len(want))
+			}
+			for i, o := range m.jsonObjects {
+				if o.startOffset != want[i].startOffset || o.endOffset != want[i].endOffset {
+					t.Errorf("object %d is at %d-%d, want %d-%d", i, o.startOffset, o.endOffset, want[i].startOffset, want[i].endOffset)
+				}
+			}
+		})
+	}
+}
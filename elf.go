@@ -0,0 +1,213 @@
+package prettybuffers
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"strings"
+)
+
+// maxELFEntries limits how many program or section headers are parsed
+const maxELFEntries = 1024
+
+var (
+	elfClasses = map[uint64]string{1: "32-bit", 2: "64-bit"}
+	elfData    = map[uint64]string{1: "little-endian", 2: "big-endian"}
+	elfTypes   = map[uint64]string{0: "NONE", 1: "REL", 2: "EXEC", 3: "DYN", 4: "CORE"}
+	elfOSABIs  = map[uint64]string{0: "System V", 3: "Linux", 6: "Solaris", 9: "FreeBSD", 12: "OpenBSD"}
+
+	elfMachines = map[uint64]string{
+		2: "SPARC", 3: "x86", 8: "MIPS", 20: "PowerPC", 21: "PowerPC64", 22: "S390",
+		40: "ARM", 42: "SuperH", 50: "IA-64", 62: "x86-64", 183: "AArch64", 243: "RISC-V",
+	}
+
+	elfSegmentTypes = map[uint64]string{
+		0: "NULL", 1: "LOAD", 2: "DYNAMIC", 3: "INTERP", 4: "NOTE", 5: "SHLIB", 6: "PHDR", 7: "TLS",
+		0x6474e550: "GNU_EH_FRAME", 0x6474e551: "GNU_STACK", 0x6474e552: "GNU_RELRO", 0x6474e553: "GNU_PROPERTY",
+	}
+
+	elfSectionTypes = map[uint64]string{
+		0: "NULL", 1: "PROGBITS", 2: "SYMTAB", 3: "STRTAB", 4: "RELA", 5: "HASH", 6: "DYNAMIC", 7: "NOTE",
+		8: "NOBITS", 9: "REL", 10: "SHLIB", 11: "DYNSYM", 14: "INIT_ARRAY", 15: "FINI_ARRAY",
+		16: "PREINIT_ARRAY", 17: "GROUP", 18: "SYMTAB_SHNDX",
+		0x6ffffff6: "GNU_HASH", 0x6ffffffe: "VERNEED", 0x6fffffff: "VERSYM",
+	}
+)
+
+// elfSectionFlags formats section flags the way readelf does, e.g. "AX"
+func elfSectionFlags(flags uint64) string {
+	var s string
+	for i, c := range "WAXxMSILOGT" {
+		if c != 'x' && flags&(1<<i) != 0 {
+			s += string(c)
+		}
+	}
+	return s
+}
+
+// elfSegmentFlags formats segment permissions, e.g. "R-X"
+func elfSegmentFlags(flags uint64) string {
+	perms := []byte("---")
+	for i, c := range "RWX" {
+		if flags&(1<<(2-i)) != 0 {
+			perms[i] = byte(c)
+		}
+	}
+	return string(perms)
+}
+
+// parseELF parses the ELF header, the program headers and the section
+// headers, along with the contents of the sections
+func parseELF(read func(off, n int) []byte, size int) []structure {
+	ident := read(0, 16)
+	if len(ident) < 16 || (ident[4] != 1 && ident[4] != 2) || (ident[5] != 1 && ident[5] != 2) {
+		return nil
+	}
+	is64 := ident[4] == 2
+	var order binary.ByteOrder = binary.LittleEndian
+	if ident[5] == 2 {
+		order = binary.BigEndian
+	}
+	word, headerSize := 4, 52
+	if is64 {
+		word, headerSize = 8, 64
+	}
+
+	b, ok := newStructBuilder(read, 0, headerSize, order, "ELF header")
+	if !ok {
+		return nil
+	}
+	b.raw("magic", 4)
+	b.enum("class", 1, elfClasses)
+	b.enum("data", 1, elfData)
+	b.dec("version", 1)
+	b.enum("OS/ABI", 1, elfOSABIs)
+	b.dec("ABI version", 1)
+	b.raw("padding", 7)
+	b.enum("e_type", 2, elfTypes)
+	b.enum("e_machine", 2, elfMachines)
+	b.dec("e_version", 4)
+	b.hex("e_entry", word)
+	phoff := b.hex("e_phoff", word)
+	shoff := b.hex("e_shoff", word)
+	b.hex("e_flags", 4)
+	b.dec("e_ehsize", 2)
+	phentsize := b.dec("e_phentsize", 2)
+	phnum := b.dec("e_phnum", 2)
+	shentsize := b.dec("e_shentsize", 2)
+	shnum := b.dec("e_shnum", 2)
+	shstrndx := b.dec("e_shstrndx", 2)
+	structures := []structure{b.done()}
+
+	phsize, shsize := 32, 40
+	if is64 {
+		phsize, shsize = 56, 64
+	}
+	if phentsize >= uint64(phsize) {
+		for i := 0; i < min(int(phnum), maxELFEntries); i++ {
+			off := phoff + uint64(i)*phentsize
+			if off+uint64(phsize) > uint64(size) {
+				break
+			}
+			b, ok := newStructBuilder(read, int(off), phsize, order, fmt.Sprintf("Program header %d", i))
+			if !ok {
+				break
+			}
+			typ := b.enum("p_type", 4, elfSegmentTypes)
+			if is64 {
+				b.add("p_flags", 4, elfSegmentFlags(b.uint(4)))
+			}
+			b.hex("p_offset", word)
+			b.hex("p_vaddr", word)
+			b.hex("p_paddr", word)
+			b.hex("p_filesz", word)
+			b.hex("p_memsz", word)
+			if !is64 {
+				b.add("p_flags", 4, elfSegmentFlags(b.uint(4)))
+			}
+			b.hex("p_align", word)
+			s := b.done()
+			if name, ok := elfSegmentTypes[typ]; ok {
+				s.name += " (" + name + ")"
+			}
+			structures = append(structures, s)
+		}
+	}
+
+	if shentsize < uint64(shsize) {
+		return structures
+	}
+	readWord := func(raw []byte) uint64 {
+		if is64 {
+			return order.Uint64(raw)
+		}
+		return uint64(order.Uint32(raw))
+	}
+	// Read the section name string table first to name the sections
+	var names []byte
+	if int(shstrndx) < min(int(shnum), maxELFEntries) {
+		if raw := read(int(shoff+shstrndx*shentsize), shsize); len(raw) == shsize {
+			off, n := readWord(raw[8+2*word:]), readWord(raw[8+3*word:])
+			if off < uint64(size) {
+				// read stops at the end of the buffer
+				names = read(int(off), min(int(n), size))
+			}
+		}
+	}
+
+	var contents []structure
+	for i := 0; i < min(int(shnum), maxELFEntries); i++ {
+		off := shoff + uint64(i)*shentsize
+		if off+uint64(shsize) > uint64(size) {
+			break
+		}
+		raw := read(int(off), shsize)
+		name := ""
+		if n := uint64(order.Uint32(raw)); n < uint64(len(names)) {
+			end := bytes.IndexByte(names[n:], 0)
+			if end < 0 {
+				end = len(names) - int(n)
+			}
+			name = sanitizeString(string(names[n : n+uint64(end)]))
+		}
+		title := fmt.Sprintf("Section header %d", i)
+		if name != "" {
+			title += " (" + name + ")"
+		}
+		b, ok := newStructBuilder(read, int(off), shsize, order, title)
+		if !ok {
+			break
+		}
+		b.hex("sh_name", 4)
+		typ := b.enum("sh_type", 4, elfSectionTypes)
+		flags := b.uint(word)
+		b.add("sh_flags", word, fmt.Sprintf("0x%X %s", flags, elfSectionFlags(flags)))
+		b.hex("sh_addr", word)
+		offset := b.hex("sh_offset", word)
+		length := b.hex("sh_size", word)
+		b.dec("sh_link", 4)
+		b.dec("sh_info", 4)
+		b.hex("sh_addralign", word)
+		b.hex("sh_entsize", word)
+		structures = append(structures, b.done())
+
+		// NULL and NOBITS sections take no room in the file
+		if typ != 0 && typ != 8 && length > 0 && offset < uint64(size) {
+			label := "Section"
+			if name != "" {
+				label += " " + name
+			}
+			typeName, ok := elfSectionTypes[typ]
+			if !ok {
+				typeName = fmt.Sprintf("type 0x%X", typ)
+			}
+			contents = append(contents, structure{
+				start: int(offset),
+				end:   int(offset) + min(int(length), size-int(offset)),
+				name:  strings.TrimSpace(fmt.Sprintf("%s, %s %s", label, typeName, elfSectionFlags(flags))),
+			})
+		}
+	}
+	// Headers take precedence over section contents claiming to overlap them
+	return append(structures, contents...)
+}
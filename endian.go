@@ -0,0 +1,36 @@
+package prettybuffers
+
+import "encoding/binary"
+
+// byteOrderName names a byte order, e.g. "little-endian"
+func byteOrderName(order binary.ByteOrder) string {
+	if order == binary.BigEndian {
+		return "big-endian"
+	}
+	return "little-endian"
+}
+
+// setByteOrder switches the byte order of grouped words and overlaid fields,
+// laying the overlays out again
+func (m *model) setByteOrder(order binary.ByteOrder) {
+	m.byteOrder = order
+	m.parseStructures()
+	m.status = "Reading multi-byte values " + byteOrderName(order)
+}
+
+// toggleByteOrder flips between little-endian and big-endian
+func (m *model) toggleByteOrder() {
+	if m.byteOrder == binary.BigEndian {
+		m.setByteOrder(binary.LittleEndian)
+	} else {
+		m.setByteOrder(binary.BigEndian)
+	}
+}
+
+// byteOrderInfo shows the byte order in the footer, e.g. "[LE]"
+func (m model) byteOrderInfo() string {
+	if m.byteOrder == binary.BigEndian {
+		return "[BE]"
+	}
+	return "[LE]"
+}
@@ -0,0 +1,82 @@
+package prettybuffers
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/charmbracelet/lipgloss"
+)
+
+// entropyBars are block characters for entropy from none to the maximum
+var entropyBars = []rune("▁▂▃▄▅▆▇█")
+
+// shannonEntropy returns the Shannon entropy of data in bits per byte, from
+// 0 for a single repeated value to 8 for uniformly random bytes
+func shannonEntropy(data []byte) float64 {
+	if len(data) == 0 {
+		return 0
+	}
+	var counts [256]int
+	for _, b := range data {
+		counts[b]++
+	}
+	entropy := 0.0
+	for _, c := range counts {
+		if c > 0 {
+			p := float64(c) / float64(len(data))
+			entropy -= p * math.Log2(p)
+		}
+	}
+	return entropy
+}
+
+// entropyRatio returns the entropy of data relative to the highest entropy
+// n bytes can have, which is below 8 bits per byte for fewer than 256 bytes
+func entropyRatio(data []byte) float64 {
+	highest := math.Log2(float64(min(len(data), 256)))
+	if highest == 0 {
+		return 0
+	}
+	return shannonEntropy(data) / highest
+}
+
+// scaleIndex maps a ratio from 0 to 1 onto an index into n steps
+func scaleIndex(ratio float64, n int) int {
+	return max(0, min(int(ratio*float64(n)), n-1))
+}
+
+// entropyBar returns a block character as high as the entropy ratio
+func entropyBar(ratio float64) string {
+	return string(entropyBars[scaleIndex(ratio, len(entropyBars))])
+}
+
+// entropyStyle returns the heat color of theme for the entropy ratio
+func (t Theme) entropyStyle(ratio float64) lipgloss.Style {
+	if len(t.EntropyHeat) == 0 {
+		return lipgloss.NewStyle()
+	}
+	return t.EntropyHeat[scaleIndex(ratio, len(t.EntropyHeat))]
+}
+
+// EntropyColumn shows the Shannon entropy of each row in bits per byte, with
+// a bar relative to the highest entropy a row can have, so that compressed
+// or encrypted regions stand out
+type EntropyColumn struct{}
+
+// Header implements ColumnRenderer
+func (EntropyColumn) Header() string { return "Entropy" }
+
+// Width implements ColumnRenderer
+func (EntropyColumn) Width(int) int { return 7 }
+
+// RenderRow implements ColumnRenderer
+func (EntropyColumn) RenderRow(data []byte, _ int) string {
+	if len(data) == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%4.2f %s", shannonEntropy(data), entropyBar(entropyRatio(data)))
+}
+
+func (c EntropyColumn) renderStyled(m model, data []byte, offset int) string {
+	return m.theme.entropyStyle(entropyRatio(data)).Render(c.RenderRow(data, offset))
+}
@@ -0,0 +1,61 @@
+package prettybuffers
+
+// events are the callbacks through which a host application follows what
+// the user does in the viewer. They are called from the event loop, so they
+// must return quickly and must not call methods of the Viewer, which wait
+// for the event loop; start a goroutine for anything more.
+type events struct {
+	cursorMove func(offset int)
+	selection  func(start, end int)
+	quit       func()
+	edit       func(offset int, old, new byte)
+}
+
+// OnCursorMove calls fn with the offset of the cursor whenever it moves. fn
+// runs on the event loop of the viewer and must not block nor call methods
+// of the Viewer; the same goes for the other callbacks.
+func OnCursorMove(fn func(offset int)) Option {
+	return func(c *config) {
+		c.events.cursorMove = fn
+	}
+}
+
+// OnSelect calls fn with the range selected, end exclusive, whenever the
+// selection grows or shrinks, e.g. to decode the selected bytes with a
+// parser of the host application
+func OnSelect(fn func(start, end int)) Option {
+	return func(c *config) {
+		c.events.selection = fn
+	}
+}
+
+// OnQuit calls fn when the user quits the viewer, which in a Model is
+// left to the application
+func OnQuit(fn func()) Option {
+	return func(c *config) {
+		c.events.quit = fn
+	}
+}
+
+// OnEdit calls fn whenever the user overwrites a byte in edit mode, with
+// its offset and its value before and after, once for each hex digit typed.
+// Inserted and deleted bytes are not reported.
+func OnEdit(fn func(offset int, old, new byte)) Option {
+	return func(c *config) {
+		c.events.edit = fn
+	}
+}
+
+// notify calls the callbacks for what changed since prev
+func (m model) notify(prev model) {
+	if m.events.cursorMove != nil && m.cursor != prev.cursor {
+		m.events.cursorMove(m.cursor)
+	}
+	if m.events.selection != nil && m.selection.active && m.size() > 0 {
+		start, end := m.selection.bounds(m.cursor)
+		prevStart, prevEnd := prev.selection.bounds(prev.cursor)
+		if !prev.selection.active || start != prevStart || end != prevEnd {
+			m.events.selection(start, min(end, m.size()-1)+1)
+		}
+	}
+}
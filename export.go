@@ -0,0 +1,106 @@
+package prettybuffers
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// exportFormat is a file format the buffer can be exported in
+type exportFormat struct {
+	name   string
+	encode func(data []byte) []byte
+	// decode reverses encode for the import command, nil if it can't be
+	decode func(text []byte) ([]byte, error)
+	// render replaces encode for formats showing what the viewer knows about
+	// the data, which starts at start in the buffer
+	render func(m *model, start int, data []byte) []byte
+}
+
+// exportFormats lists the formats offered by the export command
+var exportFormats = []exportFormat{
+	{name: "raw", encode: func(data []byte) []byte { return data }},
+	{name: "hex", encode: func(data []byte) []byte { return []byte(hex.EncodeToString(data) + "\n") },
+		decode: func(text []byte) ([]byte, error) { return hex.DecodeString(string(bytes.TrimSpace(text))) }},
+	{name: "base64", encode: func(data []byte) []byte {
+		return []byte(base64.StdEncoding.EncodeToString(data) + "\n")
+	}, decode: func(text []byte) ([]byte, error) {
+		return base64.StdEncoding.DecodeString(string(bytes.TrimSpace(text)))
+	}},
+	{name: "go", encode: func(data []byte) []byte { return []byte(fmt.Sprintf("%q\n", data)) }},
+	{name: "gobytes", encode: func(data []byte) []byte { return []byte(formatGoBytes(data) + "\n") }},
+	{name: "c", encode: func(data []byte) []byte { return []byte(formatCArray(data) + "\n") }},
+	{name: "python", encode: func(data []byte) []byte { return []byte(formatPythonBytes(data) + "\n") }},
+	{name: "xxd", encode: func(data []byte) []byte { return []byte(Xxd(data)) },
+		decode: func(text []byte) ([]byte, error) { return ParseXxd(string(text)) }},
+	{name: "html", render: (*model).renderHTML},
+	{name: "markdown", render: (*model).renderMarkdown},
+}
+
+// exportData returns the bytes to export: the selection if there is one,
+// otherwise the whole buffer
+func (m *model) exportData() ([]byte, error) {
+	if m.selection.active {
+		return m.selectedBytes(), nil
+	}
+	if !m.requireMemory("Exporting") {
+		return nil, errors.New(m.status)
+	}
+	return m.data, nil
+}
+
+// export writes the selection or the whole buffer to path in the named
+// format and returns the number of bytes exported
+func (m *model) export(format, path string) (int, error) {
+	for _, f := range exportFormats {
+		if f.name != format {
+			continue
+		}
+		data, err := m.exportData()
+		if err != nil {
+			return 0, err
+		}
+		var out []byte
+		if f.render != nil {
+			start := 0
+			if m.selection.active {
+				start, _ = m.selection.bounds(m.cursor)
+			}
+			out = f.render(m, start, data)
+		} else {
+			out = f.encode(data)
+		}
+		if err := os.WriteFile(path, out, 0o644); err != nil {
+			return 0, err
+		}
+		return len(data), nil
+	}
+	return 0, fmt.Errorf("unknown export format %q", format)
+}
+
+// importFile replaces the buffer with the bytes decoded from the file at
+// path in the named format, e.g. an xxd dump, and returns how many there are
+func (m *model) importFile(format, path string) (int, error) {
+	for _, f := range exportFormats {
+		if f.name != format || f.decode == nil {
+			continue
+		}
+		text, err := os.ReadFile(path)
+		if err != nil {
+			return 0, err
+		}
+		data, err := f.decode(text)
+		if err != nil {
+			return 0, fmt.Errorf("%s: %v", path, err)
+		}
+		m.setData(data)
+		// Saving must not overwrite the dump with the bytes
+		m.path = ""
+		m.offset = 0
+		return len(data), nil
+	}
+	return 0, fmt.Errorf("unknown import format %q", format)
+}
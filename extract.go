@@ -0,0 +1,96 @@
+package prettybuffers
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// objectExtensions are the file extensions of extracted objects, by kind.
+// Kinds missing here are written as .bin.
+var objectExtensions = map[objectKind]string{
+	objectJSON: "json", objectMsgpack: "msgpack", objectUTF16: "txt", objectBase64: "b64",
+	objectHTTP: "http", objectCapture: "pcap", objectXML: "xml", objectYAML: "yaml",
+	objectForm: "txt", objectMultipart: "txt",
+}
+
+// compressedExtensions are the file extensions of compressed objects, by
+// their format
+var compressedExtensions = map[string]string{"gzip": "gz", "zlib": "zlib"}
+
+// extractedFile is a file an object is extracted to
+type extractedFile struct {
+	name string
+	data []byte
+}
+
+// extractedFiles returns the files obj is extracted to: its bytes, named by
+// offset and kind, and the decoded payload of encodings such as base64 or
+// MessagePack
+func extractedFiles(obj jsonObject) []extractedFile {
+	kind := strings.ToLower(obj.kind.String())
+	ext, ok := objectExtensions[obj.kind]
+	if obj.kind == objectCompressed {
+		kind = obj.encoding
+		ext, ok = compressedExtensions[obj.encoding]
+	}
+	if !ok {
+		ext = "bin"
+	}
+	base := fmt.Sprintf("%08x-%s", obj.startOffset, kind)
+	files := []extractedFile{{name: base + "." + ext, data: obj.data}}
+	switch {
+	case obj.kind == objectMsgpack:
+		files = append(files, extractedFile{name: base + ".decoded.json", data: obj.decoded})
+	case obj.decoded != nil:
+		files = append(files, extractedFile{name: base + ".decoded.bin", data: obj.decoded})
+	case obj.kind == objectUTF16:
+		if text, ok := obj.parsed.(string); ok {
+			files = append(files, extractedFile{name: base + ".decoded.txt", data: []byte(text)})
+		}
+	}
+	return files
+}
+
+// extractObjects writes every detected object to its own files in dir, see
+// extractedFiles, and returns how many objects were written
+func (m *model) extractObjects(dir string) (int, error) {
+	if len(m.jsonObjects) == 0 {
+		return 0, fmt.Errorf("no objects detected")
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return 0, err
+	}
+	for i, obj := range m.jsonObjects {
+		for _, f := range extractedFiles(obj) {
+			if err := os.WriteFile(filepath.Join(dir, f.name), f.data, 0o644); err != nil {
+				return i, err
+			}
+		}
+	}
+	return len(m.jsonObjects), nil
+}
+
+// ExtractDetections writes every object detected in the buffer of this
+// viewer to files in dir, which is created if needed. Each file is named by
+// the offset and type of its object, e.g. 00000040-base64.b64, and encoded
+// objects get a second file with their payload, e.g.
+// 00000040-base64.decoded.bin.
+func (v *Viewer) ExtractDetections(dir string) error {
+	var err error
+	v.inspect(func(m *model) {
+		_, err = m.extractObjects(dir)
+	})
+	return err
+}
+
+// ExtractDetections writes the objects detected in the buffer of the TUI
+// started by StartTUI to files in dir, see Viewer.ExtractDetections
+func ExtractDetections(dir string) error {
+	v := defaultViewer()
+	if v == nil {
+		return ErrNoViewer
+	}
+	return v.ExtractDetections(dir)
+}
@@ -0,0 +1,255 @@
+package prettybuffers
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/charmbracelet/bubbles/filepicker"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// save writes the buffer to path and marks it as unmodified
+func (m *model) save(path string) error {
+	if path == "" {
+		return fmt.Errorf("no file name")
+	}
+	if m.lazy {
+		if err := saveSource(path, m.src); err != nil {
+			return err
+		}
+	} else if err := os.WriteFile(path, m.data, 0o644); err != nil {
+		return err
+	}
+	m.path = path
+	m.edit.modified = nil
+	m.edit.resized = false
+	return nil
+}
+
+// saveCurrent saves to the file the buffer belongs to, or asks for a name
+func (m *model) saveCurrent() {
+	if !m.requireWritable("Saving") {
+		return
+	}
+	if m.path == "" {
+		m.openPrompt(promptCommand, ":")
+		m.prompt.input = "w "
+		return
+	}
+	m.reportSave(m.save(m.path))
+}
+
+// reportSave shows the outcome of a save in the status line
+func (m *model) reportSave(err error) {
+	if err != nil {
+		m.status = fmt.Sprintf("Save failed: %v", err)
+		return
+	}
+	m.status = fmt.Sprintf("Wrote %d bytes to %s", m.size(), m.path)
+}
+
+// saveSource streams a source that is not held in memory to path
+func saveSource(path string, src DataSource) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, io.NewSectionReader(src, 0, src.Len())); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// SaveAs writes the buffer shown in this viewer, including any edits, to path
+func (v *Viewer) SaveAs(path string) error {
+	var err error
+	v.inspect(func(m *model) {
+		err = m.save(path)
+	})
+	return err
+}
+
+// SaveAs writes the buffer shown in the TUI started by StartTUI to path
+func SaveAs(path string) error {
+	v := defaultViewer()
+	if v == nil {
+		return ErrNoViewer
+	}
+	return v.SaveAs(path)
+}
+
+// mmapThreshold is the file size from which files are memory-mapped instead of read
+const mmapThreshold = 16 << 20
+
+// fileMsg carries the contents of a file that was opened
+type fileMsg struct {
+	path  string
+	data  []byte
+	unmap func() error // releases data if it is memory-mapped, nil otherwise
+}
+
+// fileErrMsg reports a file that could not be opened
+type fileErrMsg struct {
+	err error
+}
+
+func (e fileErrMsg) Error() string {
+	return e.err.Error()
+}
+
+// loadFile reads path and returns a fileMsg, or a fileErrMsg on failure.
+// Large files are memory-mapped rather than read.
+func loadFile(path string) tea.Msg {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fileErrMsg{err}
+	}
+
+	if info.Size() >= mmapThreshold {
+		data, unmap, err := mapFile(path)
+		if err != nil {
+			return fileErrMsg{err}
+		}
+		return fileMsg{path: path, data: data, unmap: unmap}
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fileErrMsg{err}
+	}
+	return fileMsg{path: path, data: data}
+}
+
+// openFile shows the contents of a file that was opened. Mappings larger than
+// maxInMemorySize are read lazily like large sources, so that editing and
+// searching don't copy or scan all of it.
+func (m *model) openFile(msg fileMsg) {
+	if msg.unmap != nil && len(msg.data) > maxInMemorySize {
+		src := &mappedSource{data: msg.data, size: int64(len(msg.data)), unmap: msg.unmap}
+		m.setSource(sourceMsg{src: src, lazy: true})
+		m.unmap = src.close
+	} else {
+		m.setData(msg.data)
+		m.unmap = msg.unmap
+	}
+	m.path = msg.path
+	m.offset = 0
+	m.status = fmt.Sprintf("Opened %s (%d bytes)", msg.path, m.size())
+	if m.size() > maxDetectSize {
+		m.status += ", too large for JSON detection"
+	}
+}
+
+// mappedSource is a DataSource reading a memory-mapped file. The entropy
+// overview and the histogram may still be reading it in the background when
+// the buffer is replaced, so the mapping is only released once no read is in
+// progress, and reads fail from then on.
+type mappedSource struct {
+	mu    sync.RWMutex
+	data  []byte // nil once released
+	size  int64
+	unmap func() error
+}
+
+func (s *mappedSource) Len() int64 {
+	return s.size
+}
+
+func (s *mappedSource) ReadAt(p []byte, off int64) (int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.data == nil {
+		return 0, os.ErrClosed
+	}
+	return bytesSource(s.data).ReadAt(p, off)
+}
+
+// close releases the mapping once the reads in progress are done
+func (s *mappedSource) close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.data == nil {
+		return nil
+	}
+	s.data = nil
+	return s.unmap()
+}
+
+// startPicker shows the file picker in the directory of the current file
+func (m *model) startPicker() tea.Cmd {
+	if !m.requireLocal("Opening files") {
+		return nil
+	}
+	m.picker = filepicker.New()
+	m.picker.Height = max(1, m.height-4)
+	m.picker.ShowPermissions = false
+	m.picker.CurrentDirectory = "."
+	if m.path != "" {
+		m.picker.CurrentDirectory = filepath.Dir(m.path)
+	}
+	m.picking = true
+	return m.picker.Init()
+}
+
+// updatePicker forwards msg to the file picker. It reports whether the
+// message was fully handled; messages meant for the viewer itself (new data,
+// API calls) fall through to the regular update.
+func (m *model) updatePicker(msg tea.Msg) (tea.Cmd, bool) {
+	if key, ok := msg.(tea.KeyMsg); ok && (key.String() == "q" || key.String() == "ctrl+c") {
+		m.picking = false
+		return nil, true
+	}
+
+	var cmd tea.Cmd
+	m.picker, cmd = m.picker.Update(msg)
+	if ok, path := m.picker.DidSelectFile(msg); ok {
+		m.picking = false
+		return func() tea.Msg { return loadFile(path) }, true
+	}
+
+	_, isKey := msg.(tea.KeyMsg)
+	return cmd, isKey || cmd != nil
+}
+
+// pickerView renders the file picker
+func (m model) pickerView() string {
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("Open file: %s\n\n", m.picker.CurrentDirectory))
+	sb.WriteString(m.picker.View())
+	sb.WriteString("\nEnter to open, arrow keys to navigate, 'q' to cancel.")
+	return sb.String()
+}
+
+// OpenFile loads the file at path into this viewer
+func (v *Viewer) OpenFile(path string) error {
+	msg := loadFile(path)
+	if err, ok := msg.(fileErrMsg); ok {
+		return err.err
+	}
+	v.program.Send(msg)
+	return nil
+}
+
+// OpenFile loads the file at path into the TUI started by StartTUI
+func OpenFile(path string) error {
+	v := defaultViewer()
+	if v == nil {
+		return ErrNoViewer
+	}
+	return v.OpenFile(path)
+}
+
+// requireLocal reports whether files of this process may be used, or else
+// shows that the feature is not available to a remote user, see WithRemote
+func (m *model) requireLocal(feature string) bool {
+	if m.remote {
+		m.status = feature + " is not available in remote sessions"
+		return false
+	}
+	return true
+}
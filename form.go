@@ -0,0 +1,125 @@
+package prettybuffers
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// minFormFields is how many key=value pairs a run needs to be shown as a form,
+// as a single one is common in any text
+const minFormFields = 2
+
+// formField is a key=value pair of a URL-encoded form
+type formField struct {
+	start, end int // of the pair in the data
+	key, value string
+}
+
+// isFormKeyByte reports whether c may appear in a key of a URL-encoded form
+func isFormKeyByte(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || strings.IndexByte("-._~%+[]*", c) >= 0
+}
+
+// isFormValueByte reports whether c may appear in a value of a URL-encoded
+// form, which is looser than keys as clients leave more characters unescaped
+func isFormValueByte(c byte) bool {
+	return isFormKeyByte(c) || strings.IndexByte("=!'(),;:@/?|$", c) >= 0
+}
+
+// readFormFields reads the key=value pairs separated by & starting at pos, up
+// to the first that isn't one or doesn't decode
+func readFormFields(data []byte, pos int) []formField {
+	var fields []formField
+	for pos < len(data) {
+		start := pos
+		for pos < len(data) && isFormKeyByte(data[pos]) {
+			pos++
+		}
+		if pos == start || pos == len(data) || data[pos] != '=' {
+			break
+		}
+		eq := pos
+		pos++
+		for pos < len(data) && isFormValueByte(data[pos]) {
+			pos++
+		}
+		key, err := url.QueryUnescape(string(data[start:eq]))
+		if err != nil {
+			break
+		}
+		value, err := url.QueryUnescape(string(data[eq+1 : pos]))
+		if err != nil {
+			break
+		}
+		fields = append(fields, formField{start: start, end: pos, key: key, value: value})
+		if pos == len(data) || data[pos] != '&' {
+			break
+		}
+		pos++
+	}
+	return fields
+}
+
+// scanFormObjects finds URL-encoded forms such as a=1&b=2 in data starting at
+// from, skipping the ranges of the given objects. A form starts where a key
+// can't continue one before it, or after the ? of a URL. Like
+// scanUTF16Objects it returns the offset of a form that may continue in
+// appended data.
+func scanFormObjects(data []byte, from int, skip []jsonObject) ([]jsonObject, int) {
+	var objects []jsonObject
+	resume := len(data)
+	next := 0 // index into skip of the next object at or after i
+	for i := from; i < len(data); i++ {
+		if !isFormKeyByte(data[i]) || i > 0 && isFormValueByte(data[i-1]) && data[i-1] != '?' {
+			continue
+		}
+		for next < len(skip) && skip[next].endOffset < i {
+			next++
+		}
+		end := len(data)
+		if next < len(skip) {
+			if skip[next].startOffset <= i {
+				i = skip[next].endOffset
+				continue
+			}
+			end = skip[next].startOffset
+		}
+		fields := readFormFields(data[:end], i)
+		if len(fields) > 0 && fields[len(fields)-1].end >= len(data)-1 {
+			resume = min(resume, i)
+		}
+		if len(fields) < minFormFields {
+			if len(fields) > 0 {
+				i = fields[len(fields)-1].end - 1
+			}
+			continue
+		}
+		last := fields[len(fields)-1].end
+		objects = append(objects, newFormObject(data, i, last, fields))
+		i = last - 1
+	}
+	return objects, resume
+}
+
+// newFormObject describes the form from start up to end as a table of its
+// decoded fields, with a region for each one
+func newFormObject(data []byte, start, end int, fields []formField) jsonObject {
+	o := jsonObject{
+		startOffset: start,
+		endOffset:   end - 1,
+		data:        data[start:end],
+		kind:        objectForm,
+		summary:     []string{fmt.Sprintf("URL-encoded form, %d fields", len(fields))},
+	}
+	width := 0
+	for _, f := range fields {
+		width = max(width, len(sanitizeString(f.key)))
+	}
+	for _, f := range fields {
+		key, value := sanitizeString(f.key), sanitizeString(f.value)
+		o.summary = append(o.summary, fmt.Sprintf("  %-*s = %s", width, key, value))
+		o.regions = append(o.regions, region{start: f.start, end: f.end, label: fmt.Sprintf("Form field %s = %s", key, value)})
+	}
+	return o
+}
@@ -0,0 +1,161 @@
+package prettybuffers
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/charmbracelet/lipgloss"
+)
+
+// maxFrames limits how many frames a buffer is split into
+const maxFrames = 1 << 20
+
+// framing describes length-prefixed frames, see WithFraming
+type framing struct {
+	prefixSize     int
+	order          binary.ByteOrder
+	includesHeader bool // the length counts the prefix as well as the payload
+}
+
+// frame is a frame of the buffer, or a packet record of a capture file
+type frame struct {
+	start  int
+	end    int // one past the last byte
+	header int // length of the prefix or record header
+}
+
+// frameHeaderStyle marks the length prefix of each frame
+var frameHeaderStyle = lipgloss.NewStyle().Underline(true)
+
+// frameLength reads the length prefix at the start of header
+func (f framing) frameLength(header []byte) uint64 {
+	switch f.prefixSize {
+	case 1:
+		return uint64(header[0])
+	case 2:
+		return uint64(f.order.Uint16(header))
+	case 4:
+		return uint64(f.order.Uint32(header))
+	}
+	return f.order.Uint64(header)
+}
+
+// splitFrames continues splitting the buffer into frames from the end of the
+// last complete frame. It stops at a frame that runs past the end of the
+// buffer, which appended data may complete.
+func (m *model) splitFrames() {
+	if m.framing == nil {
+		return
+	}
+	f := *m.framing
+	size := m.size()
+	pos := m.framesEnd
+	for len(m.frames) < maxFrames && pos+f.prefixSize <= size {
+		n := f.frameLength(m.window(pos, f.prefixSize))
+		if !f.includesHeader {
+			n += uint64(f.prefixSize)
+		}
+		if n < uint64(f.prefixSize) || n > uint64(size-pos) {
+			break
+		}
+		m.frames = append(m.frames, frame{start: pos, end: pos + int(n), header: f.prefixSize})
+		pos += int(n)
+	}
+	m.framesEnd = pos
+}
+
+// resplitFrames splits the whole buffer into frames again after it changed.
+// Without framing, the chunks appended are used as frames, or else the
+// packets of a capture file.
+func (m *model) resplitFrames() {
+	m.frames, m.framesEnd = nil, 0
+	if m.framing != nil {
+		m.splitFrames()
+		return
+	}
+	if len(m.chunks) > 0 {
+		m.frames = append(m.frames, m.chunks...)
+		return
+	}
+	for _, o := range m.jsonObjects {
+		if o.kind == objectCapture && o.decoded != nil {
+			// The first regions are the record header and the packet data
+			m.frames = append(m.frames, frame{start: o.startOffset, end: o.regions[1].end, header: o.regions[0].end - o.startOffset})
+		}
+	}
+}
+
+// frameUnit names what the frames are
+func (m model) frameUnit() string {
+	switch {
+	case m.framing != nil:
+		return "frame"
+	case len(m.chunks) > 0:
+		return "chunk"
+	}
+	return "packet"
+}
+
+// frameAt returns the index of the frame containing pos, or -1
+func (m model) frameAt(pos int) int {
+	i := sort.Search(len(m.frames), func(i int) bool { return m.frames[i].end > pos })
+	if i < len(m.frames) && m.frames[i].start <= pos {
+		return i
+	}
+	return -1
+}
+
+// isFrameHeader reports whether pos is part of the length prefix of a frame
+func (m model) isFrameHeader(pos int) bool {
+	i := m.frameAt(pos)
+	return i >= 0 && pos < m.frames[i].start+m.frames[i].header
+}
+
+// frameInfo describes the frame under the cursor for the footer
+func (m model) frameInfo() string {
+	i := m.frameAt(m.cursor)
+	if i < 0 {
+		return ""
+	}
+	fr := m.frames[i]
+	return fmt.Sprintf("[%s %d/%d 0x%X-0x%X, %d byte payload]", m.frameUnit(), i+1, len(m.frames), fr.start, fr.end-1,
+		fr.end-fr.start-fr.header)
+}
+
+// nextFrameOrObject moves to the next or previous frame, or to the next or
+// previous detected object when there is no framing and there are no frames
+func (m *model) nextFrameOrObject(backwards bool) {
+	if m.framing == nil && len(m.frames) == 0 {
+		m.nextObject(backwards)
+		return
+	}
+	m.nextFrame(backwards)
+}
+
+// nextFrame moves the cursor to the start of the next or previous frame
+func (m *model) nextFrame(backwards bool) {
+	if m.framing == nil && len(m.frames) == 0 {
+		m.status = "No framing configured and no capture or chunks loaded, see WithFraming"
+		return
+	}
+	var i int
+	if backwards {
+		i = sort.Search(len(m.frames), func(i int) bool { return m.frames[i].start >= m.cursor }) - 1
+	} else {
+		i = sort.Search(len(m.frames), func(i int) bool { return m.frames[i].start > m.cursor })
+	}
+	if i < 0 || i >= len(m.frames) {
+		if m.framing != nil && m.framesEnd < m.size() && !backwards {
+			m.status = fmt.Sprintf("No more frames, the frame at 0x%08X is incomplete", m.framesEnd)
+		} else {
+			m.status = fmt.Sprintf("No more %ss", m.frameUnit())
+		}
+		return
+	}
+	fr := m.frames[i]
+	m.moveCursor(fr.start - m.cursor)
+	m.status = fmt.Sprintf("%s %d of %d at 0x%08X, %d byte payload", strings.ToUpper(m.frameUnit()[:1])+m.frameUnit()[1:],
+		i+1, len(m.frames), fr.start, fr.end-fr.start-fr.header)
+}
@@ -0,0 +1,152 @@
+package prettybuffers
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/binary"
+	"fmt"
+	"reflect"
+)
+
+// structLayout lays a Go value out over the buffer by the rules of
+// encoding/binary: fields in order without padding, blank fields skipped and
+// slices as long as in the value
+type structLayout struct {
+	read   func(off, n int) []byte
+	order  binary.ByteOrder
+	pos    int
+	fields []region
+}
+
+// layoutStruct annotates the buffer from offset with the fields of v
+func layoutStruct(read func(off, n int) []byte, size, offset int, v reflect.Value, order binary.ByteOrder) ([]structure, error) {
+	name := v.Type().Name()
+	if name == "" {
+		name = v.Type().String()
+	}
+	if end := offset + binary.Size(v.Interface()); end > size {
+		return nil, fmt.Errorf("%s at 0x%X runs past the end of the buffer", name, offset)
+	}
+	l := &structLayout{read: read, order: order, pos: offset}
+	if err := l.value(v, name); err != nil {
+		return nil, err
+	}
+	return []structure{{start: offset, end: l.pos, name: name, fields: l.fields, styled: true}}, nil
+}
+
+// value adds the fields of v, named after path
+func (l *structLayout) value(v reflect.Value, path string) error {
+	t := v.Type()
+	if len(l.fields) == maxTemplateFields {
+		return fmt.Errorf("more than %d fields at %s", maxTemplateFields, path)
+	}
+	switch t.Kind() {
+	case reflect.Struct:
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if f.Name == "_" {
+				// Skipped by encoding/binary, like padding
+				n := binary.Size(reflect.Zero(f.Type).Interface())
+				l.fields = append(l.fields, region{start: l.pos, end: l.pos + n, label: path + "._ (padding)"})
+				l.pos += n
+				continue
+			}
+			if err := l.value(v.Field(i), path+"."+f.Name); err != nil {
+				return err
+			}
+		}
+		return nil
+	case reflect.Array, reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 && !t.Elem().Implements(stringerType) {
+			// Byte arrays are one field
+			raw := l.read(l.pos, v.Len())
+			preview := formatHexBytes(raw[:min(decodedPreviewBytes, len(raw))], min(decodedPreviewBytes, len(raw)))
+			if len(raw) > decodedPreviewBytes {
+				preview += " ..."
+			}
+			l.fields = append(l.fields, region{start: l.pos, end: l.pos + len(raw), label: fmt.Sprintf("%s %s = %s", path, t, preview)})
+			l.pos += len(raw)
+			return nil
+		}
+		for i := 0; i < v.Len(); i++ {
+			if err := l.value(v.Index(i), fmt.Sprintf("%s[%d]", path, i)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	// Decode the field from the buffer into a value of its type, so named
+	// types show their String method
+	n := int(t.Size())
+	ptr := reflect.New(t)
+	if err := binary.Read(bytes.NewReader(l.read(l.pos, n)), l.order, ptr.Interface()); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	value := fmt.Sprint(ptr.Elem().Interface())
+	if !t.Implements(stringerType) {
+		switch t.Kind() {
+		case reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			if u := ptr.Elem().Uint(); u >= 10 {
+				value += fmt.Sprintf(" (0x%X)", u)
+			}
+		}
+	}
+	l.fields = append(l.fields, region{start: l.pos, end: l.pos + n, label: fmt.Sprintf("%s %s = %s", path, t, value)})
+	l.pos += n
+	return nil
+}
+
+// stringerType is the type of fmt.Stringer
+var stringerType = reflect.TypeOf((*fmt.Stringer)(nil)).Elem()
+
+// overlayStruct lays v out over the buffer from offset and keeps it applied
+// as the buffer changes
+func (m *model) overlayStruct(offset int, v interface{}, order binary.ByteOrder) error {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Pointer && !rv.IsNil() {
+		rv = rv.Elem()
+	}
+	if !rv.IsValid() || binary.Size(rv.Interface()) < 0 {
+		return fmt.Errorf("%T has no fixed-size binary layout", v)
+	}
+	if offset < 0 || offset >= m.size() {
+		return fmt.Errorf("offset %d is outside the buffer", offset)
+	}
+	structures, err := layoutStruct(m.window, m.size(), offset, rv, cmp.Or(order, m.byteOrder))
+	if err != nil {
+		return err
+	}
+	m.overlays = append(m.overlays, func(read func(off, n int) []byte, size int, viewerOrder binary.ByteOrder) []structure {
+		structures, _ := layoutStruct(read, size, offset, rv, cmp.Or(order, viewerOrder))
+		return structures
+	})
+	m.parseStructures()
+	s := structures[0]
+	m.status = fmt.Sprintf("Struct %s overlaid at 0x%08X: %d fields up to 0x%08X", s.name, offset, len(s.fields), s.end)
+	return nil
+}
+
+// OverlayStruct annotates the buffer of this viewer from offset with the
+// fields of value and their values decoded in the given byte order, or in
+// that of the viewer if nil, see WithByteOrder. value is
+// a struct, a slice of structs or a pointer to either, laid out as by
+// encoding/binary, so it may only hold fixed-size types. Like templates, the
+// struct stays applied until ClearOverlays is called.
+func (v *Viewer) OverlayStruct(offset int, value interface{}, order binary.ByteOrder) error {
+	var err error
+	v.inspect(func(m *model) {
+		err = m.overlayStruct(offset, value, order)
+	})
+	return err
+}
+
+// OverlayStruct overlays a struct in the TUI started by StartTUI, see
+// Viewer.OverlayStruct
+func OverlayStruct(offset int, v interface{}, order binary.ByteOrder) error {
+	viewer := defaultViewer()
+	if viewer == nil {
+		return ErrNoViewer
+	}
+	return viewer.OverlayStruct(offset, v, order)
+}
@@ -0,0 +1,330 @@
+// Package grpcmirror mirrors the messages of gRPC calls into a viewer of
+// package prettybuffers through interceptors and a codec, so that programs
+// not using gRPC don't have to build it along with the viewer.
+package grpcmirror
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/fipso/prettybuffers"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/proto"
+)
+
+// grpcCapture mirrors the messages of gRPC calls into a viewer, the one
+// started by StartTUI at the time if v is nil. With codec set, the bytes the
+// codec encoded or decoded are mirrored; otherwise messages are encoded again.
+type grpcCapture struct {
+	v     *prettybuffers.Viewer
+	codec *wireCodec
+}
+
+// send appends data to the viewer, labeled with the method it belongs to
+func (c grpcCapture) send(data []byte, method, kind string, color prettybuffers.Color) {
+	label := fmt.Sprintf("%s %s, %d bytes", method, kind, len(data))
+	if c.v != nil {
+		c.v.AppendChunk(data, label, color)
+	} else {
+		prettybuffers.AppendChunk(data, label, color)
+	}
+}
+
+// mirror appends the encoding of msg to the viewer, labeled with the method
+// it belongs to. Interceptors only see unmarshaled messages, so protobuf
+// messages are marshaled again and others are skipped.
+func (c grpcCapture) mirror(msg interface{}, method, kind string, color prettybuffers.Color) {
+	pm, ok := msg.(proto.Message)
+	if !ok {
+		return
+	}
+	data, err := proto.Marshal(pm)
+	if err != nil {
+		return
+	}
+	c.send(data, method, kind, color)
+}
+
+// sending mirrors msg, which is about to be sent. With a codec it is
+// mirrored once the codec encoded it.
+func (c grpcCapture) sending(msg interface{}, method, kind string, color prettybuffers.Color) {
+	if c.codec == nil {
+		c.mirror(msg, method, kind, color)
+		return
+	}
+	c.codec.expect(msg, wireLabel{method: method, kind: kind, color: color})
+}
+
+// sent forgets msg if the codec didn't encode it after all
+func (c grpcCapture) sent(msg interface{}) {
+	if c.codec != nil {
+		c.codec.expect(msg, wireLabel{})
+	}
+}
+
+// received mirrors msg, which was just received, as the codec decoded it
+func (c grpcCapture) received(msg interface{}, method, kind string, color prettybuffers.Color) {
+	if c.codec == nil {
+		c.mirror(msg, method, kind, color)
+		return
+	}
+	if data, ok := c.codec.take(msg); ok {
+		c.send(data, method, kind, color)
+	}
+}
+
+// maxPendingMessages bounds the messages a codec keeps for interceptors.
+// Those of calls that other interceptors ended early are never picked up, so
+// they are dropped once there are this many.
+const maxPendingMessages = 1024
+
+// wireLabel is how to label a message once the codec encoded it
+type wireLabel struct {
+	method, kind string
+	color        prettybuffers.Color
+}
+
+// wireCodec is the protobuf codec of gRPC, keeping the bytes it decodes and
+// mirroring those it encodes, so that the viewer shows the messages as they
+// went over the wire
+type wireCodec struct {
+	capture  grpcCapture
+	mu       sync.Mutex
+	expected map[proto.Message]wireLabel // to mirror once encoded
+	decoded  map[proto.Message][]byte    // until taken by an interceptor
+}
+
+// expect mirrors msg with the given label once encoded, or forgets it if
+// the label is empty
+func (w *wireCodec) expect(msg interface{}, label wireLabel) {
+	pm, ok := msg.(proto.Message)
+	if !ok {
+		return
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if label.method == "" {
+		delete(w.expected, pm)
+		return
+	}
+	if len(w.expected) >= maxPendingMessages {
+		clear(w.expected)
+	}
+	w.expected[pm] = label
+}
+
+// take returns and forgets the bytes msg was decoded from
+func (w *wireCodec) take(msg interface{}) ([]byte, bool) {
+	pm, ok := msg.(proto.Message)
+	if !ok {
+		return nil, false
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	data, ok := w.decoded[pm]
+	delete(w.decoded, pm)
+	return data, ok
+}
+
+// Marshal implements encoding.Codec
+func (w *wireCodec) Marshal(v interface{}) ([]byte, error) {
+	pm, ok := v.(proto.Message)
+	if !ok {
+		return nil, fmt.Errorf("failed to marshal, message is %T, want proto.Message", v)
+	}
+	data, err := proto.Marshal(pm)
+	if err != nil {
+		return nil, err
+	}
+	w.mu.Lock()
+	label, ok := w.expected[pm]
+	delete(w.expected, pm)
+	w.mu.Unlock()
+	if ok {
+		w.capture.send(data, label.method, label.kind, label.color)
+	}
+	return data, nil
+}
+
+// Unmarshal implements encoding.Codec
+func (w *wireCodec) Unmarshal(data []byte, v interface{}) error {
+	pm, ok := v.(proto.Message)
+	if !ok {
+		return fmt.Errorf("failed to unmarshal, message is %T, want proto.Message", v)
+	}
+	if err := proto.Unmarshal(data, pm); err != nil {
+		return err
+	}
+	w.mu.Lock()
+	if len(w.decoded) >= maxPendingMessages {
+		clear(w.decoded)
+	}
+	w.decoded[pm] = append([]byte(nil), data...)
+	w.mu.Unlock()
+	return nil
+}
+
+// Name implements encoding.Codec, replacing the protobuf codec
+func (w *wireCodec) Name() string {
+	return "proto"
+}
+
+// newWireCapture returns a capture mirroring messages through a codec of its
+// own, see ServerOptions and DialOptions
+func newWireCapture(v *prettybuffers.Viewer) grpcCapture {
+	codec := &wireCodec{expected: make(map[proto.Message]wireLabel), decoded: make(map[proto.Message][]byte)}
+	codec.capture = grpcCapture{v: v}
+	return grpcCapture{v: v, codec: codec}
+}
+
+// unaryServer mirrors the request and response of a unary call handled here
+func (c grpcCapture) unaryServer(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	c.received(req, info.FullMethod, "request", prettybuffers.ReceivedColor)
+	resp, err := handler(ctx, req)
+	if err == nil {
+		// The response is encoded once returned
+		c.sending(resp, info.FullMethod, "response", prettybuffers.SentColor)
+	}
+	return resp, err
+}
+
+// streamServer mirrors the messages of a streaming call handled here
+func (c grpcCapture) streamServer(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	return handler(srv, mirroredServerStream{ServerStream: ss, capture: c, method: info.FullMethod})
+}
+
+// unaryClient mirrors the request and response of a unary call made here
+func (c grpcCapture) unaryClient(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	c.sending(req, method, "request", prettybuffers.SentColor)
+	err := invoker(ctx, method, req, reply, cc, opts...)
+	c.sent(req)
+	if err == nil {
+		c.received(reply, method, "response", prettybuffers.ReceivedColor)
+	}
+	return err
+}
+
+// streamClient mirrors the messages of a streaming call made here
+func (c grpcCapture) streamClient(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+	cs, err := streamer(ctx, desc, cc, method, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return mirroredClientStream{ClientStream: cs, capture: c, method: method}, nil
+}
+
+// mirroredServerStream is a server stream whose messages are mirrored
+type mirroredServerStream struct {
+	grpc.ServerStream
+	capture grpcCapture
+	method  string
+}
+
+// RecvMsg implements grpc.ServerStream, mirroring each request
+func (s mirroredServerStream) RecvMsg(m interface{}) error {
+	err := s.ServerStream.RecvMsg(m)
+	if err == nil {
+		s.capture.received(m, s.method, "request", prettybuffers.ReceivedColor)
+	}
+	return err
+}
+
+// SendMsg implements grpc.ServerStream, mirroring each response
+func (s mirroredServerStream) SendMsg(m interface{}) error {
+	s.capture.sending(m, s.method, "response", prettybuffers.SentColor)
+	err := s.ServerStream.SendMsg(m)
+	s.capture.sent(m)
+	return err
+}
+
+// mirroredClientStream is a client stream whose messages are mirrored
+type mirroredClientStream struct {
+	grpc.ClientStream
+	capture grpcCapture
+	method  string
+}
+
+// SendMsg implements grpc.ClientStream, mirroring each request
+func (s mirroredClientStream) SendMsg(m interface{}) error {
+	s.capture.sending(m, s.method, "request", prettybuffers.SentColor)
+	err := s.ClientStream.SendMsg(m)
+	s.capture.sent(m)
+	return err
+}
+
+// RecvMsg implements grpc.ClientStream, mirroring each response
+func (s mirroredClientStream) RecvMsg(m interface{}) error {
+	err := s.ClientStream.RecvMsg(m)
+	if err == nil {
+		s.capture.received(m, s.method, "response", prettybuffers.ReceivedColor)
+	}
+	return err
+}
+
+// ServerOptions returns the options that make a server append the bytes of
+// each request and response of its calls to the buffer of v as they went
+// over the wire, annotated with the full method name, e.g.
+//
+//	grpc.NewServer(grpcmirror.ServerOptions(v)...)
+//
+// They replace the protobuf codec of the server with one keeping the bytes
+// it decodes and encodes. With v nil the messages go to the TUI started by
+// StartTUI at the time of the call.
+func ServerOptions(v *prettybuffers.Viewer) []grpc.ServerOption {
+	c := newWireCapture(v)
+	return []grpc.ServerOption{
+		grpc.ForceServerCodec(c.codec),
+		grpc.ChainUnaryInterceptor(c.unaryServer),
+		grpc.ChainStreamInterceptor(c.streamServer),
+	}
+}
+
+// DialOptions returns the options that make a client connection append the
+// bytes of each request and response of its calls to the buffer of v as
+// they went over the wire, like ServerOptions
+func DialOptions(v *prettybuffers.Viewer) []grpc.DialOption {
+	c := newWireCapture(v)
+	return []grpc.DialOption{
+		grpc.WithDefaultCallOptions(grpc.ForceCodec(c.codec)),
+		grpc.WithChainUnaryInterceptor(c.unaryClient),
+		grpc.WithChainStreamInterceptor(c.streamClient),
+	}
+}
+
+// UnaryServerInterceptor returns an interceptor that appends the protobuf
+// encoding of each request and response of unary calls to the buffer of v,
+// annotated with the full method name, e.g.
+//
+//	grpc.NewServer(grpc.UnaryInterceptor(grpcmirror.UnaryServerInterceptor(v)))
+//
+// Interceptors only see unmarshaled messages, so they marshal them again,
+// which may order fields differently than on the wire or drop unknown ones.
+// ServerOptions captures the bytes as they were sent. With v nil they go to
+// the TUI started by StartTUI at the time of the call.
+func UnaryServerInterceptor(v *prettybuffers.Viewer) grpc.UnaryServerInterceptor {
+	return grpcCapture{v: v}.unaryServer
+}
+
+// StreamServerInterceptor returns an interceptor that appends each message of
+// streaming calls to the buffer of v, like UnaryServerInterceptor
+func StreamServerInterceptor(v *prettybuffers.Viewer) grpc.StreamServerInterceptor {
+	return grpcCapture{v: v}.streamServer
+}
+
+// UnaryClientInterceptor returns an interceptor that appends the protobuf
+// encoding of each request and response of unary calls made through a client
+// connection to the buffer of v, annotated with the method name. Like
+// UnaryServerInterceptor it marshals them again; DialOptions captures the
+// bytes as they were sent. With v nil they go to the TUI started by StartTUI
+// at the time of the call.
+func UnaryClientInterceptor(v *prettybuffers.Viewer) grpc.UnaryClientInterceptor {
+	return grpcCapture{v: v}.unaryClient
+}
+
+// StreamClientInterceptor returns an interceptor that appends each message of
+// streaming calls made through a client connection to the buffer of v, like
+// UnaryClientInterceptor
+func StreamClientInterceptor(v *prettybuffers.Viewer) grpc.StreamClientInterceptor {
+	return grpcCapture{v: v}.streamClient
+}
@@ -0,0 +1,123 @@
+package prettybuffers
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/key"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// Hashes holds the checksums of a range of the buffer, hex-encoded
+type Hashes struct {
+	CRC32  string // IEEE polynomial
+	MD5    string
+	SHA1   string
+	SHA256 string
+}
+
+// digests returns the names and values of the hashes in display order
+func (h Hashes) digests() [][2]string {
+	return [][2]string{{"CRC32", h.CRC32}, {"MD5", h.MD5}, {"SHA-1", h.SHA1}, {"SHA-256", h.SHA256}}
+}
+
+// hashPopup is the result of hashing the selection, shown until dismissed
+type hashPopup struct {
+	r      Range
+	hashes Hashes
+}
+
+// hashRange computes the hashes of the bytes in r, reading the buffer in chunks
+func (m model) hashRange(r Range) (Hashes, error) {
+	if r.Start < 0 || r.End > m.size() || r.Start > r.End {
+		return Hashes{}, fmt.Errorf("range 0x%X-0x%X is outside the buffer", r.Start, r.End)
+	}
+	c, md, s1, s256 := crc32.NewIEEE(), md5.New(), sha1.New(), sha256.New()
+	all := []hash.Hash{c, md, s1, s256}
+	for off := r.Start; off < r.End; off += scanChunkSize {
+		chunk := m.window(off, min(scanChunkSize, r.End-off))
+		for _, h := range all {
+			h.Write(chunk)
+		}
+	}
+	return Hashes{
+		CRC32:  hex.EncodeToString(c.Sum(nil)),
+		MD5:    hex.EncodeToString(md.Sum(nil)),
+		SHA1:   hex.EncodeToString(s1.Sum(nil)),
+		SHA256: hex.EncodeToString(s256.Sum(nil)),
+	}, nil
+}
+
+// hashSelection hashes the selected bytes and shows the result
+func (m *model) hashSelection() error {
+	if !m.selection.active {
+		return fmt.Errorf("select the bytes to hash first")
+	}
+	first, last := m.selection.bounds(m.cursor)
+	r := Range{Start: first, End: last + 1}
+	hashes, err := m.hashRange(r)
+	if err != nil {
+		return err
+	}
+	m.hashes = &hashPopup{r: r, hashes: hashes}
+	return nil
+}
+
+// updateHashes handles a key press while the hashes are shown. The digits
+// copy the hash on that line.
+func (m *model) updateHashes(msg tea.KeyMsg) tea.Cmd {
+	if key.Matches(msg, m.keys.Quit) {
+		return m.quit()
+	}
+	digests := m.hashes.hashes.digests()
+	if s := msg.String(); len(s) == 1 && s[0] >= '1' && int(s[0]-'1') < len(digests) {
+		d := digests[s[0]-'1']
+		m.hashes = nil
+		m.status = fmt.Sprintf("Copied %s %s", d[0], d[1])
+		return m.copyToClipboard(d[1])
+	}
+	m.hashes = nil
+	return nil
+}
+
+// hashView shows the hashes in a box in the middle of the screen
+func (m model) hashView() string {
+	var sb strings.Builder
+	sb.WriteString(m.theme.Header.Render(fmt.Sprintf("Hashes of 0x%08X-0x%08X (%d bytes)",
+		m.hashes.r.Start, m.hashes.r.End, m.hashes.r.End-m.hashes.r.Start)))
+	sb.WriteString("\n")
+	for i, d := range m.hashes.hashes.digests() {
+		sb.WriteString(fmt.Sprintf("\n[%d] %-8s %s", i+1, d[0], m.theme.Hex.Render(d[1])))
+	}
+	sb.WriteString("\n\n" + m.theme.Footer.Render("Press a number to copy that hash, any other key to close."))
+
+	box := lipgloss.NewStyle().Border(lipgloss.RoundedBorder()).Padding(0, 1).Render(sb.String())
+	return lipgloss.Place(m.width, m.height, lipgloss.Center, lipgloss.Center, box)
+}
+
+// HashRange returns the CRC32, MD5, SHA-1 and SHA-256 of the bytes in r
+func (v *Viewer) HashRange(r Range) (Hashes, error) {
+	var hashes Hashes
+	var err error
+	v.inspect(func(m *model) {
+		hashes, err = m.hashRange(r)
+	})
+	return hashes, err
+}
+
+// HashRange hashes part of the buffer of the TUI started by StartTUI, see
+// Viewer.HashRange
+func HashRange(r Range) (Hashes, error) {
+	v := defaultViewer()
+	if v == nil {
+		return Hashes{}, ErrNoViewer
+	}
+	return v.HashRange(r)
+}
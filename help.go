@@ -0,0 +1,55 @@
+package prettybuffers
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/key"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// helpColumnGap is the space between groups of the help overlay
+const helpColumnGap = 4
+
+// updateHelp handles a key press while the help overlay is shown
+func (m *model) updateHelp(msg tea.KeyMsg) tea.Cmd {
+	switch {
+	case key.Matches(msg, m.keys.Quit):
+		return m.quit()
+	case key.Matches(msg, m.keys.Help), key.Matches(msg, m.keys.Cancel):
+		m.showHelp = false
+	}
+	return nil
+}
+
+// helpView lists the key bindings grouped by feature, with as many groups
+// side by side as fit the terminal width
+func (m model) helpView() string {
+	var rows []string
+	var row []string
+	rowWidth := 0
+	for _, group := range m.keys.groups() {
+		var sb strings.Builder
+		sb.WriteString(m.theme.Header.Render(group.title))
+		for _, b := range group.bindings {
+			if !b.Enabled() {
+				continue
+			}
+			sb.WriteString(fmt.Sprintf("\n%-10s %s", b.Help().Key, b.Help().Desc))
+		}
+
+		block := lipgloss.NewStyle().PaddingRight(helpColumnGap).Render(sb.String())
+		if len(row) > 0 && rowWidth+lipgloss.Width(block) > m.width {
+			rows = append(rows, lipgloss.JoinHorizontal(lipgloss.Top, row...))
+			row, rowWidth = nil, 0
+		}
+		row = append(row, block)
+		rowWidth += lipgloss.Width(block)
+	}
+	rows = append(rows, lipgloss.JoinHorizontal(lipgloss.Top, row...))
+
+	return m.theme.Header.Render("Key bindings") + "\n\n" +
+		strings.Join(rows, "\n\n") + "\n" +
+		m.footer(fmt.Sprintf("Press '%s' or '%s' to close help.", m.keys.Help.Help().Key, m.keys.Cancel.Help().Key))
+}
@@ -0,0 +1,80 @@
+package prettybuffers
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/charmbracelet/lipgloss"
+)
+
+// hasHighlights reports whether any byte may need styling
+func (m model) hasHighlights() bool {
+	return len(m.search.matches) > 0 || m.cursorActive() ||
+		len(m.edit.modified) > 0 || len(m.annotations) > 0 || len(m.highlights) > 0 ||
+		len(m.frames) > 0 || len(m.structures) > 0 || (m.times != timesHidden && len(m.arrivals) > 0)
+}
+
+// cursorActive reports whether the cursor is shown, which is whenever there
+// is a byte for it to sit on
+func (m model) cursorActive() bool {
+	return m.size() > 0 || m.edit.active
+}
+
+// highlight renders the text for the byte at pos, styled by whatever covers it:
+// the cursor, the selection, an edit, a search match or highlights and
+// annotations, in that order of precedence. Otherwise the column's base style is used.
+func (m model) highlight(pos int, text string, base lipgloss.Style) string {
+	if m.cursorActive() && pos == m.cursor {
+		return m.theme.Cursor.Render(text)
+	}
+	if m.selection.active && m.selection.contains(pos, m.cursor) {
+		return m.theme.Selection.Render(text)
+	}
+	if _, ok := m.edit.modified[pos]; ok {
+		return m.theme.Modified.Render(text)
+	}
+	if len(m.search.matches) > 0 {
+		if i := m.matchAt(pos); i == m.search.current {
+			return m.theme.CurrentMatch.Render(text)
+		} else if i >= 0 {
+			return m.theme.Match.Render(text)
+		}
+	}
+	if style, ok := m.layeredStyle(pos); ok {
+		return style.Inherit(base).Render(text)
+	}
+	return base.Render(text)
+}
+
+// highlightHexBytes is formatDynamicHexBytes with highlighting applied,
+// where data starts at offset in the buffer
+func (m model) highlightHexBytes(data []byte, offset int, colWidth int) string {
+	if !m.hasHighlights() {
+		return m.theme.Hex.Render(formatDynamicHexBytes(data, colWidth))
+	}
+
+	var sb strings.Builder
+	shown := min(len(data), colWidth/3)
+	for i := 0; i < shown; i++ {
+		sb.WriteString(m.highlight(offset+i, fmt.Sprintf("%02X", data[i]), m.theme.Hex))
+		sb.WriteRune(' ')
+	}
+	if pad := colWidth - shown*3; pad > 0 {
+		sb.WriteString(strings.Repeat(" ", pad))
+	}
+	return sb.String()
+}
+
+// highlightASCIIBytes is formatASCIIBytes with highlighting applied,
+// where data starts at offset in the buffer
+func (m model) highlightASCIIBytes(data []byte, offset int) string {
+	if !m.hasHighlights() {
+		return m.theme.ASCII.Render(formatASCIIBytes(data))
+	}
+
+	var sb strings.Builder
+	for i := range data {
+		sb.WriteString(m.highlight(offset+i, formatASCIIBytes(data[i:i+1]), m.theme.ASCII))
+	}
+	return sb.String()
+}
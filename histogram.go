@@ -0,0 +1,183 @@
+package prettybuffers
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/key"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// histogramTop is how many of the most frequent byte values are listed
+const histogramTop = 16
+
+// histogram counts how often each byte value occurs in part of the buffer
+type histogram struct {
+	start, end int // counted range, end exclusive
+	counts     [256]int
+	pending    bool // the bytes are being counted in the background
+}
+
+// histogramMsg delivers a histogram counted in the background
+type histogramMsg histogram
+
+// countBytes counts the bytes of src from off up to end
+func countBytes(src DataSource, off, end int) [256]int {
+	var counts [256]int
+	buf := make([]byte, scanChunkSize)
+	for ; off < end; off += scanChunkSize {
+		n, _ := src.ReadAt(buf[:min(scanChunkSize, end-off)], int64(off))
+		for _, b := range buf[:n] {
+			counts[b]++
+		}
+	}
+	return counts
+}
+
+// openHistogram shows the histogram of the selection, or of the whole
+// buffer. Like the entropy overview, small ranges are counted right away and
+// large ones in the background.
+func (m *model) openHistogram() tea.Cmd {
+	if m.size() == 0 {
+		return nil
+	}
+	start, end := 0, m.size()
+	if m.selection.active {
+		first, last := m.selection.bounds(m.cursor)
+		start, end = first, last+1
+	}
+	m.histogram = &histogram{start: start, end: end}
+	var src DataSource
+	off := start
+	if m.lazy {
+		src = m.src
+	} else if end-start <= entropySyncSize {
+		m.histogram.counts = countBytes(bytesSource(m.data), start, end)
+		return nil
+	} else {
+		// Edits change data in place, so work on a copy
+		src, off = bytesSource(append([]byte(nil), m.data[start:end]...)), 0
+	}
+
+	m.histogram.pending = true
+	return func() tea.Msg {
+		return histogramMsg{start: start, end: end, counts: countBytes(src, off, off+end-start)}
+	}
+}
+
+// setHistogram shows a histogram counted in the background, unless the one
+// it was counted for was closed since
+func (m *model) setHistogram(msg histogramMsg) {
+	if h := m.histogram; h != nil && h.pending && h.start == msg.start && h.end == msg.end {
+		h.counts, h.pending = msg.counts, false
+	}
+}
+
+// updateHistogram handles a key press while the histogram is shown
+func (m *model) updateHistogram(msg tea.KeyMsg) tea.Cmd {
+	switch {
+	case key.Matches(msg, m.keys.Quit):
+		return m.quit()
+	case key.Matches(msg, m.keys.Histogram), key.Matches(msg, m.keys.Cancel):
+		m.histogram = nil
+	}
+	return nil
+}
+
+// total returns the number of bytes counted
+func (h *histogram) total() int {
+	return h.end - h.start
+}
+
+// share returns the fraction of bytes for which match is true
+func (h *histogram) share(match func(b byte) bool) float64 {
+	n := 0
+	for b, c := range h.counts {
+		if match(byte(b)) {
+			n += c
+		}
+	}
+	return float64(n) / float64(max(1, h.total()))
+}
+
+// histogramView shows the counts of all byte values as a 16x16 grid of bars,
+// next to the most frequent values and a breakdown of the kind of bytes
+func (m model) histogramView() string {
+	h := m.histogram
+	title := m.theme.Header.Render(fmt.Sprintf("Byte histogram of 0x%08X-0x%08X (%d bytes)", h.start, h.end, h.total()))
+	footer := m.footer(fmt.Sprintf("Press '%s' or '%s' to close the histogram.",
+		m.keys.Histogram.Help().Key, m.keys.Cancel.Help().Key))
+	if h.pending {
+		return title + "\n\nCounting bytes...\n\n" + footer
+	}
+	peak, distinct := 0, 0
+	for _, c := range h.counts {
+		peak = max(peak, c)
+		if c > 0 {
+			distinct++
+		}
+	}
+
+	// The grid has a row per high nibble and a column per low nibble
+	var grid strings.Builder
+	grid.WriteString(m.theme.Header.Render("   " + strings.Join(strings.Split("0123456789ABCDEF", ""), " ")))
+	for hi := 0; hi < 16; hi++ {
+		grid.WriteString("\n" + m.theme.Offset.Render(fmt.Sprintf("%X_", hi)))
+		for lo := 0; lo < 16; lo++ {
+			c := h.counts[hi<<4|lo]
+			cell := " "
+			if c > 0 {
+				ratio := float64(c) / float64(peak)
+				cell = m.theme.entropyStyle(ratio).Render(entropyBar(ratio))
+			}
+			grid.WriteString(" " + cell)
+		}
+	}
+
+	values := make([]int, 256)
+	for i := range values {
+		values[i] = i
+	}
+	sort.SliceStable(values, func(i, j int) bool { return h.counts[values[i]] > h.counts[values[j]] })
+	var top strings.Builder
+	top.WriteString(m.theme.Header.Render("Most frequent"))
+	barWidth := 20
+	for _, b := range values[:histogramTop] {
+		c := h.counts[b]
+		if c == 0 {
+			break
+		}
+		bar := strings.Repeat("█", max(1, c*barWidth/peak))
+		top.WriteString(fmt.Sprintf("\n%s %s %6.2f%% %s",
+			m.theme.Hex.Render(fmt.Sprintf("%02X", b)),
+			m.theme.ASCII.Render(formatASCIIBytes([]byte{byte(b)})),
+			float64(c)*100/float64(h.total()), m.theme.Offset.Render(bar)))
+	}
+
+	var summary strings.Builder
+	summary.WriteString(m.theme.Header.Render("Composition"))
+	for _, kind := range []struct {
+		name  string
+		match func(b byte) bool
+	}{
+		{"Printable ASCII", func(b byte) bool { return b >= 32 && b <= 126 }},
+		{"Whitespace", func(b byte) bool { return b == '\t' || b == '\n' || b == '\r' }},
+		{"Zero", func(b byte) bool { return b == 0 }},
+		{"Other control", func(b byte) bool { return b != 0 && b < 32 && b != '\t' && b != '\n' && b != '\r' || b == 127 }},
+		{"High (0x80-0xFF)", func(b byte) bool { return b >= 0x80 }},
+	} {
+		summary.WriteString(fmt.Sprintf("\n%-17s %6.2f%%", kind.name, h.share(kind.match)*100))
+	}
+	summary.WriteString(fmt.Sprintf("\n\n%-17s %d", "Distinct values", distinct))
+
+	var sb strings.Builder
+	sb.WriteString(title)
+	sb.WriteString("\n\n")
+	pad := lipgloss.NewStyle().PaddingRight(helpColumnGap)
+	sb.WriteString(lipgloss.JoinHorizontal(lipgloss.Top, pad.Render(grid.String()), pad.Render(top.String()), summary.String()))
+	sb.WriteString("\n\n")
+	sb.WriteString(footer)
+	return sb.String()
+}
@@ -0,0 +1,228 @@
+package prettybuffers
+
+import (
+	"fmt"
+	"html"
+	"image/color"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/charmbracelet/lipgloss"
+)
+
+// ansiColors are the colors of the 16 basic terminal colors in HTML, as
+// xterm shows them
+var ansiColors = []string{
+	"#000000", "#cd0000", "#00cd00", "#cdcd00", "#0000ee", "#cd00cd", "#00cdcd", "#e5e5e5",
+	"#7f7f7f", "#ff0000", "#00ff00", "#ffff00", "#5c5cff", "#ff00ff", "#00ffff", "#ffffff",
+}
+
+// htmlPage are the text and background colors of exported pages by theme,
+// dark unless the theme is meant for a light background
+var htmlPage = map[string][2]string{"Light": {"#000000", "#ffffff"}}
+
+// cssColor converts a terminal color such as "6", "208" or "#ff8800" to CSS,
+// or returns "" for no color
+func cssColor(c lipgloss.TerminalColor) string {
+	s, ok := c.(lipgloss.Color)
+	if !ok || s == "" {
+		return ""
+	}
+	if strings.HasPrefix(string(s), "#") {
+		return string(s)
+	}
+	n, err := strconv.Atoi(string(s))
+	switch {
+	case err != nil || n < 0 || n > 255:
+		return ""
+	case n < 16:
+		return ansiColors[n]
+	case n < 232:
+		// The 6x6x6 color cube
+		levels := []uint8{0, 95, 135, 175, 215, 255}
+		n -= 16
+		return hexColor(color.RGBA{R: levels[n/36], G: levels[n/6%6], B: levels[n%6]})
+	}
+	gray := uint8(8 + 10*(n-232))
+	return hexColor(color.RGBA{R: gray, G: gray, B: gray})
+}
+
+// hexColor formats c as #rrggbb
+func hexColor(c color.RGBA) string {
+	return fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
+}
+
+// styleCSS converts the colors and attributes of a style to CSS declarations
+func styleCSS(s lipgloss.Style, page [2]string) string {
+	fg, bg := cssColor(s.GetForeground()), cssColor(s.GetBackground())
+	if s.GetReverse() {
+		if fg == "" {
+			fg = page[0]
+		}
+		if bg == "" {
+			bg = page[1]
+		}
+		fg, bg = bg, fg
+	}
+	var css []string
+	if fg != "" {
+		css = append(css, "color:"+fg)
+	}
+	if bg != "" {
+		css = append(css, "background:"+bg)
+	}
+	if s.GetBold() {
+		css = append(css, "font-weight:bold")
+	}
+	if s.GetItalic() {
+		css = append(css, "font-style:italic")
+	}
+	if s.GetUnderline() {
+		css = append(css, "text-decoration:underline")
+	}
+	if s.GetFaint() {
+		css = append(css, "opacity:0.6")
+	}
+	return strings.Join(css, ";")
+}
+
+// htmlRun writes text in spans, opening a new one only where the attributes
+// change from the text before
+type htmlRun struct {
+	sb   *strings.Builder
+	open string // attributes of the open span, "" if none is open
+}
+
+// write appends text in a span with the given attributes
+func (r *htmlRun) write(attrs, text string) {
+	if attrs != r.open {
+		r.close()
+		if attrs != "" {
+			r.sb.WriteString("<span " + attrs + ">")
+		}
+		r.open = attrs
+	}
+	r.sb.WriteString(html.EscapeString(text))
+}
+
+// close ends the open span, if any
+func (r *htmlRun) close() {
+	if r.open != "" {
+		r.sb.WriteString("</span>")
+	}
+	r.open = ""
+}
+
+// htmlAttrs returns the span attributes of the byte at pos: the styles of its
+// highlights and annotations, and what covers it as a tooltip
+func (m model) htmlAttrs(pos int, page [2]string) string {
+	var attrs []string
+	if style, ok := m.layeredStyle(pos); ok {
+		if css := styleCSS(style, page); css != "" {
+			attrs = append(attrs, `style="`+css+`"`)
+		}
+	}
+	title := ""
+	i := sort.Search(len(m.jsonObjects), func(i int) bool { return m.jsonObjects[i].endOffset >= pos })
+	if a := m.annotationAt(pos); a != nil {
+		title = a.label
+	} else if r := m.regionAt(pos); r != nil {
+		title = r.label
+	} else if i < len(m.jsonObjects) && m.jsonObjects[i].startOffset <= pos {
+		title = m.jsonObjects[i].kind.String() + " object"
+	}
+	if title != "" {
+		attrs = append(attrs, `class="obj" title="`+html.EscapeString(title)+`"`)
+	}
+	return strings.Join(attrs, " ")
+}
+
+// renderHTML renders data, which starts at start in the buffer, as a
+// standalone page with the offset, hex and ASCII columns in the colors of
+// the theme, followed by the annotations and detected objects covering it
+func (m *model) renderHTML(start int, data []byte) []byte {
+	page, ok := htmlPage[m.theme.Name]
+	if !ok {
+		page = [2]string{"#e5e5e5", "#000000"}
+	}
+	title := m.title
+	if title == "" {
+		title = m.path
+	}
+	if title == "" {
+		title = "prettybuffers"
+	}
+	end := start + len(data)
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "<!DOCTYPE html>\n<html>\n<head>\n<meta charset=\"utf-8\">\n<title>%s</title>\n", html.EscapeString(title))
+	fmt.Fprintf(&sb, "<style>\nbody { color: %s; background: %s; font-family: monospace; }\n", page[0], page[1])
+	fmt.Fprintf(&sb, ".off { %s }\n.hex { %s }\n.ascii { %s }\n.json { %s }\nh1, h2, h3 { %s }\n",
+		styleCSS(m.theme.Offset, page), styleCSS(m.theme.Hex, page), styleCSS(m.theme.ASCII, page),
+		styleCSS(m.theme.JSON, page), styleCSS(m.theme.Header, page))
+	sb.WriteString(".obj { text-decoration: underline dotted; }\n</style>\n</head>\n<body>\n")
+	fmt.Fprintf(&sb, "<h1>%s</h1>\n<p>0x%08X-0x%08X, %d bytes</p>\n<pre>\n", html.EscapeString(title), start, max(start, end-1), len(data))
+
+	run := htmlRun{sb: &sb}
+	for row := 0; row < len(data); row += m.bytesPerRow {
+		rowData := data[row:min(row+m.bytesPerRow, len(data))]
+		attrs := make([]string, len(rowData))
+		for i := range rowData {
+			attrs[i] = m.htmlAttrs(start+row+i, page)
+		}
+		fmt.Fprintf(&sb, "<span class=\"off\">0x%08X</span> | <span class=\"hex\">", start+row)
+		for i, b := range rowData {
+			run.write(attrs[i], fmt.Sprintf("%02X", b))
+			if i+1 < len(rowData) {
+				// Spaces only take the style of bytes on both sides
+				if attrs[i+1] != attrs[i] {
+					run.close()
+				}
+				run.write(run.open, " ")
+			}
+		}
+		run.close()
+		sb.WriteString(strings.Repeat("   ", m.bytesPerRow-len(rowData)))
+		sb.WriteString("</span> | <span class=\"ascii\">")
+		for i, b := range rowData {
+			run.write(attrs[i], formatASCIIBytes([]byte{b}))
+		}
+		run.close()
+		sb.WriteString("</span>\n")
+	}
+	sb.WriteString("</pre>\n")
+
+	var notes []string
+	for _, a := range m.annotations {
+		if a.start < end && a.end > start {
+			notes = append(notes, fmt.Sprintf("<li><span style=\"%s\">%s</span> 0x%X-0x%X</li>\n",
+				styleCSS(a.style, page), html.EscapeString(a.label), a.start, a.end-1))
+		}
+	}
+	if len(notes) > 0 {
+		sb.WriteString("<h2>Annotations</h2>\n<ul>\n" + strings.Join(notes, "") + "</ul>\n")
+	}
+
+	heading := false
+	for _, o := range m.jsonObjects {
+		if o.startOffset >= end || o.endOffset < start {
+			continue
+		}
+		if !heading {
+			sb.WriteString("<h2>Detected objects</h2>\n")
+			heading = true
+		}
+		lines, err := o.lines(m.bytesPerRow)
+		if err != nil {
+			lines = []string{sanitizeString(string(o.data))}
+		}
+		fmt.Fprintf(&sb, "<h3>%s at 0x%X-0x%X</h3>\n<pre class=\"json\">\n", o.kind, o.startOffset, o.endOffset)
+		for _, line := range lines {
+			sb.WriteString(html.EscapeString(o.displayLine(line)) + "\n")
+		}
+		sb.WriteString("</pre>\n")
+	}
+	sb.WriteString("</body>\n</html>\n")
+	return []byte(sb.String())
+}
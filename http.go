@@ -0,0 +1,320 @@
+package prettybuffers
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// maxHTTPHeaderSize is the largest start line and header section detected
+const maxHTTPHeaderSize = 64 << 10
+
+// httpMethods are the request methods that start a request line
+var httpMethods = []string{"GET", "POST", "PUT", "DELETE", "HEAD", "OPTIONS", "PATCH", "CONNECT", "TRACE"}
+
+// httpHeader is a header line of an HTTP message
+type httpHeader struct {
+	start, end  int // offsets of the line, without its line ending
+	name, value string
+}
+
+// isHTTPStartLine reports whether line is an HTTP/1.x request or status line
+func isHTTPStartLine(line []byte) bool {
+	if rest, ok := bytes.CutPrefix(line, []byte("HTTP/1.")); ok {
+		// HTTP/1.1 200 OK
+		return len(rest) >= 5 && (rest[0] == '0' || rest[0] == '1') && rest[1] == ' ' &&
+			isDigits(rest[2:5]) && (len(rest) == 5 || rest[5] == ' ')
+	}
+	// GET /path HTTP/1.1
+	method, rest, ok := bytes.Cut(line, []byte(" "))
+	if !ok || !containsString(httpMethods, string(method)) {
+		return false
+	}
+	target, version, ok := bytes.Cut(rest, []byte(" "))
+	return ok && len(target) > 0 && (string(version) == "HTTP/1.0" || string(version) == "HTTP/1.1")
+}
+
+// bodylessStatus reports whether the status line of a response has a status
+// that never comes with a body: 1xx, 204 No Content or 304 Not Modified, see
+// RFC 7230 section 3.3.3
+func bodylessStatus(statusLine []byte) bool {
+	code := string(statusLine[len("HTTP/1.x "):len("HTTP/1.x 200")])
+	return code[0] == '1' || code == "204" || code == "304"
+}
+
+// mayStartHTTP reports whether an unterminated line could still turn into a
+// start line once more data is appended
+func mayStartHTTP(line []byte) bool {
+	if len(line) <= len("HTTP/1.") {
+		return bytes.HasPrefix([]byte("HTTP/1."), line)
+	}
+	if bytes.HasPrefix(line, []byte("HTTP/1.")) {
+		return true
+	}
+	method, _, ok := bytes.Cut(line, []byte(" "))
+	return ok && containsString(httpMethods, string(method))
+}
+
+// isDigits reports whether b is a non-empty run of ASCII digits
+func isDigits(b []byte) bool {
+	for _, c := range b {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return len(b) > 0
+}
+
+// containsString reports whether list contains s
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// readHTTPLine returns the end of the line starting at pos, without its CRLF
+// or LF ending, and the start of the next line. ok is false when data ends
+// before the line does.
+func readHTTPLine(data []byte, pos int) (end, next int, ok bool) {
+	i := bytes.IndexByte(data[pos:], '\n')
+	if i < 0 {
+		return 0, 0, false
+	}
+	end, next = pos+i, pos+i+1
+	if end > pos && data[end-1] == '\r' {
+		end--
+	}
+	return end, next, true
+}
+
+// errHTTPShort reports an HTTP message cut off by the end of the data
+var errHTTPShort = errors.New("http: message runs past the end of the data")
+
+// readChunked decodes a chunked body starting at pos, returning the decoded
+// bytes and the offset just past the body
+func readChunked(data []byte, pos int) ([]byte, int, error) {
+	var body []byte
+	for {
+		end, next, ok := readHTTPLine(data, pos)
+		if !ok {
+			return nil, 0, errHTTPShort
+		}
+		sizeText, _, _ := strings.Cut(string(data[pos:end]), ";")
+		size, err := strconv.ParseUint(strings.TrimSpace(sizeText), 16, 31)
+		if err != nil {
+			return nil, 0, err
+		}
+		pos = next
+		if size == 0 {
+			break
+		}
+		if pos+int(size) > len(data) {
+			return nil, 0, errHTTPShort
+		}
+		body = append(body, data[pos:pos+int(size)]...)
+		pos += int(size)
+		end, next, ok = readHTTPLine(data, pos)
+		if !ok {
+			return nil, 0, errHTTPShort
+		}
+		if end != pos {
+			return nil, 0, fmt.Errorf("http: chunk longer than its size")
+		}
+		pos = next
+	}
+	// Trailers end with an empty line
+	for {
+		end, next, ok := readHTTPLine(data, pos)
+		if !ok {
+			return nil, 0, errHTTPShort
+		}
+		if end == pos {
+			return body, next, nil
+		}
+		pos = next
+	}
+}
+
+// scanHTTPObjects finds HTTP/1.x requests and responses in data starting at
+// from, skipping the ranges of the given objects, and runs detection on their
+// bodies. Like scanJSONObjects it returns the offset of a message that was cut
+// off by the end of data.
+func scanHTTPObjects(data []byte, from int, skip []jsonObject, b *decodeBudget) ([]jsonObject, int) {
+	var objects []jsonObject
+	resume := len(data)
+	next := 0 // index into skip of the next object at or after i
+	for i := from; i < len(data); i++ {
+		for next < len(skip) && skip[next].endOffset < i {
+			next++
+		}
+		end := len(data)
+		if next < len(skip) {
+			if skip[next].startOffset <= i {
+				i = skip[next].endOffset
+				continue
+			}
+			end = skip[next].startOffset
+		}
+		// Messages start at the beginning of a line or after binary framing
+		if i > 0 && isPrintableASCII(data[i-1]) || (data[i] < 'A' || data[i] > 'Z') {
+			continue
+		}
+		obj, err := readHTTPMessage(data[:end], i, b)
+		if errors.Is(err, errHTTPShort) && end == len(data) {
+			resume = min(resume, i)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		objects = append(objects, obj)
+		i = obj.endOffset
+	}
+	return objects, resume
+}
+
+// readHTTPMessage reads the HTTP message starting at start, decompressing its
+// body within b
+func readHTTPMessage(data []byte, start int, b *decodeBudget) (jsonObject, error) {
+	limit := data[:min(len(data), start+maxHTTPHeaderSize)]
+	lineEnd, pos, ok := readHTTPLine(limit, start)
+	if !ok {
+		if len(limit) == len(data) && mayStartHTTP(data[start:]) {
+			return jsonObject{}, errHTTPShort
+		}
+		return jsonObject{}, fmt.Errorf("http: no start line")
+	}
+	startLine := data[start:lineEnd]
+	if !isHTTPStartLine(startLine) {
+		return jsonObject{}, fmt.Errorf("http: no start line")
+	}
+	response := bytes.HasPrefix(startLine, []byte("HTTP/"))
+
+	var headers []httpHeader
+	for {
+		end, next, ok := readHTTPLine(limit, pos)
+		if !ok {
+			if len(limit) < len(data) {
+				return jsonObject{}, fmt.Errorf("http: header section too large")
+			}
+			return jsonObject{}, errHTTPShort
+		}
+		if end == pos {
+			pos = next
+			break
+		}
+		name, value, found := strings.Cut(string(data[pos:end]), ":")
+		if !found || name == "" || strings.ContainsAny(name, " \t") {
+			return jsonObject{}, fmt.Errorf("http: malformed header line")
+		}
+		headers = append(headers, httpHeader{start: pos, end: end, name: name, value: strings.TrimSpace(value)})
+		pos = next
+	}
+
+	header := func(name string) string {
+		for _, h := range headers {
+			if strings.EqualFold(h.name, name) {
+				return h.value
+			}
+		}
+		return ""
+	}
+	bodyStart := pos
+	var body []byte
+	var encodings []string
+	switch {
+	case response && bodylessStatus(startLine):
+		// Whatever follows is the next message, even with a length given
+	case strings.EqualFold(header("Transfer-Encoding"), "chunked"):
+		decoded, end, err := readChunked(data, pos)
+		if err != nil {
+			return jsonObject{}, err
+		}
+		body, pos = decoded, end
+		encodings = append(encodings, "chunked")
+	case header("Content-Length") != "":
+		n, err := strconv.Atoi(header("Content-Length"))
+		if err != nil || n < 0 {
+			return jsonObject{}, fmt.Errorf("http: invalid Content-Length")
+		}
+		if pos+n > len(data) {
+			return jsonObject{}, errHTTPShort
+		}
+		body, pos = data[pos:pos+n], pos+n
+	case response:
+		// Without a length the body runs until the connection closes, here
+		// taken to be the next request or response or the end of the data
+		end := len(data)
+		for j := pos; j < len(data); j++ {
+			if data[j] >= 'A' && data[j] <= 'Z' && data[j-1] == '\n' {
+				if lineEnd, _, ok := readHTTPLine(data, j); ok && isHTTPStartLine(data[j:lineEnd]) {
+					end = j
+					break
+				}
+			}
+		}
+		body, pos = data[pos:end], end
+	}
+
+	if ce := strings.ToLower(header("Content-Encoding")); (ce == "gzip" || ce == "deflate") && len(body) > 0 {
+		if decoded, _, format, err := decompress(body, b); err == nil {
+			body = decoded
+			encodings = append(encodings, format)
+		}
+	}
+	if pos == start {
+		return jsonObject{}, fmt.Errorf("http: empty message")
+	}
+
+	obj := jsonObject{
+		startOffset: start,
+		endOffset:   pos - 1,
+		data:        data[start:pos],
+		kind:        objectHTTP,
+		encoding:    strings.Join(append(encodings, "body"), " "),
+	}
+	if len(body) > 0 {
+		obj.decoded = body
+		obj.nested = b.scan(body)
+	}
+	obj.describeHTTP(startLine, response, headers, bodyStart)
+	return obj, nil
+}
+
+// describeHTTP fills in the summary and regions of an HTTP message, with the
+// header values aligned
+func (o *jsonObject) describeHTTP(startLine []byte, response bool, headers []httpHeader, bodyStart int) {
+	o.summary = append(o.summary, sanitizeString(string(startLine)))
+	label := "HTTP request line"
+	if response {
+		label = "HTTP status line"
+	}
+	o.regions = append(o.regions, region{start: o.startOffset, end: o.startOffset + len(startLine), label: label})
+
+	width := 0
+	for _, h := range headers {
+		width = max(width, len(h.name))
+	}
+	for _, h := range headers {
+		o.summary = append(o.summary, fmt.Sprintf("  %-*s %s", width+1, sanitizeString(h.name)+":", sanitizeString(h.value)))
+		o.regions = append(o.regions, region{start: h.start, end: h.end, label: "HTTP header " + sanitizeString(h.name)})
+	}
+	if bodyStart <= o.endOffset {
+		o.regions = append(o.regions, region{start: bodyStart, end: o.endOffset + 1, label: "HTTP " + o.encoding})
+	}
+}
+
+// httpLines shows the start line and headers of an HTTP message followed by
+// what was detected in its body
+func (o jsonObject) httpLines(bytesPerLine int) []string {
+	lines := o.summary[:len(o.summary):len(o.summary)]
+	if o.decoded == nil {
+		return lines
+	}
+	return append(lines, o.decodedLines(o.encoding, bytesPerLine)...)
+}
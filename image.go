@@ -0,0 +1,289 @@
+package prettybuffers
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+)
+
+const (
+	// pngSignature starts every PNG file
+	pngSignature = "\x89PNG\r\n\x1a\n"
+	// maxPNGChunk is the largest chunk length the format allows
+	maxPNGChunk = 1<<31 - 1
+	// maxImageText limits how much of text chunks and comments is shown
+	maxImageText = 64
+)
+
+var (
+	pngColorTypes = map[byte]string{0: "grayscale", 2: "RGB", 3: "indexed", 4: "grayscale+alpha", 6: "RGBA"}
+
+	pngRenderingIntents = map[byte]string{0: "perceptual", 1: "relative colorimetric", 2: "saturation", 3: "absolute colorimetric"}
+
+	// jpegMarkers names the JPEG markers other than SOFn, APPn and RSTn
+	jpegMarkers = map[byte]string{
+		0x01: "TEM", 0xC4: "DHT", 0xC8: "JPG", 0xCC: "DAC", 0xD8: "SOI", 0xD9: "EOI", 0xDA: "SOS",
+		0xDB: "DQT", 0xDC: "DNL", 0xDD: "DRI", 0xDE: "DHP", 0xDF: "EXP", 0xFE: "COM",
+	}
+
+	jpegFrameTypes = map[byte]string{
+		0xC0: "baseline", 0xC1: "extended sequential", 0xC2: "progressive", 0xC3: "lossless",
+		0xC9: "arithmetic sequential", 0xCA: "arithmetic progressive", 0xCB: "arithmetic lossless",
+	}
+)
+
+// scanImageObjects parses a PNG or JPEG image at the start of data into
+// objects for its chunks or marker segments. Like captures, images are only
+// recognized at the start of data, as in a file or an HTTP body.
+func scanImageObjects(data []byte, from int, _ []jsonObject) ([]jsonObject, int) {
+	switch {
+	case len(data) < len(pngSignature):
+		// Too short to tell yet
+		return nil, 0
+	case string(data[:len(pngSignature)]) == pngSignature:
+		return scanPNG(data, from)
+	case data[0] == 0xFF && data[1] == 0xD8 && data[2] == 0xFF:
+		return scanJPEG(data, from)
+	}
+	return nil, len(data)
+}
+
+// newImageObject describes the part of an image from start up to end
+func newImageObject(data []byte, start, end int, line string, regions []region) jsonObject {
+	return jsonObject{
+		startOffset: start,
+		endOffset:   end - 1,
+		data:        data[start:end],
+		kind:        objectImage,
+		summary:     []string{line},
+		regions:     regions,
+	}
+}
+
+// scanPNG parses the chunks of a PNG file up to IEND
+func scanPNG(data []byte, from int) ([]jsonObject, int) {
+	var objects []jsonObject
+	if from == 0 {
+		objects = append(objects, newImageObject(data, 0, len(pngSignature), "PNG signature",
+			[]region{{start: 0, end: len(pngSignature), label: "PNG signature"}}))
+	}
+	pos := len(pngSignature)
+	for pos+12 <= len(data) {
+		length := binary.BigEndian.Uint32(data[pos:])
+		typ := sanitizeString(string(data[pos+4 : pos+8]))
+		if length > maxPNGChunk {
+			// Corrupt from here on
+			return objects, len(data)
+		}
+		end := pos + 12 + int(length)
+		if end > len(data) {
+			return objects, pos
+		}
+		body := data[pos+8 : end-4]
+		crc := binary.BigEndian.Uint32(data[end-4:])
+		check := "ok"
+		if crc32.ChecksumIEEE(data[pos+4:end-4]) != crc {
+			check = "mismatch"
+		}
+
+		line := fmt.Sprintf("PNG %s chunk, %d bytes", typ, length)
+		if info := pngChunkInfo(typ, body); info != "" {
+			line += ": " + info
+		}
+		if pos >= from {
+			objects = append(objects, newImageObject(data, pos, end, line, []region{
+				{start: pos, end: pos + 4, label: fmt.Sprintf("PNG %s length = %d", typ, length)},
+				{start: pos + 4, end: pos + 8, label: fmt.Sprintf("PNG %s chunk type", typ)},
+				{start: pos + 8, end: end - 4, label: line},
+				{start: end - 4, end: end, label: fmt.Sprintf("PNG %s CRC = 0x%08X (%s)", typ, crc, check)},
+			}))
+		}
+		pos = end
+		if typ == "IEND" {
+			break
+		}
+	}
+	return objects, pos
+}
+
+// pngChunkInfo describes the metadata in the body of a PNG chunk
+func pngChunkInfo(typ string, body []byte) string {
+	switch {
+	case typ == "IHDR" && len(body) == 13:
+		color, ok := pngColorTypes[body[9]]
+		if !ok {
+			color = fmt.Sprintf("color type %d", body[9])
+		}
+		info := fmt.Sprintf("%dx%d, %d-bit %s", binary.BigEndian.Uint32(body), binary.BigEndian.Uint32(body[4:]), body[8], color)
+		if body[12] == 1 {
+			info += ", interlaced"
+		}
+		return info
+	case typ == "PLTE":
+		return fmt.Sprintf("%d colors", len(body)/3)
+	case typ == "gAMA" && len(body) == 4:
+		return fmt.Sprintf("gamma %.5f", float64(binary.BigEndian.Uint32(body))/100000)
+	case typ == "sRGB" && len(body) == 1:
+		return pngRenderingIntents[body[0]]
+	case typ == "pHYs" && len(body) == 9:
+		x, y := binary.BigEndian.Uint32(body), binary.BigEndian.Uint32(body[4:])
+		if body[8] == 1 {
+			return fmt.Sprintf("%.0fx%.0f dpi", float64(x)*0.0254, float64(y)*0.0254)
+		}
+		return fmt.Sprintf("aspect ratio %d:%d", x, y)
+	case typ == "tIME" && len(body) == 7:
+		return fmt.Sprintf("modified %04d-%02d-%02d %02d:%02d:%02d", binary.BigEndian.Uint16(body), body[2], body[3], body[4], body[5], body[6])
+	case typ == "acTL" && len(body) == 8:
+		return fmt.Sprintf("animated, %d frames", binary.BigEndian.Uint32(body))
+	case typ == "tEXt" || typ == "iTXt" || typ == "zTXt":
+		keyword, text, _ := bytes.Cut(body, []byte{0})
+		if typ != "tEXt" {
+			// Compressed or international text isn't shown
+			return sanitizeString(string(keyword))
+		}
+		return sanitizeString(string(keyword)) + ": " + truncateText(string(text))
+	}
+	return ""
+}
+
+// truncateText shortens text from an image to maxImageText characters
+func truncateText(s string) string {
+	s = sanitizeString(s)
+	if r := []rune(s); len(r) > maxImageText {
+		return string(r[:maxImageText]) + "…"
+	}
+	return s
+}
+
+// jpegMarkerName names a JPEG marker, e.g. "SOF0" or "APP1"
+func jpegMarkerName(marker byte) string {
+	switch {
+	case marker >= 0xC0 && marker <= 0xCF && jpegMarkers[marker] == "":
+		return fmt.Sprintf("SOF%d", marker-0xC0)
+	case marker >= 0xD0 && marker <= 0xD7:
+		return fmt.Sprintf("RST%d", marker-0xD0)
+	case marker >= 0xE0 && marker <= 0xEF:
+		return fmt.Sprintf("APP%d", marker-0xE0)
+	case jpegMarkers[marker] != "":
+		return jpegMarkers[marker]
+	}
+	return fmt.Sprintf("marker 0x%02X", marker)
+}
+
+// jpegScanEnd returns the end of the entropy-coded data starting at pos,
+// where a marker other than a stuffed zero or a restart marker follows, or
+// -1 if data ends first
+func jpegScanEnd(data []byte, pos int) int {
+	for {
+		i := bytes.IndexByte(data[pos:], 0xFF)
+		if i < 0 || pos+i+1 >= len(data) {
+			return -1
+		}
+		pos += i
+		if next := data[pos+1]; next != 0 && (next < 0xD0 || next > 0xD7) && next != 0xFF {
+			return pos
+		}
+		pos++
+	}
+}
+
+// scanJPEG parses the marker segments of a JPEG file up to EOI. The
+// entropy-coded data following SOS is part of its object.
+func scanJPEG(data []byte, from int) ([]jsonObject, int) {
+	var objects []jsonObject
+	pos := 0
+	for pos+2 <= len(data) {
+		if data[pos] != 0xFF {
+			// Not a marker, so the image is corrupt or has ended
+			return objects, len(data)
+		}
+		marker := data[pos+1]
+		if marker == 0xFF {
+			// Fill byte
+			pos++
+			continue
+		}
+		name := jpegMarkerName(marker)
+		end := pos + 2
+		var regions []region
+		line := "JPEG " + name + " marker"
+		if marker != 0xD8 && marker != 0xD9 && marker != 0x01 && (marker < 0xD0 || marker > 0xD7) {
+			if pos+4 > len(data) {
+				return objects, pos
+			}
+			length := int(binary.BigEndian.Uint16(data[pos+2:]))
+			if length < 2 {
+				return objects, len(data)
+			}
+			end = pos + 2 + length
+			if end > len(data) {
+				return objects, pos
+			}
+			body := data[pos+4 : end]
+			line += fmt.Sprintf(", %d bytes", length)
+			if info := jpegSegmentInfo(marker, body); info != "" {
+				line += ": " + info
+			}
+			regions = []region{
+				{start: pos + 2, end: pos + 4, label: fmt.Sprintf("JPEG %s length = %d", name, length)},
+				{start: pos + 4, end: end, label: line},
+			}
+			if marker == 0xDA {
+				scanEnd := jpegScanEnd(data, end)
+				if scanEnd < 0 {
+					return objects, pos
+				}
+				line += fmt.Sprintf(", %d bytes of scan data", scanEnd-end)
+				regions = append(regions, region{start: end, end: scanEnd, label: fmt.Sprintf("JPEG scan data, %d bytes", scanEnd-end)})
+				end = scanEnd
+			}
+		}
+		regions = append([]region{{start: pos, end: pos + 2, label: "JPEG " + name + " marker"}}, regions...)
+		if pos >= from {
+			objects = append(objects, newImageObject(data, pos, end, line, regions))
+		}
+		pos = end
+		if marker == 0xD9 {
+			break
+		}
+	}
+	return objects, pos
+}
+
+// jpegSegmentInfo describes the metadata in the body of a JPEG segment
+func jpegSegmentInfo(marker byte, body []byte) string {
+	switch {
+	case marker >= 0xC0 && marker <= 0xCF && jpegMarkers[marker] == "" && len(body) >= 6:
+		info := fmt.Sprintf("%dx%d, %d-bit, %d components", binary.BigEndian.Uint16(body[3:]), binary.BigEndian.Uint16(body[1:]), body[0], body[5])
+		if t, ok := jpegFrameTypes[marker]; ok {
+			info = t + ", " + info
+		}
+		return info
+	case marker == 0xE0 && len(body) >= 12 && string(body[:5]) == "JFIF\x00":
+		info := fmt.Sprintf("JFIF %d.%02d", body[5], body[6])
+		x, y := binary.BigEndian.Uint16(body[8:]), binary.BigEndian.Uint16(body[10:])
+		switch body[7] {
+		case 1:
+			info += fmt.Sprintf(", %dx%d dpi", x, y)
+		case 2:
+			info += fmt.Sprintf(", %dx%d dots per cm", x, y)
+		}
+		return info
+	case marker == 0xE1 && bytes.HasPrefix(body, []byte("Exif\x00")):
+		return "Exif"
+	case marker == 0xE1 && bytes.HasPrefix(body, []byte("http://ns.adobe.com/xap/1.0/\x00")):
+		return "XMP"
+	case marker == 0xE2 && bytes.HasPrefix(body, []byte("ICC_PROFILE\x00")):
+		return "ICC profile"
+	case marker == 0xEE && bytes.HasPrefix(body, []byte("Adobe")):
+		return "Adobe"
+	case marker == 0xDA && len(body) >= 1:
+		return fmt.Sprintf("%d components", body[0])
+	case marker == 0xDD && len(body) == 2:
+		return fmt.Sprintf("restart interval %d", binary.BigEndian.Uint16(body))
+	case marker == 0xFE:
+		return truncateText(string(body))
+	}
+	return ""
+}
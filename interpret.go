@@ -0,0 +1,111 @@
+package prettybuffers
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// objectKindNames name the kinds of detected objects
+var objectKindNames = map[objectKind]string{
+	objectJSON: "JSON", objectMsgpack: "MessagePack", objectUTF16: "UTF-16", objectBase64: "base64",
+	objectCompressed: "compressed", objectTLS: "TLS", objectHTTP: "HTTP", objectCapture: "capture",
+	objectImage: "image", objectXML: "XML", objectYAML: "YAML", objectForm: "form", objectMultipart: "multipart",
+}
+
+// String names the kind of an object, e.g. "base64"
+func (k objectKind) String() string {
+	if name, ok := objectKindNames[k]; ok {
+		return name
+	}
+	return fmt.Sprintf("kind %d", int(k))
+}
+
+// interpretations are the ways the bytes of one detected object can be read,
+// cycled through with the Reinterpret key
+type interpretations struct {
+	options []jsonObject // the object detected first, then the alternatives
+	index   int          // of the one shown
+}
+
+// alternativeObjects runs the scanners other than the one that found o on
+// its bytes alone, returning what each of them finds covering the most of
+// them. These are ranked by how many of the bytes they cover, with the
+// priority of their scanners breaking ties.
+func alternativeObjects(data []byte, o jsonObject, opts DetectionOptions) []jsonObject {
+	region := data[o.startOffset : o.endOffset+1]
+	var alternatives []jsonObject
+	for _, scan := range newObjectScanners(opts, newDecodeBudget()) {
+		found, _ := scan(region, 0, nil)
+		best := -1
+		for i, f := range found {
+			if f.kind != o.kind && (best < 0 || objectLength(f) > objectLength(found[best])) {
+				best = i
+			}
+		}
+		if best >= 0 {
+			alt := shiftObject(found[best], o.startOffset)
+			alt.prettify()
+			alternatives = append(alternatives, alt)
+		}
+	}
+	sort.SliceStable(alternatives, func(i, j int) bool {
+		return objectLength(alternatives[i]) > objectLength(alternatives[j])
+	})
+	return alternatives
+}
+
+// objectLength returns how many bytes an object covers
+func objectLength(o jsonObject) int {
+	return o.endOffset - o.startOffset + 1
+}
+
+// shiftObject moves an object found in part of the buffer by delta bytes
+func shiftObject(o jsonObject, delta int) jsonObject {
+	o.startOffset += delta
+	o.endOffset += delta
+	regions := make([]region, len(o.regions))
+	for i, r := range o.regions {
+		r.start += delta
+		r.end += delta
+		regions[i] = r
+	}
+	o.regions = regions
+	return o
+}
+
+// reinterpret replaces the object under the cursor with the next way its
+// bytes can be read, after the last going back to the one detected first
+func (m *model) reinterpret() {
+	i := sort.Search(len(m.jsonObjects), func(i int) bool { return m.jsonObjects[i].endOffset >= m.cursor })
+	if i == len(m.jsonObjects) || m.jsonObjects[i].startOffset > m.cursor {
+		m.status = "Move the cursor onto a detected object to read it another way"
+		return
+	}
+	shown := m.jsonObjects[i]
+
+	cycle := m.interpretations
+	if cycle == nil || cycle.options[cycle.index].startOffset != shown.startOffset ||
+		cycle.options[cycle.index].kind != shown.kind {
+		// Start over with the object under the cursor
+		options := append([]jsonObject{shown}, alternativeObjects(m.data, shown, m.detectOpts)...)
+		cycle = &interpretations{options: options}
+		m.interpretations = cycle
+	}
+	if len(cycle.options) == 1 {
+		m.status = fmt.Sprintf("The %s object at %s can't be read another way", shown.kind,
+			strings.TrimSpace(m.formatOffset(shown.startOffset)))
+		return
+	}
+
+	cycle.index = (cycle.index + 1) % len(cycle.options)
+	next := cycle.options[cycle.index]
+	m.jsonObjects[i] = next
+	// An alternative may cover fewer bytes, which the cursor has to stay on
+	// for the next press to continue the cycle
+	if m.cursor < next.startOffset || m.cursor > next.endOffset {
+		m.moveCursor(next.startOffset - m.cursor)
+	}
+	m.status = fmt.Sprintf("Reading %s-%s as %s, interpretation %d of %d", strings.TrimSpace(m.formatOffset(next.startOffset)),
+		strings.TrimSpace(m.formatOffset(next.endOffset)), next.kind, cycle.index+1, len(cycle.options))
+}
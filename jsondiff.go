@@ -0,0 +1,247 @@
+package prettybuffers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/key"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// maxDiffValue is how much of each value the JSON diff shows
+const maxDiffValue = 60
+
+// jsonDiffEntry is a value that differs between two JSON documents
+type jsonDiffEntry struct {
+	op       byte   // '+' added, '-' removed, '~' changed
+	path     string // JSONPath of the value, e.g. $.items[0].id
+	old, new string // compact text of the values, "" where there is none
+}
+
+// diffJSON compares two JSON documents structurally. Members of objects are
+// matched by name, elements of arrays by index.
+func diffJSON(left, right []byte) ([]jsonDiffEntry, error) {
+	a, err := parseJSONTree(bytes.TrimSpace(left))
+	if err != nil {
+		return nil, err
+	}
+	b, err := parseJSONTree(bytes.TrimSpace(right))
+	if err != nil {
+		return nil, err
+	}
+	d := jsonDiffer{left: bytes.TrimSpace(left), right: bytes.TrimSpace(right)}
+	d.compare("$", a, b)
+	return d.entries, nil
+}
+
+// jsonDiffer collects the differences between the trees of two documents
+type jsonDiffer struct {
+	left, right []byte
+	entries     []jsonDiffEntry
+}
+
+// compare adds the differences between a and b, found at path
+func (d *jsonDiffer) compare(path string, a, b *jsonNode) {
+	switch {
+	case a.open != b.open || a.open == 0:
+		if old, new := compactJSON(d.left[a.start:a.end]), compactJSON(d.right[b.start:b.end]); old != new {
+			d.entries = append(d.entries, jsonDiffEntry{op: '~', path: path, old: old, new: new})
+		}
+	case a.open == '[':
+		for i := 0; i < max(len(a.children), len(b.children)); i++ {
+			d.compareChild(fmt.Sprintf("%s[%d]", path, i), a.children, b.children, i, i)
+		}
+	default:
+		// Members of b by name, in order, taken as members of a match them
+		unmatched := map[string][]int{}
+		for j, child := range b.children {
+			name := memberName(child)
+			unmatched[name] = append(unmatched[name], j)
+		}
+		matched := make([]bool, len(b.children))
+		for i, child := range a.children {
+			name, j := memberName(child), -1
+			if js := unmatched[name]; len(js) > 0 {
+				j, unmatched[name] = js[0], js[1:]
+				matched[j] = true
+			}
+			d.compareChild(memberPath(path, name), a.children, b.children, i, j)
+		}
+		for j, child := range b.children {
+			if !matched[j] {
+				d.compareChild(memberPath(path, memberName(child)), a.children, b.children, -1, j)
+			}
+		}
+	}
+}
+
+// compareChild compares child i of a with child j of b, where an index out
+// of range means the side has no such child
+func (d *jsonDiffer) compareChild(path string, a, b []*jsonNode, i, j int) {
+	switch {
+	case i < 0 || i >= len(a):
+		d.entries = append(d.entries, jsonDiffEntry{op: '+', path: path, new: compactJSON(d.right[b[j].start:b[j].end])})
+	case j < 0 || j >= len(b):
+		d.entries = append(d.entries, jsonDiffEntry{op: '-', path: path, old: compactJSON(d.left[a[i].start:a[i].end])})
+	default:
+		d.compare(path, a[i], b[j])
+	}
+}
+
+// memberName returns the unquoted name of an object member
+func memberName(n *jsonNode) string {
+	var name string
+	if json.Unmarshal([]byte(n.key), &name) != nil {
+		return n.key
+	}
+	return name
+}
+
+// memberPath appends a member name to a JSONPath, in brackets unless it is
+// a plain identifier
+func memberPath(path, name string) string {
+	plain := name != ""
+	for _, r := range name {
+		if r != '_' && r != '$' && !(r >= 'a' && r <= 'z') && !(r >= 'A' && r <= 'Z') && !(r >= '0' && r <= '9') {
+			plain = false
+		}
+	}
+	if plain {
+		return path + "." + name
+	}
+	return path + "[" + strconv.Quote(name) + "]"
+}
+
+// compactJSON returns a value without insignificant whitespace, shortened
+// to maxDiffValue
+func compactJSON(value []byte) string {
+	var buf bytes.Buffer
+	if json.Compact(&buf, value) != nil {
+		buf.Reset()
+		buf.Write(value)
+	}
+	text := sanitizeString(buf.String())
+	if len(text) > maxDiffValue {
+		text = text[:maxDiffValue] + "..."
+	}
+	return text
+}
+
+// jsonDiffCounts returns how many values were added, removed and changed
+func jsonDiffCounts(entries []jsonDiffEntry) (added, removed, changed int) {
+	for _, e := range entries {
+		switch e.op {
+		case '+':
+			added++
+		case '-':
+			removed++
+		default:
+			changed++
+		}
+	}
+	return added, removed, changed
+}
+
+// diffObjects compares two JSON objects. With a selection spanning two of
+// them, those are compared. Otherwise the first press marks the object under
+// the cursor and the second compares it with the one under the cursor then.
+func (m *model) diffObjects() {
+	var picked []jsonObject
+	if m.selection.active {
+		start, end := m.selection.bounds(m.cursor)
+		for _, obj := range m.jsonObjects {
+			if obj.tree != nil && obj.startOffset <= end && obj.endOffset >= start {
+				picked = append(picked, obj)
+			}
+		}
+		if len(picked) < 2 {
+			m.status = "Select bytes spanning two JSON objects to compare them"
+			return
+		}
+		m.selection = selection{}
+	} else {
+		i := m.objectAt(m.cursor)
+		if i < 0 || m.jsonObjects[i].tree == nil {
+			m.status = "Move the cursor onto a JSON object to compare it"
+			return
+		}
+		obj := m.jsonObjects[i]
+		if m.diffMark == nil || m.diffMark.startOffset == obj.startOffset {
+			m.diffMark = &obj
+			m.status = fmt.Sprintf("Marked the object at %s, press '%s' on another one to compare them",
+				strings.TrimSpace(m.formatOffset(obj.startOffset)), m.keys.DiffObjects.Help().Key)
+			return
+		}
+		picked = []jsonObject{*m.diffMark, obj}
+		m.diffMark = nil
+	}
+
+	a, b := picked[0], picked[1]
+	d := newDiff([]string{
+		"object at " + strings.TrimSpace(m.formatOffset(a.startOffset)),
+		"object at " + strings.TrimSpace(m.formatOffset(b.startOffset)),
+	}, [][]byte{a.text(), b.text()})
+	if d.json == nil {
+		m.status = "The objects aren't valid JSON"
+		return
+	}
+	d.back = m.offset
+	m.diff = d
+	m.offset = 0
+}
+
+// updateJSONDiff handles a key press while a JSON diff is shown, where the
+// offset is the first entry in view
+func (m *model) updateJSONDiff(msg tea.KeyMsg) {
+	rows := m.visibleRows()
+	last := max(0, len(m.diff.json)-rows)
+	switch {
+	case key.Matches(msg, m.keys.Up), key.Matches(msg, m.keys.PrevMatch):
+		m.offset = max(0, m.offset-1)
+	case key.Matches(msg, m.keys.Down), key.Matches(msg, m.keys.NextMatch):
+		m.offset = min(last, m.offset+1)
+	case key.Matches(msg, m.keys.PageUp):
+		m.offset = max(0, m.offset-rows)
+	case key.Matches(msg, m.keys.PageDown):
+		m.offset = min(last, m.offset+rows)
+	case key.Matches(msg, m.keys.Home):
+		m.offset = 0
+	case key.Matches(msg, m.keys.End):
+		m.offset = last
+	}
+}
+
+// jsonDiffView renders the differences of a JSON diff, one per line
+func (m model) jsonDiffView() string {
+	var sb strings.Builder
+	sb.WriteString(m.theme.Header.Render("JSON diff: "+strings.Join(m.diff.names, " / ")) + "\n\n")
+	sb.WriteString(m.theme.Header.Render("Path and values") + "\n")
+	sb.WriteString(strings.Repeat("-", max(1, m.width)) + "\n")
+
+	end := min(len(m.diff.json), m.offset+m.visibleRows())
+	for _, e := range m.diff.json[min(m.offset, end):end] {
+		switch e.op {
+		case '+':
+			sb.WriteString(m.theme.DiffAdded.Render("+ "+e.path+": "+e.new) + "\n")
+		case '-':
+			sb.WriteString(m.theme.DiffRemoved.Render("- "+e.path+": "+e.old) + "\n")
+		default:
+			sb.WriteString(m.theme.DiffChanged.Render("~ "+e.path+": ") + m.theme.DiffRemoved.Render(e.old) +
+				" → " + m.theme.DiffAdded.Render(e.new) + "\n")
+		}
+	}
+	if len(m.diff.json) == 0 {
+		sb.WriteString(m.theme.JSON.Render("The documents are equal") + "\n")
+	}
+
+	added, removed, changed := jsonDiffCounts(m.diff.json)
+	sb.WriteString(m.footer(fmt.Sprintf("%s, %s, %s. '%s' for the byte diff, %s to leave diff.",
+		m.theme.DiffAdded.Render(fmt.Sprintf("%d added", added)),
+		m.theme.DiffRemoved.Render(fmt.Sprintf("%d removed", removed)),
+		m.theme.DiffChanged.Render(fmt.Sprintf("%d changed", changed)),
+		m.keys.NextLayout.Help().Key, m.keys.Cancel.Help().Key)))
+	return sb.String()
+}
@@ -0,0 +1,97 @@
+package prettybuffers
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDiffJSON(t *testing.T) {
+	tests := []struct {
+		name        string
+		left, right string
+		want        []string // entries as op path: old → new
+		err         bool
+	}{
+		{"equal", `{"a": 1, "b": [1, 2]}`, `{"b":[1,2],"a":1}`, nil, false},
+		{"changed", `{"a": 1}`, `{"a": "1"}`, []string{`~ $.a: 1 → "1"`}, false},
+		{"added and removed", `{"a": 1, "b": 2}`, `{"b": 2, "c": 3}`, []string{"- $.a: 1 → ", "+ $.c:  → 3"}, false},
+		{"nested", `{"u": {"name": "x", "tags": ["a"]}}`, `{"u": {"name": "y", "tags": ["a", "b"]}}`,
+			[]string{`~ $.u.name: "x" → "y"`, `+ $.u.tags[1]:  → "b"`}, false},
+		{"array shorter", `[1, 2, 3]`, `[1]`, []string{"- $[1]: 2 → ", "- $[2]: 3 → "}, false},
+		{"type changed", `{"a": {"b": 1}}`, `{"a": [1]}`, []string{`~ $.a: {"b":1} → [1]`}, false},
+		{"whitespace only", "{\n  \"a\": [ 1 ,2 ]\n}", `{"a":[1,2]}`, nil, false},
+		{"escaped names", `{"a": 1, "a b": 2}`, `{"a": 2, "a b": 3}`,
+			[]string{"~ $.a: 1 → 2", `~ $["a b"]: 2 → 3`}, false},
+		{"duplicate names", `{"a": 1, "a": 2}`, `{"a": 1, "a": 3}`, []string{"~ $.a: 2 → 3"}, false},
+		{"scalars", `"x"`, `"y"`, []string{`~ $: "x" → "y"`}, false},
+		{"long value", `{"a": "` + strings.Repeat("x", 100) + `"}`, `{"a": 1}`,
+			[]string{`~ $.a: "` + strings.Repeat("x", maxDiffValue-1) + "... → 1"}, false},
+		{"invalid", `{"a": 1`, `{}`, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entries, err := diffJSON([]byte(tt.left), []byte(tt.right))
+			if (err != nil) != tt.err {
+				t.Fatalf("error %v", err)
+			}
+			var got []string
+			for _, e := range entries {
+				got = append(got, fmt.Sprintf("%c %s: %s → %s", e.op, e.path, e.old, e.new))
+			}
+			if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+				t.Errorf("got\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(tt.want, "\n"))
+			}
+		})
+	}
+}
+
+// TestDiffJSONLarge makes sure that documents with many members and
+// elements are compared quickly
+func TestDiffJSONLarge(t *testing.T) {
+	var left, right strings.Builder
+	left.WriteString("{")
+	right.WriteString("{")
+	n := 1 << 15
+	for i := range n {
+		if i > 0 {
+			left.WriteString(",")
+			right.WriteString(",")
+		}
+		fmt.Fprintf(&left, `"key%d": %d`, i, i)
+		// The same members in reverse order, one of them changed
+		j := n - 1 - i
+		v := j
+		if j == 7 {
+			v = -1
+		}
+		fmt.Fprintf(&right, `"key%d": %d`, j, v)
+	}
+	left.WriteString("}")
+	right.WriteString("}")
+	array := "[" + strings.TrimSuffix(strings.Repeat(`{"id": 1},`, n), ",") + "]"
+	tests := []struct {
+		name        string
+		left, right string
+		want        int
+	}{
+		{"many members", left.String(), right.String(), 1},
+		{"many elements", array, strings.Replace(array, "1", "2", 1), 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start := time.Now()
+			entries, err := diffJSON([]byte(tt.left), []byte(tt.right))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(entries) != tt.want {
+				t.Errorf("found %d differences, want %d", len(entries), tt.want)
+			}
+			if elapsed := time.Since(start); elapsed > 5*time.Second {
+				t.Errorf("comparing took %v", elapsed)
+			}
+		})
+	}
+}
@@ -0,0 +1,198 @@
+package prettybuffers
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// jsonPathStep is one step of a JSONPath expression, such as .name, [2] or
+// ..id
+type jsonPathStep struct {
+	key       string // member name, unless index or wildcard is set
+	index     *int   // array element, negative counting from the end
+	wildcard  bool   // every member or element
+	recursive bool   // at any depth below, as with ..
+}
+
+// parseJSONPath parses the subset of JSONPath the query prompt supports:
+// member names (.name or ['name']), array indexes ([0], [-1]), wildcards
+// (.* or [*]) and recursive descent (..name). The leading $ may be left
+// out, so jq-style paths such as .items[0].id work as well.
+func parseJSONPath(expr string) ([]jsonPathStep, error) {
+	rest := strings.TrimPrefix(strings.TrimSpace(expr), "$")
+	var steps []jsonPathStep
+	for rest != "" {
+		var step jsonPathStep
+		switch {
+		case strings.HasPrefix(rest, ".."):
+			step.recursive = true
+			rest = rest[2:]
+		case rest[0] == '.':
+			rest = rest[1:]
+		case rest[0] != '[':
+			return nil, fmt.Errorf("expected . or [ at %q", rest)
+		}
+		if strings.HasPrefix(rest, "[") {
+			end := strings.IndexByte(rest, ']')
+			if end < 0 {
+				return nil, fmt.Errorf("missing ] in %q", rest)
+			}
+			inner := strings.TrimSpace(rest[1:end])
+			rest = rest[end+1:]
+			switch {
+			case inner == "*":
+				step.wildcard = true
+			case len(inner) >= 2 && (inner[0] == '\'' || inner[0] == '"') && inner[len(inner)-1] == inner[0]:
+				step.key = inner[1 : len(inner)-1]
+			default:
+				i, err := strconv.Atoi(inner)
+				if err != nil {
+					return nil, fmt.Errorf("invalid index %q", inner)
+				}
+				step.index = &i
+			}
+		} else {
+			end := strings.IndexAny(rest, ".[")
+			if end < 0 {
+				end = len(rest)
+			}
+			name := rest[:end]
+			rest = rest[end:]
+			switch name {
+			case "":
+				return nil, fmt.Errorf("missing name in %q", expr)
+			case "*":
+				step.wildcard = true
+			default:
+				step.key = name
+			}
+		}
+		steps = append(steps, step)
+	}
+	return steps, nil
+}
+
+// evalJSONPath returns the nodes of the tree rooted at root that the steps
+// select, read from text
+func evalJSONPath(root *jsonNode, text []byte, steps []jsonPathStep) []*jsonNode {
+	nodes := []*jsonNode{root}
+	for _, step := range steps {
+		var next []*jsonNode
+		for _, n := range nodes {
+			if step.recursive {
+				n.walk(func(d *jsonNode) {
+					next = append(next, d.selectChildren(text, step)...)
+				})
+			} else {
+				next = append(next, n.selectChildren(text, step)...)
+			}
+		}
+		nodes = next
+	}
+	return nodes
+}
+
+// walk calls fn for n and every node below it
+func (n *jsonNode) walk(fn func(*jsonNode)) {
+	fn(n)
+	for _, child := range n.children {
+		child.walk(fn)
+	}
+}
+
+// selectChildren returns the children of n that match a step
+func (n *jsonNode) selectChildren(text []byte, step jsonPathStep) []*jsonNode {
+	switch {
+	case step.wildcard:
+		return n.children
+	case step.index != nil:
+		i := *step.index
+		if i < 0 {
+			i += len(n.children)
+		}
+		if n.open != '[' || i < 0 || i >= len(n.children) {
+			return nil
+		}
+		return n.children[i : i+1]
+	case n.open != '{':
+		return nil
+	}
+	var selected []*jsonNode
+	for _, child := range n.children {
+		var key string
+		if json.Unmarshal([]byte(child.key), &key) == nil && key == step.key {
+			selected = append(selected, child)
+		}
+	}
+	return selected
+}
+
+// startQuery evaluates a JSONPath expression against the JSON object under
+// the cursor and shows the values it selects as search matches, so that the
+// NextMatch and PrevMatch keys step through them
+func (m *model) startQuery(expr string) {
+	i := m.objectAt(m.cursor)
+	if i < 0 || m.jsonObjects[i].tree == nil {
+		m.status = "Move the cursor onto a JSON object to query it"
+		return
+	}
+	steps, err := parseJSONPath(expr)
+	if err != nil {
+		m.status = "Invalid JSONPath: " + err.Error()
+		return
+	}
+	m.search = searchState{mode: searchJSONPath, query: expr, path: steps, object: m.jsonObjects[i].startOffset}
+	m.refreshSearch()
+	if len(m.search.matches) == 0 {
+		m.status = fmt.Sprintf("No values match %s", expr)
+		return
+	}
+	m.jumpToMatch()
+}
+
+// queryMatches returns the values selected by the JSONPath of the search in
+// the object it was run against, sorted by offset
+func (m model) queryMatches() []searchMatch {
+	for _, obj := range m.jsonObjects {
+		if obj.startOffset != m.search.object || obj.tree == nil {
+			continue
+		}
+		var matches []searchMatch
+		for _, n := range evalJSONPath(obj.tree, obj.text(), m.search.path) {
+			matches = append(matches, searchMatch{offset: obj.startOffset + n.start, length: n.end - n.start})
+		}
+		sort.Slice(matches, func(i, j int) bool { return matches[i].offset < matches[j].offset })
+		return matches
+	}
+	return nil
+}
+
+// maxQueryValue is how much of a value selected by a query the status shows
+const maxQueryValue = 60
+
+// queryValue returns the text of a value selected by a query, shortened for
+// the status line
+func (m model) queryValue(match searchMatch) string {
+	value := sanitizeString(string(m.window(match.offset, min(match.length, maxQueryValue))))
+	if match.length > maxQueryValue {
+		value += "..."
+	}
+	return value
+}
+
+// matchesLine reports whether a value selected by a query overlaps the
+// bytes from start to end, e.g. of a line of a JSON tree
+func (m model) matchesLine(start, end int) bool {
+	if m.search.path == nil {
+		return false
+	}
+	for _, match := range m.search.matches {
+		if match.offset < end && match.offset+match.length > start {
+			return true
+		}
+	}
+	return false
+}
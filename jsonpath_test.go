@@ -0,0 +1,153 @@
+package prettybuffers
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseJSONPath(t *testing.T) {
+	tests := []struct {
+		expr  string
+		steps int
+		err   string // part of the error, "" for none
+	}{
+		{"$", 0, ""},
+		{"", 0, ""},
+		{"$.items[0].id", 3, ""},
+		{".items[-1]", 2, ""},
+		{"$['a b'][\"c\"]", 2, ""},
+		{"$..id", 1, ""},
+		{"$.*[*]", 2, ""},
+		{"$..[0]", 1, ""},
+		{"items", 0, `expected . or [ at "items"`},
+		{"$.a[0", 0, "missing ] in"},
+		{"$.a[x]", 0, `invalid index "x"`},
+		{"$.a.", 0, "missing name"},
+		{"$.a..", 0, "missing name"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			steps, err := parseJSONPath(tt.expr)
+			switch {
+			case tt.err == "" && err != nil:
+				t.Fatalf("error %v", err)
+			case tt.err != "":
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("error is %v, want one with %q", err, tt.err)
+				}
+				return
+			}
+			if len(steps) != tt.steps {
+				t.Errorf("parsed %d steps, want %d", len(steps), tt.steps)
+			}
+		})
+	}
+}
+
+// queryJSON returns the text of the values expr selects in doc
+func queryJSON(t *testing.T, doc, expr string) []string {
+	t.Helper()
+	tree, err := parseJSONTree([]byte(doc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	steps, err := parseJSONPath(expr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var values []string
+	for _, n := range evalJSONPath(tree, []byte(doc), steps) {
+		values = append(values, doc[n.start:n.end])
+	}
+	return values
+}
+
+func TestEvalJSONPath(t *testing.T) {
+	doc := `{"items": [{"id": 1, "tags": ["a", "b"]}, {"id": 2, "name": "x"}], "a b": true, "id": "top", "\u0065scaped": 3}`
+	tests := []struct {
+		expr string
+		want []string
+	}{
+		{"$", []string{doc}},
+		{"$.items[0].id", []string{"1"}},
+		{".items[1].name", []string{`"x"`}},
+		{"$.items[-1].id", []string{"2"}},
+		{"$.items[2]", nil},
+		{"$.items[-3]", nil},
+		{"$.items[*].id", []string{"1", "2"}},
+		{"$.items[0].*", []string{"1", `["a", "b"]`}},
+		{"$['a b']", []string{"true"}},
+		{"$.escaped", []string{"3"}},
+		{"$..id", []string{`"top"`, "1", "2"}},
+		{"$..tags[1]", []string{`"b"`}},
+		{"$.missing.id", nil},
+		{"$.id[0]", nil},
+		{"$.items.id", nil},
+		{"$[0]", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			got := queryJSON(t, doc, tt.expr)
+			if strings.Join(got, "\n") != strings.Join(tt.want, "\n") || len(got) != len(tt.want) {
+				t.Errorf("selected %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestEvalJSONPathLarge makes sure that recursive queries over large and
+// deeply nested documents finish quickly
+func TestEvalJSONPathLarge(t *testing.T) {
+	wide := "[" + strings.TrimSuffix(strings.Repeat(`{"id": 1, "v": {"id": 2}},`, 1<<15), ",") + "]"
+	deep := strings.Repeat(`{"a":`, 1000) + "1" + strings.Repeat("}", 1000)
+	tests := []struct {
+		name string
+		doc  string
+		expr string
+		want int // values selected
+	}{
+		{"wide", wide, "$..id", 2 << 15},
+		{"wide wildcard", wide, "$[*].v.id", 1 << 15},
+		{"deep", deep, "$..a", 1000},
+		{"deep twice", deep, "$..a..a", 1000 * 999 / 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start := time.Now()
+			if got := len(queryJSON(t, tt.doc, tt.expr)); got != tt.want {
+				t.Errorf("selected %d values, want %d", got, tt.want)
+			}
+			if elapsed := time.Since(start); elapsed > 5*time.Second {
+				t.Errorf("querying took %v", elapsed)
+			}
+		})
+	}
+}
+
+// TestStartQuery checks that the values a query selects become search
+// matches at their offsets in the buffer
+func TestStartQuery(t *testing.T) {
+	m := initialModel(config{})
+	m.setData([]byte(`xx {"a": [10, 20]} {"a": [30]}`))
+	m.cursor = 3
+	m.startQuery("$.a[*]")
+	want := []searchMatch{{offset: 10, length: 2}, {offset: 14, length: 2}}
+	if len(m.search.matches) != len(want) {
+		t.Fatalf("found %v, want %v", m.search.matches, want)
+	}
+	for i, match := range m.search.matches {
+		if match != want[i] {
+			t.Errorf("match %d is %v, want %v", i, match, want[i])
+		}
+	}
+	if m.cursor != 10 {
+		t.Errorf("cursor is at %d, want the first match at 10", m.cursor)
+	}
+
+	m.cursor = 0
+	m.startQuery("$.a")
+	if m.status != "Move the cursor onto a JSON object to query it" {
+		t.Errorf("status is %q off any object", m.status)
+	}
+}
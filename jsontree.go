@@ -0,0 +1,326 @@
+package prettybuffers
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/charmbracelet/lipgloss"
+)
+
+// jsonNode is a value of a JSON object shown as a tree in the Smart View.
+// Offsets are relative to the start of the object, so that each line of the
+// tree shows the bytes it was parsed from.
+type jsonNode struct {
+	key       string // as written, quotes included; "" for array elements and the root
+	lineStart int    // of the key, or of the value if it has none
+	start     int    // of the value
+	end       int    // past the value
+	open      byte   // '{' or '[' for containers, 0 for other values
+	children  []*jsonNode
+}
+
+// maxJSONDepth bounds the nesting of the trees built, like encoding/json
+const maxJSONDepth = 10000
+
+// jsonTreeParser builds a jsonNode tree from JSON text already known to be
+// valid, recording where each value starts and ends
+type jsonTreeParser struct {
+	text  []byte
+	pos   int
+	depth int
+}
+
+// parseJSONTree parses the JSON text of a detected object into a tree
+func parseJSONTree(text []byte) (*jsonNode, error) {
+	p := &jsonTreeParser{text: text}
+	p.skipSpace()
+	return p.value()
+}
+
+// skipSpace moves past whitespace
+func (p *jsonTreeParser) skipSpace() {
+	for p.pos < len(p.text) && strings.IndexByte(" \t\r\n", p.text[p.pos]) >= 0 {
+		p.pos++
+	}
+}
+
+// value parses the value at the current position
+func (p *jsonTreeParser) value() (*jsonNode, error) {
+	if p.pos >= len(p.text) {
+		return nil, errors.New("unexpected end of JSON")
+	}
+	n := &jsonNode{lineStart: p.pos, start: p.pos}
+	switch c := p.text[p.pos]; c {
+	case '{', '[':
+		if p.depth++; p.depth > maxJSONDepth {
+			return nil, errors.New("JSON nested too deeply")
+		}
+		defer func() { p.depth-- }()
+		n.open = c
+		if err := p.container(n); err != nil {
+			return nil, err
+		}
+	case '"':
+		if err := p.skipString(); err != nil {
+			return nil, err
+		}
+	default:
+		// Numbers, true, false and null
+		for p.pos < len(p.text) && strings.IndexByte(",]} \t\r\n", p.text[p.pos]) < 0 {
+			p.pos++
+		}
+	}
+	n.end = p.pos
+	return n, nil
+}
+
+// container parses the members of an object or the elements of an array
+func (p *jsonTreeParser) container(n *jsonNode) error {
+	closing := byte(']')
+	if n.open == '{' {
+		closing = '}'
+	}
+	p.pos++
+	p.skipSpace()
+	for p.pos < len(p.text) && p.text[p.pos] != closing {
+		keyStart, key := p.pos, ""
+		if n.open == '{' {
+			if err := p.skipString(); err != nil {
+				return err
+			}
+			key = string(p.text[keyStart:p.pos])
+			p.skipSpace()
+			if p.pos >= len(p.text) || p.text[p.pos] != ':' {
+				return fmt.Errorf("missing colon after key at %d", keyStart)
+			}
+			p.pos++
+			p.skipSpace()
+		}
+		child, err := p.value()
+		if err != nil {
+			return err
+		}
+		child.key, child.lineStart = key, keyStart
+		n.children = append(n.children, child)
+		p.skipSpace()
+		if p.pos < len(p.text) && p.text[p.pos] == ',' {
+			p.pos++
+			p.skipSpace()
+		}
+	}
+	if p.pos >= len(p.text) {
+		return errors.New("unexpected end of JSON")
+	}
+	p.pos++
+	return nil
+}
+
+// skipString moves past the string starting at the current position
+func (p *jsonTreeParser) skipString() error {
+	start := p.pos
+	for p.pos++; p.pos < len(p.text); p.pos++ {
+		switch p.text[p.pos] {
+		case '\\':
+			p.pos++
+		case '"':
+			p.pos++
+			return nil
+		}
+	}
+	return fmt.Errorf("unterminated string at %d", start)
+}
+
+// jsonLine is one line of a JSON tree as shown in the Smart View
+type jsonLine struct {
+	text       string
+	start, end int // bytes the line was parsed from, relative to the object
+}
+
+// jsonTreeLines renders the tree of obj, with the containers starting at the
+// offsets in collapsed folded into one line
+func jsonTreeLines(obj jsonObject, collapsed map[int]bool) []jsonLine {
+	var lines []jsonLine
+	obj.tree.appendLines(&lines, obj.text(), 0, true, func(n *jsonNode) bool {
+		return collapsed[obj.startOffset+n.start]
+	})
+	return lines
+}
+
+// appendLines appends the lines of n and its children at the given depth
+func (n *jsonNode) appendLines(lines *[]jsonLine, text []byte, depth int, last bool, collapsed func(*jsonNode) bool) {
+	prefix := strings.Repeat("  ", depth)
+	if n.key != "" {
+		prefix += n.key + ": "
+	}
+	comma := ","
+	if last {
+		comma = ""
+	}
+	switch {
+	case n.open == 0, len(n.children) == 0:
+		*lines = append(*lines, jsonLine{text: prefix + string(text[n.start:n.end]) + comma, start: n.lineStart, end: n.end})
+	case collapsed(n):
+		*lines = append(*lines, jsonLine{text: prefix + n.folded() + comma, start: n.lineStart, end: n.end})
+	default:
+		*lines = append(*lines, jsonLine{text: prefix + string(n.open), start: n.lineStart, end: n.start + 1})
+		for i, child := range n.children {
+			child.appendLines(lines, text, depth+1, i == len(n.children)-1, collapsed)
+		}
+		*lines = append(*lines, jsonLine{text: strings.Repeat("  ", depth) + string(text[n.end-1]) + comma, start: n.end - 1, end: n.end})
+	}
+}
+
+// folded shows a collapsed container with the number of its children, e.g.
+// {... 3 keys}
+func (n *jsonNode) folded() string {
+	if n.open == '{' {
+		return fmt.Sprintf("{... %d %s}", len(n.children), plural(len(n.children), "key", "keys"))
+	}
+	return fmt.Sprintf("[... %d %s]", len(n.children), plural(len(n.children), "item", "items"))
+}
+
+// plural returns one if n is 1 and other otherwise
+func plural(n int, one, other string) string {
+	if n == 1 {
+		return one
+	}
+	return other
+}
+
+// foldAt returns the container to fold or unfold for the cursor at pos,
+// relative to the start of the tree: the outermost collapsed container
+// holding it, or else the innermost one
+func (n *jsonNode) foldAt(pos int, collapsed func(*jsonNode) bool) *jsonNode {
+	var found *jsonNode
+	for node := n; node != nil; {
+		if node.open == 0 || len(node.children) == 0 || pos < node.lineStart || pos >= node.end {
+			break
+		}
+		if collapsed(node) {
+			return node
+		}
+		found = node
+		next := (*jsonNode)(nil)
+		for _, child := range node.children {
+			if pos >= child.lineStart && pos < child.end {
+				next = child
+				break
+			}
+		}
+		node = next
+	}
+	return found
+}
+
+// toggleFold collapses or expands the JSON container under the cursor in
+// the Smart View. It reports whether there was one.
+func (m *model) toggleFold() bool {
+	if len(m.layout.Renderers) > 0 || !containsColumn(m.layout.Columns, ColumnJSON) {
+		return false
+	}
+	i := m.objectAt(m.cursor)
+	if i < 0 || m.jsonObjects[i].tree == nil {
+		return false
+	}
+	obj := m.jsonObjects[i]
+	isCollapsed := func(n *jsonNode) bool { return m.collapsed[obj.startOffset+n.start] }
+	node := obj.tree.foldAt(m.cursor-obj.startOffset, isCollapsed)
+	if node == nil {
+		return false
+	}
+	at := obj.startOffset + node.start
+	if m.collapsed[at] {
+		delete(m.collapsed, at)
+		m.status = fmt.Sprintf("Expanded %d %s at %s", len(node.children),
+			plural(len(node.children), "child", "children"), strings.TrimSpace(m.formatOffset(at)))
+		return true
+	}
+	if m.collapsed == nil {
+		m.collapsed = make(map[int]bool)
+	}
+	m.collapsed[at] = true
+	// Keep the cursor on the line the container folded into
+	m.moveCursor(obj.startOffset + node.lineStart - m.cursor)
+	m.status = fmt.Sprintf("Collapsed %s at %s", node.folded(), strings.TrimSpace(m.formatOffset(at)))
+	return true
+}
+
+// highlightJSON colors the keys, strings, numbers, booleans and null in a
+// line of JSON with the styles of theme, and everything else with theme.JSON.
+// Lines cut off in the middle of a string are colored up to where they end.
+func highlightJSON(theme Theme, line string) string {
+	var sb strings.Builder
+	plain := 0 // start of the text not written yet
+	for i := 0; i < len(line); {
+		style, end := jsonToken(theme, line, i)
+		if end == i {
+			i++
+			continue
+		}
+		if plain < i {
+			sb.WriteString(theme.JSON.Render(line[plain:i]))
+		}
+		sb.WriteString(style.Inherit(theme.JSON).Render(line[i:end]))
+		i, plain = end, end
+	}
+	if plain < len(line) {
+		sb.WriteString(theme.JSON.Render(line[plain:]))
+	}
+	return sb.String()
+}
+
+// jsonToken returns the style of the token starting at line[i] and where it
+// ends, or i if no token to color starts there
+func jsonToken(theme Theme, line string, i int) (lipgloss.Style, int) {
+	// Numbers and words only start after a delimiter, not inside e.g. "keys"
+	if i > 0 && isJSONWordByte(line[i-1]) {
+		return lipgloss.Style{}, i
+	}
+	switch c := line[i]; {
+	case c == '"':
+		end := i + 1
+		for end < len(line) && line[end] != '"' {
+			if line[end] == '\\' {
+				end++
+			}
+			end++
+		}
+		end = min(end+1, len(line))
+		if rest := strings.TrimLeft(line[end:], " "); strings.HasPrefix(rest, ":") {
+			return theme.JSONKey, end
+		}
+		return theme.JSONString, end
+	case c == '-' || c >= '0' && c <= '9':
+		end := i + 1
+		for end < len(line) && strings.IndexByte("0123456789+-.eE", line[end]) >= 0 {
+			end++
+		}
+		return theme.JSONNumber, end
+	}
+	end := i
+	for end < len(line) && isJSONWordByte(line[end]) {
+		end++
+	}
+	switch line[i:end] {
+	case "true", "false":
+		return theme.JSONBool, end
+	case "null":
+		return theme.JSONNull, end
+	}
+	return lipgloss.Style{}, i
+}
+
+// isJSONWordByte reports whether c can be part of a number or literal
+func isJSONWordByte(c byte) bool {
+	return c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '.' || c == '_'
+}
+
+// renderJSON renders a line of JSON in the Smart View. While text is being
+// searched for, the matches are shown instead of the syntax.
+func (m model) renderJSON(line string) string {
+	if len(m.search.matches) > 0 && m.search.path == nil {
+		return m.highlightText(line, m.theme.JSON)
+	}
+	return highlightJSON(m.theme, line)
+}
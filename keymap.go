@@ -0,0 +1,177 @@
+package prettybuffers
+
+import "github.com/charmbracelet/bubbles/key"
+
+// KeyMap holds the key bindings of the viewer. The help overlay is generated
+// from it, so changed bindings are listed correctly.
+type KeyMap struct {
+	// Navigation
+	Up           key.Binding
+	Down         key.Binding
+	Left         key.Binding
+	Right        key.Binding
+	PageUp       key.Binding
+	PageDown     key.Binding
+	HalfPageUp   key.Binding
+	HalfPageDown key.Binding
+	RowStart     key.Binding
+	RowEnd       key.Binding
+	Home         key.Binding // first byte of the buffer
+	End          key.Binding // last byte of the buffer
+	Top          key.Binding // pressed twice, like vim's gg
+	Bottom       key.Binding
+	NextRun      key.Binding
+	PrevRun      key.Binding
+	NextFrame    key.Binding // with framing configured, see WithFraming, between chunks or in a capture file, else between detected objects
+	PrevFrame    key.Binding
+	NextObject   key.Binding // between detected objects, also where there are frames
+	PrevObject   key.Binding
+	Count        key.Binding // starts a count repeating the next motion
+
+	// Search
+	SearchHex   key.Binding
+	SearchText  key.Binding
+	SearchRegex key.Binding
+	QueryJSON   key.Binding // select values of the JSON object under the cursor by JSONPath
+	NextMatch   key.Binding // also the next difference in diff mode
+	PrevMatch   key.Binding
+
+	// Selection
+	Select          key.Binding
+	Copy            key.Binding
+	Hash            key.Binding
+	DeleteSelection key.Binding
+
+	// Editing
+	Edit       key.Binding
+	Save       key.Binding
+	EditColumn key.Binding
+	EditInsert key.Binding // in the hex column only, where it is not a digit
+	EditDelete key.Binding // in the hex column only, where it is not a digit
+	Backspace  key.Binding
+	FlipBit    key.Binding // in the bit view, inverts the bit under the cursor
+
+	// View
+	NextLayout        key.Binding
+	NextTheme         key.Binding
+	GroupBytes        key.Binding // cycle the hex column through bytes and 16, 32 and 64-bit words
+	ToggleEndian      key.Binding // byte order of grouped words and overlaid fields
+	BitView           key.Binding // show the bits of each byte, with a cursor on a single bit
+	DecimalOffsets    key.Binding // show offsets in decimal or hexadecimal
+	EntropyOverview   key.Binding
+	ToggleFold        key.Binding // collapse or expand the JSON object or array under the cursor in the Smart View
+	EnterNested       key.Binding // open the decoded contents of the object under the cursor
+	LeaveNested       key.Binding
+	Reinterpret       key.Binding // read the object under the cursor as what another detector found
+	Histogram         key.Binding // of the selection, or the whole buffer
+	ObjectList        key.Binding // sidebar listing the detected objects, to jump between them
+	LineBytes         key.Binding // select the bytes of the Smart View line of the cursor in the Hex View
+	DiffObjects       key.Binding // compare two JSON objects structurally
+	PayloadsOnly      key.Binding // hide the bytes between objects in the Smart View
+	ChunkTimes        key.Binding // cycle between hiding the arrival of streamed chunks and showing it relative or absolute
+	Varint            key.Binding // decode the varint at the cursor
+	NextEntropyRegion key.Binding // next region of low or high entropy
+	PrevEntropyRegion key.Binding
+	Help              key.Binding
+
+	// General
+	Open    key.Binding
+	Command key.Binding
+	Cancel  key.Binding
+	Quit    key.Binding
+}
+
+// DefaultKeyMap returns the default key bindings
+func DefaultKeyMap() KeyMap {
+	return KeyMap{
+		Up:           key.NewBinding(key.WithKeys("up", "k"), key.WithHelp("↑/k", "up one row")),
+		Down:         key.NewBinding(key.WithKeys("down", "j"), key.WithHelp("↓/j", "down one row")),
+		Left:         key.NewBinding(key.WithKeys("left", "h"), key.WithHelp("←/h", "previous byte")),
+		Right:        key.NewBinding(key.WithKeys("right", "l"), key.WithHelp("→/l", "next byte")),
+		PageUp:       key.NewBinding(key.WithKeys("pgup"), key.WithHelp("pgup", "page up")),
+		PageDown:     key.NewBinding(key.WithKeys("pgdown"), key.WithHelp("pgdown", "page down")),
+		HalfPageUp:   key.NewBinding(key.WithKeys("ctrl+u"), key.WithHelp("ctrl+u", "half page up")),
+		HalfPageDown: key.NewBinding(key.WithKeys("ctrl+d"), key.WithHelp("ctrl+d", "half page down")),
+		RowStart:     key.NewBinding(key.WithKeys("0"), key.WithHelp("0", "start of row")),
+		RowEnd:       key.NewBinding(key.WithKeys("$"), key.WithHelp("$", "end of row")),
+		Home:         key.NewBinding(key.WithKeys("home"), key.WithHelp("home", "first byte")),
+		End:          key.NewBinding(key.WithKeys("end"), key.WithHelp("end", "last byte")),
+		Top:          key.NewBinding(key.WithKeys("g"), key.WithHelp("gg", "first byte, or row N")),
+		Bottom:       key.NewBinding(key.WithKeys("G"), key.WithHelp("G", "last byte, or row N")),
+		NextRun:      key.NewBinding(key.WithKeys("w"), key.WithHelp("w", "next non-zero run")),
+		PrevRun:      key.NewBinding(key.WithKeys("b"), key.WithHelp("b", "previous non-zero run")),
+		NextFrame:    key.NewBinding(key.WithKeys("]"), key.WithHelp("]", "next frame, packet or object")),
+		PrevFrame:    key.NewBinding(key.WithKeys("["), key.WithHelp("[", "previous frame, packet or object")),
+		NextObject:   key.NewBinding(key.WithKeys(")"), key.WithHelp(")", "next detected object")),
+		PrevObject:   key.NewBinding(key.WithKeys("("), key.WithHelp("(", "previous detected object")),
+		Count: key.NewBinding(key.WithKeys("1", "2", "3", "4", "5", "6", "7", "8", "9"),
+			key.WithHelp("1-9", "count, e.g. 10j")),
+
+		SearchHex:   key.NewBinding(key.WithKeys("/"), key.WithHelp("/", "search hex")),
+		SearchText:  key.NewBinding(key.WithKeys("s"), key.WithHelp("s", "search text")),
+		SearchRegex: key.NewBinding(key.WithKeys("r"), key.WithHelp("r", "search regex")),
+		QueryJSON:   key.NewBinding(key.WithKeys("J"), key.WithHelp("J", "query JSON by path")),
+		NextMatch:   key.NewBinding(key.WithKeys("n"), key.WithHelp("n", "next match")),
+		PrevMatch:   key.NewBinding(key.WithKeys("N"), key.WithHelp("N", "previous match")),
+
+		Select:          key.NewBinding(key.WithKeys("v"), key.WithHelp("v", "start/stop selecting")),
+		Copy:            key.NewBinding(key.WithKeys("y"), key.WithHelp("y", "copy selection")),
+		Hash:            key.NewBinding(key.WithKeys("#"), key.WithHelp("#", "hash selection")),
+		DeleteSelection: key.NewBinding(key.WithKeys("x", "d"), key.WithHelp("x/d", "delete selection")),
+
+		Edit:       key.NewBinding(key.WithKeys("e"), key.WithHelp("e", "edit")),
+		Save:       key.NewBinding(key.WithKeys("ctrl+s"), key.WithHelp("ctrl+s", "save")),
+		EditColumn: key.NewBinding(key.WithKeys("tab"), key.WithHelp("tab", "hex/ASCII column")),
+		EditInsert: key.NewBinding(key.WithKeys("insert", "i"), key.WithHelp("insert/i", "toggle insert")),
+		EditDelete: key.NewBinding(key.WithKeys("delete", "x"), key.WithHelp("delete/x", "delete byte")),
+		Backspace:  key.NewBinding(key.WithKeys("backspace"), key.WithHelp("backspace", "delete previous byte")),
+		FlipBit:    key.NewBinding(key.WithKeys(" "), key.WithHelp("space", "flip bit in bit view")),
+
+		NextLayout:        key.NewBinding(key.WithKeys("L"), key.WithHelp("L", "next layout")),
+		NextTheme:         key.NewBinding(key.WithKeys("t"), key.WithHelp("t", "next theme")),
+		GroupBytes:        key.NewBinding(key.WithKeys("W"), key.WithHelp("W", "group bytes into words")),
+		ToggleEndian:      key.NewBinding(key.WithKeys("E"), key.WithHelp("E", "toggle little/big-endian")),
+		BitView:           key.NewBinding(key.WithKeys("B"), key.WithHelp("B", "toggle bit view")),
+		DecimalOffsets:    key.NewBinding(key.WithKeys("D"), key.WithHelp("D", "decimal/hex offsets")),
+		Histogram:         key.NewBinding(key.WithKeys("H"), key.WithHelp("H", "byte histogram")),
+		ObjectList:        key.NewBinding(key.WithKeys("S"), key.WithHelp("S", "list detected objects")),
+		LineBytes:         key.NewBinding(key.WithKeys("X"), key.WithHelp("X", "show bytes of Smart View line")),
+		DiffObjects:       key.NewBinding(key.WithKeys("K"), key.WithHelp("K", "diff two JSON objects")),
+		PayloadsOnly:      key.NewBinding(key.WithKeys("P"), key.WithHelp("P", "show payloads only")),
+		ChunkTimes:        key.NewBinding(key.WithKeys("T"), key.WithHelp("T", "chunk arrival times")),
+		Varint:            key.NewBinding(key.WithKeys("V"), key.WithHelp("V", "decode varint at cursor")),
+		ToggleFold:        key.NewBinding(key.WithKeys("enter", " "), key.WithHelp("enter/space", "fold/unfold JSON")),
+		EnterNested:       key.NewBinding(key.WithKeys("enter"), key.WithHelp("enter", "open decoded object")),
+		LeaveNested:       key.NewBinding(key.WithKeys("backspace"), key.WithHelp("backspace", "back to outer buffer")),
+		Reinterpret:       key.NewBinding(key.WithKeys("I"), key.WithHelp("I", "next interpretation of object")),
+		EntropyOverview:   key.NewBinding(key.WithKeys("O"), key.WithHelp("O", "toggle entropy overview")),
+		NextEntropyRegion: key.NewBinding(key.WithKeys("}"), key.WithHelp("}", "next entropy region")),
+		PrevEntropyRegion: key.NewBinding(key.WithKeys("{"), key.WithHelp("{", "previous entropy region")),
+		Help:              key.NewBinding(key.WithKeys("?"), key.WithHelp("?", "toggle help")),
+
+		Open:    key.NewBinding(key.WithKeys("o"), key.WithHelp("o", "open file")),
+		Command: key.NewBinding(key.WithKeys(":"), key.WithHelp(":", "command")),
+		Cancel:  key.NewBinding(key.WithKeys("esc"), key.WithHelp("esc", "cancel, clear search")),
+		Quit:    key.NewBinding(key.WithKeys("q", "ctrl+c"), key.WithHelp("q", "quit")),
+	}
+}
+
+// keyGroup is a titled set of bindings shown together in the help overlay
+type keyGroup struct {
+	title    string
+	bindings []key.Binding
+}
+
+// groups returns the bindings grouped by feature
+func (k KeyMap) groups() []keyGroup {
+	return []keyGroup{
+		{"Navigation", []key.Binding{k.Up, k.Down, k.Left, k.Right, k.PageUp, k.PageDown,
+			k.HalfPageUp, k.HalfPageDown, k.RowStart, k.RowEnd, k.Home, k.End, k.Top, k.Bottom,
+			k.NextRun, k.PrevRun, k.NextFrame, k.PrevFrame, k.NextObject, k.PrevObject, k.Count}},
+		{"Search", []key.Binding{k.SearchHex, k.SearchText, k.SearchRegex, k.QueryJSON, k.NextMatch, k.PrevMatch}},
+		{"Selection", []key.Binding{k.Select, k.Copy, k.Hash, k.DeleteSelection}},
+		{"Editing", []key.Binding{k.Edit, k.Save, k.EditColumn, k.EditInsert, k.EditDelete, k.Backspace, k.FlipBit}},
+		{"View", []key.Binding{k.NextLayout, k.NextTheme, k.GroupBytes, k.ToggleEndian, k.BitView, k.DecimalOffsets, k.Histogram, k.ObjectList, k.PayloadsOnly, k.ChunkTimes, k.LineBytes, k.DiffObjects, k.Varint, k.ToggleFold, k.EnterNested, k.LeaveNested, k.Reinterpret, k.EntropyOverview, k.NextEntropyRegion, k.PrevEntropyRegion, k.Help}},
+		{"General", []key.Binding{k.Open, k.Command, k.Cancel, k.Quit}},
+	}
+}
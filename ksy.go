@@ -0,0 +1,423 @@
+package prettybuffers
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// yamlNode is a scalar, list or mapping of the YAML subset .ksy files use
+type yamlNode struct {
+	scalar string
+	list   []*yamlNode
+	keys   []string // of a mapping, in order
+	values map[string]*yamlNode
+}
+
+// get returns the value of key in a mapping, or nil
+func (n *yamlNode) get(key string) *yamlNode {
+	if n == nil || n.values == nil {
+		return nil
+	}
+	return n.values[key]
+}
+
+// str returns the value of key in a mapping as a scalar, or ""
+func (n *yamlNode) str(key string) string {
+	if v := n.get(key); v != nil {
+		return v.scalar
+	}
+	return ""
+}
+
+// yamlLine is a line of YAML without its indentation and comment
+type yamlLine struct {
+	number int
+	indent int
+	text   string
+}
+
+// stripYAMLComment removes a comment from a line, keeping # inside quotes
+func stripYAMLComment(line string) string {
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		switch c := line[i]; {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#' && (i == 0 || line[i-1] == ' '):
+			return line[:i]
+		}
+	}
+	return line
+}
+
+// parseYAML parses block mappings and lists of scalars, with flow lists of
+// scalars such as [0x89, PNG] and block scalars for documentation
+func parseYAML(src string) (*yamlNode, error) {
+	var lines []yamlLine
+	for i, line := range strings.Split(src, "\n") {
+		line = strings.TrimRight(stripYAMLComment(line), " \t\r")
+		text := strings.TrimLeft(line, " ")
+		if text == "" || text == "---" {
+			continue
+		}
+		if strings.HasPrefix(text, "\t") {
+			return nil, fmt.Errorf("line %d: tabs can't indent YAML", i+1)
+		}
+		lines = append(lines, yamlLine{number: i + 1, indent: len(line) - len(text), text: text})
+	}
+	if len(lines) == 0 {
+		return nil, fmt.Errorf("empty document")
+	}
+	node, i, err := parseYAMLBlock(lines, 0, lines[0].indent)
+	if err == nil && i < len(lines) {
+		err = fmt.Errorf("line %d: unexpected indentation", lines[i].number)
+	}
+	return node, err
+}
+
+// isYAMLItem reports whether a line starts a list item
+func isYAMLItem(text string) bool {
+	return text == "-" || strings.HasPrefix(text, "- ")
+}
+
+// splitYAMLKey splits "key: value" into the key and the value
+func splitYAMLKey(text string) (string, string, bool) {
+	if text[0] == '"' || text[0] == '\'' {
+		end := strings.IndexByte(text[1:], text[0])
+		if end < 0 || !strings.HasPrefix(text[end+2:], ":") {
+			return "", "", false
+		}
+		return text[1 : end+1], strings.TrimSpace(text[end+3:]), true
+	}
+	if strings.HasSuffix(text, ":") {
+		return text[:len(text)-1], "", true
+	}
+	key, value, ok := strings.Cut(text, ": ")
+	return key, strings.TrimSpace(value), ok && !strings.ContainsAny(key, "[{")
+}
+
+// parseYAMLScalar parses a plain, quoted or flow list value
+func parseYAMLScalar(text string) *yamlNode {
+	switch {
+	case strings.HasPrefix(text, "[") && strings.HasSuffix(text, "]"):
+		n := &yamlNode{list: []*yamlNode{}}
+		if inner := strings.TrimSpace(text[1 : len(text)-1]); inner != "" {
+			for _, item := range strings.Split(inner, ",") {
+				n.list = append(n.list, parseYAMLScalar(strings.TrimSpace(item)))
+			}
+		}
+		return n
+	case len(text) >= 2 && text[0] == '"' && text[len(text)-1] == '"':
+		if s, err := strconv.Unquote(text); err == nil {
+			return &yamlNode{scalar: s}
+		}
+	case len(text) >= 2 && text[0] == '\'' && text[len(text)-1] == '\'':
+		return &yamlNode{scalar: strings.ReplaceAll(text[1:len(text)-1], "''", "'")}
+	}
+	return &yamlNode{scalar: text}
+}
+
+// parseYAMLBlock parses the list or mapping whose lines start at lines[i]
+// with the given indentation, returning the index of the line after it
+func parseYAMLBlock(lines []yamlLine, i, indent int) (*yamlNode, int, error) {
+	if isYAMLItem(lines[i].text) {
+		n := &yamlNode{list: []*yamlNode{}}
+		for i < len(lines) && lines[i].indent == indent && isYAMLItem(lines[i].text) {
+			content := strings.TrimLeft(lines[i].text[1:], " ")
+			var item *yamlNode
+			var err error
+			switch {
+			case content == "":
+				if i+1 == len(lines) || lines[i+1].indent <= indent {
+					item, i = &yamlNode{}, i+1
+					break
+				}
+				item, i, err = parseYAMLBlock(lines, i+1, lines[i+1].indent)
+			case isYAMLItem(content):
+				err = fmt.Errorf("line %d: nested list items on one line are not supported", lines[i].number)
+			default:
+				if _, _, ok := splitYAMLKey(content); !ok {
+					item, i = parseYAMLScalar(content), i+1
+					break
+				}
+				// A mapping starting on the line of the item, continued at
+				// the column of its first key
+				lines[i] = yamlLine{number: lines[i].number, indent: indent + len(lines[i].text) - len(content), text: content}
+				item, i, err = parseYAMLBlock(lines, i, lines[i].indent)
+			}
+			if err != nil {
+				return nil, i, err
+			}
+			n.list = append(n.list, item)
+		}
+		return n, i, nil
+	}
+
+	n := &yamlNode{values: map[string]*yamlNode{}}
+	for i < len(lines) && lines[i].indent == indent {
+		line := lines[i]
+		key, value, ok := splitYAMLKey(line.text)
+		if !ok {
+			return nil, i, fmt.Errorf("line %d: expected key: value", line.number)
+		}
+		if _, dup := n.values[key]; dup {
+			return nil, i, fmt.Errorf("line %d: duplicate key %s", line.number, key)
+		}
+		i++
+		var child *yamlNode
+		switch {
+		case value == "|" || value == ">" || value == "|-" || value == ">-":
+			// A block scalar, such as documentation
+			var text []string
+			for i < len(lines) && lines[i].indent > indent {
+				text = append(text, lines[i].text)
+				i++
+			}
+			child = &yamlNode{scalar: strings.Join(text, "\n")}
+		case value != "":
+			child = parseYAMLScalar(value)
+		case i < len(lines) && (lines[i].indent > indent || lines[i].indent == indent && isYAMLItem(lines[i].text)):
+			var err error
+			if child, i, err = parseYAMLBlock(lines, i, lines[i].indent); err != nil {
+				return nil, i, err
+			}
+		default:
+			child = &yamlNode{}
+		}
+		n.keys = append(n.keys, key)
+		n.values[key] = child
+	}
+	if i < len(lines) && lines[i].indent > indent {
+		return nil, i, fmt.Errorf("line %d: unexpected indentation", lines[i].number)
+	}
+	return n, i, nil
+}
+
+// kaitaiTypes maps the Kaitai Struct integer and float types to template
+// types
+var kaitaiTypes = map[string]string{
+	"u1": "u8", "u2": "u16", "u4": "u32", "u8": "u64",
+	"s1": "i8", "s2": "i16", "s4": "i32", "s8": "i64",
+	"f4": "f32", "f8": "f64",
+}
+
+// kaitaiUnsupported lists the attribute keys of the features not supported
+var kaitaiUnsupported = []string{"if", "process", "repeat-until", "pos", "io", "value", "pad-right", "include"}
+
+// ParseKaitai parses a subset of the Kaitai Struct format (.ksy) into a
+// template, see Template. The types, enums, byte order and attributes of seq
+// are supported, with their size, size-eos, contents, enum, repeat: expr and
+// repeat: eos. Size and repeat expressions may only use arithmetic. Instances
+// are skipped, and other features such as if, switch-on, process and bit
+// fields are reported as errors.
+func ParseKaitai(src string) (*Template, error) {
+	doc, err := parseYAML(src)
+	if err != nil {
+		return nil, err
+	}
+	id := doc.get("meta").str("id")
+	if !isIdentifier(id) {
+		return nil, fmt.Errorf("meta: missing or invalid id")
+	}
+	order, err := kaitaiEndian(doc.get("meta"), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	t := &Template{structs: map[string]*templateStruct{}}
+	enums := map[string]map[int64]string{}
+	types := map[string]*yamlNode{id: doc}
+	if err := collectKaitaiTypes(doc, types, enums); err != nil {
+		return nil, err
+	}
+	for name := range types {
+		t.structs[name] = &templateStruct{name: name}
+	}
+	orders := map[string]binary.ByteOrder{id: order}
+	for name, node := range types {
+		o := order
+		if node != doc {
+			if o, err = kaitaiEndian(node.get("meta"), order); err != nil {
+				return nil, fmt.Errorf("type %s: %w", name, err)
+			}
+		}
+		orders[name] = o
+		if node.get("params") != nil {
+			return nil, fmt.Errorf("type %s: params are not supported", name)
+		}
+		for i, attr := range node.get("seq").listItems() {
+			f, err := kaitaiField(attr, i, o, t.structs, enums)
+			if err != nil {
+				return nil, fmt.Errorf("type %s: %w", name, err)
+			}
+			t.structs[name].fields = append(t.structs[name].fields, f)
+		}
+		if len(t.structs[name].fields) == 0 {
+			return nil, fmt.Errorf("type %s has no seq", name)
+		}
+	}
+	t.root = t.structs[id]
+	return t, nil
+}
+
+// listItems returns the items of a list, or nil
+func (n *yamlNode) listItems() []*yamlNode {
+	if n == nil {
+		return nil
+	}
+	return n.list
+}
+
+// kaitaiEndian returns the byte order set in meta, or def
+func kaitaiEndian(meta *yamlNode, def binary.ByteOrder) (binary.ByteOrder, error) {
+	switch e := meta.get("endian"); {
+	case e == nil:
+		return def, nil
+	case e.values != nil:
+		return nil, fmt.Errorf("meta: switching endian is not supported")
+	case e.scalar == "le":
+		return binary.LittleEndian, nil
+	case e.scalar == "be":
+		return binary.BigEndian, nil
+	}
+	return nil, fmt.Errorf("meta: unknown endian %q", meta.str("endian"))
+}
+
+// collectKaitaiTypes adds the types and enums declared in a type, and in the
+// types nested in it, to one namespace
+func collectKaitaiTypes(node *yamlNode, types map[string]*yamlNode, enums map[string]map[int64]string) error {
+	if e := node.get("enums"); e != nil {
+		for _, name := range e.keys {
+			values := map[int64]string{}
+			for _, key := range e.values[name].keys {
+				v, err := strconv.ParseInt(key, 0, 64)
+				if err != nil {
+					return fmt.Errorf("enum %s: invalid value %s", name, key)
+				}
+				label := e.values[name].values[key]
+				if label.values != nil {
+					label = label.get("id")
+				}
+				if label != nil {
+					values[v] = label.scalar
+				}
+			}
+			enums[name] = values
+		}
+	}
+	if ts := node.get("types"); ts != nil {
+		for _, name := range ts.keys {
+			if _, dup := types[name]; dup || !isIdentifier(name) {
+				return fmt.Errorf("types: duplicate or invalid type name %s", name)
+			}
+			types[name] = ts.values[name]
+			if err := collectKaitaiTypes(ts.values[name], types, enums); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// kaitaiField converts attribute i of a seq into a template field
+func kaitaiField(attr *yamlNode, i int, order binary.ByteOrder, structs map[string]*templateStruct, enums map[string]map[int64]string) (templateField, error) {
+	f := templateField{name: attr.str("id"), order: order}
+	if f.name == "" {
+		f.name = fmt.Sprintf("_unnamed%d", i)
+	}
+	for _, key := range kaitaiUnsupported {
+		if attr.get(key) != nil {
+			return f, fmt.Errorf("%s: %s is not supported", f.name, key)
+		}
+	}
+	if term := attr.str("terminator"); term != "" && term != "0" {
+		return f, fmt.Errorf("%s: terminators other than 0 are not supported", f.name)
+	}
+	if typ := attr.get("type"); typ != nil && typ.values != nil {
+		return f, fmt.Errorf("%s: switch-on types are not supported", f.name)
+	}
+
+	size := attr.str("size")
+	if attr.str("size-eos") == "true" {
+		size = "eos"
+	}
+	if contents := attr.get("contents"); contents != nil {
+		n := len(contents.scalar)
+		for _, item := range contents.list {
+			if _, err := strconv.ParseUint(item.scalar, 0, 8); err == nil {
+				n++
+			} else {
+				n += len(item.scalar)
+			}
+		}
+		size = strconv.Itoa(n)
+	}
+	switch attr.str("repeat") {
+	case "":
+	case "expr":
+		f.count = attr.str("repeat-expr")
+	case "eos":
+		f.count = "eos"
+	default:
+		return f, fmt.Errorf("%s: repeat: %s is not supported", f.name, attr.str("repeat"))
+	}
+
+	typ := attr.str("type")
+	// Types of other specs are referred to by their name
+	typ = typ[strings.LastIndex(typ, "::")+1:]
+	base, suffix := typ, ""
+	if len(typ) > 2 && (strings.HasSuffix(typ, "le") || strings.HasSuffix(typ, "be")) {
+		base, suffix = typ[:len(typ)-2], typ[len(typ)-2:]
+	}
+	switch {
+	case typ == "" || typ == "str":
+		if size == "" {
+			return f, fmt.Errorf("%s: byte arrays and strings need a size", f.name)
+		}
+		if f.count != "" {
+			return f, fmt.Errorf("%s: repeated byte arrays are not supported", f.name)
+		}
+		f.typ, f.count = "bytes", size
+		if typ == "str" {
+			f.typ = "char"
+		}
+	case typ == "strz":
+		f.typ = "strz"
+		if size != "" {
+			f.typ, f.count = "char", size
+		}
+	case kaitaiTypes[typ] != "":
+		f.typ = kaitaiTypes[typ]
+	case kaitaiTypes[base] != "":
+		f.typ = kaitaiTypes[base]
+		f.order = map[string]binary.ByteOrder{"le": binary.LittleEndian, "be": binary.BigEndian}[suffix]
+	case structs[typ] != nil:
+		f.typ, f.size = typ, size
+	case strings.HasPrefix(typ, "b") && kaitaiTypes["u"+typ[1:]] == "" && typ != "bytes":
+		return f, fmt.Errorf("%s: bit fields are not supported", f.name)
+	default:
+		return f, fmt.Errorf("%s: unknown type %s", f.name, typ)
+	}
+
+	if name := attr.str("enum"); name != "" {
+		name = name[strings.LastIndex(name, "::")+1:]
+		if f.enum = enums[name]; f.enum == nil {
+			return f, fmt.Errorf("%s: unknown enum %s", f.name, name)
+		}
+	}
+	for _, expr := range []string{f.count, f.size} {
+		if expr == "" || expr == "eos" {
+			continue
+		}
+		if _, err := evalTemplateExpr(expr, func(string) (int64, bool) { return 1, true }); err != nil {
+			return f, fmt.Errorf("%s: unsupported expression %q", f.name, expr)
+		}
+	}
+	return f, nil
+}
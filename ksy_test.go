@@ -0,0 +1,141 @@
+package prettybuffers
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseYAML(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want string // the document as formatted by yamlString
+		err  string // part of the error, "" for none
+	}{
+		{"mapping", "a: 1\nb: 'it''s'\nc: \"x#y\" # comment", "{a: 1, b: it's, c: x#y}", ""},
+		{"nested", "meta:\n  id: png\n  endian: be", "{meta: {id: png, endian: be}}", ""},
+		{"list of mappings", "seq:\n  - id: a\n    type: u1\n  - id: b", "{seq: [{id: a, type: u1}, {id: b}]}", ""},
+		{"list at the key's indentation", "seq:\n- x\n- y\nend: 1", "{seq: [x, y], end: 1}", ""},
+		{"flow list", "contents: [0x89, PNG, '']", "{contents: [0x89, PNG, ]}", ""},
+		{"block scalar", "doc: |\n  one\n  two\nid: x", "{doc: one\ntwo, id: x}", ""},
+		{"empty value", "a:\nb: 2", "{a: , b: 2}", ""},
+		{"empty", "# nothing\n---\n", "", "empty document"},
+		{"tab", "a:\n\tb: 1", "", "line 2: tabs can't indent YAML"},
+		{"duplicate key", "a: 1\na: 2", "", "line 2: duplicate key a"},
+		{"not a mapping", "a: 1\njust text", "", "line 2: expected key: value"},
+		{"bad indentation", "a:\n    b: 1\n  c: 2", "", "line 3: unexpected indentation"},
+		{"nested items", "- - a", "", "nested list items on one line"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n, err := parseYAML(tt.src)
+			switch {
+			case tt.err == "" && err != nil:
+				t.Fatalf("error %v", err)
+			case tt.err != "":
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("error is %v, want one with %q", err, tt.err)
+				}
+				return
+			}
+			if got := yamlString(n); got != tt.want {
+				t.Errorf("parsed %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+// yamlString formats a node in flow style, to compare parsed documents
+func yamlString(n *yamlNode) string {
+	switch {
+	case n.values != nil:
+		var parts []string
+		for _, k := range n.keys {
+			parts = append(parts, k+": "+yamlString(n.values[k]))
+		}
+		return "{" + strings.Join(parts, ", ") + "}"
+	case n.list != nil:
+		var parts []string
+		for _, item := range n.list {
+			parts = append(parts, yamlString(item))
+		}
+		return "[" + strings.Join(parts, ", ") + "]"
+	}
+	return n.scalar
+}
+
+func TestParseKaitai(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		data []byte
+		want []string // labels of the fields laid out
+		err  string   // part of the error from parsing, "" for none
+	}{
+		{"integers", "meta:\n  id: ints\n  endian: be\nseq:\n  - id: a\n    type: u2\n  - id: b\n    type: s2le\n  - type: u1",
+			[]byte{1, 2, 0xFE, 0xFF, 7}, []string{"ints.a = 258 (0x102)", "ints.b = -2", "ints._unnamed2 = 7"}, ""},
+		{"contents and strings", "meta:\n  id: hdr\nseq:\n  - id: magic\n    contents: [0x89, PNG]\n  - id: name\n    type: strz\n  - id: tag\n    type: str\n    size: 2",
+			[]byte("\x89PNGab\x00xy"), []string{"hdr.magic = 89 50 4E 47", `hdr.name = "ab"`, `hdr.tag = "xy"`}, ""},
+		{"types and repeat", "meta:\n  id: f\n  endian: le\nseq:\n  - id: n\n    type: u1\n  - id: items\n    type: item\n    repeat: expr\n    repeat-expr: n\n" +
+			"types:\n  item:\n    seq:\n      - id: v\n        type: u2",
+			[]byte{2, 1, 0, 2, 0}, []string{"f.n = 2", "f.items[0].v = 1", "f.items[1].v = 2"}, ""},
+		{"enum", "meta:\n  id: e\nseq:\n  - id: kind\n    type: u1\n    enum: kinds\nenums:\n  kinds:\n    1: one\n    2:\n      id: two",
+			[]byte{2}, []string{"e.kind = two (2)"}, ""},
+		{"size-eos", "meta:\n  id: rest\nseq:\n  - id: head\n    type: u1\n  - id: body\n    size-eos: true",
+			[]byte{1, 0xAA, 0xBB}, []string{"rest.head = 1", "rest.body = AA BB"}, ""},
+		{"sized type", "meta:\n  id: s\n  endian: le\nseq:\n  - id: a\n    type: t\n    size: 4\n  - id: b\n    type: u1\ntypes:\n  t:\n    seq:\n      - id: x\n        type: u1",
+			[]byte{1, 2, 3, 4, 5}, []string{"s.a.x = 1", "s.b = 5"}, ""},
+		{"no id", "seq:\n  - id: a\n    type: u1", nil, nil, "meta: missing or invalid id"},
+		{"no seq", "meta:\n  id: x", nil, nil, "type x has no seq"},
+		{"unsupported attribute", "meta:\n  id: x\nseq:\n  - id: a\n    type: u1\n    if: b == 1", nil, nil, "a: if is not supported"},
+		{"switch-on", "meta:\n  id: x\nseq:\n  - id: a\n    type:\n      switch-on: k", nil, nil, "a: switch-on types are not supported"},
+		{"bit field", "meta:\n  id: x\nseq:\n  - id: a\n    type: b3", nil, nil, "a: bit fields are not supported"},
+		{"unknown type", "meta:\n  id: x\nseq:\n  - id: a\n    type: u3", nil, nil, "a: unknown type u3"},
+		{"bytes without size", "meta:\n  id: x\nseq:\n  - id: a", nil, nil, "a: byte arrays and strings need a size"},
+		{"unknown enum", "meta:\n  id: x\nseq:\n  - id: a\n    type: u1\n    enum: nope", nil, nil, "a: unknown enum nope"},
+		{"expression", "meta:\n  id: x\nseq:\n  - id: a\n    size: n >> 1", nil, nil, `a: unsupported expression "n >> 1"`},
+		{"switched endian", "meta:\n  id: x\n  endian:\n    switch-on: k\nseq:\n  - id: a\n    type: u1", nil, nil, "switching endian is not supported"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpl, err := ParseKaitai(tt.src)
+			switch {
+			case tt.err == "" && err != nil:
+				t.Fatalf("error %v", err)
+			case tt.err != "":
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("error is %v, want one with %q", err, tt.err)
+				}
+				return
+			}
+			structures, err := tmpl.apply(readBytes(tt.data), len(tt.data), 0, binary.LittleEndian)
+			if err != nil {
+				t.Errorf("applying: %v", err)
+			}
+			got := templateLabels(structures)
+			if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+				t.Errorf("laid out %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestParseKaitaiLarge makes sure that long definitions parse in linear
+// time
+func TestParseKaitaiLarge(t *testing.T) {
+	var sb strings.Builder
+	sb.WriteString("meta:\n  id: big\n  endian: le\nseq:\n")
+	for i := range 1 << 15 {
+		fmt.Fprintf(&sb, "  - id: f%d\n    type: u4\n    doc: |\n      field %d\n", i, i)
+	}
+	start := time.Now()
+	if _, err := ParseKaitai(sb.String()); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("parsing %d bytes took %v", sb.Len(), elapsed)
+	}
+}
@@ -0,0 +1,72 @@
+package prettybuffers
+
+import (
+	"fmt"
+	"sync"
+)
+
+// layoutsMu guards PredefinedLayouts, which RegisterLayout may change while a viewer is running
+var layoutsMu sync.RWMutex
+
+// RegisterLayout adds a layout to PredefinedLayouts, or replaces the layout
+// with the same name, and returns its index
+func RegisterLayout(layout Layout) int {
+	layoutsMu.Lock()
+	defer layoutsMu.Unlock()
+	for i, l := range PredefinedLayouts {
+		if l.Name == layout.Name {
+			PredefinedLayouts[i] = layout
+			return i
+		}
+	}
+	PredefinedLayouts = append(PredefinedLayouts, layout)
+	return len(PredefinedLayouts) - 1
+}
+
+// layoutAt returns the layout at index i of PredefinedLayouts
+func layoutAt(i int) (Layout, bool) {
+	layoutsMu.RLock()
+	defer layoutsMu.RUnlock()
+	if i < 0 || i >= len(PredefinedLayouts) {
+		return Layout{}, false
+	}
+	return PredefinedLayouts[i], true
+}
+
+// layoutCount returns the number of layouts in PredefinedLayouts
+func layoutCount() int {
+	layoutsMu.RLock()
+	defer layoutsMu.RUnlock()
+	return len(PredefinedLayouts)
+}
+
+// layoutIndex returns the index of the layout called name, or -1
+func layoutIndex(name string) int {
+	layoutsMu.RLock()
+	defer layoutsMu.RUnlock()
+	for i, l := range PredefinedLayouts {
+		if l.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// SetLayoutByName switches this viewer to the layout called name
+func (v *Viewer) SetLayoutByName(name string) error {
+	i := layoutIndex(name)
+	if i < 0 {
+		return fmt.Errorf("prettybuffers: unknown layout %q", name)
+	}
+	v.program.Send(layoutMsg(i))
+	return nil
+}
+
+// SetLayoutByName switches the TUI started by StartTUI to the layout called name
+func SetLayoutByName(name string) error {
+	v := defaultViewer()
+	if v == nil {
+		return ErrNoViewer
+	}
+	return v.SetLayoutByName(name)
+}
@@ -0,0 +1,62 @@
+package prettybuffers
+
+import (
+	"fmt"
+	"strings"
+)
+
+// literalBytesPerLine is how many bytes a line of a multi-line code literal
+// holds
+const literalBytesPerLine = 12
+
+// literalLines formats data as comma-separated hex bytes, on one line when
+// they fit and otherwise on lines of their own with the given indentation
+func literalLines(data []byte, indent string) string {
+	parts := make([]string, len(data))
+	for i, b := range data {
+		parts[i] = fmt.Sprintf("0x%02x", b)
+	}
+	if len(data) <= literalBytesPerLine {
+		return strings.Join(parts, ", ")
+	}
+	var sb strings.Builder
+	sb.WriteString("\n")
+	for i := 0; i < len(parts); i += literalBytesPerLine {
+		sb.WriteString(indent + strings.Join(parts[i:min(i+literalBytesPerLine, len(parts))], ", ") + ",\n")
+	}
+	return sb.String()
+}
+
+// formatGoBytes formats data as a Go byte slice literal, e.g. []byte{0x68, 0x69}
+func formatGoBytes(data []byte) string {
+	return "[]byte{" + literalLines(data, "\t") + "}"
+}
+
+// formatCArray formats data as a C array definition
+func formatCArray(data []byte) string {
+	return fmt.Sprintf("unsigned char data[%d] = {%s};", len(data), literalLines(data, "    "))
+}
+
+// formatPythonBytes formats data as a Python bytes literal, e.g. b"hi\x00"
+func formatPythonBytes(data []byte) string {
+	var sb strings.Builder
+	sb.WriteString(`b"`)
+	for _, b := range data {
+		switch {
+		case b == '\\' || b == '"':
+			sb.WriteString(`\` + string(rune(b)))
+		case b == '\t':
+			sb.WriteString(`\t`)
+		case b == '\n':
+			sb.WriteString(`\n`)
+		case b == '\r':
+			sb.WriteString(`\r`)
+		case b >= 0x20 && b < 0x7f:
+			sb.WriteByte(b)
+		default:
+			fmt.Fprintf(&sb, `\x%02x`, b)
+		}
+	}
+	sb.WriteString(`"`)
+	return sb.String()
+}
@@ -0,0 +1,233 @@
+package prettybuffers
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// maxMachOCommands limits how many load commands are parsed
+const maxMachOCommands = 1024
+
+var (
+	machoCPUTypes = map[uint64]string{
+		7: "x86", 0x01000007: "x86-64", 12: "ARM", 0x0100000c: "ARM64", 0x0200000c: "ARM64_32",
+		18: "PowerPC", 0x01000012: "PowerPC64",
+	}
+
+	machoFileTypes = map[uint64]string{
+		1: "OBJECT", 2: "EXECUTE", 3: "FVMLIB", 4: "CORE", 5: "PRELOAD", 6: "DYLIB", 7: "DYLINKER",
+		8: "BUNDLE", 9: "DYLIB_STUB", 10: "DSYM", 11: "KEXT_BUNDLE", 12: "FILESET",
+	}
+
+	machoHeaderFlags = []flagName{
+		{0x1, "NOUNDEFS"}, {0x2, "INCRLINK"}, {0x4, "DYLDLINK"}, {0x10, "PREBOUND"}, {0x80, "TWOLEVEL"},
+		{0x200, "NOFIXPREBINDING"}, {0x2000, "SUBSECTIONS_VIA_SYMBOLS"}, {0x8000, "WEAK_DEFINES"},
+		{0x10000, "BINDS_TO_WEAK"}, {0x20000, "ALLOW_STACK_EXECUTION"}, {0x200000, "PIE"},
+		{0x800000, "HAS_TLV_DESCRIPTORS"}, {0x2000000, "APP_EXTENSION_SAFE"},
+	}
+
+	machoCommands = map[uint64]string{
+		0x1: "LC_SEGMENT", 0x2: "LC_SYMTAB", 0x4: "LC_THREAD", 0x5: "LC_UNIXTHREAD", 0xb: "LC_DYSYMTAB",
+		0xc: "LC_LOAD_DYLIB", 0xd: "LC_ID_DYLIB", 0xe: "LC_LOAD_DYLINKER", 0xf: "LC_ID_DYLINKER",
+		0x19: "LC_SEGMENT_64", 0x1b: "LC_UUID", 0x1d: "LC_CODE_SIGNATURE", 0x1e: "LC_SEGMENT_SPLIT_INFO",
+		0x22: "LC_DYLD_INFO", 0x24: "LC_VERSION_MIN_MACOSX", 0x25: "LC_VERSION_MIN_IPHONEOS",
+		0x26: "LC_FUNCTION_STARTS", 0x29: "LC_DATA_IN_CODE", 0x2a: "LC_SOURCE_VERSION",
+		0x2b: "LC_DYLIB_CODE_SIGN_DRS", 0x32: "LC_BUILD_VERSION", 0x80000018: "LC_LOAD_WEAK_DYLIB",
+		0x8000001c: "LC_RPATH", 0x8000001f: "LC_REEXPORT_DYLIB", 0x80000022: "LC_DYLD_INFO_ONLY",
+		0x80000028: "LC_MAIN", 0x80000033: "LC_DYLD_EXPORTS_TRIE", 0x80000034: "LC_DYLD_CHAINED_FIXUPS",
+	}
+
+	// machoLinkeditData names the blobs that linkedit_data_command load
+	// commands point to
+	machoLinkeditData = map[uint64]string{
+		0x1d: "Code signature", 0x1e: "Segment split info", 0x26: "Function starts", 0x29: "Data in code",
+		0x2b: "Dylib code signing DRs", 0x80000033: "Exports trie", 0x80000034: "Chained fixups",
+	}
+)
+
+// machoProt formats VM protection bits, e.g. "r-x"
+func machoProt(prot uint64) string {
+	perms := []byte("---")
+	for i, c := range "rwx" {
+		if prot&(1<<i) != 0 {
+			perms[i] = byte(c)
+		}
+	}
+	return string(perms)
+}
+
+// machoVersion formats a version packed as xxxx.yy.zz
+func machoVersion(v uint64) string {
+	return fmt.Sprintf("%d.%d.%d", v>>16, v>>8&0xff, v&0xff)
+}
+
+// parseMachO parses the Mach-O header, the load commands with the section
+// headers of each segment, and the sections, segments and linkedit data they
+// point to
+func parseMachO(read func(off, n int) []byte, size int) []structure {
+	magic := read(0, 4)
+	if len(magic) < 4 {
+		return nil
+	}
+	var order binary.ByteOrder = binary.BigEndian
+	if magic[0] != 0xfe {
+		order = binary.LittleEndian
+	}
+	is64 := order.Uint32(magic) == 0xfeedfacf
+	headerSize, word := 28, 4
+	if is64 {
+		headerSize, word = 32, 8
+	}
+
+	b, ok := newStructBuilder(read, 0, headerSize, order, "Mach-O header")
+	if !ok {
+		return nil
+	}
+	b.hex("magic", 4)
+	b.enum("cputype", 4, machoCPUTypes)
+	b.hex("cpusubtype", 4)
+	b.enum("filetype", 4, machoFileTypes)
+	ncmds := b.dec("ncmds", 4)
+	sizeofcmds := b.dec("sizeofcmds", 4)
+	b.flags("flags", 4, machoHeaderFlags)
+	if is64 {
+		b.hex("reserved", 4)
+	}
+	structures := []structure{b.done()}
+
+	var sections, segments, linkedit []structure
+	// content adds a structure for the length bytes at off a command points to
+	content := func(list *[]structure, off, length uint64, name string) {
+		if length > 0 && off < uint64(size) {
+			*list = append(*list, structure{start: int(off), end: int(off) + min(int(length), size-int(off)), name: name})
+		}
+	}
+
+	pos := headerSize
+	end := headerSize + min(int(sizeofcmds), size-headerSize)
+	for i := 0; i < min(int(ncmds), maxMachOCommands) && pos+8 <= end; i++ {
+		raw := read(pos, 8)
+		cmd, cmdsize := uint64(order.Uint32(raw)), int(order.Uint32(raw[4:]))
+		if cmdsize < 8 || cmdsize > end-pos {
+			break
+		}
+		title := fmt.Sprintf("Load command %d", i)
+		if name, ok := machoCommands[cmd]; ok {
+			title += " (" + name
+			if cmd == 0x1 || cmd == 0x19 {
+				title += " " + cString(read(pos+8, 16))
+			}
+			title += ")"
+		}
+		// Segment commands are followed by their section headers, which are
+		// structures of their own
+		fixed := cmdsize
+		switch cmd {
+		case 0x1:
+			fixed = min(cmdsize, 56)
+		case 0x19:
+			fixed = min(cmdsize, 72)
+		}
+		b, _ := newStructBuilder(read, pos, fixed, order, title)
+		b.enum("cmd", 4, machoCommands)
+		b.dec("cmdsize", 4)
+		rest := fixed - 8
+		switch {
+		case (cmd == 0x1 || cmd == 0x19) && rest == 32+4*word:
+			segname := cString(b.data[b.pos : b.pos+16])
+			b.add("segname", 16, segname)
+			b.hex("vmaddr", word)
+			b.hex("vmsize", word)
+			fileoff := b.hex("fileoff", word)
+			filesize := b.hex("filesize", word)
+			b.add("maxprot", 4, machoProt(b.uint(4)))
+			initprot := b.uint(4)
+			b.add("initprot", 4, machoProt(initprot))
+			nsects := b.dec("nsects", 4)
+			b.hex("flags", 4)
+			content(&segments, fileoff, filesize, fmt.Sprintf("Segment %s, %s", segname, machoProt(initprot)))
+			sections = append(sections, parseMachOSections(read, size, pos+fixed, pos+cmdsize, int(nsects), order, word, &structures)...)
+		case cmd == 0x2 && rest == 16:
+			symoff := b.hex("symoff", 4)
+			nsyms := b.dec("nsyms", 4)
+			stroff := b.hex("stroff", 4)
+			strsize := b.hex("strsize", 4)
+			content(&linkedit, symoff, nsyms*uint64(8+word), "Symbol table")
+			content(&linkedit, stroff, strsize, "String table")
+		case machoLinkeditData[cmd] != "" && rest == 8:
+			dataoff := b.hex("dataoff", 4)
+			datasize := b.hex("datasize", 4)
+			content(&linkedit, dataoff, datasize, machoLinkeditData[cmd])
+		case (cmd == 0xc || cmd == 0xd || cmd == 0x80000018 || cmd == 0x8000001f) && rest >= 16:
+			nameoff := b.dec("name offset", 4)
+			b.hex("timestamp", 4)
+			b.add("current_version", 4, machoVersion(b.uint(4)))
+			b.add("compatibility_version", 4, machoVersion(b.uint(4)))
+			if nameoff == 24 {
+				b.add("name", cmdsize-24, cString(b.data[24:]))
+			}
+		case (cmd == 0xe || cmd == 0xf || cmd == 0x8000001c) && rest >= 4:
+			nameoff := b.dec("name offset", 4)
+			if nameoff == 12 {
+				b.add("name", cmdsize-12, cString(b.data[12:]))
+			}
+		case cmd == 0x1b && rest == 16:
+			b.add("uuid", 16, fmt.Sprintf("%X", b.data[8:24]))
+		case cmd == 0x80000028 && rest == 16:
+			b.hex("entryoff", 8)
+			b.hex("stacksize", 8)
+		case cmd == 0x2a && rest == 8:
+			v := b.uint(8)
+			b.add("version", 8, fmt.Sprintf("%d.%d.%d.%d.%d", v>>40, v>>30&0x3ff, v>>20&0x3ff, v>>10&0x3ff, v&0x3ff))
+		}
+		if b.pos < fixed {
+			b.raw("data", fixed-b.pos)
+		}
+		structures = append(structures, b.done())
+		pos += cmdsize
+	}
+	// Headers take precedence over the contents, and sections and linkedit
+	// data over the segments containing them
+	structures = append(structures, sections...)
+	structures = append(structures, linkedit...)
+	return append(structures, segments...)
+}
+
+// parseMachOSections parses the nsects section headers from start up to end,
+// adding them to structures, and returns the contents of the sections
+func parseMachOSections(read func(off, n int) []byte, fileSize, start, end, nsects int, order binary.ByteOrder, word int, structures *[]structure) []structure {
+	size := 68
+	if word == 8 {
+		size = 80
+	}
+	var contents []structure
+	for i := 0; i < nsects && start+(i+1)*size <= end; i++ {
+		raw := read(start+i*size, 32)
+		name := cString(raw[16:]) + "," + cString(raw[:16])
+		b, ok := newStructBuilder(read, start+i*size, size, order, "Section header "+name)
+		if !ok {
+			break
+		}
+		b.add("sectname", 16, cString(raw[:16]))
+		b.add("segname", 16, cString(raw[16:]))
+		b.hex("addr", word)
+		length := b.hex("size", word)
+		offset := b.hex("offset", 4)
+		b.dec("align", 4)
+		b.hex("reloff", 4)
+		b.dec("nreloc", 4)
+		flags := b.hex("flags", 4)
+		b.raw("reserved", size-b.pos)
+		*structures = append(*structures, b.done())
+
+		// Zero-fill sections such as __bss take no room in the file
+		if typ := flags & 0xff; offset != 0 && offset < uint64(fileSize) && length > 0 && typ != 0x1 && typ != 0xc && typ != 0x12 {
+			contents = append(contents, structure{
+				start: int(offset),
+				end:   int(offset) + min(int(length), fileSize-int(offset)),
+				name:  "Section " + name,
+			})
+		}
+	}
+	return contents
+}
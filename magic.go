@@ -0,0 +1,149 @@
+package prettybuffers
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// FileType describes a format recognized by its magic number
+type FileType struct {
+	Name      string // e.g. "PNG image"
+	MIME      string
+	Extension string // without the dot
+}
+
+// signature is a magic number found at a fixed offset from the start of a file
+type signature struct {
+	FileType
+	offset int
+	magic  []byte
+}
+
+// signatures lists the known formats. Longer magic numbers come first so
+// that they win over shorter ones they start with.
+var signatures = []signature{
+	{FileType{"SQLite database", "application/vnd.sqlite3", "sqlite"}, 0, []byte("SQLite format 3\x00")},
+	{FileType{"PNG image", "image/png", "png"}, 0, []byte("\x89PNG\r\n\x1a\n")},
+	{FileType{"pcapng capture", "application/x-pcapng", "pcapng"}, 0, []byte("\x0a\x0d\x0d\x0a")},
+	{FileType{"xz archive", "application/x-xz", "xz"}, 0, []byte("\xfd7zXZ\x00")},
+	{FileType{"7-Zip archive", "application/x-7z-compressed", "7z"}, 0, []byte("7z\xbc\xaf\x27\x1c")},
+	{FileType{"GIF image", "image/gif", "gif"}, 0, []byte("GIF87a")},
+	{FileType{"GIF image", "image/gif", "gif"}, 0, []byte("GIF89a")},
+	{FileType{"PDF document", "application/pdf", "pdf"}, 0, []byte("%PDF-")},
+	{FileType{"tar archive", "application/x-tar", "tar"}, 257, []byte("ustar")},
+	{FileType{"ELF executable", "application/x-elf", "elf"}, 0, []byte("\x7fELF")},
+	{FileType{"ZIP archive", "application/zip", "zip"}, 0, []byte("PK\x03\x04")},
+	{FileType{"Zstandard data", "application/zstd", "zst"}, 0, []byte("\x28\xb5\x2f\xfd")},
+	{FileType{"Mach-O executable", "application/x-mach-binary", "macho"}, 0, []byte("\xfe\xed\xfa\xce")},
+	{FileType{"Mach-O executable", "application/x-mach-binary", "macho"}, 0, []byte("\xfe\xed\xfa\xcf")},
+	{FileType{"Mach-O executable", "application/x-mach-binary", "macho"}, 0, []byte("\xce\xfa\xed\xfe")},
+	{FileType{"Mach-O executable", "application/x-mach-binary", "macho"}, 0, []byte("\xcf\xfa\xed\xfe")},
+	{FileType{"Java class or Mach-O universal binary", "application/java-vm", "class"}, 0, []byte("\xca\xfe\xba\xbe")},
+	{FileType{"pcap capture", "application/vnd.tcpdump.pcap", "pcap"}, 0, []byte("\xd4\xc3\xb2\xa1")},
+	{FileType{"pcap capture", "application/vnd.tcpdump.pcap", "pcap"}, 0, []byte("\xa1\xb2\xc3\xd4")},
+	{FileType{"pcap capture", "application/vnd.tcpdump.pcap", "pcap"}, 0, []byte("\x4d\x3c\xb2\xa1")},
+	{FileType{"pcap capture", "application/vnd.tcpdump.pcap", "pcap"}, 0, []byte("\xa1\xb2\x3c\x4d")},
+	{FileType{"WebAssembly module", "application/wasm", "wasm"}, 0, []byte("\x00asm")},
+	{FileType{"Ogg stream", "application/ogg", "ogg"}, 0, []byte("OggS")},
+	{FileType{"FLAC audio", "audio/flac", "flac"}, 0, []byte("fLaC")},
+	{FileType{"RIFF container", "application/octet-stream", "riff"}, 0, []byte("RIFF")},
+	{FileType{"TIFF image", "image/tiff", "tiff"}, 0, []byte("II*\x00")},
+	{FileType{"TIFF image", "image/tiff", "tiff"}, 0, []byte("MM\x00*")},
+	{FileType{"JPEG image", "image/jpeg", "jpg"}, 0, []byte("\xff\xd8\xff")},
+	{FileType{"gzip data", "application/gzip", "gz"}, 0, []byte("\x1f\x8b\x08")},
+	{FileType{"bzip2 data", "application/x-bzip2", "bz2"}, 0, []byte("BZh")},
+	{FileType{"MP3 audio", "audio/mpeg", "mp3"}, 0, []byte("ID3")},
+	{FileType{"PE executable", "application/vnd.microsoft.portable-executable", "exe"}, 0, []byte("MZ")},
+	{FileType{"BMP image", "image/bmp", "bmp"}, 0, []byte("BM")},
+}
+
+// minEmbeddedMagic is the shortest magic number searched for inside the
+// buffer, as shorter ones match by chance too often
+const minEmbeddedMagic = 4
+
+// maxEmbedded limits how many embedded files are reported
+const maxEmbedded = 64
+
+// embeddedFile is a file format found inside the buffer
+type embeddedFile struct {
+	offset int // start of the embedded file
+	FileType
+}
+
+// DetectFileType identifies the format of data by the magic number at its
+// start. It reports false if the format is unknown.
+func DetectFileType(data []byte) (FileType, bool) {
+	for _, s := range signatures {
+		if s.offset+len(s.magic) <= len(data) && bytes.Equal(data[s.offset:s.offset+len(s.magic)], s.magic) {
+			return s.FileType, true
+		}
+	}
+	return FileType{}, false
+}
+
+// detectEmbedded finds files that start inside data, after its first byte,
+// by searching for the longer magic numbers
+func detectEmbedded(data []byte) []embeddedFile {
+	var found []embeddedFile
+	taken := map[int]bool{}
+	for _, s := range signatures {
+		if len(s.magic) < minEmbeddedMagic {
+			continue
+		}
+		for pos := 1; pos < len(data); {
+			i := bytes.Index(data[pos:], s.magic)
+			if i < 0 {
+				break
+			}
+			start := pos + i - s.offset
+			if start > 0 && !taken[start] {
+				taken[start] = true
+				found = append(found, embeddedFile{offset: start, FileType: s.FileType})
+			}
+			pos += i + 1
+		}
+	}
+	sort.Slice(found, func(i, j int) bool { return found[i].offset < found[j].offset })
+	if len(found) > maxEmbedded {
+		found = found[:maxEmbedded]
+	}
+	return found
+}
+
+// detectFileTypes recognizes the format of the buffer and of files embedded
+// in it. Embedded files are only searched for in buffers held in memory.
+func (m *model) detectFileTypes() {
+	m.fileType, m.embedded = FileType{}, nil
+	if t, ok := DetectFileType(m.window(0, 512)); ok {
+		m.fileType = t
+	}
+	m.parseStructures()
+	if m.lazy || len(m.data) > maxDetectSize {
+		return
+	}
+	for _, e := range detectEmbedded(m.data) {
+		// Archives repeat their own magic number for every entry
+		if e.FileType != m.fileType {
+			m.embedded = append(m.embedded, e)
+		}
+	}
+}
+
+// fileTypeInfo describes the detected formats for the header, or returns ""
+// if none were found
+func (m model) fileTypeInfo() string {
+	var parts []string
+	if m.fileType.Name != "" {
+		parts = append(parts, "Type: "+m.fileType.Name)
+	}
+	for i, e := range m.embedded {
+		if i == 3 {
+			parts = append(parts, fmt.Sprintf("%d more embedded", len(m.embedded)-i))
+			break
+		}
+		parts = append(parts, fmt.Sprintf("%s at 0x%08X", e.Name, e.offset))
+	}
+	return strings.Join(parts, ", ")
+}
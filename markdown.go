@@ -0,0 +1,89 @@
+package prettybuffers
+
+import (
+	"fmt"
+	"strings"
+)
+
+// renderMarkdown renders data, which starts at start in the buffer, in the
+// columns of the current layout as a fenced code block for pasting into
+// issues and docs, followed by a list of the annotations covering it. The
+// Smart View isn't made of rows, so it is rendered as the Hex View.
+func (m *model) renderMarkdown(start int, data []byte) []byte {
+	layout := m.layout
+	if len(layout.Renderers) == 0 && containsColumn(layout.Columns, ColumnJSON) {
+		layout = hexViewLayout
+	}
+	columns := m.renderers(layout)
+	var block strings.Builder
+	headers := make([]string, len(columns))
+	separators := make([]string, len(columns))
+	for i, c := range columns {
+		width := c.Width(m.bytesPerRow)
+		headers[i] = fmt.Sprintf("%-*s", width, c.Header())
+		separators[i] = strings.Repeat("-", width)
+	}
+	block.WriteString(strings.TrimRight(strings.Join(headers, " | "), " ") + "\n")
+	block.WriteString(strings.Join(separators, "-+-") + "\n")
+	for row := 0; row < len(data); row += m.bytesPerRow {
+		rowData := data[row:min(row+m.bytesPerRow, len(data))]
+		cells := make([]string, len(columns))
+		for i, c := range columns {
+			cells[i] = fmt.Sprintf("%-*s", c.Width(m.bytesPerRow), c.RenderRow(rowData, start+row))
+		}
+		block.WriteString(strings.TrimRight(strings.Join(cells, " | "), " ") + "\n")
+	}
+	// The fence has to be longer than any run of backticks in the block,
+	// which the ASCII column or a template may well show
+	fence := strings.Repeat("`", max(3, longestRun(block.String(), '`')+1))
+	var sb strings.Builder
+	sb.WriteString(fence + "text\n" + block.String() + fence + "\n")
+
+	end := start + len(data)
+	notes := false
+	for _, a := range m.annotations {
+		if a.start >= end || a.end <= start {
+			continue
+		}
+		if !notes {
+			sb.WriteString("\n")
+			notes = true
+		}
+		fmt.Fprintf(&sb, "- `0x%08X-0x%08X` %s\n", a.start, a.end-1, escapeMarkdown(a.label))
+	}
+	return []byte(sb.String())
+}
+
+// longestRun returns the length of the longest run of c in s
+func longestRun(s string, c byte) int {
+	longest, run := 0, 0
+	for i := 0; i < len(s); i++ {
+		if s[i] == c {
+			run++
+			longest = max(longest, run)
+		} else {
+			run = 0
+		}
+	}
+	return longest
+}
+
+// markdownSpecial are the characters escaped in text written to Markdown
+const markdownSpecial = "\\`*_[]<>()#|~!"
+
+// escapeMarkdown escapes s to show as is within a line of Markdown
+func escapeMarkdown(s string) string {
+	var sb strings.Builder
+	for _, r := range s {
+		switch {
+		case r == '\n' || r == '\r':
+			sb.WriteByte(' ')
+		case strings.ContainsRune(markdownSpecial, r):
+			sb.WriteByte('\\')
+			sb.WriteRune(r)
+		default:
+			sb.WriteRune(r)
+		}
+	}
+	return sb.String()
+}
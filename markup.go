@@ -0,0 +1,179 @@
+package prettybuffers
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// markupColors are the backgrounds given in turn to the ranges of markup
+var markupColors = []Color{"24", "58", "89", "22", "94", "54"}
+
+// ParseMarkup parses markup annotating ranges of the buffer, one per line or
+// separated by semicolons, such as
+//
+//	0x10:4 "length" u32le
+//	0x14:16 "session_id" bytes
+//	0x24 "flags" u16
+//
+// Each range is an offset and a length, followed by a quoted label and
+// optionally the type its value is shown as: u8 to u64, i8 to i64, f32 and
+// f64, in the byte order of the viewer unless they end in le or be, char for
+// text or bytes. The length may be left out for numbers. Comments start with
+// #.
+func ParseMarkup(src string) ([]Markup, error) {
+	var list []Markup
+	for n, line := range splitMarkup(src) {
+		if line == "" {
+			continue
+		}
+		mk, err := parseMarkupLine(line)
+		if err != nil {
+			return nil, fmt.Errorf("entry %d: %w", n+1, err)
+		}
+		list = append(list, mk)
+	}
+	return list, nil
+}
+
+// Markup is a range annotated by markup, see ParseMarkup
+type Markup struct {
+	Start  int
+	Length int
+	Label  string
+	field  *templateField // decodes the value shown, if a type is given
+}
+
+// splitMarkup splits markup into trimmed entries at newlines and semicolons,
+// dropping comments, outside of quoted labels
+func splitMarkup(src string) []string {
+	var entries []string
+	start := 0
+	for i := 0; i <= len(src); i++ {
+		switch {
+		case i == len(src) || src[i] == '\n' || src[i] == ';':
+			entries = append(entries, strings.TrimSpace(src[start:i]))
+			start = i + 1
+		case src[i] == '"':
+			if q, err := strconv.QuotedPrefix(src[i:]); err == nil {
+				i += len(q) - 1
+			}
+		case src[i] == '#':
+			entries = append(entries, strings.TrimSpace(src[start:i]))
+			for i < len(src) && src[i] != '\n' {
+				i++
+			}
+			start = i + 1
+		}
+	}
+	return entries
+}
+
+// parseMarkupLine parses one entry of markup
+func parseMarkupLine(line string) (Markup, error) {
+	at, rest, _ := strings.Cut(line, " ")
+	off, length, hasLength := strings.Cut(at, ":")
+	start, err := parseOffset(off)
+	if err != nil || start < 0 {
+		return Markup{}, fmt.Errorf("invalid offset %q", off)
+	}
+	mk := Markup{Start: start, Length: -1}
+	if hasLength {
+		n, err := strconv.ParseInt(length, 0, 64)
+		if err != nil || n <= 0 {
+			return mk, fmt.Errorf("invalid length %q", length)
+		}
+		mk.Length = int(n)
+	}
+
+	rest = strings.TrimSpace(rest)
+	quoted, err := strconv.QuotedPrefix(rest)
+	if err != nil {
+		return mk, fmt.Errorf("expected a quoted label after %s", at)
+	}
+	mk.Label, _ = strconv.Unquote(quoted)
+
+	if typ := strings.TrimSpace(rest[len(quoted):]); typ != "" {
+		f, err := parseTemplateField([]string{typ, "value"}, nil, nil)
+		if err != nil || f.typ == "strz" {
+			return mk, fmt.Errorf("unknown type %s", typ)
+		}
+		size := templateSizes[f.typ]
+		switch {
+		case f.typ == "char" || f.typ == "bytes":
+			if mk.Length < 0 {
+				return mk, fmt.Errorf("%s needs a length", typ)
+			}
+		case mk.Length < 0:
+			mk.Length = size
+		case mk.Length != size:
+			return mk, fmt.Errorf("%s is %d bytes, not %d", typ, size, mk.Length)
+		}
+		mk.field = &f
+	}
+	if mk.Length < 0 {
+		return mk, fmt.Errorf("missing length of %q", mk.Label)
+	}
+	return mk, nil
+}
+
+// markupAnnotations turns markup into annotations, colored in turn
+func markupAnnotations(list []Markup) []annotation {
+	annotations := make([]annotation, len(list))
+	for i, mk := range list {
+		annotations[i] = annotation{
+			start: mk.Start,
+			end:   mk.Start + mk.Length,
+			label: mk.Label,
+			style: lipgloss.NewStyle().Background(lipgloss.Color(markupColors[i%len(markupColors)])),
+			field: mk.field,
+		}
+	}
+	return annotations
+}
+
+// cmdMark annotates the ranges given as markup, or removes all annotations
+func cmdMark(m *model, args string) (tea.Cmd, error) {
+	switch args {
+	case "":
+		return nil, fmt.Errorf(`usage: mark <offset>:<length> "label" [type]; ... | mark clear`)
+	case "clear":
+		m.annotations = nil
+		return nil, nil
+	}
+	list, err := ParseMarkup(args)
+	if err != nil {
+		return nil, err
+	}
+	for _, a := range markupAnnotations(list) {
+		m.addAnnotation(a)
+	}
+	m.status = fmt.Sprintf("Annotated %d ranges", len(list))
+	return nil, nil
+}
+
+// AnnotateMarkup annotates the ranges given as markup, see ParseMarkup. An
+// error is returned if the markup can't be parsed, and nothing is annotated.
+func (v *Viewer) AnnotateMarkup(src string) error {
+	list, err := ParseMarkup(src)
+	if err != nil {
+		return err
+	}
+	for _, a := range markupAnnotations(list) {
+		v.program.Send(annotateMsg(a))
+	}
+	return nil
+}
+
+// AnnotateMarkup annotates ranges in the TUI started by StartTUI, see
+// Viewer.AnnotateMarkup
+func AnnotateMarkup(src string) error {
+	v := defaultViewer()
+	if v == nil {
+		return ErrNoViewer
+	}
+	return v.AnnotateMarkup(src)
+}
@@ -0,0 +1,269 @@
+package prettybuffers
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+)
+
+// maxCapturedBody limits how much of each body is mirrored into the viewer
+const maxCapturedBody = 1 << 20
+
+// HTTPOption configures which requests Middleware and RoundTripper capture
+type HTTPOption func(*httpCapture)
+
+// WithHTTPFilter only captures the requests for which keep returns true
+func WithHTTPFilter(keep func(*http.Request) bool) HTTPOption {
+	return func(c *httpCapture) {
+		c.filter = keep
+	}
+}
+
+// WithHTTPSampling captures only about the given fraction of requests, from
+// 0 for none to 1 for all (the default)
+func WithHTTPSampling(rate float64) HTTPOption {
+	return func(c *httpCapture) {
+		c.rate = rate
+	}
+}
+
+// httpCapture mirrors the bodies of the requests it is configured to keep
+// into a viewer, the one started by StartTUI at the time if v is nil
+type httpCapture struct {
+	v      *Viewer
+	filter func(*http.Request) bool
+	rate   float64
+	count  atomic.Int64 // of captured requests, numbering them
+}
+
+// newHTTPCapture applies opts on top of capturing every request
+func newHTTPCapture(v *Viewer, opts []HTTPOption) *httpCapture {
+	c := &httpCapture{v: v, rate: 1}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// keep reports whether r is captured, and the number of its capture if so
+func (c *httpCapture) keep(r *http.Request) (int64, bool) {
+	if c.filter != nil && !c.filter(r) || c.rate < 1 && rand.Float64() >= c.rate {
+		return 0, false
+	}
+	return c.count.Add(1), true
+}
+
+// send appends a body to the viewer as a chunk with the given label
+func (c *httpCapture) send(body *capturedBody, label string, color Color) {
+	label = fmt.Sprintf("%s, %d bytes", label, body.buf.Len())
+	if body.truncated {
+		label += " (truncated)"
+	}
+	sendChunk(c.v, body.buf.Bytes(), label, color)
+}
+
+// capturedBody collects up to maxCapturedBody bytes of a body
+type capturedBody struct {
+	buf       bytes.Buffer
+	truncated bool
+}
+
+// Write implements io.Writer
+func (b *capturedBody) Write(p []byte) (int, error) {
+	room := maxCapturedBody - b.buf.Len()
+	if len(p) > room {
+		b.truncated = true
+	}
+	b.buf.Write(p[:min(len(p), room)])
+	return len(p), nil
+}
+
+// recordedBody records what is read from a body, calling done, if set, once
+// when it is read to the end or closed
+type recordedBody struct {
+	io.ReadCloser
+	body capturedBody
+	once sync.Once
+	done func(*capturedBody)
+}
+
+// Read implements io.Reader
+func (r *recordedBody) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.body.Write(p[:n])
+	if err == io.EOF {
+		r.finish()
+	}
+	return n, err
+}
+
+// Close implements io.Closer
+func (r *recordedBody) Close() error {
+	err := r.ReadCloser.Close()
+	r.finish()
+	return err
+}
+
+// finish reports the recorded body, once
+func (r *recordedBody) finish() {
+	r.once.Do(func() {
+		if r.done != nil {
+			r.done(&r.body)
+		}
+	})
+}
+
+// recordingWriter records the status and body of a response
+type recordingWriter struct {
+	http.ResponseWriter
+	status   int
+	body     capturedBody
+	hijacked bool
+}
+
+// WriteHeader implements http.ResponseWriter
+func (w *recordingWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+// Write implements http.ResponseWriter
+func (w *recordingWriter) Write(p []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(p)
+	w.body.Write(p[:n])
+	return n, err
+}
+
+// Flush implements http.Flusher when the underlying writer does
+func (w *recordingWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack implements http.Hijacker when the underlying writer does. What is
+// written to the connection afterwards isn't recorded.
+func (w *recordingWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, http.ErrNotSupported
+	}
+	conn, rw, err := h.Hijack()
+	if err == nil {
+		w.hijacked = true
+	}
+	return conn, rw, err
+}
+
+// Unwrap returns the underlying writer, for http.ResponseController
+func (w *recordingWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// middleware captures the bodies of requests handled by next
+func (c *httpCapture) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n, ok := c.keep(r)
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+		name := fmt.Sprintf("#%d %s %s", n, r.Method, r.URL.RequestURI())
+		var request *recordedBody
+		if r.Body != nil && r.Body != http.NoBody {
+			request = &recordedBody{ReadCloser: r.Body}
+			r.Body = request
+		}
+		rec := &recordingWriter{ResponseWriter: w}
+		next.ServeHTTP(rec, r)
+
+		// The handler may not have read the request body to the end
+		if request != nil {
+			c.send(&request.body, name+" request body", ReceivedColor)
+		}
+		status := rec.status
+		if status == 0 {
+			// A handler that writes nothing responds with 200 OK
+			status = http.StatusOK
+		}
+		result := fmt.Sprintf("status %d", status)
+		if rec.hijacked {
+			result = "connection hijacked"
+		}
+		c.send(&rec.body, name+" response body, "+result, SentColor)
+	})
+}
+
+// roundTripper captures the bodies of requests sent through next
+type roundTripper struct {
+	capture *httpCapture
+	next    http.RoundTripper
+}
+
+// RoundTrip implements http.RoundTripper
+func (t roundTripper) RoundTrip(r *http.Request) (*http.Response, error) {
+	n, ok := t.capture.keep(r)
+	if !ok {
+		return t.next.RoundTrip(r)
+	}
+	name := fmt.Sprintf("#%d %s %s", n, r.Method, r.URL)
+	if r.Body != nil && r.Body != http.NoBody {
+		// RoundTrip must not modify the request, so send a copy
+		r = r.Clone(r.Context())
+		r.Body = &recordedBody{ReadCloser: r.Body, done: func(body *capturedBody) {
+			t.capture.send(body, name+" request body", SentColor)
+		}}
+	}
+	resp, err := t.next.RoundTrip(r)
+	if err != nil {
+		return nil, err
+	}
+	status := resp.StatusCode
+	resp.Body = &recordedBody{ReadCloser: resp.Body, done: func(body *capturedBody) {
+		t.capture.send(body, fmt.Sprintf("%s response body, status %d", name, status), ReceivedColor)
+	}}
+	return resp, nil
+}
+
+// Middleware returns a handler that mirrors the bodies of the requests and
+// responses handled by next into this viewer, each labeled with the method,
+// path and status of its request
+func (v *Viewer) Middleware(next http.Handler, opts ...HTTPOption) http.Handler {
+	return newHTTPCapture(v, opts).middleware(next)
+}
+
+// RoundTripper returns a transport that mirrors the bodies of the requests
+// sent through next, http.DefaultTransport if nil, and of their responses
+// into this viewer. Response bodies are mirrored once read or closed.
+func (v *Viewer) RoundTripper(next http.RoundTripper, opts ...HTTPOption) http.RoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return roundTripper{capture: newHTTPCapture(v, opts), next: next}
+}
+
+// Middleware mirrors request and response bodies into the TUI started by
+// StartTUI, see Viewer.Middleware
+func Middleware(next http.Handler, opts ...HTTPOption) http.Handler {
+	return newHTTPCapture(nil, opts).middleware(next)
+}
+
+// RoundTripper mirrors request and response bodies into the TUI started by
+// StartTUI, see Viewer.RoundTripper
+func RoundTripper(next http.RoundTripper, opts ...HTTPOption) http.RoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return roundTripper{capture: newHTTPCapture(nil, opts), next: next}
+}
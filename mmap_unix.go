@@ -0,0 +1,34 @@
+//go:build unix
+
+package prettybuffers
+
+import (
+	"os"
+	"syscall"
+)
+
+// mapFile maps the file at path into memory. Pages are only read from disk
+// when they are touched, so huge files can be viewed without loading them.
+// The mapping is private: edits made in the viewer never reach the file.
+func mapFile(path string) ([]byte, func() error, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, nil, err
+	}
+	if info.Size() == 0 {
+		return []byte{}, func() error { return nil }, nil
+	}
+
+	data, err := syscall.Mmap(int(f.Fd()), 0, int(info.Size()),
+		syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_PRIVATE)
+	if err != nil {
+		return nil, nil, err
+	}
+	return data, func() error { return syscall.Munmap(data) }, nil
+}
@@ -0,0 +1,174 @@
+package prettybuffers
+
+import (
+	"fmt"
+
+	"github.com/charmbracelet/bubbles/key"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// scanChunkSize is how many bytes are read at a time when scanning for runs
+const scanChunkSize = 4096
+
+// countPrefix collects the digits of a count such as the 10 in "10j". It
+// reports whether msg was part of a count.
+func (m *model) countPrefix(msg tea.KeyMsg) bool {
+	digit := msg.String()
+	if len(digit) != 1 || digit[0] < '0' || digit[0] > '9' {
+		return false
+	}
+	if m.count == 0 && !key.Matches(msg, m.keys.Count) {
+		return false
+	}
+	m.count = min(m.count*10+int(digit[0]-'0'), 1<<20)
+	m.status = fmt.Sprintf("Count: %d", m.count)
+	return true
+}
+
+// takeCount returns the pending count, or 1 if none was typed, and resets it
+func (m *model) takeCount() int {
+	n := max(1, m.count)
+	m.count = 0
+	return n
+}
+
+// motion moves the cursor for the vim-style motion keys shared by normal and
+// selection mode, repeated by the pending count. It reports whether msg was a motion.
+func (m *model) motion(msg tea.KeyMsg) bool {
+	halfPage := max(1, m.visibleRows()/2)
+	switch {
+	case key.Matches(msg, m.keys.Up):
+		m.moveLines(-m.takeCount())
+	case key.Matches(msg, m.keys.Down):
+		m.moveLines(m.takeCount())
+	case key.Matches(msg, m.keys.Left):
+		m.moveCursor(-m.takeCount())
+	case key.Matches(msg, m.keys.Right):
+		m.moveCursor(m.takeCount())
+	case key.Matches(msg, m.keys.PageUp):
+		m.scrollPages(-m.takeCount())
+	case key.Matches(msg, m.keys.PageDown):
+		m.scrollPages(m.takeCount())
+	case key.Matches(msg, m.keys.HalfPageUp):
+		m.moveLines(-halfPage * m.takeCount())
+	case key.Matches(msg, m.keys.HalfPageDown):
+		m.moveLines(halfPage * m.takeCount())
+	case key.Matches(msg, m.keys.RowStart):
+		start, _ := m.lineBounds()
+		m.moveCursor(start - m.cursor)
+	case key.Matches(msg, m.keys.RowEnd):
+		_, end := m.lineBounds()
+		m.moveCursor(end - m.cursor)
+	case key.Matches(msg, m.keys.Home):
+		m.moveCursor(-m.cursor)
+	case key.Matches(msg, m.keys.End):
+		m.moveCursor(m.size())
+	case key.Matches(msg, m.keys.Top):
+		// Completed by pressing it again, see handlePendingKey
+		m.pendingKey = "g"
+		return true
+	case key.Matches(msg, m.keys.Bottom):
+		if m.count > 0 {
+			m.gotoRow(m.takeCount())
+		} else {
+			m.moveCursor(m.size())
+		}
+	case key.Matches(msg, m.keys.NextRun):
+		for n := m.takeCount(); n > 0; n-- {
+			m.moveCursor(m.nextRun(m.cursor) - m.cursor)
+		}
+	case key.Matches(msg, m.keys.PrevRun):
+		for n := m.takeCount(); n > 0; n-- {
+			m.moveCursor(m.prevRun(m.cursor) - m.cursor)
+		}
+	default:
+		return false
+	}
+	m.count = 0
+	return true
+}
+
+// scrollPages scrolls the view by whole pages and moves the cursor along. A
+// page down near the end shows the last page rather than stopping short of
+// it, and moves the cursor as far as it can go.
+func (m *model) scrollPages(pages int) {
+	if m.inSmartView() && m.size() > 0 {
+		m.scrollSmartPages(pages)
+		return
+	}
+	page := m.visibleRows() * m.bytesPerRow
+	viewStart := m.offset - (m.offset % m.bytesPerRow)
+	m.offset = max(0, min(viewStart+pages*page, lastPageStart(m.cursorLimit()+1, m.bytesPerRow, m.visibleRows())))
+	m.cursor = max(0, min(m.cursor+pages*page, m.cursorLimit()))
+	// Keep the cursor in view when the page was cut short
+	m.moveCursor(0)
+}
+
+// lastPageStart returns the offset of the first row of the last page of a
+// buffer of size bytes shown in rows of bytesPerRow
+func lastPageStart(size, bytesPerRow, rows int) int {
+	lastRow := max(size-1, 0) / bytesPerRow * bytesPerRow
+	return max(0, lastRow-(rows-1)*bytesPerRow)
+}
+
+// gotoRow moves the cursor to the start of the given row, counting from 1
+func (m *model) gotoRow(row int) {
+	m.moveCursor((row-1)*m.bytesPerRow - m.cursor)
+}
+
+// runClass groups bytes for the w and b motions: zero, printable ASCII and other
+func runClass(b byte) int {
+	switch {
+	case b == 0:
+		return 0
+	case b >= 32 && b <= 126:
+		return 1
+	}
+	return 2
+}
+
+// scanBytes walks the buffer from pos in the direction of step (1 or -1)
+// while match returns true, and returns the offset where it stopped. That is
+// -1 or the buffer size if every byte on the way matched.
+func (m model) scanBytes(pos, step int, match func(b byte) bool) int {
+	for pos >= 0 && pos < m.size() {
+		start := pos
+		if step < 0 {
+			start = max(0, pos-scanChunkSize+1)
+		}
+		chunk := m.window(start, scanChunkSize)
+		for ; pos >= start && pos-start < len(chunk); pos += step {
+			if !match(chunk[pos-start]) {
+				return pos
+			}
+		}
+	}
+	return pos
+}
+
+// nextRun returns the start of the next run of non-zero bytes after the run
+// containing pos, or pos if there is none
+func (m model) nextRun(pos int) int {
+	cur := m.window(pos, 1)
+	if len(cur) == 0 {
+		return pos
+	}
+	class := runClass(cur[0])
+	next := m.scanBytes(pos, 1, func(b byte) bool { return runClass(b) == class })
+	next = m.scanBytes(next, 1, func(b byte) bool { return b == 0 })
+	if next >= m.size() {
+		return pos
+	}
+	return next
+}
+
+// prevRun returns the start of the run of non-zero bytes before pos, or pos
+// if there is none
+func (m model) prevRun(pos int) int {
+	prev := m.scanBytes(pos-1, -1, func(b byte) bool { return b == 0 })
+	if prev < 0 {
+		return pos
+	}
+	class := runClass(m.window(prev, 1)[0])
+	return m.scanBytes(prev, -1, func(b byte) bool { return runClass(b) == class }) + 1
+}
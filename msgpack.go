@@ -0,0 +1,333 @@
+package prettybuffers
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"math"
+	"strconv"
+	"unicode/utf8"
+)
+
+const (
+	// maxMsgpackSize is the largest MessagePack value that is decoded, so
+	// that random bytes declaring huge lengths are rejected quickly
+	maxMsgpackSize = 1 << 20
+	// maxMsgpackDepth limits the nesting of decoded values
+	maxMsgpackDepth = 32
+)
+
+var (
+	errMsgpackShort   = errors.New("msgpack: value runs past the end of the data")
+	errMsgpackInvalid = errors.New("msgpack: invalid value")
+)
+
+// msgpackDecoder converts one MessagePack value into JSON text, keeping the
+// order of map keys
+type msgpackDecoder struct {
+	data  []byte
+	pos   int
+	out   bytes.Buffer
+	depth int
+}
+
+// take returns the next n bytes
+func (d *msgpackDecoder) take(n int) ([]byte, error) {
+	if n < 0 || n > maxMsgpackSize {
+		return nil, errMsgpackInvalid
+	}
+	if d.pos+n > len(d.data) {
+		return nil, errMsgpackShort
+	}
+	b := d.data[d.pos : d.pos+n]
+	d.pos += n
+	return b, nil
+}
+
+// length reads a big-endian length of size bytes
+func (d *msgpackDecoder) length(size int) (int, error) {
+	b, err := d.take(size)
+	if err != nil {
+		return 0, err
+	}
+	switch size {
+	case 1:
+		return int(b[0]), nil
+	case 2:
+		return int(binary.BigEndian.Uint16(b)), nil
+	}
+	n := binary.BigEndian.Uint32(b)
+	if n > maxMsgpackSize {
+		return 0, errMsgpackInvalid
+	}
+	return int(n), nil
+}
+
+// value decodes the next value and writes it as JSON
+func (d *msgpackDecoder) value() error {
+	head, err := d.take(1)
+	if err != nil {
+		return err
+	}
+	switch b := head[0]; {
+	case b <= 0x7f:
+		d.out.WriteString(strconv.Itoa(int(b)))
+	case b >= 0xe0:
+		d.out.WriteString(strconv.Itoa(int(int8(b))))
+	case b <= 0x8f:
+		return d.mapBody(int(b & 0x0f))
+	case b <= 0x9f:
+		return d.arrayBody(int(b & 0x0f))
+	case b <= 0xbf:
+		return d.str(int(b & 0x1f))
+	case b == 0xc0:
+		d.out.WriteString("null")
+	case b == 0xc2:
+		d.out.WriteString("false")
+	case b == 0xc3:
+		d.out.WriteString("true")
+	case b >= 0xc4 && b <= 0xc6:
+		n, err := d.length(1 << (b - 0xc4))
+		if err != nil {
+			return err
+		}
+		return d.bin(n)
+	case b >= 0xc7 && b <= 0xc9:
+		n, err := d.length(1 << (b - 0xc7))
+		if err != nil {
+			return err
+		}
+		return d.ext(n)
+	case b == 0xca:
+		raw, err := d.take(4)
+		if err != nil {
+			return err
+		}
+		d.float(float64(math.Float32frombits(binary.BigEndian.Uint32(raw))))
+	case b == 0xcb:
+		raw, err := d.take(8)
+		if err != nil {
+			return err
+		}
+		d.float(math.Float64frombits(binary.BigEndian.Uint64(raw)))
+	case b >= 0xcc && b <= 0xcf:
+		raw, err := d.take(1 << (b - 0xcc))
+		if err != nil {
+			return err
+		}
+		var n uint64
+		for _, c := range raw {
+			n = n<<8 | uint64(c)
+		}
+		d.out.WriteString(strconv.FormatUint(n, 10))
+	case b >= 0xd0 && b <= 0xd3:
+		size := 1 << (b - 0xd0)
+		raw, err := d.take(size)
+		if err != nil {
+			return err
+		}
+		var n uint64
+		for _, c := range raw {
+			n = n<<8 | uint64(c)
+		}
+		// Sign-extend from the encoded size
+		shift := 64 - 8*size
+		d.out.WriteString(strconv.FormatInt(int64(n<<shift)>>shift, 10))
+	case b >= 0xd4 && b <= 0xd8:
+		return d.ext(1 << (b - 0xd4))
+	case b >= 0xd9 && b <= 0xdb:
+		n, err := d.length(1 << (b - 0xd9))
+		if err != nil {
+			return err
+		}
+		return d.str(n)
+	case b == 0xdc || b == 0xdd:
+		n, err := d.length(2 << (b - 0xdc))
+		if err != nil {
+			return err
+		}
+		return d.arrayBody(n)
+	case b == 0xde || b == 0xdf:
+		n, err := d.length(2 << (b - 0xde))
+		if err != nil {
+			return err
+		}
+		return d.mapBody(n)
+	default:
+		// 0xc1 is never used
+		return errMsgpackInvalid
+	}
+	return nil
+}
+
+// float writes a float, or null for values JSON cannot represent
+func (d *msgpackDecoder) float(f float64) {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		d.out.WriteString("null")
+		return
+	}
+	d.out.WriteString(strconv.FormatFloat(f, 'g', -1, 64))
+}
+
+// str writes a string of n bytes, which must be valid UTF-8
+func (d *msgpackDecoder) str(n int) error {
+	raw, err := d.take(n)
+	if err != nil {
+		return err
+	}
+	if !utf8.Valid(raw) {
+		return errMsgpackInvalid
+	}
+	text, _ := json.Marshal(string(raw))
+	d.out.Write(text)
+	return nil
+}
+
+// bin writes n bytes of binary data as a base64 string
+func (d *msgpackDecoder) bin(n int) error {
+	raw, err := d.take(n)
+	if err != nil {
+		return err
+	}
+	text, _ := json.Marshal(raw)
+	d.out.Write(text)
+	return nil
+}
+
+// ext writes an extension value of n data bytes as an object holding its type
+func (d *msgpackDecoder) ext(n int) error {
+	typ, err := d.take(1)
+	if err != nil {
+		return err
+	}
+	d.out.WriteString(`{"ext":` + strconv.Itoa(int(int8(typ[0]))) + `,"data":`)
+	if err := d.bin(n); err != nil {
+		return err
+	}
+	d.out.WriteByte('}')
+	return nil
+}
+
+// arrayBody writes the n elements of an array
+func (d *msgpackDecoder) arrayBody(n int) error {
+	if d.depth++; d.depth > maxMsgpackDepth {
+		return errMsgpackInvalid
+	}
+	d.out.WriteByte('[')
+	for i := 0; i < n; i++ {
+		if i > 0 {
+			d.out.WriteByte(',')
+		}
+		if err := d.value(); err != nil {
+			return err
+		}
+	}
+	d.out.WriteByte(']')
+	d.depth--
+	return nil
+}
+
+// mapBody writes the n entries of a map. JSON only has string keys, so other
+// keys are written as strings holding their JSON text.
+func (d *msgpackDecoder) mapBody(n int) error {
+	if d.depth++; d.depth > maxMsgpackDepth {
+		return errMsgpackInvalid
+	}
+	d.out.WriteByte('{')
+	for i := 0; i < n; i++ {
+		if i > 0 {
+			d.out.WriteByte(',')
+		}
+		keyStart := d.out.Len()
+		if err := d.value(); err != nil {
+			return err
+		}
+		if key := d.out.Bytes()[keyStart:]; key[0] != '"' {
+			quoted, _ := json.Marshal(string(key))
+			d.out.Truncate(keyStart)
+			d.out.Write(quoted)
+		}
+		d.out.WriteByte(':')
+		if err := d.value(); err != nil {
+			return err
+		}
+	}
+	d.out.WriteByte('}')
+	d.depth--
+	return nil
+}
+
+// isMsgpackMap reports whether b starts a MessagePack map
+func isMsgpackMap(b byte) bool {
+	return b >= 0x81 && b <= 0x8f || b == 0xde || b == 0xdf
+}
+
+// isMsgpackStr reports whether b starts a MessagePack string
+func isMsgpackStr(b byte) bool {
+	return b >= 0xa1 && b <= 0xbf || b >= 0xd9 && b <= 0xdb
+}
+
+// decodeMsgpack decodes the MessagePack map at the start of data and returns
+// it as JSON text along with its encoded length. Only non-empty maps whose
+// first key is a string are accepted, as any byte is the start of some
+// MessagePack value.
+func decodeMsgpack(data []byte) ([]byte, int, error) {
+	if len(data) < 2 || !isMsgpackMap(data[0]) {
+		return nil, 0, errMsgpackInvalid
+	}
+	d := &msgpackDecoder{data: data}
+	if data[0] >= 0xde {
+		// The first key follows the 2 or 4 byte length
+		if skip := 1 + 2<<(data[0]-0xde); len(data) <= skip || !isMsgpackStr(data[skip]) {
+			return nil, 0, errMsgpackInvalid
+		}
+	} else if !isMsgpackStr(data[1]) {
+		return nil, 0, errMsgpackInvalid
+	}
+	if err := d.value(); err != nil {
+		return nil, 0, err
+	}
+	return d.out.Bytes(), d.pos, nil
+}
+
+// scanMsgpackObjects finds MessagePack maps in data starting at from,
+// skipping the ranges of the given objects. Like scanJSONObjects it returns
+// the offset of the first value that was cut off by the end of data.
+func scanMsgpackObjects(data []byte, from int, skip []jsonObject) ([]jsonObject, int) {
+	var objects []jsonObject
+	resume := len(data)
+	next := 0 // index into skip of the next object at or after i
+	for i := from; i < len(data); i++ {
+		for next < len(skip) && skip[next].endOffset < i {
+			next++
+		}
+		if next < len(skip) && skip[next].startOffset <= i {
+			i = skip[next].endOffset
+			continue
+		}
+		if !isMsgpackMap(data[i]) {
+			continue
+		}
+		text, n, err := decodeMsgpack(data[i:])
+		if errors.Is(err, errMsgpackShort) {
+			resume = min(resume, i)
+			continue
+		}
+		if err != nil || (next < len(skip) && i+n > skip[next].startOffset) {
+			continue
+		}
+		var parsed interface{}
+		_ = json.Unmarshal(text, &parsed)
+		objects = append(objects, jsonObject{
+			startOffset: i,
+			endOffset:   i + n - 1,
+			data:        data[i : i+n],
+			parsed:      parsed,
+			decoded:     text,
+			kind:        objectMsgpack,
+		})
+		i += n - 1
+	}
+	return objects, resume
+}
@@ -0,0 +1,189 @@
+package prettybuffers
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// maxMultipartParts limits how many parts of a multipart body are parsed
+const maxMultipartParts = 1024
+
+// errMultipartShort reports a multipart body cut off by the end of the data
+var errMultipartShort = errors.New("multipart: body runs past the end of the data")
+
+// multipartPart is a part of a multipart body, starting at its boundary line
+type multipartPart struct {
+	start, bodyStart, bodyEnd int
+	headers                   []httpHeader
+}
+
+// isMultipartBoundary reports whether b is a valid boundary as of RFC 2046:
+// up to 70 characters of a limited set, not ending in a space
+func isMultipartBoundary(b []byte) bool {
+	if len(b) == 0 || len(b) > 70 || b[len(b)-1] == ' ' {
+		return false
+	}
+	for _, c := range b {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || strings.IndexByte("'()+_,-./:=? ", c) >= 0) {
+			return false
+		}
+	}
+	return true
+}
+
+// scanMultipartObjects finds MIME multipart bodies in data starting at from,
+// skipping the ranges of the given objects. A body starts with a --boundary
+// line and must end with the closing --boundary-- line. Each part becomes an
+// object with its headers, and detection runs on its content. Like
+// scanHTTPObjects it returns the offset of a body cut off by the end of data.
+func scanMultipartObjects(data []byte, from int, skip []jsonObject, b *decodeBudget) ([]jsonObject, int) {
+	var objects []jsonObject
+	resume := len(data)
+	next := 0 // index into skip of the next object at or after i
+	for i := from; i+1 < len(data); i++ {
+		// Bodies start at the beginning of a line or after binary framing
+		if data[i] != '-' || data[i+1] != '-' || i > 0 && isPrintableASCII(data[i-1]) {
+			continue
+		}
+		for next < len(skip) && skip[next].endOffset < i {
+			next++
+		}
+		end := len(data)
+		if next < len(skip) {
+			if skip[next].startOffset <= i {
+				i = skip[next].endOffset
+				continue
+			}
+			end = skip[next].startOffset
+		}
+		parts, err := readMultipart(data[:end], i, b)
+		if errors.Is(err, errMultipartShort) && end == len(data) {
+			resume = min(resume, i)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		objects = append(objects, parts...)
+		i = parts[len(parts)-1].endOffset
+	}
+	return objects, resume
+}
+
+// readMultipart reads the multipart body starting at start into an object for
+// each part, spanning its boundary line, headers and content
+func readMultipart(data []byte, start int, b *decodeBudget) ([]jsonObject, error) {
+	lineEnd, pos, ok := readHTTPLine(data, start)
+	if !ok {
+		return nil, errMultipartShort
+	}
+	boundary := data[start+2 : lineEnd]
+	if !isMultipartBoundary(boundary) || bytes.HasSuffix(boundary, []byte("--")) {
+		return nil, fmt.Errorf("multipart: no boundary line")
+	}
+	delimiter := append([]byte("\n--"), boundary...)
+
+	var parts []multipartPart
+	partStart := start
+	for {
+		if len(parts) == maxMultipartParts {
+			return nil, fmt.Errorf("multipart: more than %d parts", maxMultipartParts)
+		}
+		p := multipartPart{start: partStart}
+		for {
+			end, next, ok := readHTTPLine(data, pos)
+			if !ok {
+				return nil, errMultipartShort
+			}
+			if end == pos {
+				pos = next
+				break
+			}
+			name, value, found := strings.Cut(string(data[pos:end]), ":")
+			if !found || name == "" || strings.ContainsAny(name, " \t") || pos-start > maxHTTPHeaderSize {
+				return nil, fmt.Errorf("multipart: malformed header line")
+			}
+			p.headers = append(p.headers, httpHeader{start: pos, end: end, name: name, value: strings.TrimSpace(value)})
+			pos = next
+		}
+
+		// The line ending before the next boundary line belongs to it
+		i := bytes.Index(data[pos-1:], delimiter)
+		if i < 0 {
+			return nil, errMultipartShort
+		}
+		p.bodyStart, p.bodyEnd = pos, pos-1+i
+		if p.bodyEnd > p.bodyStart && data[p.bodyEnd-1] == '\r' {
+			p.bodyEnd--
+		}
+		p.bodyEnd = max(p.bodyEnd, p.bodyStart)
+		partStart = pos + i
+		parts = append(parts, p)
+
+		after := partStart + len(delimiter) - 1
+		if after+2 > len(data) {
+			return nil, errMultipartShort
+		}
+		if data[after] == '-' && data[after+1] == '-' {
+			// The closing boundary line, up to the end of its line if there
+			// is one
+			end := after + 2
+			if _, next, ok := readHTTPLine(data, end); ok && len(bytes.TrimSpace(data[end:next])) == 0 {
+				end = next
+			}
+			return multipartObjects(data, parts, partStart, end, string(boundary), b), nil
+		}
+		lineEnd, next, ok := readHTTPLine(data, after)
+		if !ok {
+			return nil, errMultipartShort
+		}
+		if len(bytes.TrimSpace(data[after:lineEnd])) > 0 {
+			return nil, fmt.Errorf("multipart: malformed boundary line")
+		}
+		pos = next
+	}
+}
+
+// multipartObjects describes the parts of a multipart body, the last one
+// including the closing boundary line from closing up to end. Detection runs
+// on the content of each part within b.
+func multipartObjects(data []byte, parts []multipartPart, closing, end int, boundary string, b *decodeBudget) []jsonObject {
+	objects := make([]jsonObject, len(parts))
+	for n, p := range parts {
+		partEnd := end
+		if n+1 < len(parts) {
+			partEnd = parts[n+1].start
+		}
+		o := jsonObject{
+			startOffset: p.start,
+			endOffset:   partEnd - 1,
+			data:        data[p.start:partEnd],
+			kind:        objectMultipart,
+			encoding:    "part content",
+			summary:     []string{fmt.Sprintf("Multipart part %d of %d, boundary %s", n+1, len(parts), sanitizeString(boundary))},
+			regions:     []region{{start: p.start, end: p.start + 2 + len(boundary), label: "Multipart boundary"}},
+		}
+		width := 0
+		for _, h := range p.headers {
+			width = max(width, len(h.name))
+		}
+		for _, h := range p.headers {
+			o.summary = append(o.summary, fmt.Sprintf("  %-*s %s", width+1, sanitizeString(h.name)+":", sanitizeString(h.value)))
+			o.regions = append(o.regions, region{start: h.start, end: h.end,
+				label: fmt.Sprintf("Multipart part %d header %s", n+1, sanitizeString(h.name))})
+		}
+		if body := data[p.bodyStart:p.bodyEnd]; len(body) > 0 {
+			o.decoded = body
+			o.nested = b.scan(body)
+			o.regions = append(o.regions, region{start: p.bodyStart, end: p.bodyEnd,
+				label: fmt.Sprintf("Multipart part %d content, %d bytes", n+1, len(body))})
+		}
+		if n+1 == len(parts) {
+			o.regions = append(o.regions, region{start: closing, end: closing + 4 + len(boundary), label: "Multipart closing boundary"})
+		}
+		objects[n] = o
+	}
+	return objects
+}
@@ -0,0 +1,193 @@
+package prettybuffers
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/key"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+const (
+	// objectListWidth is how many cells the sidebar listing detected objects
+	// takes, its border included
+	objectListWidth = 40
+	// objectListEntryLines is the number of lines of each entry in the list
+	objectListEntryLines = 2
+	// maxPreviewBytes bounds how much of an object its preview is made from
+	maxPreviewBytes = 256
+)
+
+// objectList is the sidebar listing the detected objects. While it is
+// shown, the navigation keys move through the list instead of the data.
+type objectList struct {
+	shown    bool
+	selected int // index into jsonObjects
+	top      int // first entry in view
+}
+
+// dataWidth returns how many cells the data takes, less the sidebar
+func (m model) dataWidth() int {
+	if m.objectList.shown {
+		return max(1, m.width-objectListWidth)
+	}
+	return m.width
+}
+
+// toggleObjectList shows or hides the sidebar. It opens on the object under
+// the cursor, or the first one after it.
+func (m *model) toggleObjectList() {
+	if m.objectList.shown {
+		m.closeObjectList()
+		return
+	}
+	if len(m.jsonObjects) == 0 {
+		m.status = "No objects detected"
+		return
+	}
+	i := sort.Search(len(m.jsonObjects), func(i int) bool { return m.jsonObjects[i].endOffset >= m.cursor })
+	m.objectList = objectList{shown: true, selected: min(i, len(m.jsonObjects)-1)}
+	m.scrollObjectList()
+	if !m.fixedBytesPerRow {
+		m.autoBytesPerRow()
+	}
+	m.status = fmt.Sprintf("'%s'/'%s' to choose an object, '%s' to close the list there, '%s' to close it",
+		m.keys.Up.Help().Key, m.keys.Down.Help().Key, m.keys.EnterNested.Help().Key, m.keys.Cancel.Help().Key)
+}
+
+// closeObjectList hides the sidebar, giving its width back to the data
+func (m *model) closeObjectList() {
+	m.objectList.shown = false
+	if !m.fixedBytesPerRow {
+		m.autoBytesPerRow()
+	}
+}
+
+// updateObjectList handles a key press while the sidebar is shown. Moving
+// through the list jumps the data to the selected object, and enter closes
+// the list there.
+func (m *model) updateObjectList(msg tea.KeyMsg) tea.Cmd {
+	page := max(1, m.visibleRows()/objectListEntryLines)
+	switch {
+	case key.Matches(msg, m.keys.Quit):
+		return m.quit()
+	case key.Matches(msg, m.keys.ObjectList), key.Matches(msg, m.keys.Cancel):
+		m.closeObjectList()
+	case key.Matches(msg, m.keys.EnterNested):
+		m.selectObject(m.objectList.selected)
+		m.closeObjectList()
+	case key.Matches(msg, m.keys.Up):
+		m.selectObject(m.objectList.selected - 1)
+	case key.Matches(msg, m.keys.Down):
+		m.selectObject(m.objectList.selected + 1)
+	case key.Matches(msg, m.keys.PageUp):
+		m.selectObject(m.objectList.selected - page)
+	case key.Matches(msg, m.keys.PageDown):
+		m.selectObject(m.objectList.selected + page)
+	case key.Matches(msg, m.keys.Home), key.Matches(msg, m.keys.Top):
+		m.selectObject(0)
+	case key.Matches(msg, m.keys.End), key.Matches(msg, m.keys.Bottom):
+		m.selectObject(len(m.jsonObjects) - 1)
+	}
+	return nil
+}
+
+// selectObject selects entry i of the list and jumps to its object
+func (m *model) selectObject(i int) {
+	if len(m.jsonObjects) == 0 {
+		return
+	}
+	i = max(0, min(i, len(m.jsonObjects)-1))
+	m.objectList.selected = i
+	m.scrollObjectList()
+	m.jumpToObject(i)
+}
+
+// scrollObjectList keeps the selected entry in view
+func (m *model) scrollObjectList() {
+	entries := max(1, m.visibleRows()/objectListEntryLines)
+	l := &m.objectList
+	l.top = max(min(l.top, l.selected), l.selected-entries+1)
+}
+
+// withObjectList draws the sidebar to the right of the header and data rows
+// of a view rendered dataWidth cells wide
+func (m model) withObjectList(view string) string {
+	lines := strings.Split(view, "\n")
+	sidebar := m.objectListLines()
+	width := m.dataWidth()
+	clip := lipgloss.NewStyle().MaxWidth(width)
+	border := " " + m.theme.Scrollbar.Render("│") + " "
+	// Leave the blank line and the footer at the full width
+	for i := 0; i < len(sidebar) && i < len(lines)-2; i++ {
+		line := clip.Render(lines[i])
+		lines[i] = line + strings.Repeat(" ", width-lipgloss.Width(line)) + border + sidebar[i]
+	}
+	return strings.Join(lines, "\n")
+}
+
+// objectListLines renders the sidebar, with the same header lines as the
+// views it is drawn next to
+func (m model) objectListLines() []string {
+	width := objectListWidth - len(" | ")
+	clip := lipgloss.NewStyle().MaxWidth(width)
+	lines := []string{
+		m.theme.Header.Render(fmt.Sprintf("Objects (%d)", len(m.jsonObjects))),
+		"",
+		m.theme.Header.Render("Offset, type and size"),
+		strings.Repeat("-", width),
+	}
+	rows := m.visibleRows()
+	for i := m.objectList.top; i < len(m.jsonObjects) && len(lines)+objectListEntryLines <= scrollbarHeaderLines+rows; i++ {
+		obj := m.jsonObjects[i]
+		entry := []string{
+			fmt.Sprintf("%s %-11s %d B", strings.TrimSpace(m.formatOffset(obj.startOffset)), obj.kind, obj.endOffset-obj.startOffset+1),
+			"  " + obj.preview(),
+		}
+		for j, text := range entry {
+			text = clip.Render(text)
+			style := m.theme.Offset
+			if j > 0 {
+				style = m.theme.JSON
+			}
+			if i == m.objectList.selected {
+				style = m.theme.Selection
+				text += strings.Repeat(" ", width-lipgloss.Width(text))
+			}
+			lines = append(lines, style.Render(text))
+		}
+	}
+	return lines
+}
+
+// preview summarizes an object on one line: the first keys and values of
+// JSON, or else the start of its text
+func (o jsonObject) preview() string {
+	switch {
+	case o.tree != nil && o.tree.open == '{':
+		text := o.text()
+		var members []string
+		for _, child := range o.tree.children {
+			value := string(text[child.start:child.end])
+			if child.open != 0 && len(child.children) > 0 {
+				value = child.folded()
+			}
+			members = append(members, child.key+": "+value)
+			if len(strings.Join(members, ", ")) > objectListWidth {
+				break
+			}
+		}
+		return sanitizeString("{" + strings.Join(members, ", ") + "}")
+	case o.tree != nil:
+		return o.tree.folded()
+	case len(o.summary) > 0:
+		return sanitizeString(o.summary[0])
+	}
+	text := o.data
+	if o.kind == objectMsgpack {
+		text = o.text()
+	}
+	return strings.Join(strings.Fields(sanitizeString(string(text[:min(len(text), maxPreviewBytes)]))), " ")
+}
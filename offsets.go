@@ -0,0 +1,66 @@
+package prettybuffers
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+)
+
+// minCompactDigits is the fewest digits compact offsets are padded to
+const minCompactDigits = 4
+
+// offsetColumn returns the offset column as set by WithDecimalOffsets,
+// WithCompactOffsets and WithBaseAddress
+func (m model) offsetColumn() OffsetColumn {
+	base := m.firstAddress()
+	c := OffsetColumn{Decimal: m.decimalOffsets, Base: base}
+	// Wide enough for the last address the cursor can reach
+	last := base + uint64(max(m.cursorLimit(), 0))
+	if last < base {
+		// Addresses wrap around past the largest one
+		last = math.MaxUint64
+	}
+	digits := len(fmt.Sprintf("%X", last))
+	if c.Decimal {
+		digits = len(fmt.Sprint(last))
+	}
+	if m.compactOffsets {
+		c.Digits = max(digits, minCompactDigits)
+	} else if digits > c.digits() {
+		c.Digits = digits
+	}
+	return c
+}
+
+// formatOffset formats an offset the way the offset column shows it, as an
+// address relative to the base address
+func (m model) formatOffset(offset int) string {
+	return m.offsetColumn().RenderRow(nil, offset)
+}
+
+// parseAddress parses an address as shown in the offset column, in decimal
+// or with a 0x prefix in hexadecimal, and returns its offset in the buffer
+func (m model) parseAddress(s string) (int, error) {
+	addr, err := strconv.ParseUint(s, 0, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid offset %q", s)
+	}
+	base := m.firstAddress()
+	if addr < base || addr-base >= uint64(max(m.size(), 0)) {
+		return 0, fmt.Errorf("offset %s is outside the buffer", s)
+	}
+	return int(addr - base), nil
+}
+
+// toggleDecimalOffsets switches offsets between hexadecimal and decimal
+func (m *model) toggleDecimalOffsets() {
+	m.decimalOffsets = !m.decimalOffsets
+	if !m.fixedBytesPerRow {
+		m.autoBytesPerRow()
+	}
+	if m.decimalOffsets {
+		m.status = "Showing offsets in decimal"
+	} else {
+		m.status = "Showing offsets in hexadecimal"
+	}
+}
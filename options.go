@@ -0,0 +1,284 @@
+package prettybuffers
+
+import (
+	"encoding/binary"
+	"io"
+)
+
+// Option configures a viewer started with StartTUI
+type Option func(*config)
+
+// config holds the settings collected from Options
+type config struct {
+	layoutIndex int
+	bytesPerRow int
+	title       string
+	altScreen   bool
+	theme       Theme
+	keys        KeyMap
+	framing     *framing
+	readOnly    bool
+	input       io.Reader // of the terminal, stdin if nil
+	output      io.Writer // of the terminal, stdout if nil
+	events      events
+	groupSize   int
+	byteOrder   binary.ByteOrder
+	decimal     bool // offsets, see WithDecimalOffsets
+	compact     bool // offsets, see WithCompactOffsets
+	base        uint64
+	detection   DetectionOptions
+	payloads    bool // see WithPayloadsOnly
+	maxSize     int  // see WithMaxBufferSize
+	remote      bool // see WithRemote
+	clipboard   io.Writer
+}
+
+// defaultConfig returns the settings used when no options are given
+func defaultConfig() config {
+	return config{
+		layoutIndex: 0,
+		bytesPerRow: 0, // 0 means adjust to the terminal width
+		altScreen:   true,
+		theme:       DarkTheme,
+		keys:        DefaultKeyMap(),
+		byteOrder:   binary.LittleEndian,
+	}
+}
+
+// newConfig applies the given options on top of the defaults
+func newConfig(opts []Option) config {
+	cfg := defaultConfig()
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	return cfg
+}
+
+// WithInitialLayout selects the layout (an index into PredefinedLayouts) shown at startup
+func WithInitialLayout(layoutIndex int) Option {
+	return func(c *config) {
+		if layoutIndex >= 0 && layoutIndex < layoutCount() {
+			c.layoutIndex = layoutIndex
+		}
+	}
+}
+
+// WithBytesPerRow fixes the number of bytes per row instead of deriving it from the terminal width
+func WithBytesPerRow(n int) Option {
+	return func(c *config) {
+		if n > 0 {
+			c.bytesPerRow = n
+		}
+	}
+}
+
+// WithTitle sets a title shown in the header and as the terminal window title
+func WithTitle(title string) Option {
+	return func(c *config) {
+		c.title = title
+	}
+}
+
+// WithAltScreen controls whether the viewer takes over the alternate screen buffer (default true)
+func WithAltScreen(enabled bool) Option {
+	return func(c *config) {
+		c.altScreen = enabled
+	}
+}
+
+// WithTheme sets the theme used at startup, see PredefinedThemes (default DarkTheme)
+func WithTheme(theme Theme) Option {
+	return func(c *config) {
+		c.theme = theme
+	}
+}
+
+// WithKeyMap replaces the key bindings, see DefaultKeyMap
+func WithKeyMap(keys KeyMap) Option {
+	return func(c *config) {
+		c.keys = keys
+	}
+}
+
+// WithFraming splits the buffer into frames that each start with a length
+// prefix of prefixSize bytes (1, 2, 4 or 8) in the given byte order, e.g.
+// binary.BigEndian. includesHeader tells whether the length counts the prefix
+// as well as the payload. Frame headers are underlined, and the NextFrame and
+// PrevFrame keys move between frames.
+func WithFraming(prefixSize int, order binary.ByteOrder, includesHeader bool) Option {
+	return func(c *config) {
+		switch prefixSize {
+		case 1, 2, 4, 8:
+			if order == nil {
+				order = binary.BigEndian
+			}
+			c.framing = &framing{prefixSize: prefixSize, order: order, includesHeader: includesHeader}
+		}
+	}
+}
+
+// WithByteGrouping shows the bytes of the hex column in words of size bytes
+// (2, 4 or 8), e.g. 01234567 89ABCDEF for 4 with big-endian words, in the
+// byte order set by WithByteOrder. Little-endian words show their bytes
+// reversed, so that they read as numbers. The GroupBytes key cycles through
+// the sizes.
+func WithByteGrouping(size int) Option {
+	return func(c *config) {
+		switch size {
+		case 1, 2, 4, 8:
+			c.groupSize = size
+		}
+	}
+}
+
+// WithByteOrder sets the byte order in which grouped words are shown and
+// overlaid templates and structs read fields that don't set their own,
+// binary.LittleEndian by default. The ToggleEndian key flips it.
+func WithByteOrder(order binary.ByteOrder) Option {
+	return func(c *config) {
+		if order != nil {
+			c.byteOrder = order
+		}
+	}
+}
+
+// WithDecimalOffsets shows offsets in decimal instead of hexadecimal, for
+// comparing them with tools that report decimal positions. The
+// DecimalOffsets key toggles it, and the set offsets command sets it as well
+// as WithCompactOffsets.
+func WithDecimalOffsets(enabled bool) Option {
+	return func(c *config) {
+		c.decimal = enabled
+	}
+}
+
+// WithCompactOffsets pads offsets to as many digits as the size of the
+// buffer needs, at least 4, instead of 8 hexadecimal or 10 decimal digits
+func WithCompactOffsets(enabled bool) Option {
+	return func(c *config) {
+		c.compact = enabled
+	}
+}
+
+// WithBaseAddress shows offsets relative to addr, such as the load address
+// of a firmware image or the position of a slice within a larger file, in
+// the offset column and the status bar. The goto command takes such
+// addresses too.
+func WithBaseAddress(addr uint64) Option {
+	return func(c *config) {
+		c.base = addr
+	}
+}
+
+// WithStrictJSON sets whether only JSON that parses is detected, which is
+// the default. With strict set to false, text that merely looks like JSON is
+// shown as such too, e.g. with trailing commas, unquoted keys or comments,
+// as long as its brackets balance outside of strings. Objects in decoded
+// data, such as of base64, are always detected strictly. This is the
+// AcceptUnparsed field of WithDetectionOptions.
+func WithStrictJSON(strict bool) Option {
+	return func(c *config) {
+		c.detection.AcceptUnparsed = !strict
+	}
+}
+
+// DetectionOptions tune how JSON is detected, trading false positives for
+// false negatives. Fields left at their zero value keep the defaults.
+type DetectionOptions struct {
+	// MinLength is the fewest bytes an object or array must span, for
+	// ignoring short runs such as [1] in binary data
+	MinLength int
+	// AcceptUnparsed keeps text whose brackets balance even though it
+	// doesn't parse as JSON, see WithStrictJSON
+	AcceptUnparsed bool
+	// MaxDepth is the deepest nesting scanned, 10000 by default like
+	// encoding/json. Deeper text isn't detected.
+	MaxDepth int
+	// StartChars are the brackets objects may start with, "{[" by default.
+	// Set it to "{" to only detect objects and not arrays.
+	StartChars string
+}
+
+// WithDetectionOptions sets how JSON is detected in the buffer, see
+// DetectionOptions. Only the fields set in opts are changed, so that it
+// combines with WithStrictJSON in either order, which is also the way to
+// turn AcceptUnparsed back off. Objects in decoded data, such as of base64,
+// are always detected with the defaults.
+func WithDetectionOptions(opts DetectionOptions) Option {
+	return func(c *config) {
+		if opts.MinLength != 0 {
+			c.detection.MinLength = opts.MinLength
+		}
+		if opts.AcceptUnparsed {
+			c.detection.AcceptUnparsed = true
+		}
+		if opts.MaxDepth != 0 {
+			c.detection.MaxDepth = opts.MaxDepth
+		}
+		if opts.StartChars != "" {
+			c.detection.StartChars = opts.StartChars
+		}
+	}
+}
+
+// WithPayloadsOnly shows only the detected objects in the Smart View, each
+// run of bytes between them collapsed to a line telling how much was
+// skipped. The PayloadsOnly key toggles it.
+func WithPayloadsOnly(enabled bool) Option {
+	return func(c *config) {
+		c.payloads = enabled
+	}
+}
+
+// WithMaxBufferSize keeps at most size bytes of data streamed in, such as by
+// ShowReader, AppendBytes or AppendChunk, discarding the oldest bytes as new
+// ones arrive so that an endless stream doesn't exhaust memory. Offsets go on
+// counting from the first byte ever received, and the header tells how much
+// was discarded. Whole rows are discarded at a time, so the buffer may hold a
+// little less. A size of 0, the default, keeps everything.
+func WithMaxBufferSize(size int) Option {
+	return func(c *config) {
+		c.maxSize = size
+	}
+}
+
+// WithReadOnly disables editing, deleting and saving the buffer in the
+// viewer, so that files can be inspected without risk of changing them
+func WithReadOnly(readOnly bool) Option {
+	return func(c *config) {
+		c.readOnly = readOnly
+	}
+}
+
+// WithRemote tells the viewer that its user is on another machine, such as
+// in a session served by package sshserve. The files of this process are out
+// of their reach then: opening files and commands writing them are disabled.
+func WithRemote(remote bool) Option {
+	return func(c *config) {
+		c.remote = remote
+	}
+}
+
+// WithClipboard sends what is copied to w, as the OSC52 escape sequence
+// terminals set their clipboard from, instead of to os.Stderr. Sessions
+// served over SSH set the clipboard of their client this way.
+func WithClipboard(w io.Writer) Option {
+	return func(c *config) {
+		c.clipboard = w
+	}
+}
+
+// WithInput reads keys from r instead of stdin, such as the terminal of a
+// pty, so that several viewers can run at once on terminals of their own
+func WithInput(r io.Reader) Option {
+	return func(c *config) {
+		c.input = r
+	}
+}
+
+// WithOutput renders the viewer to w instead of stdout, see WithInput
+func WithOutput(w io.Writer) Option {
+	return func(c *config) {
+		c.output = w
+	}
+}
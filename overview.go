@@ -0,0 +1,193 @@
+package prettybuffers
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+const (
+	// entropyMinBlock is the smallest block the overview computes entropy for
+	entropyMinBlock = 256
+	// entropyMaxBlocks limits how many blocks the buffer is split into
+	entropyMaxBlocks = 4096
+	// entropySyncSize is the largest buffer whose overview is computed
+	// inside the event loop instead of in the background
+	entropySyncSize = 1 << 20
+	// entropyStripLines is the number of view lines taken by the overview
+	entropyStripLines = 2
+)
+
+// Entropy ratios separating low, medium and high entropy blocks
+const (
+	lowEntropy  = 0.3
+	highEntropy = 0.8
+)
+
+// entropyOverview holds the entropy of the whole buffer in fixed-size blocks
+type entropyOverview struct {
+	gen       int // data generation the blocks were computed for
+	blockSize int
+	blocks    []float64 // entropy ratio of each block, see entropyRatio
+}
+
+// entropyMsg delivers an overview computed in the background
+type entropyMsg entropyOverview
+
+// computeEntropy splits src into blocks and computes the entropy of each
+func computeEntropy(src DataSource, gen int) entropyOverview {
+	size := int(src.Len())
+	blockSize := max(entropyMinBlock, (size+entropyMaxBlocks-1)/entropyMaxBlocks)
+	o := entropyOverview{gen: gen, blockSize: blockSize}
+	buf := make([]byte, blockSize)
+	for off := 0; off < size; off += blockSize {
+		n, _ := src.ReadAt(buf[:min(blockSize, size-off)], int64(off))
+		o.blocks = append(o.blocks, entropyRatio(buf[:n]))
+	}
+	return o
+}
+
+// class returns -1, 0 or 1 for a block of low, medium or high entropy
+func (o *entropyOverview) class(block int) int {
+	switch r := o.blocks[block]; {
+	case r <= lowEntropy:
+		return -1
+	case r >= highEntropy:
+		return 1
+	}
+	return 0
+}
+
+// regionStart reports whether a low or high entropy region starts at block
+func (o *entropyOverview) regionStart(block int) bool {
+	c := o.class(block)
+	return c != 0 && (block == 0 || o.class(block-1) != c)
+}
+
+// toggleEntropy shows or hides the overview. Mouse reporting is only enabled
+// while it is shown, so that it doesn't get in the way of selecting text.
+func (m *model) toggleEntropy() tea.Cmd {
+	m.showEntropy = !m.showEntropy
+	if m.showEntropy {
+		return tea.EnableMouseCellMotion
+	}
+	return tea.DisableMouse
+}
+
+// entropyCmd brings the overview up to date with the data if it is shown.
+// Small buffers are handled right away, large ones in the background.
+func (m *model) entropyCmd() tea.Cmd {
+	if !m.showEntropy || m.entropyPending || m.size() == 0 ||
+		(m.entropy != nil && m.entropy.gen == m.entropyGen) {
+		return nil
+	}
+	var src DataSource
+	if m.lazy {
+		src = m.src
+	} else if len(m.data) <= entropySyncSize {
+		o := computeEntropy(bytesSource(m.data), m.entropyGen)
+		m.entropy = &o
+		return nil
+	} else {
+		// Edits change data in place, so work on a copy
+		src = bytesSource(append([]byte(nil), m.data...))
+	}
+
+	m.entropyPending = true
+	gen := m.entropyGen
+	return func() tea.Msg {
+		return entropyMsg(computeEntropy(src, gen))
+	}
+}
+
+// entropyCells returns the range of blocks shown by each cell of a strip at
+// most width cells wide
+func (m model) entropyCells(width int) [][2]int {
+	n := len(m.entropy.blocks)
+	count := min(width, n)
+	cells := make([][2]int, count)
+	for x := range cells {
+		cells[x] = [2]int{x * n / count, (x + 1) * n / count}
+	}
+	return cells
+}
+
+// entropyStrip renders the overview as a heatmap with a marker below the
+// cell holding the cursor
+func (m model) entropyStrip() string {
+	if m.entropy == nil {
+		return "Computing entropy...\n"
+	}
+	var strip, marker strings.Builder
+	for _, cell := range m.entropyCells(max(1, m.width-2)) {
+		sum := 0.0
+		for _, r := range m.entropy.blocks[cell[0]:cell[1]] {
+			sum += r
+		}
+		ratio := sum / float64(cell[1]-cell[0])
+		strip.WriteString(m.theme.entropyStyle(ratio).Render(entropyBar(ratio)))
+
+		cursorBlock := m.cursor / m.entropy.blockSize
+		if cursorBlock >= cell[0] && cursorBlock < cell[1] {
+			marker.WriteRune('^')
+		} else {
+			marker.WriteRune(' ')
+		}
+	}
+	return strip.String() + "\n" + strings.TrimRight(marker.String(), " ")
+}
+
+// withEntropyStrip inserts the overview between the data rows and the footer
+func (m model) withEntropyStrip(view string) string {
+	if !m.showEntropy {
+		return view
+	}
+	lines := strings.Split(view, "\n")
+	footer := max(0, len(lines)-2)
+	strip := strings.Split(m.entropyStrip(), "\n")
+	lines = append(lines[:footer], append(strip, lines[footer:]...)...)
+	return strings.Join(lines, "\n")
+}
+
+// clickEntropy moves the cursor to the block under a mouse click on the strip
+func (m *model) clickEntropy(msg tea.MouseMsg) {
+	// The strip sits above the blank line and the footer at the bottom
+	if m.entropy == nil || msg.Action != tea.MouseActionPress || msg.Button != tea.MouseButtonLeft ||
+		msg.Y != m.height-2-entropyStripLines {
+		return
+	}
+	cells := m.entropyCells(max(1, m.dataWidth()-2))
+	if msg.X >= len(cells) {
+		return
+	}
+	m.moveCursor(cells[msg.X][0]*m.entropy.blockSize - m.cursor)
+}
+
+// nextEntropyRegion moves the cursor to the start of the next (or previous)
+// region of low or high entropy
+func (m *model) nextEntropyRegion(backwards bool) {
+	if !m.showEntropy || m.entropy == nil {
+		m.status = fmt.Sprintf("Press '%s' to show the entropy overview first", m.keys.EntropyOverview.Help().Key)
+		return
+	}
+	o := m.entropy
+	step := 1
+	if backwards {
+		step = -1
+	}
+	for b := min(m.cursor/o.blockSize, len(o.blocks)) + step; b >= 0 && b < len(o.blocks); b += step {
+		if o.regionStart(b) {
+			m.moveCursor(b*o.blockSize - m.cursor)
+			kind := "Low"
+			if o.class(b) > 0 {
+				kind = "High"
+			}
+			m.status = fmt.Sprintf("%s entropy region at 0x%08X (%.2f bits/byte)", kind, b*o.blockSize,
+				o.blocks[b]*math.Log2(float64(min(o.blockSize, 256))))
+			return
+		}
+	}
+	m.status = "No more low or high entropy regions"
+}
@@ -0,0 +1,55 @@
+package prettybuffers
+
+import (
+	"fmt"
+	"strings"
+)
+
+// togglePayloadsOnly shows or hides the bytes between detected objects in
+// the Smart View, switching to it if another layout is shown
+func (m *model) togglePayloadsOnly() {
+	m.payloadsOnly = !m.payloadsOnly
+	if !m.payloadsOnly {
+		m.status = "Showing the bytes between objects"
+		m.moveCursor(0)
+		return
+	}
+	if !m.inSmartView() {
+		for i := 0; i < layoutCount(); i++ {
+			if layout, _ := layoutAt(i); len(layout.Renderers) == 0 && containsColumn(layout.Columns, ColumnJSON) {
+				m.setLayout(i, layout)
+				break
+			}
+		}
+	}
+	m.status = "Showing only detected objects, the bytes between them are skipped"
+	m.moveCursor(0)
+}
+
+// skippedLine renders the line standing in for the bytes from start to end,
+// exclusive, in the Smart View while payloadsOnly is set
+func (m model) skippedLine(start, end, hexWidth int) string {
+	style := m.theme.Footer
+	if m.cursor >= start && m.cursor < end {
+		style = m.theme.Cursor
+	}
+	return fmt.Sprintf("%s | %s | %s\n",
+		m.theme.Offset.Render(m.formatOffset(start)),
+		strings.Repeat(" ", hexWidth),
+		style.Render(fmt.Sprintf("… %s skipped …", formatSize(end-start))))
+}
+
+// formatSize formats a number of bytes for people, e.g. 1.2 KB
+func formatSize(n int) string {
+	if n < 1024 {
+		return fmt.Sprintf("%d %s", n, plural(n, "byte", "bytes"))
+	}
+	size := float64(n) / 1024
+	for _, unit := range []string{"KB", "MB", "GB"} {
+		if size < 1024 || unit == "GB" {
+			return fmt.Sprintf("%.1f %s", size, unit)
+		}
+		size /= 1024
+	}
+	return ""
+}
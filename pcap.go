@@ -0,0 +1,301 @@
+package prettybuffers
+
+import (
+	"encoding/binary"
+	"fmt"
+	"time"
+)
+
+const (
+	// pcapHeaderSize is the size of the global header of a pcap file
+	pcapHeaderSize = 24
+	// pcapRecordHeaderSize is the size of the header of each packet record
+	pcapRecordHeaderSize = 16
+	// maxCapturedPacket is the largest packet accepted, to stop at corrupt
+	// records instead of treating the rest of the file as one packet
+	maxCapturedPacket = 1 << 18
+	// pcapngBlockType is the type of the section header block starting a
+	// pcapng file, which reads the same in either byte order
+	pcapngBlockType = 0x0A0D0D0A
+)
+
+// linkTypes names common link-layer header types of captures
+var linkTypes = map[uint32]string{
+	0:   "BSD loopback",
+	1:   "Ethernet",
+	101: "raw IP",
+	105: "IEEE 802.11",
+	113: "Linux cooked",
+	127: "IEEE 802.11 radiotap",
+	228: "IPv4",
+	229: "IPv6",
+	276: "Linux cooked v2",
+}
+
+// linkTypeName names a link-layer header type
+func linkTypeName(t uint32) string {
+	if name, ok := linkTypes[t]; ok {
+		return name
+	}
+	return fmt.Sprintf("link type %d", t)
+}
+
+// pcapngBlockTypes names the pcapng blocks other than packets
+var pcapngBlockTypes = map[uint32]string{
+	pcapngBlockType: "Section header block",
+	1:               "Interface description block",
+	4:               "Name resolution block",
+	5:               "Interface statistics block",
+	10:              "Decryption secrets block",
+}
+
+// captureTimestamp formats a timestamp of sec seconds and frac units of a
+// second with the given number of digits, in UTC
+func captureTimestamp(sec int64, frac uint64, digits int) string {
+	scale := uint64(1)
+	for i := 0; i < 9-digits; i++ {
+		scale *= 10
+	}
+	t := time.Unix(sec, int64(frac*scale)).UTC()
+	if digits == 0 {
+		return t.Format("2006-01-02 15:04:05")
+	}
+	return t.Format("2006-01-02 15:04:05") + fmt.Sprintf(".%0*d", digits, frac)
+}
+
+// scanCaptureObjects parses a pcap or pcapng file at the start of data into
+// objects for its headers and packet records, running detection on each
+// packet. Captures are only recognized at the start of data, so the objects
+// of other scanners need not be skipped. Like scanJSONObjects it returns the
+// offset of a record cut off by the end of data.
+func scanCaptureObjects(data []byte, from int, _ []jsonObject, b *decodeBudget) ([]jsonObject, int) {
+	if len(data) < 4 {
+		// Too short to tell yet
+		return nil, 0
+	}
+	switch binary.LittleEndian.Uint32(data) {
+	case 0xa1b2c3d4, 0xa1b23c4d:
+		return scanPcap(data, from, binary.LittleEndian, b)
+	case 0xd4c3b2a1, 0x4d3cb2a1:
+		return scanPcap(data, from, binary.BigEndian, b)
+	case pcapngBlockType:
+		return scanPcapng(data, from, b)
+	}
+	return nil, len(data)
+}
+
+// newPacketObject describes packet n of a capture, whose record spans start
+// up to end with a header of headerSize bytes followed by caplen bytes of the
+// packet, detecting objects in it within b
+func newPacketObject(data []byte, start, end, headerSize, caplen, origLen, n int, timestamp, link string, b *decodeBudget) jsonObject {
+	packet := data[start+headerSize : start+headerSize+caplen]
+	nested := b.scan(packet)
+	line := fmt.Sprintf("Packet %d, %s, %d bytes", n, timestamp, caplen)
+	if origLen > caplen {
+		line += fmt.Sprintf(" of %d", origLen)
+	}
+	return jsonObject{
+		startOffset: start,
+		endOffset:   end - 1,
+		data:        data[start:end],
+		decoded:     packet,
+		kind:        objectCapture,
+		encoding:    "packet",
+		nested:      nested,
+		summary:     []string{line},
+		regions: []region{
+			{start: start, end: start + headerSize, label: fmt.Sprintf("Packet %d record header", n)},
+			{start: start + headerSize, end: start + headerSize + caplen, label: fmt.Sprintf("Packet %d, %s", n, link)},
+		},
+	}
+}
+
+// scanPcap parses a pcap file in the given byte order
+func scanPcap(data []byte, from int, order binary.ByteOrder, b *decodeBudget) ([]jsonObject, int) {
+	if len(data) < pcapHeaderSize {
+		return nil, 0
+	}
+	digits, unit := 6, "microsecond"
+	if order.Uint32(data) == 0xa1b23c4d {
+		digits, unit = 9, "nanosecond"
+	}
+	link := linkTypeName(order.Uint32(data[20:]) & 0xffff)
+
+	var objects []jsonObject
+	if from == 0 {
+		objects = append(objects, jsonObject{
+			startOffset: 0,
+			endOffset:   pcapHeaderSize - 1,
+			data:        data[:pcapHeaderSize],
+			kind:        objectCapture,
+			summary: []string{fmt.Sprintf("pcap capture, version %d.%d, %s, snaplen %d, %s timestamps",
+				order.Uint16(data[4:]), order.Uint16(data[6:]), link, order.Uint32(data[16:]), unit)},
+			regions: []region{
+				{start: 0, end: 4, label: "pcap magic number"},
+				{start: 4, end: 8, label: "pcap version"},
+				{start: 8, end: 16, label: "pcap reserved"},
+				{start: 16, end: 20, label: "pcap snapshot length"},
+				{start: 20, end: 24, label: "pcap link type: " + link},
+			},
+		})
+	}
+
+	pos := pcapHeaderSize
+	for n := 1; pos+pcapRecordHeaderSize <= len(data); n++ {
+		record := data[pos:]
+		caplen := int(order.Uint32(record[8:]))
+		if caplen > maxCapturedPacket {
+			// Corrupt from here on
+			return objects, len(data)
+		}
+		end := pos + pcapRecordHeaderSize + caplen
+		if end > len(data) {
+			return objects, pos
+		}
+		if pos >= from {
+			timestamp := captureTimestamp(int64(order.Uint32(record)), uint64(order.Uint32(record[4:])), digits)
+			objects = append(objects, newPacketObject(data, pos, end, pcapRecordHeaderSize, caplen,
+				int(order.Uint32(record[12:])), n, timestamp, link, b))
+		}
+		pos = end
+	}
+	return objects, pos
+}
+
+// pcapngInterface is an interface described in a pcapng section
+type pcapngInterface struct {
+	link      string
+	unitsPerS uint64 // timestamp resolution
+	digits    int    // of fractions of a second to show
+}
+
+// readPcapngInterface parses the body of an interface description block
+func readPcapngInterface(body []byte, order binary.ByteOrder) pcapngInterface {
+	iface := pcapngInterface{link: linkTypeName(uint32(order.Uint16(body))), unitsPerS: 1e6, digits: 6}
+	// Options follow the link type, reserved bytes and snapshot length
+	for pos := 8; pos+4 <= len(body); {
+		code, n := order.Uint16(body[pos:]), int(order.Uint16(body[pos+2:]))
+		if code == 0 || pos+4+n > len(body) {
+			break
+		}
+		if code == 9 && n == 1 {
+			// if_tsresol: a power of ten, or of two with the high bit set
+			res := body[pos+4]
+			iface.unitsPerS, iface.digits = 1, 0
+			for i := 0; i < int(res&0x7f) && iface.unitsPerS < 1<<62; i++ {
+				if res&0x80 != 0 {
+					iface.unitsPerS *= 2
+				} else {
+					iface.unitsPerS *= 10
+					iface.digits++
+				}
+			}
+			if res&0x80 != 0 {
+				iface.digits = 9
+			}
+			iface.digits = min(iface.digits, 9)
+		}
+		pos += 4 + (n+3)&^3
+	}
+	return iface
+}
+
+// timestamp formats a timestamp in units of the interface's resolution
+func (iface pcapngInterface) timestamp(units uint64) string {
+	frac := units % iface.unitsPerS
+	// Scale the fraction to the digits shown
+	scaled := uint64(0)
+	if iface.digits > 0 {
+		div := uint64(1)
+		for i := 0; i < iface.digits; i++ {
+			div *= 10
+		}
+		if iface.unitsPerS <= 1e9 {
+			scaled = frac * div / iface.unitsPerS
+		} else {
+			scaled = frac / (iface.unitsPerS / div)
+		}
+	}
+	return captureTimestamp(int64(units/iface.unitsPerS), scaled, iface.digits)
+}
+
+// scanPcapng parses the blocks of a pcapng file
+func scanPcapng(data []byte, from int, b *decodeBudget) ([]jsonObject, int) {
+	var objects []jsonObject
+	var order binary.ByteOrder
+	var ifaces []pcapngInterface
+	pos, n := 0, 0
+	for pos+12 <= len(data) {
+		if binary.LittleEndian.Uint32(data[pos:]) == pcapngBlockType {
+			// A new section with its own byte order and interfaces
+			switch binary.LittleEndian.Uint32(data[pos+8:]) {
+			case 0x1A2B3C4D:
+				order = binary.LittleEndian
+			case 0x4D3C2B1A:
+				order = binary.BigEndian
+			default:
+				return objects, len(data)
+			}
+			ifaces = nil
+		}
+		if order == nil {
+			return objects, len(data)
+		}
+		typ, length := order.Uint32(data[pos:]), int(order.Uint32(data[pos+4:]))
+		if length < 12 || length%4 != 0 || length > maxCapturedPacket+64 {
+			return objects, len(data)
+		}
+		if pos+length > len(data) {
+			return objects, pos
+		}
+		body := data[pos+8 : pos+length-4]
+
+		obj := jsonObject{startOffset: pos, endOffset: pos + length - 1, data: data[pos : pos+length], kind: objectCapture}
+		switch {
+		case typ == 6 && len(body) >= 20:
+			// Enhanced packet block
+			caplen := int(order.Uint32(body[12:]))
+			if caplen > len(body)-20 {
+				return objects, len(data)
+			}
+			iface := pcapngInterface{link: "unknown interface", unitsPerS: 1e6, digits: 6}
+			if id := order.Uint32(body); int(id) < len(ifaces) {
+				iface = ifaces[id]
+			}
+			n++
+			timestamp := iface.timestamp(uint64(order.Uint32(body[4:]))<<32 | uint64(order.Uint32(body[8:])))
+			obj = newPacketObject(data, pos, pos+length, 28, caplen, int(order.Uint32(body[16:])), n, timestamp, iface.link, b)
+		case typ == 3 && len(body) >= 4:
+			// Simple packet block, captured up to the snapshot length
+			origLen := int(order.Uint32(body))
+			caplen := min(origLen, len(body)-4)
+			link := "unknown interface"
+			if len(ifaces) > 0 {
+				link = ifaces[0].link
+			}
+			n++
+			obj = newPacketObject(data, pos, pos+length, 12, caplen, origLen, n, "no timestamp", link, b)
+		default:
+			name, ok := pcapngBlockTypes[typ]
+			if !ok {
+				name = fmt.Sprintf("Block type 0x%X", typ)
+			}
+			line := fmt.Sprintf("pcapng %s, %d bytes", name, length)
+			switch {
+			case typ == pcapngBlockType && len(body) >= 8:
+				line = fmt.Sprintf("pcapng section, version %d.%d", order.Uint16(body[4:]), order.Uint16(body[6:]))
+			case typ == 1 && len(body) >= 8:
+				iface := readPcapngInterface(body, order)
+				ifaces = append(ifaces, iface)
+				line = fmt.Sprintf("pcapng interface %d, %s, snaplen %d", len(ifaces)-1, iface.link, order.Uint32(body[4:]))
+			}
+			obj.summary = []string{line}
+			obj.regions = []region{{start: pos, end: pos + length, label: "pcapng " + name}}
+		}
+		if pos >= from {
+			objects = append(objects, obj)
+		}
+		pos += length
+	}
+	return objects, pos
+}
@@ -0,0 +1,208 @@
+package prettybuffers
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"time"
+)
+
+const (
+	// maxPESections limits how many section headers are parsed. The format
+	// itself allows at most 96.
+	maxPESections = 96
+	// peDirectories is the number of data directories the format defines
+	peDirectories = 16
+)
+
+var (
+	peMachines = map[uint64]string{
+		0x14c: "x86", 0x166: "MIPS", 0x1c0: "ARM", 0x1c4: "ARM Thumb-2", 0x200: "IA-64",
+		0x5064: "RISC-V 64", 0x8664: "x86-64", 0xaa64: "AArch64",
+	}
+
+	peMagics = map[uint64]string{0x10b: "PE32", 0x20b: "PE32+", 0x107: "ROM"}
+
+	peSubsystems = map[uint64]string{
+		1: "native", 2: "Windows GUI", 3: "Windows console", 7: "POSIX console", 9: "Windows CE GUI",
+		10: "EFI application", 11: "EFI boot service driver", 12: "EFI runtime driver", 13: "EFI ROM",
+		14: "Xbox", 16: "Windows boot application",
+	}
+
+	peDirectoryNames = [peDirectories]string{
+		"Export table", "Import table", "Resource table", "Exception table", "Certificate table",
+		"Base relocation table", "Debug", "Architecture", "Global pointer", "TLS table",
+		"Load config table", "Bound import", "Import address table", "Delay import descriptor",
+		"CLR runtime header", "Reserved",
+	}
+)
+
+var (
+	peCharacteristics = []flagName{
+		{0x0001, "relocs stripped"}, {0x0002, "executable"}, {0x0020, "large address aware"},
+		{0x0100, "32-bit"}, {0x0200, "debug stripped"}, {0x1000, "system"}, {0x2000, "DLL"},
+	}
+	peDLLCharacteristics = []flagName{
+		{0x0020, "high entropy VA"}, {0x0040, "dynamic base"}, {0x0080, "force integrity"},
+		{0x0100, "NX compatible"}, {0x0200, "no isolation"}, {0x0400, "no SEH"},
+		{0x1000, "app container"}, {0x4000, "guard CF"}, {0x8000, "terminal server aware"},
+	}
+	peSectionContents = []flagName{{0x20, "code"}, {0x40, "initialized data"}, {0x80, "uninitialized data"}}
+)
+
+// peSectionPerms formats the memory permissions of a section, e.g. "R-X"
+func peSectionPerms(flags uint64) string {
+	perms := []byte("---")
+	for i, bit := range []uint64{0x40000000, 0x80000000, 0x20000000} {
+		if flags&bit != 0 {
+			perms[i] = "RWX"[i]
+		}
+	}
+	return string(perms)
+}
+
+// parsePE parses the DOS header and, when it points to one, the PE header,
+// the optional header and the section table, along with the contents of the
+// sections
+func parsePE(read func(off, n int) []byte, size int) []structure {
+	order := binary.LittleEndian
+	b, ok := newStructBuilder(read, 0, 64, order, "DOS header")
+	if !ok {
+		return nil
+	}
+	b.raw("e_magic", 2)
+	for _, name := range []string{"e_cblp", "e_cp", "e_crlc", "e_cparhdr", "e_minalloc", "e_maxalloc"} {
+		b.dec(name, 2)
+	}
+	for _, name := range []string{"e_ss", "e_sp", "e_csum", "e_ip", "e_cs", "e_lfarlc"} {
+		b.hex(name, 2)
+	}
+	b.dec("e_ovno", 2)
+	b.raw("e_res", 8)
+	b.hex("e_oemid", 2)
+	b.hex("e_oeminfo", 2)
+	b.raw("e_res2", 20)
+	lfanew := int(b.hex("e_lfanew", 4))
+	structures := []structure{b.done()}
+
+	if lfanew < 64 || lfanew > size-24 || !bytes.Equal(read(lfanew, 4), []byte("PE\x00\x00")) {
+		// A plain DOS executable
+		return structures
+	}
+	if lfanew > 64 {
+		structures = append(structures, structure{start: 64, end: lfanew, name: "DOS stub"})
+	}
+
+	b, ok = newStructBuilder(read, lfanew, 24, order, "PE header")
+	if !ok {
+		return structures
+	}
+	b.raw("Signature", 4)
+	b.enum("Machine", 2, peMachines)
+	sections := b.dec("NumberOfSections", 2)
+	stamp := b.uint(4)
+	b.add("TimeDateStamp", 4, fmt.Sprintf("%s (0x%X)", time.Unix(int64(stamp), 0).UTC().Format("2006-01-02 15:04:05"), stamp))
+	b.hex("PointerToSymbolTable", 4)
+	b.dec("NumberOfSymbols", 4)
+	optSize := int(b.dec("SizeOfOptionalHeader", 2))
+	b.flags("Characteristics", 2, peCharacteristics)
+	structures = append(structures, b.done())
+
+	optStart := lfanew + 24
+	if s, ok := parsePEOptionalHeader(read, optStart, optSize); ok {
+		structures = append(structures, s)
+	}
+
+	var contents []structure
+	for i := 0; i < min(int(sections), maxPESections); i++ {
+		off := optStart + optSize + i*40
+		raw := read(off, 40)
+		if len(raw) < 40 {
+			break
+		}
+		name := sanitizeString(string(bytes.TrimRight(raw[:8], "\x00")))
+		b, _ := newStructBuilder(read, off, 40, order, fmt.Sprintf("Section header %d (%s)", i+1, name))
+		b.add("Name", 8, name)
+		b.hex("VirtualSize", 4)
+		b.hex("VirtualAddress", 4)
+		length := b.hex("SizeOfRawData", 4)
+		offset := b.hex("PointerToRawData", 4)
+		b.hex("PointerToRelocations", 4)
+		b.hex("PointerToLinenumbers", 4)
+		b.dec("NumberOfRelocations", 2)
+		b.dec("NumberOfLinenumbers", 2)
+		flags := b.uint(4)
+		b.add("Characteristics", 4, formatFlags(flags, peSectionContents)+" "+peSectionPerms(flags))
+		structures = append(structures, b.done())
+
+		if length > 0 && offset < uint64(size) {
+			label := "Section " + name + ","
+			if kinds := flagNames(flags, peSectionContents); kinds != "" {
+				label += " " + kinds
+			}
+			contents = append(contents, structure{
+				start: int(offset),
+				end:   int(offset) + min(int(length), size-int(offset)),
+				name:  label + " " + peSectionPerms(flags),
+			})
+		}
+	}
+	// Headers take precedence over section contents claiming to overlap them
+	return append(structures, contents...)
+}
+
+// parsePEOptionalHeader parses the optional header of size bytes at off,
+// which despite its name every image has
+func parsePEOptionalHeader(read func(off, n int) []byte, off, size int) (structure, bool) {
+	magic := read(off, 2)
+	if len(magic) < 2 {
+		return structure{}, false
+	}
+	is64 := binary.LittleEndian.Uint16(magic) == 0x20b
+	word, fixed := 4, 96
+	if is64 {
+		word, fixed = 8, 112
+	}
+	if size < fixed {
+		return structure{}, false
+	}
+	b, ok := newStructBuilder(read, off, size, binary.LittleEndian, "Optional header")
+	if !ok {
+		return structure{}, false
+	}
+	b.enum("Magic", 2, peMagics)
+	b.dec("MajorLinkerVersion", 1)
+	b.dec("MinorLinkerVersion", 1)
+	b.hex("SizeOfCode", 4)
+	b.hex("SizeOfInitializedData", 4)
+	b.hex("SizeOfUninitializedData", 4)
+	b.hex("AddressOfEntryPoint", 4)
+	b.hex("BaseOfCode", 4)
+	if !is64 {
+		b.hex("BaseOfData", 4)
+	}
+	b.hex("ImageBase", word)
+	b.hex("SectionAlignment", 4)
+	b.hex("FileAlignment", 4)
+	for _, name := range []string{"OperatingSystemVersion", "ImageVersion", "SubsystemVersion"} {
+		b.dec("Major"+name, 2)
+		b.dec("Minor"+name, 2)
+	}
+	b.hex("Win32VersionValue", 4)
+	b.hex("SizeOfImage", 4)
+	b.hex("SizeOfHeaders", 4)
+	b.hex("CheckSum", 4)
+	b.enum("Subsystem", 2, peSubsystems)
+	b.flags("DllCharacteristics", 2, peDLLCharacteristics)
+	b.hex("SizeOfStackReserve", word)
+	b.hex("SizeOfStackCommit", word)
+	b.hex("SizeOfHeapReserve", word)
+	b.hex("SizeOfHeapCommit", word)
+	b.hex("LoaderFlags", 4)
+	n := b.dec("NumberOfRvaAndSizes", 4)
+	for i := 0; i < min(min(int(n), peDirectories), (size-fixed)/8); i++ {
+		b.hex(peDirectoryNames[i]+" RVA", 4)
+		b.hex(peDirectoryNames[i]+" size", 4)
+	}
+	return b.done(), true
+}
@@ -2,11 +2,17 @@ package prettybuffers
 
 import (
 	"bytes"
+	"encoding/binary"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"os"
+	"io"
 	"strings"
+	"sync"
+	"time"
 
+	"github.com/charmbracelet/bubbles/filepicker"
+	"github.com/charmbracelet/bubbles/key"
 	tea "github.com/charmbracelet/bubbletea"
 )
 
@@ -22,6 +28,20 @@ const (
 	ColumnASCII
 	// ColumnJSON displays JSON representation if possible
 	ColumnJSON
+	// ColumnEntropy displays the Shannon entropy of each row
+	ColumnEntropy
+	// ColumnText displays the bytes decoded as UTF-8 text
+	ColumnText
+	// ColumnVarint displays the LEB128 varints starting in each row
+	ColumnVarint
+	// ColumnBinary displays each byte as eight binary digits
+	ColumnBinary
+	// ColumnOctal displays each byte as three octal digits
+	ColumnOctal
+	// ColumnDecimal displays each byte as a decimal number
+	ColumnDecimal
+	// ColumnTime displays when the streamed chunks starting in each row arrived
+	ColumnTime
 )
 
 // jsonObject represents a detected JSON object in the byte stream
@@ -30,255 +50,695 @@ type jsonObject struct {
 	endOffset   int
 	data        []byte
 	parsed      interface{}
+	decoded     []byte // JSON text of a MessagePack value, nil for JSON
+	kind        objectKind
+	encoding    string       // of a text run, e.g. "UTF-16LE"
+	nested      []jsonObject // detected in decoded, for encodings like base64
+	summary     []string     // content lines of protocol messages such as TLS
+	regions     []region     // named parts, sorted by start offset
+	pretty      []string     // JSON text indented once detected, see prettify
+	prettyWidth int          // of the longest line of pretty, without its indentation
+	tree        *jsonNode    // of JSON objects, shown with collapsible containers
+}
+
+// objectKind tells how a detected object was encoded
+type objectKind int
+
+const (
+	objectJSON objectKind = iota
+	objectMsgpack
+	objectUTF16
+	objectBase64
+	objectCompressed
+	objectTLS
+	objectHTTP
+	objectCapture
+	objectImage
+	objectXML
+	objectYAML
+	objectForm
+	objectMultipart
+)
+
+// text returns the object as JSON text
+func (o jsonObject) text() []byte {
+	if o.decoded != nil {
+		return o.decoded
+	}
+	return o.data
+}
+
+// lines returns the object prettified for the content column. Text runs are
+// split so that each line holds the characters of bytesPerLine bytes.
+func (o jsonObject) lines(bytesPerLine int) ([]string, error) {
+	switch o.kind {
+	case objectUTF16:
+		return o.utf16Lines(bytesPerLine), nil
+	case objectBase64:
+		return o.base64Lines(bytesPerLine), nil
+	case objectCompressed:
+		return o.decodedLines(o.encoding, bytesPerLine), nil
+	case objectTLS, objectImage, objectXML, objectYAML, objectForm:
+		return o.summary, nil
+	case objectHTTP, objectMultipart:
+		return o.httpLines(bytesPerLine), nil
+	case objectCapture:
+		return append(o.summary[:len(o.summary):len(o.summary)], o.nestedLines(bytesPerLine)...), nil
+	}
+	if o.pretty != nil {
+		return o.pretty, nil
+	}
+	var pretty bytes.Buffer
+	if err := json.Indent(&pretty, o.text(), "", "  "); err != nil {
+		return nil, err
+	}
+	return strings.Split(pretty.String(), "\n"), nil
+}
+
+// prettify indents the text of a JSON or MessagePack object once, so that
+// rendering doesn't have to on every frame
+func (o *jsonObject) prettify() {
+	if o.kind != objectJSON && o.kind != objectMsgpack {
+		return
+	}
+	lines, err := o.lines(0)
+	if err != nil {
+		return
+	}
+	o.pretty, o.prettyWidth = lines, 0
+	for _, line := range lines {
+		o.prettyWidth = max(o.prettyWidth, len(strings.TrimSpace(line)))
+	}
+	if o.kind == objectJSON {
+		o.tree, _ = parseJSONTree(o.data)
+	}
 }
 
 // Layout represents a specific arrangement of columns
 type Layout struct {
 	Name    string
 	Columns []ColumnType
+	// Renderers replaces Columns when set, allowing custom columns
+	Renderers []ColumnRenderer
 }
 
-// PredefinedLayouts contains the available layouts
+// PredefinedLayouts contains the available layouts. Use RegisterLayout to add
+// layouts, as it may be read concurrently by a running viewer.
 var PredefinedLayouts = []Layout{
 	{Name: "Hex View", Columns: []ColumnType{ColumnOffset, ColumnHex, ColumnASCII}},
 	{Name: "Smart View", Columns: []ColumnType{ColumnOffset, ColumnHex, ColumnJSON, ColumnASCII}},
+	{Name: "Text View", Columns: []ColumnType{ColumnOffset, ColumnHex, ColumnText}},
 }
 
 // model represents the application state
 type model struct {
-	data        []byte
-	offset      int
-	bytesPerRow int
-	width       int
-	height      int
-	layout      Layout
-	layoutIndex int
-	jsonObjects []jsonObject
+	data             []byte
+	offset           int
+	bytesPerRow      int
+	fixedBytesPerRow bool
+	groupSize        int              // bytes shown together as a word in the hex column, see WithByteGrouping
+	byteOrder        binary.ByteOrder // of grouped words and of overlaid fields without one of their own
+	bits             bitView
+	objectList       objectList
+	decimalOffsets   bool   // see WithDecimalOffsets
+	payloadsOnly     bool   // the Smart View skips the bytes between objects, see WithPayloadsOnly
+	compactOffsets   bool   // see WithCompactOffsets
+	baseAddress      uint64 // added to offsets shown, see WithBaseAddress
+	maxSize          int    // of the buffer streamed data is appended to, 0 for no limit
+	discarded        int    // bytes dropped from the start to stay within maxSize
+	width            int
+	height           int
+	layout           Layout
+	layoutIndex      int
+	collapsed        map[int]bool // JSON containers folded in the Smart View, by offset
+	jsonObjects      []jsonObject
+	scanResume       int  // offset from which appended data must be rescanned
+	ownsData         bool // whether data may be appended to in place
+	title            string
+	prompt           prompt
+	search           searchState
+	status           string // one-off message shown in place of the footer
+	cursor           int
+	selection        selection
+	pendingKey       string // first key of a two-key command, e.g. "y" before a copy format
+	count            int    // count typed before a motion, e.g. the 10 in "10j"
+	edit             editState
+	readOnly         bool       // editing and saving are disabled, see WithReadOnly
+	remote           bool       // used from another machine, which keeps the files of this process out of reach
+	clipboard        io.Writer  // where copies are sent as escape sequences, os.Stderr if nil
+	component        bool       // embedded in another application, which decides when to quit
+	events           events     // callbacks of the host application, see OnCursorMove
+	path             string     // file the buffer was loaded from or last saved to
+	src              DataSource // where the buffer was loaded from
+	lazy             bool       // src is read on demand through cache instead of held in data
+	cache            *windowCache
+	unmap            func() error // releases data when it is a memory-mapped file
+	picking          bool         // the file picker is shown instead of the data
+	picker           filepicker.Model
+	diff             *diffState  // buffers being compared, nil outside diff mode
+	diffMark         *jsonObject // object marked to be compared by DiffObjects
+	annotations      []annotation
+	highlights       []highlightGroup
+	theme            Theme
+	themeIndex       int // index into PredefinedThemes, -1 for a custom theme
+	keys             KeyMap
+	showHelp         bool // the help overlay is shown instead of the data
+	showEntropy      bool // the entropy overview is shown above the footer
+	entropy          *entropyOverview
+	entropyGen       int  // bumped whenever the data changes, to tell when entropy is stale
+	entropyPending   bool // entropy is being computed in the background
+	histogram        *histogram // byte counts shown instead of the data, nil when hidden
+	hashes           *hashPopup // hashes of the selection, nil when hidden
+	fileType         FileType   // format detected from the magic number, if any
+	embedded         []embeddedFile
+	parents          []nestedParent    // buffers the current one was opened from, innermost last
+	framing          *framing          // splits the buffer into length-prefixed frames, nil for none
+	frames           []frame           // from framing, or the chunks appended or packets of a capture
+	chunks           []frame           // appended as labeled chunks, such as by AppendChunk
+	streams          []chunkStream    // the chunks of each stream, after all of them; nil until a stream is mirrored
+	stream           int              // index into streams of the one shown, 0 for all of them
+	arrivals         []arrival         // of the chunks streamed in, by ShowReader, AppendBytes or AppendChunk
+	times            timeMode          // how the arrival of chunks is shown
+	framesEnd        int               // end of the last complete frame
+	structures       []structure       // of the detected file format, sorted by start
+	overlays         []overlayParser   // applied by the user, such as templates
+	interpretations  *interpretations  // of the object last reinterpreted, nil after a rescan
+	detectGen        int               // bumped whenever the buffer is rescanned, to tell when a detection is stale
+	detection        *detection        // running in the background, nil when done
+	editRescan       editedRegion     // edited since the last rescan
+	detectOpts       DetectionOptions  // how JSON is detected, see WithDetectionOptions
 }
 
-func initialModel() model {
-	return model{
+func initialModel(cfg config) model {
+	m := model{
 		data:        []byte{},
 		offset:      0,
 		bytesPerRow: 16, // Default value, will be adjusted based on terminal width
 		width:       80,
 		height:      24,
-		layout:      PredefinedLayouts[0], // Default to first layout (Hex View)
-		layoutIndex: 0,
+		layoutIndex: cfg.layoutIndex,
 		jsonObjects: []jsonObject{},
+		title:       cfg.title,
+	}
+	m.layout, _ = layoutAt(cfg.layoutIndex)
+	if cfg.bytesPerRow > 0 {
+		m.bytesPerRow = cfg.bytesPerRow
+		m.fixedBytesPerRow = true
 	}
+	m.setTheme(cfg.theme)
+	m.keys = cfg.keys
+	m.framing = cfg.framing
+	m.readOnly = cfg.readOnly
+	m.detectOpts = cfg.detection
+	m.events = cfg.events
+	m.groupSize, m.byteOrder = cfg.groupSize, cfg.byteOrder
+	m.decimalOffsets, m.compactOffsets = cfg.decimal, cfg.compact
+	m.baseAddress = cfg.base
+	m.payloadsOnly = cfg.payloads
+	m.maxSize = cfg.maxSize
+	m.remote, m.clipboard = cfg.remote, cfg.clipboard
+	return m
 }
 
 func (m model) Init() tea.Cmd {
+	if m.title != "" {
+		return tea.SetWindowTitle(m.title)
+	}
 	return nil
 }
 
+// headerLine returns the first line of the view, naming the current layout
+func (m model) headerLine() string {
+	header := "Layout: " + m.layout.Name
+	if m.title != "" {
+		header = fmt.Sprintf("%s - %s", m.title, header)
+	}
+	header += m.nestedInfo() + m.streamInfo()
+	if info := m.fileTypeInfo(); info != "" {
+		header += " - " + info
+	}
+	if info := m.discardedInfo(); info != "" {
+		header += " - " + info
+	}
+	return m.theme.Header.Render(header) + "\n\n"
+}
+
 func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	next, cmd := m.update(msg)
+	updated := next.(model)
+	updated.notify(m)
+	// Keep the entropy overview and detection in step with whatever the
+	// message changed
+	cmd = tea.Batch(cmd, updated.entropyCmd(), updated.detectCmd(), updated.editRescanCmd())
+	return updated, cmd
+}
+
+func (m model) update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	if m.picking {
+		cmd, handled := m.updatePicker(msg)
+		if handled {
+			return m, cmd
+		}
+	}
+
 	switch msg := msg.(type) {
 
 	case tea.KeyMsg:
-		switch msg.String() {
-		case "q", "ctrl+c":
-			return m, tea.Quit
-		case "up", "k":
-			if m.offset >= m.bytesPerRow {
-				m.offset -= m.bytesPerRow
-			}
-		case "down", "j":
-			if m.offset+m.bytesPerRow < len(m.data) {
-				m.offset += m.bytesPerRow
-			}
-		case "page_up":
-			rowsPerPage := m.height - 2
-			if m.offset >= m.bytesPerRow*rowsPerPage {
-				m.offset -= m.bytesPerRow * rowsPerPage
-			} else {
-				m.offset = 0
-			}
-		case "page_down":
-			rowsPerPage := m.height - 2
-			if m.offset+m.bytesPerRow*rowsPerPage < len(m.data) {
-				m.offset += m.bytesPerRow * rowsPerPage
+		if m.prompt.kind != promptNone {
+			return m, m.updatePrompt(msg)
+		}
+		m.status = ""
+		if m.pendingKey != "" {
+			return m, m.handlePendingKey(msg)
+		}
+		if m.showHelp {
+			return m, m.updateHelp(msg)
+		}
+		if m.histogram != nil {
+			return m, m.updateHistogram(msg)
+		}
+		if m.hashes != nil {
+			return m, m.updateHashes(msg)
+		}
+		if m.objectList.shown {
+			return m, m.updateObjectList(msg)
+		}
+		if m.edit.active {
+			return m, m.updateEdit(msg)
+		}
+		if m.diff != nil {
+			return m, m.updateDiff(msg)
+		}
+		if m.bits.active && m.updateBits(msg) {
+			return m, nil
+		}
+		if m.countPrefix(msg) || m.motion(msg) {
+			return m, nil
+		}
+		m.count = 0
+
+		if m.selection.active {
+			switch {
+			case key.Matches(msg, m.keys.DeleteSelection):
+				m.deleteSelection()
+				return m, nil
+			case key.Matches(msg, m.keys.Copy):
+				m.pendingKey = "y"
+				m.status = copyFormatHelp()
+				return m, nil
+			case key.Matches(msg, m.keys.Hash):
+				if err := m.hashSelection(); err != nil {
+					m.status = err.Error()
+				}
+				return m, nil
+			case key.Matches(msg, m.keys.Cancel), key.Matches(msg, m.keys.Select):
+				m.selection = selection{}
+				return m, nil
 			}
-		case "l":
+		}
+
+		switch {
+		case key.Matches(msg, m.keys.Quit):
+			return m, m.quit()
+		case key.Matches(msg, m.keys.Help):
+			m.showHelp = true
+		case key.Matches(msg, m.keys.Select):
+			m.startSelection()
+		case key.Matches(msg, m.keys.Edit):
+			m.startEdit()
+		case key.Matches(msg, m.keys.Command):
+			m.openPrompt(promptCommand, ":")
+		case key.Matches(msg, m.keys.Save):
+			m.saveCurrent()
+		case key.Matches(msg, m.keys.Open):
+			return m, m.startPicker()
+		case key.Matches(msg, m.keys.SearchHex):
+			m.openPrompt(promptSearchHex, "Search hex: ")
+		case key.Matches(msg, m.keys.SearchText):
+			m.openPrompt(promptSearchText, textSearchLabel(false))
+		case key.Matches(msg, m.keys.SearchRegex):
+			m.openPrompt(promptSearchRegex, "Search regex: ")
+		case key.Matches(msg, m.keys.QueryJSON):
+			m.openPrompt(promptQuery, "JSONPath, e.g. $.items[0].id: ")
+		case key.Matches(msg, m.keys.NextMatch):
+			m.nextMatch(false)
+		case key.Matches(msg, m.keys.PrevMatch):
+			m.nextMatch(true)
+		case key.Matches(msg, m.keys.Cancel):
+			m.clearSearch()
+		case key.Matches(msg, m.keys.NextLayout):
 			// Switch to next layout
-			m.layoutIndex = (m.layoutIndex + 1) % len(PredefinedLayouts)
-			m.layout = PredefinedLayouts[m.layoutIndex]
+			next := (m.layoutIndex + 1) % layoutCount()
+			layout, _ := layoutAt(next)
+			m.setLayout(next, layout)
+		case key.Matches(msg, m.keys.NextTheme):
+			m.nextTheme()
+		case key.Matches(msg, m.keys.GroupBytes):
+			m.cycleGrouping()
+		case key.Matches(msg, m.keys.ToggleEndian):
+			m.toggleByteOrder()
+		case key.Matches(msg, m.keys.BitView):
+			m.toggleBitView()
+		case key.Matches(msg, m.keys.DecimalOffsets):
+			m.toggleDecimalOffsets()
+		case key.Matches(msg, m.keys.Histogram):
+			return m, m.openHistogram()
+		case key.Matches(msg, m.keys.ObjectList):
+			m.toggleObjectList()
+		case key.Matches(msg, m.keys.LineBytes):
+			m.showLineBytes()
+		case key.Matches(msg, m.keys.DiffObjects):
+			m.diffObjects()
+		case key.Matches(msg, m.keys.PayloadsOnly):
+			m.togglePayloadsOnly()
+		case key.Matches(msg, m.keys.ChunkTimes):
+			m.cycleTimes()
+		case key.Matches(msg, m.keys.Varint):
+			if err := m.decodeVarintAtCursor(); err != nil {
+				m.status = err.Error()
+			}
+		case key.Matches(msg, m.keys.ToggleFold) && m.toggleFold():
+		case key.Matches(msg, m.keys.EnterNested):
+			m.enterNested()
+		case key.Matches(msg, m.keys.Reinterpret):
+			m.reinterpret()
+		case key.Matches(msg, m.keys.LeaveNested):
+			m.leaveNested()
+		case key.Matches(msg, m.keys.EntropyOverview):
+			return m, m.toggleEntropy()
+		case key.Matches(msg, m.keys.NextEntropyRegion):
+			m.nextEntropyRegion(false)
+		case key.Matches(msg, m.keys.PrevEntropyRegion):
+			m.nextEntropyRegion(true)
+		case key.Matches(msg, m.keys.NextFrame):
+			m.nextFrameOrObject(false)
+		case key.Matches(msg, m.keys.PrevFrame):
+			m.nextFrameOrObject(true)
+		case key.Matches(msg, m.keys.NextObject):
+			m.nextObject(false)
+		case key.Matches(msg, m.keys.PrevObject):
+			m.nextObject(true)
+		}
+	case tea.MouseMsg:
+		if m.showEntropy {
+			m.clickEntropy(msg)
+			m.clickSmartLine(msg)
 		}
 	case tea.WindowSizeMsg:
 		m.width = msg.Width
 		m.height = msg.Height
-		// Adjust bytes per row based on terminal width
-		// Each byte needs about 3 characters in hex view (2 hex digits + space)
-		// Plus offset (12 chars), separators (4 chars), and ASCII view (1 char per byte)
-		// We'll leave some margin for safety
-		availableWidth := m.width - 20
-		if availableWidth > 0 {
-			// Calculate how many bytes we can fit
-			m.bytesPerRow = availableWidth / 4 // 3 for hex + 1 for ASCII
-			// Ensure it's at least 8 bytes and a multiple of 8 for clean display
-			if m.bytesPerRow < 8 {
-				m.bytesPerRow = 8
-			} else {
-				m.bytesPerRow = (m.bytesPerRow / 8) * 8
-			}
+		m.picker.Height = max(1, m.height-4)
+		if !m.fixedBytesPerRow {
+			m.autoBytesPerRow()
 		}
 	case bytesMsg:
-		m.data = []byte(msg)
-		// Detect JSON objects in the data
-		m.jsonObjects = findJSONObjects(m.data)
+		m.setData(msg)
+		m.path = ""
+	case fileMsg:
+		m.openFile(msg)
+	case fileErrMsg:
+		m.status = msg.Error()
+	case sourceMsg:
+		m.setSource(msg)
+	case annotateMsg:
+		m.addAnnotation(annotation(msg))
+	case clearAnnotationsMsg:
+		m.annotations = nil
+	case highlightMsg:
+		m.highlights = append(m.highlights, highlightGroup(msg))
+	case clearHighlightsMsg:
+		m.highlights = nil
+	case themeMsg:
+		m.setTheme(Theme(msg))
+	case diffMsg:
+		m.diff = newDiff(msg.names, msg.buffers)
+		m.offset = 0
+	case appendMsg:
+		if msg.replace {
+			m.setData(msg.data)
+			m.path = ""
+			m.arrivals = []arrival{{start: 0, at: msg.at}}
+		} else {
+			m.appendStreamed(msg.data, msg.at)
+		}
+		m.discardOldest()
+	case chunkMsg:
+		m.receiveChunk(msg)
+	case droppedChunksMsg:
+		m.status = fmt.Sprintf("%d chunks dropped, as the viewer fell behind", msg)
+	case readyMsg:
+		close(msg)
+	case queryMsg:
+		msg(&m)
+	case entropyMsg:
+		overview := entropyOverview(msg)
+		m.entropy = &overview
+		m.entropyPending = false
+	case histogramMsg:
+		m.setHistogram(msg)
+	case detectMsg:
+		m.mergeDetected(msg)
+	case editRescanMsg:
+		if m.editRescan.pending && int(msg) == m.editRescan.gen {
+			m.rescanEdited()
+		}
 	case layoutMsg:
-		layoutIndex := int(msg)
-		if layoutIndex >= 0 && layoutIndex < len(PredefinedLayouts) {
-			m.layoutIndex = layoutIndex
-			m.layout = PredefinedLayouts[layoutIndex]
+		if layout, ok := layoutAt(int(msg)); ok {
+			m.setLayout(int(msg), layout)
 		}
 	}
 
 	return m, nil
 }
 
-func (m model) View() string {
-	if len(m.data) == 0 {
-		return "No data to display. Press q to quit."
-	}
-
-	var sb strings.Builder
-
-	// Display current layout name
-	sb.WriteString(fmt.Sprintf("Layout: %s\n\n", m.layout.Name))
+// setData replaces the buffer with data owned by the caller
+func (m *model) setData(data []byte) {
+	m.setSource(sourceMsg{src: bytesSource(data), data: data})
+}
 
-	// Calculate how many rows we can display
-	rowsToDisplay := m.height - 5 // Leave room for header, separator, layout name, and footer
-	if rowsToDisplay < 1 {
-		rowsToDisplay = 1
+// setSource replaces the buffer with the contents of a DataSource
+func (m *model) setSource(msg sourceMsg) {
+	if m.unmap != nil {
+		// Nothing refers to the old mapping once the buffer is replaced
+		_ = m.unmap()
+		m.unmap = nil
 	}
+	m.closeParents()
+	m.src = msg.src
+	m.lazy = msg.lazy
+	m.cache = &windowCache{}
+	m.data = msg.data
+	m.ownsData = false
+	m.selection = selection{}
+	m.edit = editState{}
+	m.annotations = nil
+	m.chunks = nil
+	m.streams, m.stream = nil, 0
+	m.arrivals = nil
+	m.discarded = 0
+	m.highlights = nil
+	m.histogram = nil
+	m.collapsed = nil
+	m.cursor = min(m.cursor, max(0, m.size()-1))
+	m.rescan()
+}
 
-	// Check which view we're using
-	if m.layout.Name == "Smart View" {
-		return m.renderSmartView(rowsToDisplay)
+// maxDetectSize is the largest buffer that is scanned for JSON objects, as
+// detection would otherwise touch every page of huge memory-mapped files
+const maxDetectSize = 64 << 20
+
+// rescan reruns detection and search over the whole buffer after it changed.
+// Detection runs in the background for large buffers, see startDetection.
+func (m *model) rescan() {
+	m.entropyGen++
+	m.detectGen++
+	m.cancelDetection()
+	m.editRescan.pending = false
+	if m.lazy || len(m.data) > maxDetectSize {
+		m.jsonObjects, m.scanResume = nil, len(m.data)
+	} else if len(m.data) > detectSyncSize {
+		m.startDetection()
+	} else {
+		m.jsonObjects, m.scanResume = m.detectObjects(m.data, 0)
 	}
+	m.interpretations = nil
+	m.detectFileTypes()
+	m.resplitFrames()
+	m.refreshSearch()
+}
 
-	// Create dynamic header based on bytes per row and columns
-	hasOffset := containsColumn(m.layout.Columns, ColumnOffset)
-	hasHex := containsColumn(m.layout.Columns, ColumnHex)
-	hasASCII := containsColumn(m.layout.Columns, ColumnASCII)
+// autoBytesPerRow adjusts bytes per row to the terminal width
+func (m *model) autoBytesPerRow() {
+	// Each byte needs about 3 characters in hex view (2 hex digits + space)
+	// Plus offset (12 chars), separators (4 chars), and ASCII view (1 char per byte)
+	// We'll leave some margin for safety
+	availableWidth := m.dataWidth() - 20
+	if availableWidth > 0 {
+		// Calculate how many bytes we can fit
+		m.bytesPerRow = availableWidth / 4 // 3 for hex + 1 for ASCII
+		// Ensure it's at least 8 bytes and a multiple of 8 for clean display
+		if m.bytesPerRow < 8 {
+			m.bytesPerRow = 8
+		} else {
+			m.bytesPerRow = (m.bytesPerRow / 8) * 8
+		}
+	}
+	// Layouts with wider columns, such as binary, take fewer bytes per row
+	for m.bytesPerRow > 8 && m.rowWidth() > m.dataWidth() {
+		m.bytesPerRow -= 8
+	}
+}
 
-	// Header
-	if hasOffset {
-		sb.WriteString("Offset    ")
+// rowWidth returns how many cells a row of the layout takes, 0 for the
+// Smart View, which lays out objects instead of rows
+func (m model) rowWidth() int {
+	if len(m.layout.Renderers) == 0 && containsColumn(m.layout.Columns, ColumnJSON) {
+		return 0
+	}
+	width := 0
+	for i, c := range m.renderers(m.layout) {
+		if i > 0 {
+			width += len(" | ")
+		}
+		width += c.Width(m.bytesPerRow)
 	}
+	return width
+}
 
-	hexHeaderWidth := m.bytesPerRow*3 - 1 // 3 chars per byte (2 hex + 1 space) minus trailing space
-	asciiHeaderWidth := m.bytesPerRow
+// setLayout switches to the layout at index i of PredefinedLayouts
+func (m *model) setLayout(i int, layout Layout) {
+	m.layoutIndex = i
+	m.layout = layout
+	m.bits.active = m.bits.active && showsBits(layout)
+	if !m.fixedBytesPerRow {
+		m.autoBytesPerRow()
+	}
+}
 
-	if hasHex {
-		if hasOffset {
-			sb.WriteString("| ")
+// handlePendingKey completes a two-key command
+func (m *model) handlePendingKey(msg tea.KeyMsg) tea.Cmd {
+	pending := m.pendingKey
+	m.pendingKey = ""
+	switch pending {
+	case "y":
+		return m.copySelection(msg.String())
+	case "g":
+		if key.Matches(msg, m.keys.Top) {
+			m.gotoRow(m.takeCount())
 		}
-		sb.WriteString(fmt.Sprintf("%-*s ", hexHeaderWidth, "Hexadecimal"))
 	}
+	m.count = 0
+	return nil
+}
 
-	if hasASCII {
-		sb.WriteString("| ")
-		sb.WriteString(fmt.Sprintf("%-*s", asciiHeaderWidth, "ASCII"))
+func (m model) View() string {
+	if m.picking {
+		return m.pickerView()
+	}
+	if m.showHelp {
+		return m.helpView()
+	}
+	if m.histogram != nil {
+		return m.histogramView()
+	}
+	if m.hashes != nil {
+		return m.hashView()
+	}
+	if m.diff != nil {
+		return m.diffView()
+	}
+	if m.size() == 0 {
+		return "No data to display. Press q to quit."
+	}
+	if m.objectList.shown {
+		data := m
+		data.objectList.shown = false
+		data.width = m.dataWidth()
+		return m.withObjectList(data.View())
 	}
-	sb.WriteString("\n")
 
-	// Separator line
-	if hasOffset {
-		sb.WriteString("----------")
+	// Calculate how many rows we can display
+	rowsToDisplay := m.visibleRows()
+
+	// Layouts with a JSON column use the Smart View renderer
+	if len(m.layout.Renderers) == 0 && containsColumn(m.layout.Columns, ColumnJSON) {
+		return m.withEntropyStrip(m.withScrollbar(m.renderSmartView(rowsToDisplay), rowsToDisplay))
 	}
+	return m.withEntropyStrip(m.withScrollbar(m.renderHexView(rowsToDisplay), rowsToDisplay))
+}
 
-	if hasHex {
-		if hasOffset {
-			sb.WriteString("+-")
-		} else {
-			sb.WriteString("-")
-		}
-		sb.WriteString(strings.Repeat("-", hexHeaderWidth))
+// visibleRows returns how many data rows fit between the header (layout
+// name, blank line, column header and separator) and the footer (blank line
+// and help text), less the entropy overview when it is shown
+func (m model) visibleRows() int {
+	if m.showEntropy {
+		return max(1, m.height-6-entropyStripLines)
 	}
+	return max(1, m.height-6)
+}
+
+// renderHexView renders the row-based layouts
+func (m model) renderHexView(rowsToDisplay int) string {
+	var sb strings.Builder
 
-	if hasASCII {
-		sb.WriteString("-+-")
-		sb.WriteString(strings.Repeat("-", asciiHeaderWidth))
+	// Display current layout name
+	sb.WriteString(m.headerLine())
+	sb.WriteString(m.hexRows(rowsToDisplay))
+
+	// Footer
+	sb.WriteString(m.footer(
+		fmt.Sprintf(
+			"Cursor at %s, showing %d/%d bytes. Press '%s' for help, '%s' to switch layout, '%s' to quit.",
+			strings.TrimSpace(m.formatOffset(m.cursor)),
+			min(m.size(), m.bytesPerRow*rowsToDisplay),
+			m.size(),
+			m.keys.Help.Help().Key, m.keys.NextLayout.Help().Key, m.keys.Quit.Help().Key,
+		),
+	))
+
+	return sb.String()
+}
+
+// hexRows renders the column headings and up to rowsToDisplay rows of the
+// row-based layouts, starting at the row holding the offset
+func (m model) hexRows(rowsToDisplay int) string {
+	var sb strings.Builder
+	columns := m.renderers(m.layout)
+
+	// Header and separator line
+	headers := make([]string, len(columns))
+	separators := make([]string, len(columns))
+	for i, c := range columns {
+		width := c.Width(m.bytesPerRow)
+		headers[i] = fmt.Sprintf("%-*s", width, c.Header())
+		separators[i] = strings.Repeat("-", width)
 	}
+	sb.WriteString(m.theme.Header.Render(strings.Join(headers, " | ")))
+	sb.WriteString("\n")
+	sb.WriteString(strings.Join(separators, "-+-"))
 	sb.WriteString("\n")
 
-	// Calculate the starting offset
+	// Calculate the starting offset and read the visible bytes
 	startOffset := m.offset - (m.offset % m.bytesPerRow)
+	visible := m.window(startOffset, rowsToDisplay*m.bytesPerRow)
 
 	// Display rows
 	for row := 0; row < rowsToDisplay; row++ {
 		currentOffset := startOffset + (row * m.bytesPerRow)
-		if currentOffset >= len(m.data) {
+		if currentOffset >= m.size() && currentOffset > m.cursorLimit() {
 			break
 		}
 
-		// Offset column
-		if hasOffset {
-			sb.WriteString(fmt.Sprintf("0x%08X ", currentOffset))
-		}
-
-		// Hex columns
-		var hexPart strings.Builder
-		var asciiPart strings.Builder
-
-		for col := 0; col < m.bytesPerRow; col++ {
-			pos := currentOffset + col
-			if pos < len(m.data) {
-				if hasHex {
-					hexPart.WriteString(fmt.Sprintf("%02X ", m.data[pos]))
-				}
-
-				// ASCII representation
-				if hasASCII {
-					if m.data[pos] >= 32 && m.data[pos] <= 126 {
-						asciiPart.WriteRune(rune(m.data[pos]))
-					} else {
-						asciiPart.WriteRune('.')
-					}
-				}
-			} else {
-				if hasHex {
-					hexPart.WriteString("   ")
-				}
-				if hasASCII {
-					asciiPart.WriteRune(' ')
-				}
-			}
-		}
-
-		if hasHex {
-			// Trim the trailing space from hex part
-			hexStr := strings.TrimRight(hexPart.String(), " ")
-
-			// Ensure the hex part fills the allocated space
-			hexWidth := m.bytesPerRow*3 - 1
-
-			if hasOffset {
-				sb.WriteString("| ")
+		rowStart := min(row*m.bytesPerRow, len(visible))
+		rowData := visible[rowStart:min(rowStart+m.bytesPerRow, len(visible))]
+		for i, c := range columns {
+			if i > 0 {
+				sb.WriteString(" | ")
 			}
-			sb.WriteString(fmt.Sprintf("%-*s", hexWidth, hexStr))
-		}
-
-		// ASCII column
-		if hasASCII {
-			sb.WriteString(" | ")
-			sb.WriteString(asciiPart.String())
+			sb.WriteString(m.renderCell(c, rowData, currentOffset, i == len(columns)-1))
 		}
 		sb.WriteString("\n")
 	}
-
-	// Footer
-	sb.WriteString(
-		fmt.Sprintf(
-			"\nShowing %d/%d bytes. Use arrow keys to navigate, 'l' to switch layout, 'q' to quit.",
-			min(len(m.data), m.bytesPerRow*rowsToDisplay),
-			len(m.data),
-		),
-	)
-
 	return sb.String()
 }
 
@@ -299,21 +759,38 @@ func (m model) renderSmartView(rowsToDisplay int) string {
 	var sb strings.Builder
 
 	// Display current layout name
-	sb.WriteString(fmt.Sprintf("Layout: %s\n\n", m.layout.Name))
+	sb.WriteString(m.headerLine())
 
-	if len(m.data) == 0 {
+	if m.size() == 0 {
 		sb.WriteString("No data to display.\n\n")
-		sb.WriteString("Press 'l' to switch layout, 'q' to quit.")
+		sb.WriteString(fmt.Sprintf("Press '%s' to switch layout, '%s' to quit.", m.keys.NextLayout.Help().Key, m.keys.Quit.Help().Key))
 		return sb.String()
 	}
+	sb.WriteString(m.smartRows(rowsToDisplay))
 
-	// Use a responsive hex column based on terminal width
-	hexBytesPerRow := 8 // Default
-	if m.width > 100 {
-		hexBytesPerRow = 16
-	} else if m.width < 80 {
-		hexBytesPerRow = 4
+	// Footer
+	found := "found " + countObjects(m.jsonObjects)
+	if i := m.objectAt(m.cursor); i >= 0 {
+		found = fmt.Sprintf("in object %d/%d", i+1, len(m.jsonObjects))
 	}
+	sb.WriteString(m.footer(
+		fmt.Sprintf(
+			"Cursor at %s, %s. Press '%s' for help, '%s' to switch layout, '%s' to quit.",
+			strings.TrimSpace(m.formatOffset(m.cursor)),
+			found,
+			m.keys.Help.Help().Key, m.keys.NextLayout.Help().Key, m.keys.Quit.Help().Key,
+		),
+	))
+
+	return sb.String()
+}
+
+// smartRows renders the column headings and up to rowsToDisplay rows of the
+// Smart View, starting at the offset
+func (m model) smartRows(rowsToDisplay int) string {
+	var sb strings.Builder
+
+	hexBytesPerRow, maxHexColWidth := m.smartColumns()
 
 	// Determine if we're currently viewing a JSON object
 	currentJSONIndex := -1
@@ -324,45 +801,19 @@ func (m model) renderSmartView(rowsToDisplay int) string {
 		}
 	}
 
-	// Pre-process ALL JSON objects to determine display requirements
-	var maxHexColWidth int = 65 // Default minimum width to ensure sufficient space
-	
-	// Analyze all JSON objects to find the max required width
-	for _, obj := range m.jsonObjects {
-		var prettyJSON bytes.Buffer
-		err := json.Indent(&prettyJSON, obj.data, "", "  ")
-		if err == nil {
-			// Find the maximum line length in the prettified JSON
-			jsonLines := strings.Split(prettyJSON.String(), "\n")
-			for _, line := range jsonLines {
-				content := strings.TrimSpace(line)
-				contentLen := len(content)
-				if contentLen > 0 {
-					// Each byte needs 3 characters in hex (2 for hex, 1 for space)
-					requiredWidth := contentLen * 3
-					if requiredWidth > maxHexColWidth {
-						maxHexColWidth = requiredWidth
-					}
-				}
-			}
-		}
-	}
-
-	// Ensure the column width is reasonable
-	maxHexColWidth = min(maxHexColWidth, m.width/2)
-	
 	// Header with updated width
-	sb.WriteString(fmt.Sprintf("%-10s | %-*s | Content\n", "Offset", maxHexColWidth, "Hex"))
+	offsetWidth := m.offsetColumn().Width(0)
+	sb.WriteString(m.theme.Header.Render(fmt.Sprintf("%-*s | %-*s | Content", offsetWidth, "Offset", maxHexColWidth, "Hex")) + "\n")
 
 	// Calculate the content column width
-	contentColWidth := m.width - (maxHexColWidth + 15) // Account for offset column, hex column and separators
+	contentColWidth := m.width - (maxHexColWidth + offsetWidth + 5) // Account for offset column, hex column and separators
 	if contentColWidth < 20 {
 		contentColWidth = 20 // Ensure minimum readable width
 	}
 
 	// Separator line
 	sb.WriteString(fmt.Sprintf("%s+-%s-+-%s\n",
-		strings.Repeat("-", 10),
+		strings.Repeat("-", offsetWidth),
 		strings.Repeat("-", maxHexColWidth),
 		strings.Repeat("-", contentColWidth)))
 
@@ -383,11 +834,14 @@ func (m model) renderSmartView(rowsToDisplay int) string {
 	}
 
 	rowsRendered := 0
-	startPos := m.offset
+	// Start at the line holding the offset, so that rows between objects
+	// stay where scrolling them line by line puts them
+	startPos := m.smartLineStart(min(m.offset, m.size()-1))
+	lineStart := startPos
 
 	// If we're in the middle of a JSON object, adjust our offset to show it correctly
 	if currentObj != nil {
-		// If we're in a JSON object, start from the beginning of it
+		// Render it from its start, skipping the lines before the offset
 		startPos = currentObj.startOffset
 	}
 
@@ -395,7 +849,7 @@ func (m model) renderSmartView(rowsToDisplay int) string {
 	currentPos := startPos
 
 	// Render data
-	for rowsRendered < rowsToDisplay && currentPos < len(m.data) {
+	for rowsRendered < rowsToDisplay && currentPos < m.size() {
 		// Check if the current position is the start of a JSON object
 		jsonObjIndex := -1
 		for i, obj := range m.jsonObjects {
@@ -409,72 +863,74 @@ func (m model) renderSmartView(rowsToDisplay int) string {
 		if jsonObjIndex >= 0 {
 			obj := m.jsonObjects[jsonObjIndex]
 
+			// JSON is shown as a tree, each line with the bytes it was parsed from
+			if obj.tree != nil {
+				lines := jsonTreeLines(obj, m.collapsed)
+				skip := 0
+				// Scrolled into the object, so start at the line holding the offset
+				for skip < len(lines)-1 && obj.startOffset+lines[skip].start < lineStart {
+					skip++
+				}
+				for _, line := range lines[skip:] {
+					if rowsRendered >= rowsToDisplay {
+						break
+					}
+					start := obj.startOffset + line.start
+					text := m.renderJSON(sanitizeString(line.text))
+					if m.matchesLine(start, obj.startOffset+line.end) {
+						text = m.theme.Match.Inherit(m.theme.JSON).Render(sanitizeString(line.text))
+					}
+					sb.WriteString(fmt.Sprintf("%s | %s | %s\n",
+						m.theme.Offset.Render(m.formatOffset(start)),
+						m.highlightHexBytes(m.window(start, min(line.end-line.start, maxHexColWidth/3)), start, maxHexColWidth),
+						text))
+					rowsRendered++
+				}
+				currentPos = obj.endOffset + 1
+				continue
+			}
+
 			// Format the JSON prettily
-			var prettyJSON bytes.Buffer
-			err := json.Indent(&prettyJSON, obj.data, "", "  ")
+			perLine := max(1, maxHexColWidth/3)
+			jsonLines, err := obj.lines(perLine)
 
 			if err != nil {
 				// If we can't prettify, just show a single row with hex and raw JSON
 				hexPart := formatHexBytes(obj.data[:min(hexBytesPerRow, len(obj.data))], hexBytesPerRow)
-				sb.WriteString(fmt.Sprintf("0x%08X | %-*s | %s\n",
-					obj.startOffset,
-					maxHexColWidth,
-					hexPart,
-					sanitizeString(string(obj.data))))
+				sb.WriteString(fmt.Sprintf("%s | %s | %s\n",
+					m.theme.Offset.Render(m.formatOffset(obj.startOffset)),
+					m.theme.Hex.Render(fmt.Sprintf("%-*s", maxHexColWidth, hexPart)),
+					m.theme.JSON.Render(sanitizeString(string(obj.data)))))
 				rowsRendered++
 				currentPos = obj.endOffset + 1
 				continue
 			}
 
-			// Split the pretty JSON into lines
-			jsonLines := strings.Split(prettyJSON.String(), "\n")
-
 			// Display each line of the JSON
 			for i, line := range jsonLines {
 				if rowsRendered >= rowsToDisplay {
 					break
 				}
+				lineOffset := obj.lineOffset(i, perLine)
+				if lineOffset < lineStart && i < len(jsonLines)-1 {
+					// Scrolled past this line
+					continue
+				}
 
-				// Format the row with hex of the actual characters on this line
-				hexValues := ""
-				if i == 0 {
-					// First line - the opening brace
-					hexValues = formatDynamicHexBytes([]byte{'{'}, maxHexColWidth)
-				} else if i == len(jsonLines)-1 {
-					// Last line - the closing brace
-					hexValues = formatDynamicHexBytes([]byte{'}'}, maxHexColWidth)
-				} else if len(line) > 0 {
-					// Process the actual characters in this line (skip whitespace)
-					lineContent := strings.TrimSpace(line)
-					
-					// If the line has content, show its hex
-					if len(lineContent) > 0 {
-						// Convert string to bytes safely - only include ASCII characters
-						hexPart := []byte{}
-						for _, ch := range lineContent {
-							if ch < 128 && ch >= 32 {
-								hexPart = append(hexPart, byte(ch))
-							}
-						}
-						
-						// Only process if we have valid hex bytes
-						if len(hexPart) > 0 {
-							hexValues = formatDynamicHexBytes(hexPart, maxHexColWidth)
-						} else {
-							// Empty but properly formatted padding if no valid bytes
-							hexValues = strings.Repeat(" ", maxHexColWidth)
-						}
-					}
+				// These lines don't map to the bytes exactly, so they show the
+				// bytes of the object in order, from the offset of the line
+				var lineBytes []byte
+				if start := i * perLine; start < len(obj.data) {
+					lineBytes = obj.data[start:min(start+perLine, len(obj.data))]
 				}
-				
+
 				// Sanitize the line to prevent display issues
-				cleanLine := sanitizeString(line)
+				cleanLine := m.renderJSON(obj.displayLine(line))
 
 				// Format the row
-				sb.WriteString(fmt.Sprintf("0x%08X | %-*s | %s\n", 
-					obj.startOffset + i, 
-					maxHexColWidth,
-					hexValues,
+				sb.WriteString(fmt.Sprintf("%s | %s | %s\n",
+					m.theme.Offset.Render(m.formatOffset(lineOffset)),
+					m.highlightHexBytes(lineBytes, lineOffset, maxHexColWidth),
 					cleanLine))
 				rowsRendered++
 
@@ -485,11 +941,17 @@ func (m model) renderSmartView(rowsToDisplay int) string {
 			}
 		} else {
 			// Not the start of a JSON object, check if it's part of one
-			if jsonCovered[currentPos] {
+			if m.payloadsOnly && !jsonCovered[currentPos] {
+				// Skip the whole gap up to the next object in one line
+				end := m.stretchAt(currentPos).end
+				sb.WriteString(m.skippedLine(currentPos, end, maxHexColWidth))
+				rowsRendered++
+				currentPos = end
+			} else if jsonCovered[currentPos] {
 				// This position is covered by a JSON object but not the start
 				// Skip to the next position that's not part of this JSON object
 				foundNextPos := false
-				for i := currentPos + 1; i < len(m.data); i++ {
+				for i := currentPos + 1; i < m.size(); i++ {
 					if !jsonCovered[i] {
 						currentPos = i
 						foundNextPos = true
@@ -505,7 +967,7 @@ func (m model) renderSmartView(rowsToDisplay int) string {
 				// Not part of a JSON object, render as hex and ASCII
 				// Determine how far we can go before hitting a JSON object
 				endPos := currentPos + hexBytesPerRow - 1
-				for i := currentPos; i <= endPos && i < len(m.data); i++ {
+				for i := currentPos; i <= endPos && i < m.size(); i++ {
 					if jsonCovered[i] {
 						endPos = i - 1
 						break
@@ -513,21 +975,20 @@ func (m model) renderSmartView(rowsToDisplay int) string {
 				}
 
 				// Make sure we don't go beyond the data
-				endPos = min(endPos, len(m.data)-1)
+				endPos = min(endPos, m.size()-1)
 
 				// Get the bytes for this row
-				rowBytes := m.data[currentPos : endPos+1]
+				rowBytes := m.window(currentPos, endPos-currentPos+1)
 
 				// Create the hex representation
-				hexPart := formatDynamicHexBytes(rowBytes, maxHexColWidth)
+				hexPart := m.highlightHexBytes(rowBytes, currentPos, maxHexColWidth)
 
 				// Create the ASCII representation
-				asciiPart := formatASCIIBytes(rowBytes)
+				asciiPart := m.highlightASCIIBytes(rowBytes, currentPos)
 
 				// Render this line
-				sb.WriteString(fmt.Sprintf("0x%08X | %-*s | %s\n",
-					currentPos,
-					maxHexColWidth,
+				sb.WriteString(fmt.Sprintf("%s | %s | %s\n",
+					m.theme.Offset.Render(m.formatOffset(currentPos)),
 					hexPart,
 					asciiPart))
 				rowsRendered++
@@ -536,14 +997,6 @@ func (m model) renderSmartView(rowsToDisplay int) string {
 		}
 	}
 
-	// Footer
-	sb.WriteString(
-		fmt.Sprintf(
-			"\nFound %d JSON objects. Use arrow keys to navigate, 'l' to switch layout, 'q' to quit.",
-			len(m.jsonObjects),
-		),
-	)
-
 	return sb.String()
 }
 
@@ -661,121 +1114,385 @@ func max(x, y int) int {
 // bytesMsg is a custom message type for passing byte data
 type bytesMsg []byte
 
+// appendMsg is a custom message type for appending byte data, which arrived
+// at the given time
+type appendMsg struct {
+	data    []byte
+	at      time.Time
+	replace bool // the data replaces the buffer, as the first chunk read by ShowReader
+}
+
 // layoutMsg is a custom message type for changing layouts
 type layoutMsg int
 
-var globalProgram *tea.Program
+// queryMsg runs a function against the model inside the event loop, so that
+// API calls can read and change its state without racing the UI
+type queryMsg func(m *model)
+
+// readyMsg carries a channel that the model closes when it handles the
+// message, signaling that the event loop is running and has handled every
+// message sent before
+type readyMsg chan struct{}
+
+// Viewer is a handle to a running TUI instance
+type Viewer struct {
+	program *tea.Program
+	done    chan struct{}
+	chunks  *chunkQueue // mirrored to the viewer and not yet taken by the event loop
+	err     error
+	final   model // state of the model after the program exited
+}
+
+// inspect runs fn against the model inside the event loop, or against the
+// final model if the viewer has already exited
+func (v *Viewer) inspect(fn func(m *model)) {
+	ran := make(chan struct{})
+	go v.program.Send(queryMsg(func(m *model) {
+		fn(m)
+		close(ran)
+	}))
+	select {
+	case <-ran:
+	case <-v.done:
+		select {
+		case <-ran:
+		default:
+			fn(&v.final)
+		}
+	}
+}
+
+// deliver sends msg to the event loop and waits until it has been handled.
+// It returns ErrViewerExited if the viewer exited before handling it.
+func (v *Viewer) deliver(msg tea.Msg) error {
+	handled := make(chan struct{})
+	go func() {
+		// Messages from one goroutine are handled in the order sent
+		v.program.Send(msg)
+		v.program.Send(readyMsg(handled))
+	}()
+	select {
+	case <-handled:
+		return nil
+	case <-v.done:
+		select {
+		case <-handled:
+			return nil
+		default:
+			return ErrViewerExited
+		}
+	}
+}
+
+// ShowBytes displays the given bytes in this viewer. It returns once they
+// are shown, or ErrViewerExited if the viewer exited first.
+func (v *Viewer) ShowBytes(data []byte) error {
+	return v.deliver(bytesMsg(data))
+}
+
+// SetLayout sets the current layout of this viewer by index
+func (v *Viewer) SetLayout(layoutIndex int) {
+	if layoutIndex >= 0 && layoutIndex < layoutCount() {
+		v.program.Send(layoutMsg(layoutIndex))
+	}
+}
+
+// Done returns a channel that is closed once the viewer has exited
+func (v *Viewer) Done() <-chan struct{} {
+	return v.done
+}
+
+// Wait blocks until the viewer exits and returns the error it exited with, if any
+func (v *Viewer) Wait() error {
+	<-v.done
+	return v.err
+}
+
+// Close quits the viewer, restores the terminal and waits for it to exit.
+// Calling Close on a viewer that has already exited is a no-op.
+func (v *Viewer) Close() error {
+	v.program.Quit()
+	<-v.done
+	defaultMu.Lock()
+	if defaultV == v {
+		defaultV = nil
+	}
+	defaultMu.Unlock()
+	if errors.Is(v.err, tea.ErrProgramKilled) {
+		return nil
+	}
+	return v.err
+}
+
+// The default viewer is the one most recently started with StartTUI, the
+// target of the package-level functions. Viewers are independent of it, so
+// that any number of them can run at once.
+var (
+	defaultMu sync.Mutex
+	defaultV  *Viewer
+)
+
+// defaultViewer returns the default viewer, nil if none is running
+func defaultViewer() *Viewer {
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
+	return defaultV
+}
 
-// ShowBytes displays the given bytes in the TUI
-func ShowBytes(data []byte) {
-	if globalProgram != nil {
-		globalProgram.Send(bytesMsg(data))
+// ShowBytes displays the given bytes in the TUI started by StartTUI, see
+// Viewer.ShowBytes
+func ShowBytes(data []byte) error {
+	v := defaultViewer()
+	if v == nil {
+		return ErrNoViewer
 	}
+	return v.ShowBytes(data)
 }
 
 // SetLayout sets the current layout by index
 func SetLayout(layoutIndex int) {
-	if globalProgram != nil && layoutIndex >= 0 && layoutIndex < len(PredefinedLayouts) {
-		globalProgram.Send(layoutMsg(layoutIndex))
+	if v := defaultViewer(); v != nil {
+		v.SetLayout(layoutIndex)
+	}
+}
+
+// Stop shuts down the TUI started by StartTUI and restores the terminal
+func Stop() error {
+	v := defaultViewer()
+	if v == nil {
+		return nil
 	}
+	return v.Close()
 }
 
 // findJSONObjects scans a byte slice for valid JSON objects/arrays
 func findJSONObjects(data []byte) []jsonObject {
-	var objects []jsonObject
+	objects, _ := scanJSONObjects(data, 0, DetectionOptions{})
+	return objects
+}
 
-	// Define JSON start characters
-	jsonStartChars := map[byte]byte{
-		'{': '}', // object start -> expected end
-		'[': ']', // array start -> expected end
+// scanJSONObjects scans data starting at from for JSON objects/arrays. It also
+// returns the offset of the first candidate that was still unterminated at the
+// end of data, or len(data) if there was none; appended data only needs to be
+// rescanned from there. Unless opts accept unparsed text, only what
+// encoding/json parses is kept, otherwise also text that merely looks like
+// JSON, e.g. with trailing commas or unquoted keys.
+func scanJSONObjects(data []byte, from int, opts DetectionOptions) ([]jsonObject, int) {
+	var objects []jsonObject
+	resume := len(data)
+	startChars, maxDepth := opts.startChars(), opts.maxDepth()
+	// Where the containers nested in candidates that weren't kept end, so
+	// that trying them next doesn't walk over the same bytes again
+	var nested []jsonSpan
+	walked := map[int]jsonSpan{}
+	remember := func() {
+		for _, n := range nested {
+			walked[n.start] = n
+		}
 	}
 
-	for i := 0; i < len(data); i++ {
-		// Check for potential JSON start
-		endChar, isStart := jsonStartChars[data[i]]
-		if !isStart {
+	for i := from; i < len(data); i++ {
+		if (data[i] != '{' && data[i] != '[') || strings.IndexByte(startChars, data[i]) < 0 {
 			continue
 		}
-
-		// Check if the potential JSON object is likely valid
-		if i+1 >= len(data) {
+		end, truncated := -1, false
+		nested = nested[:0]
+		if ok, short := jsonStart(data[i:]); !ok {
+			truncated = short
+		} else if span, ok := walked[i]; ok {
+			end, truncated = span.end, span.truncated
+		} else {
+			end, truncated = jsonEnd(data[i:], maxDepth, func(span jsonSpan) {
+				span.start += i
+				nested = append(nested, span)
+			})
+		}
+		if truncated {
+			// Ran out of data before the brackets balanced
+			resume = min(resume, i)
+			remember()
+			continue
+		}
+		if end < 0 {
+			remember()
+			continue
+		}
+		if end+1 < opts.MinLength {
+			// Whatever is nested in it is shorter still
+			i += end
 			continue
 		}
 
-		// Check if the next character suggests a valid JSON structure
-		nextChar := data[i+1]
-		if nextChar != '"' && nextChar != '{' && nextChar != '[' && 
-		   !(nextChar >= '0' && nextChar <= '9') {
-			// Skip if not promising
+		jsonData := data[i : i+end+1]
+		var parsed interface{}
+		if err := json.Unmarshal(jsonData, &parsed); err != nil && !opts.AcceptUnparsed {
+			// Objects nested in it may still be valid
+			remember()
 			continue
 		}
+		objects = append(objects, jsonObject{
+			startOffset: i,
+			endOffset:   i + end,
+			data:        jsonData,
+			parsed:      parsed,
+		})
+		// Move on past the object
+		i += end
+	}
 
-		// Found a potential JSON start
-		startOffset := i
-		nestLevel := 1
-
-		// Scan for matching end character
-		validJSON := false
-		for j := i + 1; j < len(data); j++ {
-			if data[j] == data[i] {
-				// Found nested start of same type
-				nestLevel++
-			} else if data[j] == endChar {
-				// Found an end character
-				nestLevel--
-
-				// If all brackets match, we might have valid JSON
-				if nestLevel == 0 {
-					jsonData := data[startOffset : j+1]
-
-					// Try to parse as JSON
-					var parsed interface{}
-					if err := json.Unmarshal(jsonData, &parsed); err == nil {
-						// Valid JSON found
-						objects = append(objects, jsonObject{
-							startOffset: startOffset,
-							endOffset:   j,
-							data:        jsonData,
-							parsed:      parsed,
-						})
-						validJSON = true
-					} else if len(jsonData) > 10 {
-						// If parsing failed but structure seems valid, 
-						// still consider it as a JSON object
-						objects = append(objects, jsonObject{
-							startOffset: startOffset,
-							endOffset:   j,
-							data:        jsonData,
-							parsed:      nil,
-						})
-						validJSON = true
-					}
+	return objects, resume
+}
 
-					// Move outer loop forward
-					i = j
-					break
-				}
-			}
+// jsonEnd returns the index of the bracket closing the object or array that
+// data starts with, or -1 if data stops looking like JSON before then.
+// Brackets in strings don't count, minding escaped quotes. It also reports
+// whether data ended before the brackets balanced. Nesting deeper than
+// maxDepth doesn't count as JSON. The containers nested in it are passed to
+// nested along the way, as the walk tells where they end too; the walk goes
+// on past the outer one nesting too deep for the inner ones' sake.
+func jsonEnd(data []byte, maxDepth int, nested func(jsonSpan)) (int, bool) {
+	var closing []byte // brackets expected to close the open ones, innermost last
+	var open []int     // offsets of the open brackets, innermost last
+	deep := 0          // how many of the outermost open ones nest too deep
+	end, truncated := -1, false
+	// Starting at a nested bracket gives the same tokens from there on, so
+	// where it ends is known once the walk gets there
+	found := func(start, length int, short bool) {
+		if start == 0 {
+			end, truncated = length, short
+		} else {
+			nested(jsonSpan{start: start, end: length, truncated: short})
 		}
+	}
+	fail := func() (int, bool) {
+		for _, o := range open[deep:] {
+			found(o, -1, false)
+		}
+		return end, truncated
+	}
 
-		if !validJSON {
-			continue
+	inString, escaped := false, false
+	for j, c := range data {
+		switch {
+		case inString:
+			switch {
+			case escaped:
+				escaped = false
+			case c == '\\':
+				escaped = true
+			case c == '"':
+				inString = false
+			case c < 0x20:
+				// Control characters in strings must be escaped
+				return fail()
+			}
+		case c == '"':
+			inString = true
+		case c == '{':
+			closing = append(closing, '}')
+			open = append(open, j)
+		case c == '[':
+			closing = append(closing, ']')
+			open = append(open, j)
+		case c == '}', c == ']':
+			if closing[len(closing)-1] != c {
+				return fail()
+			}
+			o := open[len(open)-1]
+			closing, open = closing[:len(closing)-1], open[:len(open)-1]
+			if len(open) < deep {
+				// It nested too deep and was given up on already
+				deep = len(open)
+			} else {
+				found(o, j-o, false)
+			}
+			if len(open) == 0 {
+				return end, truncated
+			}
+		case c < 0x20 && c != '\t' && c != '\r' && c != '\n', c > 0x7E:
+			// Binary data outside strings isn't JSON
+			return fail()
+		}
+		// Nesting is counted from each open bracket, so the inner ones may
+		// still be within maxDepth
+		for len(open)-deep > maxDepth {
+			found(open[deep], -1, false)
+			deep++
 		}
 	}
+	for _, o := range open[deep:] {
+		found(o, -1, true)
+	}
+	return end, truncated
+}
 
-	return objects
+// jsonSpan is where a container nested in a candidate ends, see jsonEnd
+type jsonSpan struct {
+	start     int
+	end       int // relative to start, -1 if it isn't JSON
+	truncated bool
+}
+
+// jsonStart reports whether a key or value follows the bracket data starts
+// with, not e.g. "[x]" or "{}", and whether data ended before telling
+func jsonStart(data []byte) (ok, truncated bool) {
+	first := bytes.TrimLeft(data[1:], " \t\r\n")
+	if len(first) == 0 {
+		return false, true
+	}
+	return strings.IndexByte(`"{[-0123456789`, first[0]) >= 0 || (data[0] == '[' && strings.IndexByte("tfn", first[0]) >= 0), false
 }
 
-// StartTUI initializes and starts the terminal UI
-func StartTUI() {
-	model := initialModel()
-	p := tea.NewProgram(model, tea.WithAltScreen())
-	globalProgram = p
+// StartTUI initializes and starts the terminal UI, configured by opts. It
+// returns once the UI is running, or with an error if the terminal could not
+// be set up. The returned viewer also becomes the default viewer, the target
+// of the package-level functions such as ShowBytes, SetLayout and Stop,
+// until another one is started. Several viewers may run at once, each on a
+// terminal of its own, see WithInput and WithOutput.
+func StartTUI(opts ...Option) (*Viewer, error) {
+	cfg := newConfig(opts)
+
+	var programOpts []tea.ProgramOption
+	if cfg.altScreen {
+		programOpts = append(programOpts, tea.WithAltScreen())
+	}
+	if cfg.input != nil {
+		programOpts = append(programOpts, tea.WithInput(cfg.input))
+	}
+	if cfg.output != nil {
+		programOpts = append(programOpts, tea.WithOutput(cfg.output))
+	}
+
+	v := &Viewer{
+		program: tea.NewProgram(initialModel(cfg), programOpts...),
+		done:    make(chan struct{}),
+		chunks:  &chunkQueue{wake: make(chan struct{}, 1)},
+	}
+	go v.chunks.run(v.program, v.done)
 
 	go func() {
-		if _, err := p.Run(); err != nil {
-			fmt.Printf("Error running program: %v", err)
-			os.Exit(1)
+		final, err := v.program.Run()
+		if fm, ok := final.(model); ok {
+			v.final = fm
 		}
+		v.err = err
+		close(v.done)
 	}()
-}
\ No newline at end of file
+
+	// Wait until the event loop handles a message, or until Run fails
+	ready := make(chan struct{})
+	go v.program.Send(readyMsg(ready))
+	select {
+	case <-ready:
+	case <-v.done:
+		if v.err != nil {
+			return nil, fmt.Errorf("starting TUI: %w", v.err)
+		}
+		return v, nil
+	}
+
+	defaultMu.Lock()
+	defaultV = v
+	defaultMu.Unlock()
+	return v, nil
+}
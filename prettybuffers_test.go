@@ -0,0 +1,52 @@
+package prettybuffers
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+// TestScanJSONObjectsNestedInvalid makes sure that deeply nested text that
+// isn't JSON is scanned in linear time, as buffers up to detectSyncSize are
+// scanned inside the event loop. Trying every bracket on its own took
+// seconds for these.
+func TestScanJSONObjectsNestedInvalid(t *testing.T) {
+	inputs := map[string][]byte{
+		"balanced":      append(bytes.Repeat([]byte("[1 "), 120000), bytes.Repeat([]byte("]"), 120000)...),
+		"unterminated":  bytes.Repeat([]byte("[1 "), 120000),
+		"quoted":        bytes.Repeat([]byte(`["[" `), 80000),
+		"moderate":      bytes.Repeat(append(bytes.Repeat([]byte("[1 "), 500), bytes.Repeat([]byte("]"), 500)...), 200),
+		"deep and flat": append(bytes.Repeat([]byte("{\"a\":"), 20000), `[1,2] {"b":true}`...),
+	}
+	for name, data := range inputs {
+		start := time.Now()
+		scanJSONObjects(data, 0, DetectionOptions{})
+		// Linear scans take milliseconds; allow for slow machines
+		if elapsed := time.Since(start); elapsed > 2*time.Second {
+			t.Errorf("%s: scanning %d bytes took %v", name, len(data), elapsed)
+		}
+	}
+}
+
+// TestScanJSONObjectsInsideInvalid checks that valid JSON nested in text
+// that isn't is still found, as is JSON after it
+func TestScanJSONObjectsInsideInvalid(t *testing.T) {
+	data := []byte(`x [1 {"a":[1,2]} ] {"b":"[\"q\"]"} [[1],[2]`)
+	objects, resume := scanJSONObjects(data, 0, DetectionOptions{})
+	var got []string
+	for _, o := range objects {
+		got = append(got, string(o.data))
+	}
+	want := []string{`{"a":[1,2]}`, `{"b":"[\"q\"]"}`, `[1]`, `[2]`}
+	if len(got) != len(want) {
+		t.Fatalf("found %q, want %q", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("object %d is %q, want %q", i, got[i], want[i])
+		}
+	}
+	if want := bytes.LastIndex(data, []byte("[[")); resume != want {
+		t.Errorf("resume is %d, want %d", resume, want)
+	}
+}
@@ -0,0 +1,126 @@
+package prettybuffers
+
+import (
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// promptKind identifies what a line of typed input is used for
+type promptKind int
+
+const (
+	// promptNone means no prompt is open
+	promptNone promptKind = iota
+	// promptSearchHex reads a hex byte pattern to search for
+	promptSearchHex
+	// promptSearchText reads text to search for
+	promptSearchText
+	// promptSearchRegex reads a regular expression to search for
+	promptSearchRegex
+	// promptCommand reads a command line such as "w out.bin"
+	promptCommand
+	// promptQuery reads a JSONPath to select values of the JSON object under
+	// the cursor
+	promptQuery
+)
+
+// prompt is a single-line text input shown in place of the footer
+type prompt struct {
+	kind       promptKind
+	label      string
+	input      string
+	ignoreCase bool     // toggled with tab in text search prompts
+	candidates []string // completions offered after tab in the command prompt
+}
+
+// openPrompt starts reading a line of input for the given purpose
+func (m *model) openPrompt(kind promptKind, label string) {
+	m.prompt = prompt{kind: kind, label: label}
+	m.status = ""
+}
+
+// updatePrompt handles a key press while a prompt is open
+func (m *model) updatePrompt(msg tea.KeyMsg) tea.Cmd {
+	switch msg.Type {
+	case tea.KeyEsc, tea.KeyCtrlC:
+		m.prompt = prompt{}
+	case tea.KeyEnter:
+		p := m.prompt
+		m.prompt = prompt{}
+		return m.submitPrompt(p)
+	case tea.KeyBackspace:
+		if len(m.prompt.input) > 0 {
+			runes := []rune(m.prompt.input)
+			m.prompt.input = string(runes[:len(runes)-1])
+		}
+	case tea.KeyTab:
+		switch m.prompt.kind {
+		case promptSearchText:
+			m.prompt.ignoreCase = !m.prompt.ignoreCase
+			m.prompt.label = textSearchLabel(m.prompt.ignoreCase)
+		case promptCommand:
+			m.prompt.input, m.prompt.candidates = m.completeCommand(m.prompt.input)
+		}
+		return nil
+	case tea.KeySpace:
+		m.prompt.input += " "
+	case tea.KeyRunes:
+		m.prompt.input += string(msg.Runes)
+	}
+	m.prompt.candidates = nil
+	return nil
+}
+
+// submitPrompt acts on the input of a prompt once enter is pressed
+func (m *model) submitPrompt(p prompt) tea.Cmd {
+	switch p.kind {
+	case promptSearchHex:
+		m.startSearch(searchHex, p.input, false)
+	case promptSearchText:
+		m.startSearch(searchText, p.input, p.ignoreCase)
+	case promptSearchRegex:
+		m.startSearch(searchRegex, p.input, false)
+	case promptQuery:
+		m.startQuery(p.input)
+	case promptCommand:
+		cmd, err := m.runCommand(p.input)
+		if err != nil && m.status == "" {
+			m.status = err.Error()
+		}
+		return cmd
+	}
+	return nil
+}
+
+// textSearchLabel returns the label of the text search prompt
+func textSearchLabel(ignoreCase bool) string {
+	if ignoreCase {
+		return "Search text (ignore case, tab to toggle): "
+	}
+	return "Search text (tab to ignore case): "
+}
+
+// footer returns the bottom line of the view: the open prompt, a status
+// message, or the given default help text
+func (m model) footer(help string) string {
+	if m.prompt.kind != promptNone {
+		line := m.prompt.label + m.prompt.input + "_"
+		if len(m.prompt.candidates) > 0 {
+			line += "  [" + strings.Join(m.prompt.candidates, " | ") + "]"
+		}
+		return "\n" + m.theme.Footer.Render(line)
+	}
+	if m.status != "" {
+		return "\n" + m.theme.Footer.Render(m.status)
+	}
+	if m.edit.active {
+		help = m.editHelp()
+	} else if m.bits.active {
+		help = m.bitHelp()
+	}
+	if m.detection != nil {
+		help = m.detection.progress() + ". " + help
+	}
+	return "\n" + m.annotationInfo() + m.theme.Footer.Render(m.byteOrderInfo()+" "+help)
+}
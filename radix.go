@@ -0,0 +1,105 @@
+package prettybuffers
+
+import (
+	"fmt"
+	"strings"
+)
+
+// radixColumn shows each byte as a number of a fixed width, such as eight
+// binary digits, separated by spaces
+type radixColumn struct {
+	format string // of one byte, e.g. "%08b"
+	digits int    // cells the format takes
+}
+
+// width returns how many cells rows of bytesPerRow bytes take
+func (c radixColumn) width(bytesPerRow int) int {
+	return max(bytesPerRow*(c.digits+1)-1, 0)
+}
+
+// render joins the cells of n bytes with a space between them
+func (c radixColumn) render(n int, cell func(i int) string) string {
+	var sb strings.Builder
+	for i := 0; i < n; i++ {
+		if i > 0 {
+			sb.WriteRune(' ')
+		}
+		sb.WriteString(cell(i))
+	}
+	return sb.String()
+}
+
+// renderRow renders the bytes of a row as plain text
+func (c radixColumn) renderRow(data []byte) string {
+	return c.render(len(data), func(i int) string {
+		return fmt.Sprintf(c.format, data[i])
+	})
+}
+
+// renderStyled renders the bytes of a row with the highlights of the viewer
+func (c radixColumn) renderStyled(m model, data []byte, offset int) string {
+	blank := strings.Repeat(" ", c.digits)
+	return c.render(m.bytesPerRow, func(i int) string {
+		if i < len(data) {
+			return m.highlight(offset+i, fmt.Sprintf(c.format, data[i]), m.theme.Hex)
+		}
+		// Padding is highlighted when the cursor sits past the end in insert mode
+		return m.highlight(offset+i, blank, m.theme.Hex)
+	})
+}
+
+var (
+	binaryRadix  = radixColumn{format: "%08b", digits: 8}
+	octalRadix   = radixColumn{format: "%03o", digits: 3}
+	decimalRadix = radixColumn{format: "%3d", digits: 3}
+)
+
+// BinaryColumn shows each byte as eight binary digits, e.g. to read the
+// bits of flag registers
+type BinaryColumn struct{}
+
+// Header implements ColumnRenderer
+func (BinaryColumn) Header() string { return "Binary" }
+
+// Width implements ColumnRenderer
+func (BinaryColumn) Width(bytesPerRow int) int { return binaryRadix.width(bytesPerRow) }
+
+// RenderRow implements ColumnRenderer
+func (BinaryColumn) RenderRow(data []byte, _ int) string { return binaryRadix.renderRow(data) }
+
+func (BinaryColumn) renderStyled(m model, data []byte, offset int) string {
+	return binaryRadix.renderStyled(m, data, offset)
+}
+
+// OctalColumn shows each byte as three octal digits
+type OctalColumn struct{}
+
+// Header implements ColumnRenderer
+func (OctalColumn) Header() string { return "Octal" }
+
+// Width implements ColumnRenderer
+func (OctalColumn) Width(bytesPerRow int) int { return octalRadix.width(bytesPerRow) }
+
+// RenderRow implements ColumnRenderer
+func (OctalColumn) RenderRow(data []byte, _ int) string { return octalRadix.renderRow(data) }
+
+func (OctalColumn) renderStyled(m model, data []byte, offset int) string {
+	return octalRadix.renderStyled(m, data, offset)
+}
+
+// DecimalColumn shows each byte as an unsigned decimal number, right-aligned
+// in three cells
+type DecimalColumn struct{}
+
+// Header implements ColumnRenderer
+func (DecimalColumn) Header() string { return "Decimal" }
+
+// Width implements ColumnRenderer
+func (DecimalColumn) Width(bytesPerRow int) int { return decimalRadix.width(bytesPerRow) }
+
+// RenderRow implements ColumnRenderer
+func (DecimalColumn) RenderRow(data []byte, _ int) string { return decimalRadix.renderRow(data) }
+
+func (DecimalColumn) renderStyled(m model, data []byte, offset int) string {
+	return decimalRadix.renderStyled(m, data, offset)
+}
@@ -0,0 +1,127 @@
+package prettybuffers
+
+import (
+	"sort"
+
+	"github.com/charmbracelet/lipgloss"
+)
+
+// Range is a span of the buffer from Start up to (not including) End
+type Range struct {
+	Start int
+	End   int
+}
+
+// highlightGroup is a set of ranges drawn with one style
+type highlightGroup struct {
+	ranges []Range // sorted by Start, non-empty
+	style  lipgloss.Style
+}
+
+// highlightMsg adds a highlight group
+type highlightMsg highlightGroup
+
+// clearHighlightsMsg removes all highlight groups
+type clearHighlightsMsg struct{}
+
+// newHighlightGroup drops empty ranges and sorts the rest
+func newHighlightGroup(ranges []Range, style lipgloss.Style) highlightGroup {
+	g := highlightGroup{style: style}
+	for _, r := range ranges {
+		if r.End > r.Start {
+			g.ranges = append(g.ranges, r)
+		}
+	}
+	sort.Slice(g.ranges, func(i, j int) bool { return g.ranges[i].Start < g.ranges[j].Start })
+	return g
+}
+
+// covers reports whether any range of the group contains pos
+func (g highlightGroup) covers(pos int) bool {
+	// Ranges may overlap, so check every range starting at or before pos
+	i := sort.Search(len(g.ranges), func(i int) bool { return g.ranges[i].Start > pos })
+	for j := i - 1; j >= 0; j-- {
+		if pos < g.ranges[j].End {
+			return true
+		}
+	}
+	return false
+}
+
+// layeredStyle combines the highlight groups, the annotation, the frame header,
+// the start of a streamed chunk and the file format structure covering pos.
+// Later groups take precedence for the properties they set; properties they
+// leave unset fall through to earlier groups, then to the annotation, the
+// frame header, the chunk start and finally the structure.
+func (m model) layeredStyle(pos int) (lipgloss.Style, bool) {
+	style := lipgloss.NewStyle()
+	found := false
+	for i := len(m.highlights) - 1; i >= 0; i-- {
+		if m.highlights[i].covers(pos) {
+			style = style.Inherit(m.highlights[i].style)
+			found = true
+		}
+	}
+	if a := m.annotationAt(pos); a != nil {
+		style = style.Inherit(a.style)
+		found = true
+	}
+	if m.isFrameHeader(pos) {
+		style = style.Inherit(frameHeaderStyle)
+		found = true
+	}
+	if m.isChunkStart(pos) {
+		style = style.Inherit(chunkStartStyle)
+		found = true
+	}
+	if s, ok := m.structureStyle(pos); ok {
+		style = style.Inherit(s)
+		found = true
+	}
+	return style, found
+}
+
+// shiftHighlights moves highlighted ranges after bytes were inserted or deleted
+func (m *model) shiftHighlights(pos, delta int) {
+	shift := func(off int) int {
+		if off < pos {
+			return off
+		}
+		return max(pos, off+delta)
+	}
+
+	for i, g := range m.highlights {
+		shifted := make([]Range, 0, len(g.ranges))
+		for _, r := range g.ranges {
+			shifted = append(shifted, Range{Start: shift(r.Start), End: shift(r.End)})
+		}
+		m.highlights[i] = newHighlightGroup(shifted, g.style)
+	}
+}
+
+// Highlight draws the given ranges with style until ClearHighlights is
+// called. Unlike annotations, highlights carry no label; they are meant for
+// transient emphasis such as externally computed regions. When highlights
+// overlap, the one added last wins for the style properties it sets.
+func (v *Viewer) Highlight(ranges []Range, style lipgloss.Style) {
+	v.program.Send(highlightMsg(newHighlightGroup(ranges, style)))
+}
+
+// ClearHighlights removes all highlights from this viewer
+func (v *Viewer) ClearHighlights() {
+	v.program.Send(clearHighlightsMsg{})
+}
+
+// Highlight draws ranges in the TUI started by StartTUI, see Viewer.Highlight
+func Highlight(ranges []Range, style lipgloss.Style) {
+	if v := defaultViewer(); v != nil {
+		v.Highlight(ranges, style)
+	}
+}
+
+// ClearHighlights removes all highlights from the TUI started by StartTUI
+func ClearHighlights() {
+	if v := defaultViewer(); v != nil {
+		v.ClearHighlights()
+	}
+}
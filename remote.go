@@ -0,0 +1,189 @@
+package prettybuffers
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+)
+
+// Buffers are pushed to a receiving viewer over a stream, such as a TCP
+// connection or unix socket, as messages made of a label and the data, each
+// prefixed with its length as a big-endian uint32:
+//
+//	label length (4) | label (UTF-8) | data length (4) | data
+//
+// Any number of messages may follow each other on a connection, so that
+// producers written in any language can push buffers with a few lines.
+const (
+	// maxRemoteLabel is the longest label accepted from a sender
+	maxRemoteLabel = 4 << 10
+	// maxRemoteBuffer is the largest buffer accepted from a sender
+	maxRemoteBuffer = 16 << 20
+	// maxRemoteSenders is how many senders a receiver reads from at once;
+	// more wait to be accepted until one of them disconnects
+	maxRemoteSenders = 16
+)
+
+// ErrRemoteTooLarge is returned when a message exceeds the size a receiver
+// accepts, 4 KiB for labels and 16 MiB for buffers
+var ErrRemoteTooLarge = errors.New("prettybuffers: remote buffer too large")
+
+// writeRemoteBuffer writes a message holding label and data to w
+func writeRemoteBuffer(w io.Writer, label string, data []byte) error {
+	if len(label) > maxRemoteLabel || len(data) > maxRemoteBuffer {
+		return ErrRemoteTooLarge
+	}
+	msg := make([]byte, 0, 8+len(label)+len(data))
+	msg = binary.BigEndian.AppendUint32(msg, uint32(len(label)))
+	msg = append(msg, label...)
+	msg = binary.BigEndian.AppendUint32(msg, uint32(len(data)))
+	msg = append(msg, data...)
+	_, err := w.Write(msg)
+	return err
+}
+
+// readRemoteBuffer reads the next message from r. It returns io.EOF if r
+// ends between messages and io.ErrUnexpectedEOF if it ends inside one.
+func readRemoteBuffer(r io.Reader) (string, []byte, error) {
+	label, err := readRemoteField(r, maxRemoteLabel)
+	if err != nil {
+		return "", nil, err
+	}
+	data, err := readRemoteField(r, maxRemoteBuffer)
+	if errors.Is(err, io.EOF) {
+		err = io.ErrUnexpectedEOF
+	}
+	return string(label), data, err
+}
+
+// readRemoteField reads a length-prefixed field of at most limit bytes
+func readRemoteField(r io.Reader, limit int) ([]byte, error) {
+	var prefix [4]byte
+	if _, err := io.ReadFull(r, prefix[:]); err != nil {
+		return nil, err
+	}
+	n := binary.BigEndian.Uint32(prefix[:])
+	if uint64(n) > uint64(limit) {
+		return nil, ErrRemoteTooLarge
+	}
+	// The length is the sender's word, so memory is only taken as the
+	// bytes arrive
+	var field bytes.Buffer
+	if _, err := io.CopyN(&field, r, int64(n)); err != nil {
+		if errors.Is(err, io.EOF) {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return field.Bytes(), nil
+}
+
+// Sender pushes labeled buffers to a viewer receiving them with Receive,
+// possibly on another machine or in another container. It is safe for
+// concurrent use.
+type Sender struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewSender returns a sender writing to w, such as a connection to a receiver
+func NewSender(w io.Writer) *Sender {
+	return &Sender{w: w}
+}
+
+// DialSender connects to a receiver listening on the given network and
+// address, e.g. ("tcp", "host:7777") or ("unix", "/tmp/prettybuffers.sock")
+func DialSender(network, address string) (*Sender, error) {
+	conn, err := net.Dial(network, address)
+	if err != nil {
+		return nil, err
+	}
+	return NewSender(conn), nil
+}
+
+// Send pushes data to the receiver, where it is appended as a chunk with the
+// given label
+func (s *Sender) Send(label string, data []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return writeRemoteBuffer(s.w, label, data)
+}
+
+// Close closes the connection to the receiver if the sender writes to one
+func (s *Sender) Close() error {
+	if c, ok := s.w.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// receiveFrom appends the buffers of one sender to v until it disconnects or
+// sends something invalid. Its chunks are colored by the number of the sender
+// and labeled after it if they have no label of their own.
+func receiveFrom(v *Viewer, conn net.Conn, sender int) {
+	defer conn.Close()
+	color := markupColors[(sender-1)%len(markupColors)]
+	r := bufio.NewReader(conn)
+	for {
+		label, data, err := readRemoteBuffer(r)
+		if err != nil {
+			return
+		}
+		if label == "" {
+			label = fmt.Sprintf("sender %d", sender)
+		}
+		// Waiting for the viewer holds back the sender rather than
+		// dropping what it sends
+		v.program.Send(newChunkMsg(data, fmt.Sprintf("%s, %d bytes", label, len(data)), color))
+	}
+}
+
+// Receive accepts senders on l, such as those of DialSender or of another
+// process speaking the same protocol, and appends each buffer they push to
+// this viewer as a labeled chunk. Up to 16 senders are read from at once,
+// further ones are accepted as others disconnect. It blocks until l is closed
+// or the viewer exits, closing l then, and returns nil if the viewer exited.
+// Senders can push without end, so start the viewer WithMaxBufferSize to
+// keep only the latest bytes.
+func (v *Viewer) Receive(l net.Listener) error {
+	go func() {
+		<-v.done
+		l.Close()
+	}()
+	slots := make(chan struct{}, maxRemoteSenders)
+	for sender := 1; ; sender++ {
+		select {
+		case slots <- struct{}{}:
+		case <-v.done:
+			return nil
+		}
+		conn, err := l.Accept()
+		if err != nil {
+			select {
+			case <-v.done:
+				return nil
+			default:
+				return err
+			}
+		}
+		go func(sender int) {
+			defer func() { <-slots }()
+			receiveFrom(v, conn, sender)
+		}(sender)
+	}
+}
+
+// Receive accepts senders into the TUI started by StartTUI, see
+// Viewer.Receive
+func Receive(l net.Listener) error {
+	v := defaultViewer()
+	if v == nil {
+		return ErrNoViewer
+	}
+	return v.Receive(l)
+}
@@ -0,0 +1,135 @@
+package prettybuffers
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// remoteMessage returns a message as writeRemoteBuffer writes it, without
+// checking the limits
+func remoteMessage(label string, data []byte) []byte {
+	msg := binary.BigEndian.AppendUint32(nil, uint32(len(label)))
+	msg = append(msg, label...)
+	msg = binary.BigEndian.AppendUint32(msg, uint32(len(data)))
+	return append(msg, data...)
+}
+
+func TestWriteRemoteBuffer(t *testing.T) {
+	tests := []struct {
+		name  string
+		label string
+		data  []byte
+		err   error
+	}{
+		{"labeled", "app.log", []byte("hello"), nil},
+		{"no label", "", []byte{0x00, 0xFF}, nil},
+		{"empty", "empty", nil, nil},
+		{"largest", strings.Repeat("l", maxRemoteLabel), make([]byte, maxRemoteBuffer), nil},
+		{"label too long", strings.Repeat("l", maxRemoteLabel+1), []byte("x"), ErrRemoteTooLarge},
+		{"buffer too large", "big", make([]byte, maxRemoteBuffer+1), ErrRemoteTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var w bytes.Buffer
+			err := writeRemoteBuffer(&w, tt.label, tt.data)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("error is %v, want %v", err, tt.err)
+			}
+			if err != nil {
+				if w.Len() != 0 {
+					t.Errorf("wrote %d bytes of a message too large", w.Len())
+				}
+				return
+			}
+			if want := remoteMessage(tt.label, tt.data); !bytes.Equal(w.Bytes(), want) {
+				t.Errorf("wrote %d bytes, want %d", w.Len(), len(want))
+			}
+		})
+	}
+}
+
+func TestReadRemoteBuffer(t *testing.T) {
+	hello := remoteMessage("app.log", []byte("hello"))
+	tests := []struct {
+		name  string
+		data  []byte
+		label string
+		want  string
+		err   error
+	}{
+		{"message", hello, "app.log", "hello", nil},
+		{"no label", remoteMessage("", []byte{0x00, 0xFF}), "", "\x00\xFF", nil},
+		{"empty buffer", remoteMessage("empty", nil), "empty", "", nil},
+		{"end between messages", nil, "", "", io.EOF},
+		{"truncated label length", hello[:2], "", "", io.ErrUnexpectedEOF},
+		{"truncated label", hello[:6], "", "", io.ErrUnexpectedEOF},
+		{"end after label", hello[:11], "", "", io.ErrUnexpectedEOF},
+		{"truncated data length", hello[:13], "", "", io.ErrUnexpectedEOF},
+		{"truncated data", hello[:len(hello)-1], "", "", io.ErrUnexpectedEOF},
+		{"label too long", binary.BigEndian.AppendUint32(nil, maxRemoteLabel+1), "", "", ErrRemoteTooLarge},
+		{"buffer too large", binary.BigEndian.AppendUint32(remoteMessage("big", nil)[:7], maxRemoteBuffer+1), "", "", ErrRemoteTooLarge},
+		{"largest length", binary.BigEndian.AppendUint32(nil, 1<<32-1), "", "", ErrRemoteTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			label, data, err := readRemoteBuffer(bytes.NewReader(tt.data))
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("error is %v, want %v", err, tt.err)
+			}
+			if err != nil {
+				return
+			}
+			if label != tt.label || string(data) != tt.want {
+				t.Errorf("read %q: %q, want %q: %q", label, data, tt.label, tt.want)
+			}
+		})
+	}
+}
+
+// TestReadRemoteBufferSequence reads messages written one after another by a
+// Sender until the stream ends between them
+func TestReadRemoteBufferSequence(t *testing.T) {
+	var w bytes.Buffer
+	s := NewSender(&w)
+	want := []string{"first", "", "third"}
+	for _, data := range want {
+		if err := s.Send("seq", []byte(data)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	r := bytes.NewReader(w.Bytes())
+	for i, data := range want {
+		label, got, err := readRemoteBuffer(r)
+		if err != nil {
+			t.Fatalf("message %d: %v", i, err)
+		}
+		if label != "seq" || string(got) != data {
+			t.Errorf("message %d is %q: %q, want %q: %q", i, label, got, "seq", data)
+		}
+	}
+	if _, _, err := readRemoteBuffer(r); !errors.Is(err, io.EOF) {
+		t.Errorf("error after the last message is %v, want %v", err, io.EOF)
+	}
+}
+
+// TestReadRemoteBufferLyingLength makes sure a sender announcing the largest
+// buffer and sending a few bytes only gets memory for what arrived
+func TestReadRemoteBufferLyingLength(t *testing.T) {
+	msg := binary.BigEndian.AppendUint32(remoteMessage("liar", nil)[:8], maxRemoteBuffer)
+	msg = append(msg, "only this"...)
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	_, _, err := readRemoteBuffer(bytes.NewReader(msg))
+	runtime.ReadMemStats(&after)
+	if !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("error is %v, want %v", err, io.ErrUnexpectedEOF)
+	}
+	if n := after.TotalAlloc - before.TotalAlloc; n > 1<<20 {
+		t.Errorf("allocated %d bytes for a truncated message", n)
+	}
+}
@@ -0,0 +1,125 @@
+package prettybuffers
+
+import (
+	"fmt"
+	"sort"
+)
+
+// firstAddress returns the address shown for the first byte of the buffer,
+// counting on from the base address past the bytes discarded
+func (m model) firstAddress() uint64 {
+	return m.baseAddress + uint64(m.discarded)
+}
+
+// discardOldest drops bytes from the start of the buffer once appending grew
+// it past the size set by WithMaxBufferSize. Whole rows are dropped, or whole
+// frames with framing set, so that those after keep their bounds.
+func (m *model) discardOldest() {
+	if m.maxSize <= 0 || m.lazy || len(m.data) <= m.maxSize {
+		return
+	}
+	n := len(m.data) - m.maxSize
+	n = min(len(m.data), (n+m.bytesPerRow-1)/m.bytesPerRow*m.bytesPerRow)
+	if m.framing != nil {
+		i := sort.Search(len(m.frames), func(i int) bool { return m.frames[i].start >= n })
+		if i < len(m.frames) {
+			n = m.frames[i].start
+		}
+	}
+
+	m.data = m.data[n:]
+	m.discarded += n
+	m.shiftOffsets(0, -n)
+	m.cursor = max(0, m.cursor-n)
+	m.offset = max(0, m.offset-n)
+	m.entropyGen++
+
+	kept := m.jsonObjects[:0]
+	for _, o := range m.jsonObjects {
+		if o.startOffset >= n {
+			kept = append(kept, shiftObject(o, -n))
+		}
+	}
+	m.objectList.selected = max(0, m.objectList.selected-(len(m.jsonObjects)-len(kept)))
+	m.jsonObjects = kept
+	m.scanResume = max(0, m.scanResume-n)
+	m.interpretations = nil
+	m.search.object -= n
+	m.discardMatches(n)
+	if m.detection != nil {
+		m.detection.discard(n)
+	}
+	collapsed := make(map[int]bool, len(m.collapsed))
+	for off, c := range m.collapsed {
+		if off >= n {
+			collapsed[off-n] = c
+		}
+	}
+	m.collapsed = collapsed
+
+	m.chunks = discardFrames(m.chunks, n)
+	// The chunk cut off by the discarded bytes now starts the buffer
+	i := max(0, sort.Search(len(m.arrivals), func(i int) bool { return m.arrivals[i].start > n })-1)
+	m.arrivals = append([]arrival(nil), m.arrivals[i:]...)
+	for j := range m.arrivals {
+		m.arrivals[j].start = max(0, m.arrivals[j].start-n)
+	}
+	embedded := m.embedded[:0]
+	for _, e := range m.embedded {
+		if e.offset >= n {
+			e.offset -= n
+			embedded = append(embedded, e)
+		}
+	}
+	m.embedded = embedded
+	m.resplitFrames()
+	m.parseStructures()
+}
+
+// discardFrames drops the frames before n and moves the rest back by n,
+// cutting off the one n falls into
+func discardFrames(frames []frame, n int) []frame {
+	var kept []frame
+	for _, f := range frames {
+		if f.end > n {
+			cut := max(0, n-f.start)
+			kept = append(kept, frame{start: f.start + cut - n, end: f.end - n, header: max(0, f.header-cut)})
+		}
+	}
+	return kept
+}
+
+// discard drops the first n bytes of the data being scanned, as they were
+// dropped from the buffer. Chunks handed out before are moved back by n once
+// merged, see mergeDetected.
+func (d *detection) discard(n int) {
+	d.data = d.data[n:]
+	d.end = max(0, d.end-n)
+	d.merged = max(0, d.merged-n)
+	d.discarded += n
+}
+
+// shifted returns the objects found in a chunk moved back by n bytes, less
+// those that started before
+func (msg detectMsg) shifted(n int) detectMsg {
+	var objects []jsonObject
+	for _, o := range msg.objects {
+		if o.startOffset >= n {
+			objects = append(objects, shiftObject(o, -n))
+		}
+	}
+	msg.objects = objects
+	msg.from = max(0, msg.from-n)
+	msg.end = max(0, msg.end-n)
+	msg.resume = max(0, msg.resume-n)
+	return msg
+}
+
+// discardedInfo tells how much was discarded to keep the buffer within its
+// maximum size for the header, or returns "" if nothing was
+func (m model) discardedInfo() string {
+	if m.discarded == 0 {
+		return ""
+	}
+	return fmt.Sprintf("oldest %s discarded", formatSize(m.discarded))
+}
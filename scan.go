@@ -0,0 +1,280 @@
+package prettybuffers
+
+import (
+	"fmt"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+const (
+	// detectSyncSize is the largest buffer scanned for objects inside the
+	// event loop instead of in the background
+	detectSyncSize = 1 << 20
+	// detectChunkSize is how much more of the buffer each background step
+	// scans, keeping each one short
+	detectChunkSize = 1 << 20
+	// detectWindowMargin is how much is scanned before and after the visible
+	// rows right away, so that they show objects before the background scan
+	// gets to them
+	detectWindowMargin = 64 << 10
+	// editRescanDelay is how long editing has to pause before the edited
+	// bytes are scanned again, so that typing doesn't rescan on every key
+	editRescanDelay = 300 * time.Millisecond
+)
+
+// detection is a scan for objects running through the buffer in the
+// background, one chunk at a time
+type detection struct {
+	gen       int           // of the data scanned, see detectGen
+	data      []byte        // copy of the buffer, as edits change it in place
+	end       int           // of the data handed to the chunk last scanned
+	merged    int           // end of the data of the chunks merged so far
+	pending   bool          // a chunk is being scanned
+	discarded int           // bytes dropped from the start of data, see discardOldest
+	stop      chan struct{} // closed to give up on the chunk being scanned
+}
+
+// detectMsg delivers the objects found by scanning a chunk in the background
+type detectMsg struct {
+	gen       int
+	from      int // offset the chunk was scanned from
+	end       int // of the data scanned, up to and including the chunk
+	objects   []jsonObject
+	resume    int // offset objects that may continue past end start at
+	discarded int // of the detection when the chunk was handed out
+}
+
+// startDetection scans around the visible rows and leaves the rest of the
+// buffer to the background, see detectCmd. Until the background scan gets to
+// them the objects around the visible rows may be cut off or be part of
+// something larger.
+func (m *model) startDetection() {
+	start := max(0, m.offset-detectWindowMargin)
+	end := min(len(m.data), m.offset+m.visibleRows()*m.bytesPerRow+detectWindowMargin)
+	found, resume := m.detectObjects(m.data[:end], start)
+	m.jsonObjects = nil
+	for _, o := range found {
+		if o.startOffset < resume {
+			m.jsonObjects = append(m.jsonObjects, o)
+		}
+	}
+	m.scanResume = 0
+	m.detection = &detection{gen: m.detectGen, data: append([]byte(nil), m.data...), stop: make(chan struct{})}
+}
+
+// cancelDetection stops the detection running in the background, as the
+// buffer it scans was replaced or edited
+func (m *model) cancelDetection() {
+	if m.detection != nil {
+		close(m.detection.stop)
+		m.detection = nil
+	}
+}
+
+// progress describes how far the detection got, e.g. "Scanning… 42%"
+func (d *detection) progress() string {
+	return fmt.Sprintf("Scanning… %d%%", d.merged*100/max(1, len(d.data)))
+}
+
+// detectCmd scans the next chunk of the buffer in the background while a
+// detection is running and no chunk is being scanned
+func (m *model) detectCmd() tea.Cmd {
+	d := m.detection
+	if d == nil || d.pending {
+		return nil
+	}
+	d.pending = true
+	// Objects may continue past the chunk, so scan on from where the last
+	// one left off. The chunk grows with what is rescanned, so that an
+	// object cut off early doesn't get its bytes scanned again and again.
+	d.end = min(len(d.data), d.end+max(detectChunkSize, d.end-m.scanResume))
+	data, from, gen, stop, opts, discarded := d.data[:d.end], m.scanResume, d.gen, d.stop, m.detectOpts, d.discarded
+	return func() tea.Msg {
+		objects, resume, ok := scanObjectsUntil(data, from, opts, stop)
+		if !ok {
+			return nil
+		}
+		return detectMsg{gen: gen, from: from, end: len(data), objects: objects, resume: resume, discarded: discarded}
+	}
+}
+
+// mergeDetected replaces the objects from where a chunk was scanned from
+// with those it found. Those starting after where appended data must be
+// rescanned from are shown until the next chunk replaces them, as they may
+// be part of an object continuing past the chunk. Beyond the chunk, those
+// found around the visible rows are kept.
+func (m *model) mergeDetected(msg detectMsg) {
+	d := m.detection
+	if d == nil || msg.gen != d.gen {
+		// The buffer was replaced or edited since
+		return
+	}
+	if msg.discarded != d.discarded {
+		// The buffer lost its oldest bytes while the chunk was scanned
+		msg = msg.shifted(d.discarded - msg.discarded)
+	}
+	d.pending = false
+	d.merged = msg.end
+	done := msg.end == len(d.data)
+
+	var objects, rest []jsonObject
+	for _, o := range m.jsonObjects {
+		if o.startOffset < msg.from {
+			objects = append(objects, o)
+		} else if o.startOffset >= msg.end && !done {
+			rest = append(rest, o)
+		}
+	}
+	scanned := len(objects)
+	for _, o := range msg.objects {
+		if !overlapsAny(objects[:scanned], o) {
+			objects = append(objects, o)
+		}
+	}
+	scanned = len(objects)
+	for _, o := range rest {
+		if !overlapsAny(objects[:scanned], o) {
+			objects = append(objects, o)
+		}
+	}
+
+	m.jsonObjects = objects
+	m.scanResume = msg.resume
+	if done {
+		m.detection = nil
+	}
+	m.resplitFrames()
+}
+
+// editedRegion is the part of the buffer edited since objects were last
+// detected in it
+type editedRegion struct {
+	start, end int  // of the edited bytes, end exclusive
+	pending    bool // there were edits since the last rescan
+	gen        int  // bumped by every edit, so that only the last one rescans
+	ticked     int  // gen the last wait for a pause was started for
+}
+
+// editRescanMsg is sent once editing paused after the edit of a generation
+type editRescanMsg int
+
+// edited records that the n bytes at pos changed after delta bytes were
+// inserted (delta > 0) or deleted (delta < 0) there. The objects after them
+// move along right away and those cut into are dropped until editing pauses
+// and the region is scanned again, see rescanEdited.
+func (m *model) edited(pos, n, delta int) {
+	m.entropyGen++
+	m.interpretations = nil
+	r := &m.editRescan
+	shift := func(off int) int {
+		if off < pos {
+			return off
+		}
+		return max(pos, off+delta)
+	}
+	if r.pending {
+		r.start, r.end = min(shift(r.start), pos), max(shift(r.end), pos+n)
+	} else {
+		r.start, r.end, r.pending = pos, pos+n, true
+	}
+	r.gen++
+	if m.detection != nil {
+		// It scans a copy of the buffer from before the edit
+		m.cancelDetection()
+		r.start, r.end = 0, len(m.data)
+	}
+	if delta == 0 {
+		return
+	}
+
+	objects := m.jsonObjects[:0]
+	for _, o := range m.jsonObjects {
+		switch {
+		case o.endOffset < pos:
+			objects = append(objects, o)
+		case o.startOffset >= pos-min(delta, 0):
+			objects = append(objects, shiftObject(o, delta))
+		default:
+			// Its bytes changed, so it is scanned again with the edited ones
+			r.start, r.end = min(r.start, o.startOffset), max(r.end, shift(o.endOffset+1))
+		}
+	}
+	m.jsonObjects = objects
+	m.scanResume = shift(m.scanResume)
+}
+
+// editRescanCmd waits for editing to pause after the last edit
+func (m *model) editRescanCmd() tea.Cmd {
+	r := &m.editRescan
+	if !r.pending || r.ticked == r.gen {
+		return nil
+	}
+	r.ticked = r.gen
+	gen := r.gen
+	return tea.Tick(editRescanDelay, func(time.Time) tea.Msg {
+		return editRescanMsg(gen)
+	})
+}
+
+// rescanEdited brings what is detected up to date with the edits made since
+// the last rescan. Objects are only looked for again around the edited bytes,
+// and the whole buffer is rescanned if they grow to more than detectSyncSize.
+func (m *model) rescanEdited() {
+	r := &m.editRescan
+	r.pending = false
+	if m.detection != nil || len(m.data) > maxDetectSize {
+		m.rescan()
+		return
+	}
+	start, end := r.start, r.end
+	for _, o := range m.jsonObjects {
+		if o.startOffset < end && o.endOffset >= start {
+			start, end = min(start, o.startOffset), max(end, o.endOffset+1)
+		}
+	}
+	// An edit may also complete an object starting before it, such as by
+	// typing its closing brace
+	from := max(0, start-detectWindowMargin)
+	to := min(len(m.data), end+detectWindowMargin)
+	var found []jsonObject
+	resume := 0
+	for {
+		if to-from > detectSyncSize {
+			m.rescan()
+			return
+		}
+		found, resume = m.detectObjects(m.data[:to], from)
+		if resume >= to || to == len(m.data) {
+			break
+		}
+		// An object may continue past the bytes scanned
+		to = min(len(m.data), from+2*(to-from))
+	}
+
+	var objects []jsonObject
+	for _, o := range m.jsonObjects {
+		if o.startOffset < from {
+			objects = append(objects, o)
+		}
+	}
+	before := len(objects)
+	for _, o := range found {
+		if !overlapsAny(objects[:before], o) {
+			objects = append(objects, o)
+		}
+	}
+	scanned := len(objects)
+	for _, o := range m.jsonObjects {
+		if o.startOffset >= to && !overlapsAny(objects[:scanned], o) {
+			objects = append(objects, o)
+		}
+	}
+	m.jsonObjects = objects
+	if to == len(m.data) {
+		m.scanResume = resume
+	}
+	m.detectFileTypes()
+	m.resplitFrames()
+	m.refreshSearch()
+}
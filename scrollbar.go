@@ -0,0 +1,101 @@
+package prettybuffers
+
+import (
+	"strings"
+
+	"github.com/charmbracelet/lipgloss"
+)
+
+// Characters drawn in the scrollbar
+const (
+	scrollbarTrack  = "│"
+	scrollbarTick   = "■"
+	scrollbarObject = "◆"
+)
+
+// scrollbarHeaderLines is the number of view lines above the first data row
+const scrollbarHeaderLines = 4
+
+// scrollbarCell is what one row of the scrollbar shows
+type scrollbarCell struct {
+	thumb      bool
+	match      bool
+	object     bool
+	annotation *annotation
+}
+
+// scrollbar maps the buffer onto rows cells, marking the part in view and
+// where search matches, JSON objects and annotations are
+func (m model) scrollbar(rows int) []scrollbarCell {
+	cells := make([]scrollbarCell, rows)
+	size := m.size()
+	if size == 0 {
+		return cells
+	}
+	// mark sets the cells covering the bytes from start up to (not including) end
+	mark := func(start, end int, set func(c *scrollbarCell)) {
+		first := start * rows / size
+		last := max(first, (end-1)*rows/size)
+		for r := first; r <= last && r < rows; r++ {
+			set(&cells[r])
+		}
+	}
+
+	viewStart := m.offset - m.offset%m.bytesPerRow
+	mark(viewStart, min(size, viewStart+rows*m.bytesPerRow), func(c *scrollbarCell) { c.thumb = true })
+	for _, obj := range m.jsonObjects {
+		mark(obj.startOffset, obj.endOffset+1, func(c *scrollbarCell) { c.object = true })
+	}
+	for i := range m.annotations {
+		a := &m.annotations[i]
+		mark(a.start, a.end, func(c *scrollbarCell) { c.annotation = a })
+	}
+	for _, match := range m.search.matches {
+		mark(match.offset, match.offset+match.length, func(c *scrollbarCell) { c.match = true })
+	}
+	return cells
+}
+
+// render draws the cell; ticks take precedence over each other in the order
+// search match, annotation, JSON object, and are drawn on top of the thumb
+func (c scrollbarCell) render(theme Theme) string {
+	base := theme.Scrollbar
+	if c.thumb {
+		base = theme.ScrollbarThumb
+	}
+	switch {
+	case c.match:
+		return theme.ScrollbarMatch.Inherit(base).Render(scrollbarTick)
+	case c.annotation != nil:
+		return c.annotation.style.Inherit(base).Render(scrollbarTick)
+	case c.object:
+		return theme.ScrollbarObject.Inherit(base).Render(scrollbarObject)
+	case c.thumb:
+		return base.Render(" ")
+	}
+	return base.Render(scrollbarTrack)
+}
+
+// withScrollbar draws the scrollbar along the right edge of the data rows of
+// a rendered view
+func (m model) withScrollbar(view string, rows int) string {
+	lines := strings.Split(view, "\n")
+	footer := len(lines) - 2 // blank line and help text
+	if footer < scrollbarHeaderLines {
+		return view
+	}
+	// Pad the data rows so that the scrollbar always spans the full height
+	for footer < scrollbarHeaderLines+rows {
+		lines = append(lines[:footer+1], lines[footer:]...)
+		lines[footer] = ""
+		footer++
+	}
+
+	width := max(1, m.width-2)
+	clip := lipgloss.NewStyle().MaxWidth(width)
+	for i, cell := range m.scrollbar(rows) {
+		line := clip.Render(lines[scrollbarHeaderLines+i])
+		lines[scrollbarHeaderLines+i] = line + strings.Repeat(" ", width-lipgloss.Width(line)) + " " + cell.render(m.theme)
+	}
+	return strings.Join(lines, "\n")
+}
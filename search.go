@@ -0,0 +1,342 @@
+package prettybuffers
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/charmbracelet/lipgloss"
+)
+
+// searchMode selects how a search query is interpreted
+type searchMode int
+
+const (
+	// searchHex treats the query as a sequence of hex bytes, e.g. "DE AD BE EF"
+	searchHex searchMode = iota
+	// searchText treats the query as literal text
+	searchText
+	// searchRegex treats the query as a Go regular expression over the raw bytes
+	searchRegex
+	// searchJSONPath treats the query as a JSONPath selecting values of a
+	// detected JSON object, see startQuery
+	searchJSONPath
+)
+
+// searchMatch is one occurrence of the search pattern in the buffer
+type searchMatch struct {
+	offset int
+	length int
+}
+
+// searchState holds the active search and its results
+type searchState struct {
+	mode       searchMode
+	query      string
+	pattern    []byte
+	re         *regexp.Regexp
+	ignoreCase bool
+	matches    []searchMatch
+	current    int
+	path       []jsonPathStep // of a JSONPath query
+	object     int            // offset of the JSON object queried
+}
+
+// parseHexPattern parses a pattern like "DE AD BE EF" or "deadbeef" into bytes
+func parseHexPattern(query string) ([]byte, error) {
+	cleaned := strings.Join(strings.Fields(query), "")
+	cleaned = strings.TrimPrefix(strings.TrimPrefix(cleaned, "0x"), "0X")
+	if cleaned == "" {
+		return nil, fmt.Errorf("empty pattern")
+	}
+	pattern, err := hex.DecodeString(cleaned)
+	if err != nil {
+		return nil, fmt.Errorf("invalid hex pattern %q", query)
+	}
+	return pattern, nil
+}
+
+// findAllRegex returns the non-empty matches of re in data
+func findAllRegex(data []byte, re *regexp.Regexp) []searchMatch {
+	var matches []searchMatch
+	for _, loc := range re.FindAllIndex(data, -1) {
+		if loc[1] > loc[0] {
+			matches = append(matches, searchMatch{offset: loc[0], length: loc[1] - loc[0]})
+		}
+	}
+	return matches
+}
+
+// findAll returns the non-overlapping occurrences of pattern in data
+func findAll(data, pattern []byte) []searchMatch {
+	var matches []searchMatch
+	for pos := 0; pos < len(data); {
+		i := bytes.Index(data[pos:], pattern)
+		if i < 0 {
+			break
+		}
+		matches = append(matches, searchMatch{offset: pos + i, length: len(pattern)})
+		pos += i + len(pattern)
+	}
+	return matches
+}
+
+// foldASCII returns a copy of data with ASCII letters lowercased. Unlike
+// bytes.ToLower it never changes the length, so offsets stay valid.
+func foldASCII(data []byte) []byte {
+	folded := make([]byte, len(data))
+	for i, b := range data {
+		if b >= 'A' && b <= 'Z' {
+			b += 'a' - 'A'
+		}
+		folded[i] = b
+	}
+	return folded
+}
+
+// startSearch runs a new search and jumps to the first match at or after the current offset
+func (m *model) startSearch(mode searchMode, query string, ignoreCase bool) {
+	if !m.requireMemory("Search") {
+		return
+	}
+	var pattern []byte
+	var re *regexp.Regexp
+	var err error
+	switch mode {
+	case searchHex:
+		pattern, err = parseHexPattern(query)
+	case searchText:
+		if query == "" {
+			err = fmt.Errorf("empty pattern")
+		}
+		pattern = []byte(query)
+	case searchRegex:
+		re, err = regexp.Compile(query)
+		if err != nil {
+			err = fmt.Errorf("invalid regex: %v", err)
+		}
+	}
+	if err != nil {
+		m.status = err.Error()
+		return
+	}
+
+	m.search = searchState{mode: mode, query: query, pattern: pattern, re: re, ignoreCase: ignoreCase}
+	m.refreshSearch()
+	if len(m.search.matches) == 0 {
+		m.status = fmt.Sprintf("Pattern not found: %s", m.search.describe())
+		return
+	}
+
+	// Start at the first match that is not above the viewport
+	m.search.current = sort.Search(len(m.search.matches), func(i int) bool {
+		return m.search.matches[i].offset >= m.offset
+	}) % len(m.search.matches)
+	m.jumpToMatch()
+}
+
+// refreshSearch recomputes the matches of the active search after the data changed
+func (m *model) refreshSearch() {
+	switch {
+	case !m.search.active():
+		return
+	case m.search.path != nil:
+		m.search.matches = m.queryMatches()
+	default:
+		m.search.matches = m.search.find(m.data)
+	}
+	if m.search.current >= len(m.search.matches) {
+		m.search.current = 0
+	}
+}
+
+// regexSearchOverlap is how far before appended data a regular expression
+// is matched again, as its matches may go on into the appended bytes
+const regexSearchOverlap = 4 << 10
+
+// searchAppended finds the matches of the active search in the data appended
+// from start on, instead of searching the whole buffer again. Patterns are
+// looked for from len(pattern)-1 bytes before start, which finds the same
+// matches as searching everything; regular expressions from up to
+// regexSearchOverlap bytes before it.
+func (m *model) searchAppended(start int) {
+	s := &m.search
+	if !s.active() || s.path != nil {
+		// Queries only look at one object
+		m.refreshSearch()
+		return
+	}
+	from := max(0, start-len(s.pattern)+1)
+	kept := len(s.matches)
+	if s.re != nil {
+		// Matches near the end may now be longer
+		from = max(0, start-regexSearchOverlap)
+		for kept > 0 && s.matches[kept-1].offset >= from {
+			kept--
+		}
+	}
+	s.matches = s.matches[:kept]
+	if kept > 0 {
+		last := s.matches[kept-1]
+		from = max(from, last.offset+last.length)
+	}
+
+	for _, match := range s.find(m.data[from:]) {
+		match.offset += from
+		s.matches = append(s.matches, match)
+	}
+}
+
+// discardMatches drops the matches in the n bytes discarded from the start of
+// the buffer, which is already cut, and moves the others back. A match cut in
+// two may have hidden others overlapping it, so the start of the buffer is
+// searched again then, up to a match that lines up with one kept.
+func (m *model) discardMatches(n int) {
+	s := &m.search
+	cut := false
+	matches := s.matches[:0]
+	for _, match := range s.matches {
+		if match.offset >= n {
+			match.offset -= n
+			matches = append(matches, match)
+		} else if match.offset+match.length > n {
+			cut = true
+		}
+	}
+	s.current = max(0, s.current-(len(s.matches)-len(matches)))
+	s.matches = matches
+	if !cut || s.path != nil {
+		return
+	}
+	for k := 0; ; k = 2*k + 1 {
+		if k >= len(matches) {
+			s.matches = s.find(m.data)
+			break
+		}
+		// The matches after one found again are the same
+		last := matches[k]
+		found := s.find(m.data[:last.offset+last.length])
+		if len(found) > 0 && found[len(found)-1] == last {
+			s.matches = append(found, matches[k+1:]...)
+			break
+		}
+	}
+	s.current = max(0, min(s.current+len(s.matches)-len(matches), len(s.matches)-1))
+}
+
+// clearSearch removes the active search and its highlights
+func (m *model) clearSearch() {
+	m.search = searchState{}
+	m.status = ""
+}
+
+// nextMatch moves to the next (or previous, if backwards) match, wrapping around
+func (m *model) nextMatch(backwards bool) {
+	n := len(m.search.matches)
+	if n == 0 {
+		if m.search.active() {
+			m.status = fmt.Sprintf("Pattern not found: %s", m.search.describe())
+		}
+		return
+	}
+	if backwards {
+		m.search.current = (m.search.current - 1 + n) % n
+	} else {
+		m.search.current = (m.search.current + 1) % n
+	}
+	m.jumpToMatch()
+}
+
+// jumpToMatch scrolls the view to the current match
+func (m *model) jumpToMatch() {
+	match := m.search.matches[m.search.current]
+	m.offset = match.offset
+	m.cursor = match.offset
+	if m.search.path != nil {
+		m.status = fmt.Sprintf("Match %d/%d at %s for %s: %s", m.search.current+1, len(m.search.matches),
+			strings.TrimSpace(m.formatOffset(match.offset)), m.search.describe(), m.queryValue(match))
+		return
+	}
+	m.status = fmt.Sprintf("Match %d/%d at %s (%d bytes) for %s", m.search.current+1, len(m.search.matches),
+		strings.TrimSpace(m.formatOffset(match.offset)), match.length, m.search.describe())
+}
+
+// find returns the matches of the pattern or regular expression in data
+func (s searchState) find(data []byte) []searchMatch {
+	switch {
+	case s.re != nil:
+		return findAllRegex(data, s.re)
+	case s.ignoreCase:
+		return findAll(foldASCII(data), foldASCII(s.pattern))
+	}
+	return findAll(data, s.pattern)
+}
+
+// active reports whether a search has been run
+func (s searchState) active() bool {
+	return s.pattern != nil || s.re != nil || s.path != nil
+}
+
+// describe returns the query as shown in status messages
+func (s searchState) describe() string {
+	switch s.mode {
+	case searchHex, searchJSONPath:
+		return s.query
+	case searchRegex:
+		return "/" + s.query + "/"
+	}
+	return fmt.Sprintf("%q", s.query)
+}
+
+// matchAt returns the index of the match covering pos, or -1
+func (m model) matchAt(pos int) int {
+	matches := m.search.matches
+	i := sort.Search(len(matches), func(i int) bool {
+		return matches[i].offset+matches[i].length > pos
+	})
+	if i < len(matches) && matches[i].offset <= pos {
+		return i
+	}
+	return -1
+}
+
+// highlightText highlights occurrences of the search pattern inside a line of
+// already formatted text, used where content is not rendered byte by byte.
+// The rest of the line is rendered with base.
+func (m model) highlightText(line string, base lipgloss.Style) string {
+	if len(m.search.matches) == 0 || m.search.path != nil {
+		// Values selected by queries are not text to find in lines
+		return base.Render(line)
+	}
+	if m.search.re != nil {
+		return m.highlightMatches(line, findAllRegex([]byte(line), m.search.re), base)
+	}
+	needle := string(m.search.pattern)
+	if formatASCIIBytes(m.search.pattern) != needle {
+		return base.Render(line)
+	}
+
+	haystack := line
+	if m.search.ignoreCase {
+		haystack = string(foldASCII([]byte(line)))
+		needle = string(foldASCII([]byte(needle)))
+	}
+
+	return m.highlightMatches(line, findAll([]byte(haystack), []byte(needle)), base)
+}
+
+// highlightMatches styles the given ranges of line, rendering the rest with base
+func (m model) highlightMatches(line string, matches []searchMatch, base lipgloss.Style) string {
+	var sb strings.Builder
+	last := 0
+	for _, match := range matches {
+		sb.WriteString(base.Render(line[last:match.offset]))
+		sb.WriteString(m.theme.Match.Render(line[match.offset : match.offset+match.length]))
+		last = match.offset + match.length
+	}
+	sb.WriteString(base.Render(line[last:]))
+	return sb.String()
+}
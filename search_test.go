@@ -0,0 +1,38 @@
+package prettybuffers
+
+import (
+	"regexp"
+	"slices"
+	"testing"
+	"time"
+)
+
+// TestSearchAppended checks that searching only the appended data finds the
+// same matches as searching the whole buffer, also for matches split across
+// chunks and cut by discarding the oldest bytes
+func TestSearchAppended(t *testing.T) {
+	chunks := []string{"xaaa", "xxnee", "dlexxNEEDLEneedle", "ne", "ed", "le", "aaaa", "aab", "bbneedleneedl", "eaab"}
+	searches := map[string]searchState{
+		"pattern":     {pattern: []byte("needle")},
+		"overlapping": {pattern: []byte("aa")},
+		"ignore case": {pattern: []byte("needle"), ignoreCase: true},
+		"regex":       {re: regexp.MustCompile(`a+b+`)},
+	}
+	for name, search := range searches {
+		for maxSize := range 24 {
+			m := initialModel(config{maxSize: maxSize})
+			m.bytesPerRow = 1
+			m.setData(nil)
+			m.search = search
+			for i, chunk := range chunks {
+				m.appendStreamed([]byte(chunk), time.Now())
+				m.discardOldest()
+				want := m.search.find(m.data)
+				if !slices.Equal(m.search.matches, want) {
+					t.Errorf("%s, keeping %d bytes: after chunk %d of %q found %v, want %v", name, maxSize, i, m.data, m.search.matches, want)
+					break
+				}
+			}
+		}
+	}
+}
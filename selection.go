@@ -0,0 +1,141 @@
+package prettybuffers
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/aymanbagabas/go-osc52/v2"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// selection is a range of bytes between an anchor and the cursor
+type selection struct {
+	active bool
+	anchor int
+}
+
+// bounds returns the first and last selected offset for the given cursor
+func (s selection) bounds(cursor int) (int, int) {
+	return min(s.anchor, cursor), max(s.anchor, cursor)
+}
+
+// contains reports whether pos is selected for the given cursor
+func (s selection) contains(pos, cursor int) bool {
+	start, end := s.bounds(cursor)
+	return pos >= start && pos <= end
+}
+
+// selectedBytes returns the bytes covered by the selection
+func (m model) selectedBytes() []byte {
+	if !m.selection.active || m.size() == 0 {
+		return nil
+	}
+	start, end := m.selection.bounds(m.cursor)
+	return m.window(start, end-start+1)
+}
+
+// startSelection begins selecting at the cursor
+func (m *model) startSelection() {
+	if m.size() == 0 {
+		return
+	}
+	m.placeCursorInView()
+	m.selection = selection{active: true, anchor: m.cursor}
+	m.status = "Select with the arrow keys or h/j/k/l, 'y' to copy, '#' to hash, 'x' or 'd' to delete, esc to cancel"
+}
+
+// moveCursor moves the cursor by delta bytes, clamped to the buffer, and
+// scrolls the view so that it stays visible
+func (m *model) moveCursor(delta int) {
+	m.cursor = max(0, min(m.cursor+delta, m.cursorLimit()))
+	if m.inSmartView() && m.size() > 0 {
+		m.scrollSmartView()
+		return
+	}
+
+	rows := m.visibleRows()
+	rowStart := m.cursor - (m.cursor % m.bytesPerRow)
+	viewStart := m.offset - (m.offset % m.bytesPerRow)
+	if rowStart < viewStart {
+		m.offset = rowStart
+	} else if rowStart >= viewStart+rows*m.bytesPerRow {
+		m.offset = rowStart - (rows-1)*m.bytesPerRow
+	}
+}
+
+// copyFormat is a textual representation used when copying bytes
+type copyFormat struct {
+	key    string
+	name   string
+	encode func([]byte) string
+}
+
+// copyFormats lists the representations offered after pressing 'y'
+var copyFormats = []copyFormat{
+	{key: "h", name: "hex", encode: hex.EncodeToString},
+	{key: "s", name: "spaced hex", encode: formatSpacedHex},
+	{key: "b", name: "base64", encode: base64.StdEncoding.EncodeToString},
+	{key: "g", name: "Go string", encode: func(data []byte) string {
+		return fmt.Sprintf("%q", data)
+	}},
+	{key: "G", name: "Go []byte", encode: formatGoBytes},
+	{key: "c", name: "C array", encode: formatCArray},
+	{key: "p", name: "Python bytes", encode: formatPythonBytes},
+}
+
+// formatSpacedHex formats bytes as upper case hex pairs separated by spaces
+func formatSpacedHex(data []byte) string {
+	parts := make([]string, len(data))
+	for i, b := range data {
+		parts[i] = fmt.Sprintf("%02X", b)
+	}
+	return strings.Join(parts, " ")
+}
+
+// copyFormatHelp lists the copy formats and their keys for the status line
+func copyFormatHelp() string {
+	parts := make([]string, len(copyFormats))
+	for i, f := range copyFormats {
+		parts[i] = fmt.Sprintf("[%s] %s", f.key, f.name)
+	}
+	return "Copy as: " + strings.Join(parts, ", ")
+}
+
+// copySelection copies the selection in the format bound to key
+func (m *model) copySelection(key string) tea.Cmd {
+	data := m.selectedBytes()
+	for _, f := range copyFormats {
+		if f.key != key {
+			continue
+		}
+		m.selection = selection{}
+		m.status = fmt.Sprintf("Copied %d bytes as %s", len(data), f.name)
+		return m.copyToClipboard(f.encode(data))
+	}
+	m.status = "Copy cancelled"
+	return nil
+}
+
+// copyToClipboard sets the system clipboard through an OSC52 escape sequence,
+// which the terminal handles even when the program runs over SSH. Sessions
+// served by package sshserve set the clipboard of their client, see
+// WithClipboard.
+func (m *model) copyToClipboard(text string) tea.Cmd {
+	w := m.clipboard
+	return func() tea.Msg {
+		seq := osc52.New(text)
+		if w == nil {
+			w = os.Stderr
+			if os.Getenv("TMUX") != "" {
+				seq = seq.Tmux()
+			} else if strings.HasPrefix(os.Getenv("TERM"), "screen") {
+				seq = seq.Screen()
+			}
+		}
+		_, _ = seq.WriteTo(w)
+		return nil
+	}
+}
@@ -0,0 +1,237 @@
+package prettybuffers
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// inSmartView reports whether the layout is shown by the Smart View, which
+// lays out objects as prettified lines rather than in rows of bytes
+func (m model) inSmartView() bool {
+	return len(m.layout.Renderers) == 0 && containsColumn(m.layout.Columns, ColumnJSON)
+}
+
+// smartColumns returns how many bytes the Smart View shows per row between
+// objects, and how wide its hex column is
+func (m model) smartColumns() (hexBytesPerRow, maxHexColWidth int) {
+	// Use a responsive hex column based on terminal width
+	hexBytesPerRow = 8 // Default
+	if m.width > 100 {
+		hexBytesPerRow = 16
+	} else if m.width < 80 {
+		hexBytesPerRow = 4
+	}
+
+	// Default minimum width to ensure sufficient space. Other objects are
+	// split to fit whatever width the column gets.
+	maxHexColWidth = 65
+	for _, obj := range m.jsonObjects {
+		// Each byte needs 3 characters in hex (2 for hex, 1 for space)
+		maxHexColWidth = max(maxHexColWidth, obj.prettyWidth*3)
+	}
+	// Ensure the column width is reasonable
+	return hexBytesPerRow, min(maxHexColWidth, m.width/2)
+}
+
+// lineOffset returns the offset shown for line i of an object that isn't
+// shown as a tree. Such lines don't map to the bytes exactly, so each gets
+// the bytes in order, perLine at a time.
+func (o jsonObject) lineOffset(i, perLine int) int {
+	return o.startOffset + min(i*perLine, len(o.data)-1)
+}
+
+// objectLineStarts returns the offsets of the lines the Smart View shows obj
+// in, in increasing order. Lines past the bytes of the object share the
+// offset of its last byte, and are listed once.
+func (m model) objectLineStarts(obj jsonObject, perLine int) []int {
+	if obj.tree != nil {
+		var starts []int
+		for _, line := range jsonTreeLines(obj, m.collapsed) {
+			starts = append(starts, obj.startOffset+line.start)
+		}
+		return starts
+	}
+	lines, err := obj.lines(perLine)
+	if err != nil || len(lines) == 0 {
+		return []int{obj.startOffset}
+	}
+	starts := []int{obj.startOffset}
+	for i := 1; i < len(lines); i++ {
+		if off := obj.lineOffset(i, perLine); off > starts[len(starts)-1] {
+			starts = append(starts, off)
+		}
+	}
+	return starts
+}
+
+// smartStretch is an object, or a gap between objects, as the Smart View
+// lays it out in lines
+type smartStretch struct {
+	start, end int   // end is exclusive
+	starts     []int // of the lines of an object, nil in gaps
+	rowBytes   int   // bytes per line in gaps, counted from start
+}
+
+// stretchAt returns the stretch of the Smart View holding pos
+func (m model) stretchAt(pos int) smartStretch {
+	hexBytesPerRow, maxHexColWidth := m.smartColumns()
+	if i := m.objectAt(pos); i >= 0 {
+		obj := m.jsonObjects[i]
+		return smartStretch{start: obj.startOffset, end: obj.endOffset + 1,
+			starts: m.objectLineStarts(obj, max(1, maxHexColWidth/3))}
+	}
+	s := smartStretch{end: m.size(), rowBytes: hexBytesPerRow}
+	i := sort.Search(len(m.jsonObjects), func(i int) bool { return m.jsonObjects[i].startOffset > pos })
+	if i > 0 {
+		s.start = m.jsonObjects[i-1].endOffset + 1
+	}
+	if i < len(m.jsonObjects) {
+		s.end = m.jsonObjects[i].startOffset
+	}
+	if m.payloadsOnly {
+		// The gap is skipped in a single line
+		s.rowBytes = max(1, s.end-s.start)
+	}
+	return s
+}
+
+// lineCount returns how many lines the stretch takes
+func (s smartStretch) lineCount() int {
+	if s.starts != nil {
+		return len(s.starts)
+	}
+	return max(1, (s.end-s.start+s.rowBytes-1)/s.rowBytes)
+}
+
+// lineStart returns the offset line i of the stretch starts at
+func (s smartStretch) lineStart(i int) int {
+	if s.starts != nil {
+		return s.starts[i]
+	}
+	return s.start + i*s.rowBytes
+}
+
+// lineIndex returns the index of the line showing pos
+func (s smartStretch) lineIndex(pos int) int {
+	if s.starts != nil {
+		return max(0, sort.SearchInts(s.starts, pos+1)-1)
+	}
+	return (pos - s.start) / s.rowBytes
+}
+
+// smartLineStart returns the offset of the Smart View line showing pos
+func (m model) smartLineStart(pos int) int {
+	s := m.stretchAt(pos)
+	return s.lineStart(s.lineIndex(pos))
+}
+
+// smartLineStep returns the offset of the Smart View line n lines below the
+// one showing pos, or above it for negative n, stopping at the first and
+// last lines
+func (m model) smartLineStep(pos, n int) int {
+	s := m.stretchAt(pos)
+	i := s.lineIndex(pos)
+	for n > 0 && i+n >= s.lineCount() {
+		if s.end >= m.size() {
+			return s.lineStart(s.lineCount() - 1)
+		}
+		// Moving on to the first line of the next stretch
+		n -= s.lineCount() - i
+		s, i = m.stretchAt(s.end), 0
+	}
+	for n < 0 && i+n < 0 {
+		if s.start == 0 {
+			return s.lineStart(0)
+		}
+		// Moving back to the last line of the previous stretch
+		n += i + 1
+		s = m.stretchAt(s.start - 1)
+		i = s.lineCount() - 1
+	}
+	return s.lineStart(i + n)
+}
+
+// scrollSmartView scrolls the Smart View just enough to show the line of the
+// cursor
+func (m *model) scrollSmartView() {
+	line := m.smartLineStart(m.cursor)
+	if line < m.offset {
+		m.offset = line
+	} else if top := m.smartLineStep(line, -(m.visibleRows() - 1)); top > m.offset {
+		m.offset = top
+	}
+}
+
+// moveLines moves the cursor n rows down, or up for negative n. In the Smart
+// View these are its lines, and the cursor goes to the start of one.
+func (m *model) moveLines(n int) {
+	if !m.inSmartView() || m.size() == 0 {
+		m.moveCursor(n * m.bytesPerRow)
+		return
+	}
+	m.moveCursor(m.smartLineStep(m.cursor, n) - m.cursor)
+}
+
+// lineBounds returns the first and last offsets of the row of the cursor,
+// or of its line in the Smart View
+func (m model) lineBounds() (int, int) {
+	if !m.inSmartView() || m.size() == 0 {
+		start := m.cursor - m.cursor%m.bytesPerRow
+		return start, start + m.bytesPerRow - 1
+	}
+	start := m.smartLineStart(m.cursor)
+	s := m.stretchAt(m.cursor)
+	if i := s.lineIndex(m.cursor); i+1 < s.lineCount() {
+		return start, s.lineStart(i+1) - 1
+	}
+	return start, s.end - 1
+}
+
+// scrollSmartPages scrolls the Smart View by whole pages of lines and moves
+// the cursor along, like scrollPages does in the other views
+func (m *model) scrollSmartPages(pages int) {
+	rows := m.visibleRows()
+	lastPage := m.smartLineStep(m.size()-1, -(rows - 1))
+	m.offset = min(m.smartLineStep(m.offset, pages*rows), max(lastPage, m.smartLineStart(m.offset)))
+	m.cursor = m.smartLineStep(m.cursor, pages*rows)
+	m.moveCursor(0)
+}
+
+// showLineBytes switches from the Smart View to the first layout showing
+// plain rows of bytes, with the bytes of the line of the cursor selected
+func (m *model) showLineBytes() {
+	if !m.inSmartView() || m.size() == 0 {
+		m.status = "Only lines of the Smart View have bytes to show"
+		return
+	}
+	start, end := m.lineBounds()
+	for i := 0; i < layoutCount(); i++ {
+		layout, _ := layoutAt(i)
+		if len(layout.Renderers) > 0 || !containsColumn(layout.Columns, ColumnHex) ||
+			containsColumn(layout.Columns, ColumnJSON) {
+			continue
+		}
+		m.setLayout(i, layout)
+		m.selection = selection{active: true, anchor: start}
+		m.cursor = end
+		m.moveCursor(0)
+		m.status = fmt.Sprintf("Bytes %s-%s of the line, %d in all", strings.TrimSpace(m.formatOffset(start)),
+			strings.TrimSpace(m.formatOffset(end)), end-start+1)
+		return
+	}
+	m.status = "No layout shows rows of bytes"
+}
+
+// clickSmartLine moves the cursor to the start of the Smart View line under a
+// mouse click
+func (m *model) clickSmartLine(msg tea.MouseMsg) {
+	row := msg.Y - scrollbarHeaderLines
+	if !m.inSmartView() || m.size() == 0 || msg.Action != tea.MouseActionPress ||
+		msg.Button != tea.MouseButtonLeft || row < 0 || row >= m.visibleRows() || msg.X >= m.dataWidth() {
+		return
+	}
+	m.moveCursor(m.smartLineStep(min(m.offset, m.size()-1), row) - m.cursor)
+}
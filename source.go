@@ -0,0 +1,169 @@
+package prettybuffers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// maxInMemorySize is the largest DataSource that is read into memory as a
+// whole. Larger sources are read lazily, one visible window at a time, and
+// features that need the whole buffer (search, editing, detection) are off.
+const maxInMemorySize = 64 << 20
+
+// windowCacheSize is the minimum number of bytes read at once from a lazy source
+const windowCacheSize = 64 << 10
+
+// DataSource provides random access to the bytes shown in a viewer. It lets
+// the viewer display files, remote ranges or generated data without holding
+// all of it in memory.
+type DataSource interface {
+	// Len returns the total number of bytes in the source
+	Len() int64
+	// ReadAt reads len(p) bytes starting at off, as defined by io.ReaderAt
+	ReadAt(p []byte, off int64) (n int, err error)
+}
+
+// bytesSource is a DataSource backed by a byte slice
+type bytesSource []byte
+
+func (b bytesSource) Len() int64 {
+	return int64(len(b))
+}
+
+func (b bytesSource) ReadAt(p []byte, off int64) (int, error) {
+	if off >= int64(len(b)) {
+		return 0, io.EOF
+	}
+	n := copy(p, b[off:])
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// Bytes returns the underlying slice, letting the viewer skip copying it
+func (b bytesSource) Bytes() []byte {
+	return b
+}
+
+// sectionSource is a DataSource reading from an io.ReaderAt of known size
+type sectionSource struct {
+	r    io.ReaderAt
+	size int64
+}
+
+func (s sectionSource) Len() int64 {
+	return s.size
+}
+
+func (s sectionSource) ReadAt(p []byte, off int64) (int, error) {
+	return io.NewSectionReader(s.r, 0, s.size).ReadAt(p, off)
+}
+
+// SectionSource returns a DataSource reading size bytes from r, such as an
+// *os.File or a reader for a remote range
+func SectionSource(r io.ReaderAt, size int64) DataSource {
+	return sectionSource{r: r, size: size}
+}
+
+// sourceMsg replaces the buffer with the contents of a DataSource
+type sourceMsg struct {
+	src  DataSource
+	data []byte // contents of src when it fits in memory
+	lazy bool   // src is too large to hold in memory and is read on demand
+}
+
+// loadSource prepares src for display, reading it into memory if it is small
+// enough. It runs outside the event loop so that slow sources don't block the UI.
+func loadSource(src DataSource) (sourceMsg, error) {
+	if b, ok := src.(interface{ Bytes() []byte }); ok {
+		return sourceMsg{src: src, data: b.Bytes()}, nil
+	}
+	if src.Len() > maxInMemorySize {
+		return sourceMsg{src: src, lazy: true}, nil
+	}
+
+	data := make([]byte, src.Len())
+	n, err := src.ReadAt(data, 0)
+	if err != nil && !(errors.Is(err, io.EOF) && n == len(data)) {
+		return sourceMsg{}, fmt.Errorf("reading source: %w", err)
+	}
+	return sourceMsg{src: src, data: data}, nil
+}
+
+// windowCache holds the bytes last read from a lazy source. It is shared by
+// all copies of a model, since View works on a value receiver.
+type windowCache struct {
+	off  int
+	data []byte
+}
+
+// size returns the number of bytes in the buffer
+func (m model) size() int {
+	if m.lazy {
+		return int(m.src.Len())
+	}
+	return len(m.data)
+}
+
+// window returns up to n bytes of the buffer starting at off
+func (m model) window(off, n int) []byte {
+	size := m.size()
+	if off < 0 || off >= size || n <= 0 {
+		return nil
+	}
+	n = min(n, size-off)
+	if !m.lazy {
+		return m.data[off : off+n]
+	}
+
+	c := m.cache
+	if off < c.off || off+n > c.off+len(c.data) {
+		c.off = off
+		c.data = make([]byte, min(max(n, windowCacheSize), size-off))
+		read, _ := m.src.ReadAt(c.data, int64(off))
+		c.data = c.data[:read]
+	}
+	start := off - c.off
+	return c.data[start:min(start+n, len(c.data))]
+}
+
+// requireMemory reports whether the whole buffer is in memory, setting a
+// status message naming the feature if it isn't
+func (m *model) requireMemory(feature string) bool {
+	if m.lazy {
+		m.status = fmt.Sprintf("%s is not available for sources larger than %d MiB", feature, maxInMemorySize>>20)
+		return false
+	}
+	return true
+}
+
+// requireWritable reports whether the buffer may be changed or saved, or
+// else shows that the feature is disabled
+func (m *model) requireWritable(feature string) bool {
+	if m.readOnly {
+		m.status = feature + " is disabled in read-only mode"
+		return false
+	}
+	return true
+}
+
+// ShowSource displays the contents of src in this viewer
+func (v *Viewer) ShowSource(src DataSource) error {
+	msg, err := loadSource(src)
+	if err != nil {
+		return err
+	}
+	v.program.Send(msg)
+	return nil
+}
+
+// ShowSource displays the contents of src in the TUI started by StartTUI
+func ShowSource(src DataSource) error {
+	v := defaultViewer()
+	if v == nil {
+		return ErrNoViewer
+	}
+	return v.ShowSource(src)
+}
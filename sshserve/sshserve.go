@@ -0,0 +1,292 @@
+// Package sshserve serves the viewer of package prettybuffers over SSH, so
+// that the buffers of a process running on a remote server can be inspected
+// live with `ssh host -p 2222`. It is kept apart so that programs not serving
+// over SSH don't have to build the SSH stack along with the viewer.
+package sshserve
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"sync"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/ssh"
+	"github.com/charmbracelet/wish"
+	"github.com/charmbracelet/wish/activeterm"
+	bm "github.com/charmbracelet/wish/bubbletea"
+	"github.com/fipso/prettybuffers"
+	"github.com/muesli/termenv"
+)
+
+// defaultHostKeyPath is where Serve keeps its host key unless told
+// otherwise, generating one if it doesn't exist
+const defaultHostKeyPath = "prettybuffers_ed25519"
+
+// maxSessionBacklog is how many updates a session may fall behind by before
+// they are replaced by the whole buffer
+const maxSessionBacklog = 256
+
+// Option configures a server started with Serve
+type Option func(*config)
+
+// config holds the settings collected from Options
+type config struct {
+	hostKeyPath    string
+	authorizedKeys string
+	viewer         []prettybuffers.Option
+}
+
+// WithHostKeyPath sets the file holding the host key of the server, which is
+// generated if it doesn't exist (default "prettybuffers_ed25519")
+func WithHostKeyPath(path string) Option {
+	return func(c *config) {
+		c.hostKeyPath = path
+	}
+}
+
+// WithAuthorizedKeys only lets in the users whose public keys are listed in
+// the given authorized_keys file. Without it anyone who can reach the address
+// can connect, so only leave it out when listening on localhost.
+func WithAuthorizedKeys(path string) Option {
+	return func(c *config) {
+		c.authorizedKeys = path
+	}
+}
+
+// WithViewerOptions configures the viewer of each session, such as its
+// initial layout or theme
+func WithViewerOptions(opts ...prettybuffers.Option) Option {
+	return func(c *config) {
+		c.viewer = append(c.viewer, opts...)
+	}
+}
+
+// Server serves a buffer over SSH. Everyone who connects gets a viewer of
+// their own, showing the buffer as it is and then as it changes.
+type Server struct {
+	server   *ssh.Server
+	listener net.Listener
+	options  []prettybuffers.Option
+
+	mu       sync.Mutex // guards data and sessions, and orders the updates queued for them
+	data     []byte
+	sessions map[*tea.Program]*session
+}
+
+// Serve listens on addr, e.g. "localhost:2222", and serves the viewer to
+// every SSH session with a terminal. Listening on other interfaces than
+// localhost calls for WithAuthorizedKeys. Sessions are read-only and can't
+// open or save files on the server. Fill the buffer with ShowBytes,
+// AppendBytes or Writer of the returned server.
+//
+// As a server has no terminal to detect colors from, Serve enables 256
+// colors if the process would otherwise render none.
+func Serve(addr string, opts ...Option) (*Server, error) {
+	cfg := config{hostKeyPath: defaultHostKeyPath}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	s := &Server{
+		// Remote sessions must not change the buffer nor touch files here
+		options:  append(cfg.viewer, prettybuffers.WithReadOnly(true), prettybuffers.WithRemote(true)),
+		sessions: make(map[*tea.Program]*session),
+	}
+
+	serverOpts := []ssh.Option{
+		wish.WithAddress(addr),
+		wish.WithHostKeyPath(cfg.hostKeyPath),
+		wish.WithMiddleware(
+			bm.MiddlewareWithProgramHandler(s.newSession, termenv.ANSI256),
+			activeterm.Middleware(),
+		),
+	}
+	if cfg.authorizedKeys != "" {
+		serverOpts = append(serverOpts, wish.WithAuthorizedKeys(cfg.authorizedKeys))
+	}
+	server, err := wish.NewServer(serverOpts...)
+	if err != nil {
+		return nil, fmt.Errorf("starting SSH server: %w", err)
+	}
+	// Listen here rather than in the background so that a taken port is
+	// reported to the caller
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("starting SSH server: %w", err)
+	}
+	s.server, s.listener = server, listener
+
+	if lipgloss.ColorProfile() == termenv.Ascii {
+		lipgloss.SetColorProfile(termenv.ANSI256)
+	}
+	go func() {
+		_ = server.Serve(listener)
+	}()
+	return s, nil
+}
+
+// showMsg replaces the buffer of a session
+type showMsg []byte
+
+// appendMsg appends to the buffer of a session
+type appendMsg []byte
+
+// sessionModel is the viewer of a session: the component of package
+// prettybuffers, sized by the terminal of the session and ending it on the
+// Quit key
+type sessionModel struct {
+	hex  prettybuffers.Model
+	quit *bool // set once the user quits
+}
+
+// Init implements tea.Model
+func (m sessionModel) Init() tea.Cmd {
+	return m.hex.Init()
+}
+
+// Update implements tea.Model
+func (m sessionModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.hex.SetSize(msg.Width, msg.Height)
+		return m, nil
+	case showMsg:
+		m.hex.SetData(msg)
+		return m, nil
+	case appendMsg:
+		m.hex.AppendData(msg)
+		return m, nil
+	}
+	next, cmd := m.hex.Update(msg)
+	m.hex = next.(prettybuffers.Model)
+	if *m.quit {
+		return m, tea.Quit
+	}
+	return m, cmd
+}
+
+// View implements tea.Model
+func (m sessionModel) View() string {
+	return m.hex.View()
+}
+
+// session hands the updates of the buffer to the program of a session in
+// order, so that a session falling behind holds up neither the producer nor
+// the other sessions
+type session struct {
+	p       *tea.Program
+	mu      sync.Mutex
+	pending []tea.Msg
+	wake    chan struct{} // signaled when updates are queued
+}
+
+// queue adds an update for the session. Once it fell too far behind, what is
+// pending is replaced by the whole buffer, data, which the update is part of.
+func (q *session) queue(msg tea.Msg, data []byte) {
+	q.mu.Lock()
+	if len(q.pending) < maxSessionBacklog {
+		q.pending = append(q.pending, msg)
+	} else {
+		q.pending = []tea.Msg{showMsg(append([]byte(nil), data...))}
+	}
+	q.mu.Unlock()
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+// run sends the queued updates to the program until done is closed
+func (q *session) run(done <-chan struct{}) {
+	for {
+		select {
+		case <-q.wake:
+		case <-done:
+			return
+		}
+		q.mu.Lock()
+		pending := q.pending
+		q.pending = nil
+		q.mu.Unlock()
+		for _, msg := range pending {
+			q.p.Send(msg)
+		}
+	}
+}
+
+// newSession returns the program showing the buffer to a new session
+func (s *Server) newSession(sess ssh.Session) *tea.Program {
+	quit := new(bool)
+	opts := append(s.options[:len(s.options):len(s.options)],
+		prettybuffers.WithClipboard(sess.Stderr()), prettybuffers.OnQuit(func() { *quit = true }))
+	m := sessionModel{hex: prettybuffers.NewModel(opts...), quit: quit}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	m.hex.SetData(s.data)
+	p := tea.NewProgram(m, append(bm.MakeOptions(sess), tea.WithAltScreen())...)
+	q := &session{p: p, wake: make(chan struct{}, 1)}
+	s.sessions[p] = q
+	go q.run(sess.Context().Done())
+	go func() {
+		<-sess.Context().Done()
+		s.mu.Lock()
+		delete(s.sessions, p)
+		s.mu.Unlock()
+	}()
+	return p
+}
+
+// Addr returns the address the server listens on, useful when it was started
+// on port 0
+func (s *Server) Addr() net.Addr {
+	return s.listener.Addr()
+}
+
+// ShowBytes replaces the buffer shown to every session, current and future
+func (s *Server) ShowBytes(data []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data = append([]byte(nil), data...)
+	for _, q := range s.sessions {
+		q.queue(showMsg(s.data), s.data)
+	}
+}
+
+// AppendBytes appends data to the buffer shown to every session. The data is
+// copied, so the caller may reuse it once AppendBytes returns.
+func (s *Server) AppendBytes(data []byte) {
+	if len(data) == 0 {
+		return
+	}
+	data = append([]byte(nil), data...)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data = append(s.data, data...)
+	for _, q := range s.sessions {
+		q.queue(appendMsg(data), s.data)
+	}
+}
+
+// writer appends whatever is written to it to the buffer of a server
+type writer struct {
+	s *Server
+}
+
+// Write implements io.Writer
+func (w writer) Write(p []byte) (int, error) {
+	w.s.AppendBytes(p)
+	return len(p), nil
+}
+
+// Writer returns a writer that appends everything written to it to the
+// buffer shown to every session, e.g. io.MultiWriter(conn, server.Writer())
+func (s *Server) Writer() io.Writer {
+	return writer{s: s}
+}
+
+// Close stops the server and ends every session
+func (s *Server) Close() error {
+	return s.server.Close()
+}
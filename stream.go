@@ -0,0 +1,192 @@
+package prettybuffers
+
+import (
+	"errors"
+	"io"
+	"time"
+)
+
+// readChunkSize is how many bytes ShowReader reads before updating the view
+const readChunkSize = 32 * 1024
+
+// ErrNoViewer is returned by package-level functions when StartTUI has not been called
+var ErrNoViewer = errors.New("prettybuffers: no viewer running")
+
+// ErrViewerExited is returned when data can't be shown as the viewer has exited
+var ErrViewerExited = errors.New("prettybuffers: viewer has exited")
+
+// ShowReader reads r until EOF, updating the view after every chunk so that
+// live data (pipes, sockets, files being written) shows up as it arrives.
+// It blocks until r is exhausted or the viewer exits and returns any read
+// error other than io.EOF.
+func (v *Viewer) ShowReader(r io.Reader) error {
+	chunk := make([]byte, readChunkSize)
+	first := true
+
+	for {
+		n, err := r.Read(chunk)
+		if n > 0 {
+			select {
+			case <-v.done:
+				return nil
+			default:
+			}
+			// The first chunk replaces whatever was shown before
+			v.program.Send(appendMsg{data: append([]byte(nil), chunk[:n]...), at: time.Now(), replace: first})
+			first = false
+		}
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// ShowReader streams r into the TUI started by StartTUI
+func ShowReader(r io.Reader) error {
+	v := defaultViewer()
+	if v == nil {
+		return ErrNoViewer
+	}
+	return v.ShowReader(r)
+}
+
+// appendData appends data to the buffer and runs detection on the new tail
+func (m *model) appendData(data []byte) {
+	if !m.requireMemory("Appending") {
+		return
+	}
+	if !m.ownsData {
+		// The current buffer belongs to the caller; copy it before growing it
+		m.data = append(make([]byte, 0, len(m.data)+len(data)), m.data...)
+		m.ownsData = true
+	}
+	start := len(m.data)
+	m.data = append(m.data, data...)
+	m.entropyGen++
+	if m.fileType.Name == "" {
+		// The magic number may only now be complete
+		m.fileType, _ = DetectFileType(m.window(0, 512))
+	}
+	// Headers may only now be complete
+	m.parseStructures()
+
+	if m.detection != nil {
+		// The background scan goes on to the appended data
+		m.detection.data = append(m.detection.data, data...)
+	} else {
+		// Objects at or after the resume point may have been incomplete; rescan them
+		kept := m.jsonObjects[:0]
+		for _, obj := range m.jsonObjects {
+			if obj.startOffset < m.scanResume {
+				kept = append(kept, obj)
+			}
+		}
+		tail, resume := m.detectObjects(m.data, m.scanResume)
+		m.jsonObjects = append(kept, tail...)
+		m.scanResume = resume
+	}
+	if m.framing != nil {
+		m.splitFrames()
+	} else {
+		m.resplitFrames()
+	}
+	m.searchAppended(start)
+}
+
+// AppendBytes appends data to the buffer shown in this viewer. The data is
+// copied, so the caller may reuse it once AppendBytes returns.
+func (v *Viewer) AppendBytes(data []byte) {
+	v.program.Send(appendMsg{data: append([]byte(nil), data...), at: time.Now()})
+}
+
+// AppendBytes appends data to the buffer shown in the TUI started by StartTUI
+func AppendBytes(data []byte) {
+	if v := defaultViewer(); v != nil {
+		v.AppendBytes(data)
+	}
+}
+
+// AppendChunk appends data to the buffer of this viewer as a chunk, such as
+// a packet or message, annotated with a label in the given color. The
+// NextFrame and PrevFrame keys move between chunks. The data is copied.
+// AppendChunk doesn't wait for the viewer, which drops chunks and tells how
+// many once it falls too far behind.
+func (v *Viewer) AppendChunk(data []byte, label string, color Color) {
+	sendChunk(v, append([]byte(nil), data...), label, color)
+}
+
+// AppendChunk appends a chunk to the TUI started by StartTUI, see
+// Viewer.AppendChunk
+func AppendChunk(data []byte, label string, color Color) {
+	if v := defaultViewer(); v != nil {
+		v.AppendChunk(data, label, color)
+	}
+}
+
+// viewerWriter appends whatever is written to it to the buffer of a viewer,
+// the one started by StartTUI at the time of writing if v is nil
+type viewerWriter struct {
+	v *Viewer
+}
+
+// Write implements io.Writer. It never fails, so that writes through an
+// io.MultiWriter go on once the viewer has exited.
+func (w viewerWriter) Write(p []byte) (int, error) {
+	v := w.v
+	if v == nil {
+		v = defaultViewer()
+	}
+	if v == nil || len(p) == 0 {
+		return len(p), nil
+	}
+	select {
+	case <-v.done:
+	default:
+		v.AppendBytes(p)
+	}
+	return len(p), nil
+}
+
+// teeWriter writes to w and mirrors what w accepted to a viewer
+type teeWriter struct {
+	w      io.Writer
+	viewer viewerWriter
+}
+
+// Write implements io.Writer
+func (t teeWriter) Write(p []byte) (int, error) {
+	n, err := t.w.Write(p)
+	if n > 0 {
+		_, _ = t.viewer.Write(p[:n])
+	}
+	return n, err
+}
+
+// Writer returns a writer that appends everything written to it to the
+// buffer of this viewer, e.g. io.MultiWriter(conn, v.Writer())
+func (v *Viewer) Writer() io.Writer {
+	return viewerWriter{v: v}
+}
+
+// TeeWriter returns a writer that writes to w and appends whatever w
+// accepted to the buffer of this viewer
+func (v *Viewer) TeeWriter(w io.Writer) io.Writer {
+	return teeWriter{w: w, viewer: viewerWriter{v: v}}
+}
+
+// NewWriter returns a writer that appends everything written to it to the
+// buffer of the TUI started by StartTUI, so that existing code paths can be
+// watched live, e.g. io.MultiWriter(conn, prettybuffers.NewWriter()). Writes
+// are dropped while no viewer is running.
+func NewWriter() io.Writer {
+	return viewerWriter{}
+}
+
+// TeeWriter returns a writer that writes to w and appends whatever w
+// accepted to the buffer of the TUI started by StartTUI
+func TeeWriter(w io.Writer) io.Writer {
+	return teeWriter{w: w}
+}
@@ -0,0 +1,249 @@
+package prettybuffers
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/charmbracelet/lipgloss"
+)
+
+// maxStructures limits how many structures a file format overlay adds, e.g.
+// for binaries with very many sections
+const maxStructures = 4096
+
+// structure is a part of a file format, such as an ELF program header, that
+// is divided into named fields
+type structure struct {
+	start  int
+	end    int // one past the last byte
+	name   string
+	fields []region // sorted by start, labelled with their parsed values
+	styled bool     // headers are colored, data such as section contents is not
+	entry  string   // name of the archive entry whose data this is
+}
+
+// structureParser parses the structures of a file format. read returns up to
+// n bytes at off, fewer at the end of the buffer.
+type structureParser func(read func(off, n int) []byte, size int) []structure
+
+// overlayParser lays out the structures of an overlay, such as a template.
+// order is the byte order of the viewer, which applies to the fields that
+// don't set their own.
+type overlayParser func(read func(off, n int) []byte, size int, order binary.ByteOrder) []structure
+
+// structureParsers parse the formats named by their FileType.Extension
+var structureParsers = map[string]structureParser{
+	"elf":   parseELF,
+	"exe":   parsePE,
+	"macho": parseMachO,
+	"tar":   parseTar,
+	"zip":   parseZIP,
+}
+
+// parseStructures overlays the structures of the detected file format, and
+// those of the overlays applied, such as templates
+func (m *model) parseStructures() {
+	m.structures = nil
+	if parse, ok := structureParsers[m.fileType.Extension]; ok {
+		m.structures = addStructures(nil, parse(m.window, m.size()))
+	}
+	for _, parse := range m.overlays {
+		// Overlays take precedence over the file format and earlier overlays
+		added := addStructures(nil, parse(m.window, m.size(), m.byteOrder))
+		kept := m.structures[:0]
+		for _, s := range m.structures {
+			i := sort.Search(len(added), func(i int) bool { return added[i].end > s.start })
+			if i == len(added) || added[i].start >= s.end {
+				kept = append(kept, s)
+			}
+		}
+		m.structures = addStructures(kept, added)
+	}
+}
+
+// addStructures inserts the structures of list into kept, which is sorted,
+// skipping those overlapping ones already there. Structures earlier in list
+// take precedence over later ones overlapping them.
+func addStructures(kept, list []structure) []structure {
+	for _, s := range list {
+		if len(kept) == maxStructures {
+			break
+		}
+		i := sort.Search(len(kept), func(i int) bool { return kept[i].end > s.start })
+		if s.end > s.start && (i == len(kept) || kept[i].start >= s.end) {
+			kept = append(kept, structure{})
+			copy(kept[i+1:], kept[i:])
+			kept[i] = s
+		}
+	}
+	return kept
+}
+
+// structureAt returns the index of the structure containing pos, or -1
+func (m model) structureAt(pos int) int {
+	i := sort.Search(len(m.structures), func(i int) bool { return m.structures[i].end > pos })
+	if i < len(m.structures) && m.structures[i].start <= pos {
+		return i
+	}
+	return -1
+}
+
+// structureStyle returns the style of the structure containing pos. Styled
+// structures alternate between the theme's structure styles.
+func (m model) structureStyle(pos int) (lipgloss.Style, bool) {
+	i := m.structureAt(pos)
+	if i < 0 || !m.structures[i].styled || len(m.theme.Structure) == 0 {
+		return lipgloss.Style{}, false
+	}
+	return m.theme.Structure[i%len(m.theme.Structure)], true
+}
+
+// structureField returns the field of a structure covering pos, or nil
+func (m model) structureField(pos int) *region {
+	i := m.structureAt(pos)
+	if i < 0 {
+		return nil
+	}
+	s := m.structures[i]
+	j := sort.Search(len(s.fields), func(j int) bool { return s.fields[j].end > pos })
+	if j < len(s.fields) && s.fields[j].start <= pos {
+		return &s.fields[j]
+	}
+	return nil
+}
+
+// structureRegion returns the structure covering pos as a region, or nil
+func (m model) structureRegion(pos int) *region {
+	i := m.structureAt(pos)
+	if i < 0 {
+		return nil
+	}
+	s := m.structures[i]
+	return &region{start: s.start, end: s.end, label: s.name}
+}
+
+// structBuilder reads the fields of a structure one after another
+type structBuilder struct {
+	data  []byte
+	order binary.ByteOrder
+	pos   int
+	s     structure
+}
+
+// newStructBuilder starts a structure called name of size bytes at off. ok
+// is false when the buffer ends before the structure does.
+func newStructBuilder(read func(off, n int) []byte, off, size int, order binary.ByteOrder, name string) (*structBuilder, bool) {
+	data := read(off, size)
+	if len(data) < size {
+		return nil, false
+	}
+	return &structBuilder{data: data, order: order, s: structure{start: off, end: off + size, name: name, styled: true}}, true
+}
+
+// uint reads an unsigned field of size 1, 2, 4 or 8 bytes
+func (b *structBuilder) uint(size int) uint64 {
+	raw := b.data[b.pos : b.pos+size]
+	switch size {
+	case 1:
+		return uint64(raw[0])
+	case 2:
+		return uint64(b.order.Uint16(raw))
+	case 4:
+		return uint64(b.order.Uint32(raw))
+	}
+	return b.order.Uint64(raw)
+}
+
+// add records a field of size bytes with the given description
+func (b *structBuilder) add(name string, size int, value string) {
+	label := b.s.name + " " + name
+	if value != "" {
+		label += " = " + value
+	}
+	b.s.fields = append(b.s.fields, region{start: b.s.start + b.pos, end: b.s.start + b.pos + size, label: label})
+	b.pos += size
+}
+
+// dec adds a field shown in decimal and returns its value
+func (b *structBuilder) dec(name string, size int) uint64 {
+	v := b.uint(size)
+	b.add(name, size, fmt.Sprint(v))
+	return v
+}
+
+// hex adds a field shown in hexadecimal and returns its value
+func (b *structBuilder) hex(name string, size int) uint64 {
+	v := b.uint(size)
+	b.add(name, size, fmt.Sprintf("0x%X", v))
+	return v
+}
+
+// enum adds a field shown by the name of its value and returns the value
+func (b *structBuilder) enum(name string, size int, names map[uint64]string) uint64 {
+	v := b.uint(size)
+	value := fmt.Sprintf("0x%X", v)
+	if n, ok := names[v]; ok {
+		value = fmt.Sprintf("%s (0x%X)", n, v)
+	}
+	b.add(name, size, value)
+	return v
+}
+
+// flags adds a field shown as its value and the names of the flags set in
+// it, and returns the value
+func (b *structBuilder) flags(name string, size int, names []flagName) uint64 {
+	v := b.uint(size)
+	b.add(name, size, formatFlags(v, names))
+	return v
+}
+
+// str adds a NUL-padded string field and returns the string
+func (b *structBuilder) str(name string, size int) string {
+	s := cString(b.data[b.pos : b.pos+size])
+	b.add(name, size, s)
+	return s
+}
+
+// raw adds a field of size bytes shown without a value
+func (b *structBuilder) raw(name string, size int) {
+	b.add(name, size, "")
+}
+
+// done returns the structure built
+func (b *structBuilder) done() structure {
+	return b.s
+}
+
+// flagName names a bit of a flags field
+type flagName struct {
+	bit  uint64
+	name string
+}
+
+// flagNames lists the names of the flags set in v
+func flagNames(v uint64, flags []flagName) string {
+	var names []string
+	for _, f := range flags {
+		if v&f.bit != 0 {
+			names = append(names, f.name)
+		}
+	}
+	return strings.Join(names, ", ")
+}
+
+// formatFlags formats a flags field, e.g. "0x22 executable, large address
+// aware"
+func formatFlags(v uint64, flags []flagName) string {
+	return strings.TrimSpace(fmt.Sprintf("0x%X %s", v, flagNames(v, flags)))
+}
+
+// cString returns the string in raw up to the first NUL byte
+func cString(raw []byte) string {
+	if i := bytes.IndexByte(raw, 0); i >= 0 {
+		raw = raw[:i]
+	}
+	return sanitizeString(string(raw))
+}
@@ -0,0 +1,664 @@
+package prettybuffers
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+const (
+	// maxTemplateFields limits how many fields applying a template adds, so
+	// that a huge array length read from the buffer can't stall the viewer
+	maxTemplateFields = 1 << 16
+	// maxTemplateDepth limits how deeply structs nest, as one may contain
+	// itself
+	maxTemplateDepth = 32
+)
+
+// templateSizes are the sizes of the built-in field types
+var templateSizes = map[string]int{
+	"u8": 1, "u16": 2, "u32": 4, "u64": 8,
+	"i8": 1, "i16": 2, "i32": 4, "i64": 8,
+	"f32": 4, "f64": 8, "char": 1, "bytes": 1, "strz": 1,
+}
+
+// maxTemplateString limits how far a NUL-terminated string is searched for
+// its end
+const maxTemplateString = 1 << 16
+
+// Template describes the layout of binary data, in the style of 010 Editor
+// templates: structs of typed fields, which may be arrays whose length is
+// computed from numbers and earlier fields, or eos to repeat up to the end of
+// the buffer. For example:
+//
+//	endian big
+//	struct entry {
+//	    u8 kind
+//	    u16 length
+//	    bytes data[length]
+//	}
+//	struct file {
+//	    char magic[4]
+//	    u32le count
+//	    entry entries[count]
+//	}
+//
+// Field types are u8 to u64, i8 to i64, f32, f64, char for text, strz for a
+// NUL-terminated string, bytes, and the structs declared before. Numbers use
+// the byte order of the last endian line before them, or else that of the
+// viewer (see WithByteOrder), unless the type ends in le or be. The last
+// struct declared is the one applied to the buffer. Comments start with # or
+// //.
+//
+// Templates can also be loaded from Kaitai Struct definitions with
+// ParseKaitai.
+type Template struct {
+	structs map[string]*templateStruct
+	root    *templateStruct
+}
+
+// templateStruct is a struct declared in a template
+type templateStruct struct {
+	name   string
+	fields []templateField
+}
+
+// templateField is a field of a struct
+type templateField struct {
+	typ   string // without the byte order suffix
+	name  string
+	count string           // array length, an expression or "eos"; "" if not an array
+	order binary.ByteOrder // nil for the byte order of the viewer
+	line  int
+	enum  map[int64]string // names of the values of an integer field
+	size  string           // bytes a struct field takes, if not those of its fields
+}
+
+// isIdentifier reports whether s can name a struct or a field
+func isIdentifier(s string) bool {
+	for i, c := range s {
+		if !(c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || i > 0 && c >= '0' && c <= '9') {
+			return false
+		}
+	}
+	return s != ""
+}
+
+// ParseTemplate parses the source of a template, see Template
+func ParseTemplate(src string) (*Template, error) {
+	t := &Template{structs: map[string]*templateStruct{}}
+	var order binary.ByteOrder // nil for the byte order of the viewer
+	var current *templateStruct
+	for i, line := range strings.Split(src, "\n") {
+		n := i + 1
+		if j := strings.Index(line, "#"); j >= 0 {
+			line = line[:j]
+		}
+		if j := strings.Index(line, "//"); j >= 0 {
+			line = line[:j]
+		}
+		words := strings.Fields(strings.TrimSuffix(strings.TrimSpace(line), ";"))
+		switch {
+		case len(words) == 0:
+		case words[0] == "endian":
+			if len(words) != 2 {
+				return nil, fmt.Errorf("line %d: expected endian <little|big>", n)
+			}
+			switch words[1] {
+			case "little", "le":
+				order = binary.LittleEndian
+			case "big", "be":
+				order = binary.BigEndian
+			default:
+				return nil, fmt.Errorf("line %d: unknown byte order %q", n, words[1])
+			}
+		case words[0] == "struct":
+			if current != nil {
+				return nil, fmt.Errorf("line %d: struct inside struct %s", n, current.name)
+			}
+			if len(words) != 3 || words[2] != "{" || !isIdentifier(words[1]) {
+				return nil, fmt.Errorf("line %d: expected struct <name> {", n)
+			}
+			if _, ok := templateSizes[words[1]]; ok || t.structs[words[1]] != nil {
+				return nil, fmt.Errorf("line %d: type %s is already defined", n, words[1])
+			}
+			current = &templateStruct{name: words[1]}
+			t.structs[current.name] = current
+		case words[0] == "}" && len(words) == 1:
+			if current == nil {
+				return nil, fmt.Errorf("line %d: } outside of a struct", n)
+			}
+			if len(current.fields) == 0 {
+				return nil, fmt.Errorf("line %d: struct %s has no fields", n, current.name)
+			}
+			t.root, current = current, nil
+		default:
+			if current == nil {
+				return nil, fmt.Errorf("line %d: field outside of a struct", n)
+			}
+			f, err := parseTemplateField(words, order, t.structs)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", n, err)
+			}
+			f.line = n
+			current.fields = append(current.fields, f)
+		}
+	}
+	if current != nil {
+		return nil, fmt.Errorf("struct %s is not closed", current.name)
+	}
+	if t.root == nil {
+		return nil, fmt.Errorf("template declares no struct")
+	}
+	return t, nil
+}
+
+// parseTemplateField parses a field declaration such as "u16be length" or
+// "entry entries[count]"
+func parseTemplateField(words []string, order binary.ByteOrder, structs map[string]*templateStruct) (templateField, error) {
+	if len(words) != 2 {
+		return templateField{}, fmt.Errorf("expected <type> <name>[length]")
+	}
+	f := templateField{typ: words[0], name: words[1], order: order}
+	if name, count, ok := strings.Cut(f.name, "["); ok {
+		if !strings.HasSuffix(count, "]") {
+			return f, fmt.Errorf("expected ] after the length of %s", name)
+		}
+		f.name, f.count = name, strings.TrimSuffix(count, "]")
+		if f.count == "" {
+			return f, fmt.Errorf("missing length of %s", f.name)
+		}
+		if _, err := evalTemplateExpr(f.count, func(string) (int64, bool) { return 1, true }); err != nil && f.count != "eos" {
+			return f, fmt.Errorf("length of %s: %w", f.name, err)
+		}
+	}
+	if !isIdentifier(f.name) {
+		return f, fmt.Errorf("invalid field name %q", f.name)
+	}
+	if _, ok := structs[f.typ]; ok {
+		return f, nil
+	}
+	for suffix, o := range map[string]binary.ByteOrder{"le": binary.LittleEndian, "be": binary.BigEndian} {
+		if base := strings.TrimSuffix(f.typ, suffix); base != f.typ && templateSizes[base] > 1 {
+			f.typ, f.order = base, o
+		}
+	}
+	if _, ok := templateSizes[f.typ]; !ok {
+		return f, fmt.Errorf("unknown type %s", f.typ)
+	}
+	return f, nil
+}
+
+// templateRun lays a template out over the buffer
+type templateRun struct {
+	t      *Template
+	read   func(off, n int) []byte
+	size   int
+	pos    int
+	fields []region
+	depth  int
+	order  binary.ByteOrder // of the fields that don't set their own
+}
+
+// apply lays the template out at offset. Each struct among the fields of the
+// root struct becomes a structure of its own, and the other fields are
+// grouped into structures between them. It returns the structures laid out
+// until an error, such as a field running past the end of the buffer.
+func (t *Template) apply(read func(off, n int) []byte, size, offset int, order binary.ByteOrder) ([]structure, error) {
+	r := &templateRun{t: t, read: read, size: size, pos: offset, order: order}
+	scopes := []map[string]int64{{}}
+	var structures []structure
+	group := -1 // first of the plain fields not yet in a structure
+	flush := func() {
+		if group >= 0 && group < len(r.fields) {
+			structures = append(structures, structure{start: r.fields[group].start, end: r.pos, name: t.root.name,
+				fields: r.fields[group:], styled: true})
+		}
+		group = -1
+	}
+
+	var err error
+	for _, f := range t.root.fields {
+		s, ok := t.structs[f.typ]
+		if !ok {
+			if group < 0 {
+				group = len(r.fields)
+			}
+			if err = r.field(f, t.root.name, scopes); err != nil {
+				break
+			}
+			continue
+		}
+		flush()
+		var n int
+		if n, err = r.count(f, scopes); err != nil {
+			break
+		}
+		err = r.repeat(f, n, t.root.name+"."+f.name, func(path string) error {
+			from, start := len(r.fields), r.pos
+			err := r.structField(f, s, path, scopes)
+			if len(r.fields) > from {
+				structures = append(structures, structure{start: start, end: r.pos, name: path, fields: r.fields[from:], styled: true})
+			}
+			return err
+		})
+		if err != nil {
+			break
+		}
+	}
+	flush()
+	return structures, err
+}
+
+// count returns the length of an array field, or 1 for other fields, or -1
+// for arrays repeated up to the end of the buffer
+func (r *templateRun) count(f templateField, scopes []map[string]int64) (int, error) {
+	switch f.count {
+	case "":
+		return 1, nil
+	case "eos":
+		return -1, nil
+	}
+	n, err := r.eval(f.count, scopes)
+	if err != nil {
+		return 0, fmt.Errorf("line %d: length of %s: %w", f.line, f.name, err)
+	}
+	if n < 0 || n > math.MaxInt32 {
+		return 0, fmt.Errorf("line %d: invalid length %d of %s", f.line, n, f.name)
+	}
+	return int(n), nil
+}
+
+// eval evaluates an expression with the values of the fields laid out so
+// far. Names starting with _parent. or _root. look in the enclosing or the
+// outermost struct only, and _io.size and _io.pos are the size of the buffer
+// and the current offset, as in Kaitai Struct.
+func (r *templateRun) eval(expr string, scopes []map[string]int64) (int64, error) {
+	return evalTemplateExpr(expr, func(name string) (int64, bool) {
+		switch {
+		case name == "_io.size":
+			return int64(r.size), true
+		case name == "_io.pos":
+			return int64(r.pos), true
+		case strings.HasPrefix(name, "_root."):
+			name, scopes = strings.TrimPrefix(name, "_root."), scopes[:1]
+		case strings.HasPrefix(name, "_parent."):
+			name, scopes = strings.TrimPrefix(name, "_parent."), scopes[:max(1, len(scopes)-1)]
+		}
+		for i := len(scopes) - 1; i >= 0; i-- {
+			if v, ok := scopes[i][name]; ok {
+				return v, true
+			}
+		}
+		return 0, false
+	})
+}
+
+// repeat lays out the elements of an array field, n of them or, if n is -1,
+// up to the end of the buffer. Other fields are laid out once.
+func (r *templateRun) repeat(f templateField, n int, path string, lay func(path string) error) error {
+	for i := 0; i < n || n < 0 && r.pos < r.size; i++ {
+		p := path
+		if f.count != "" {
+			p += fmt.Sprintf("[%d]", i)
+		}
+		start := r.pos
+		if err := lay(p); err != nil {
+			return err
+		}
+		if n < 0 && r.pos == start {
+			// Repeating elements that take no room would never end
+			break
+		}
+	}
+	return nil
+}
+
+// structField lays out a struct, within the size of the field if it has one
+func (r *templateRun) structField(f templateField, s *templateStruct, path string, scopes []map[string]int64) error {
+	if f.size == "" {
+		return r.structFields(s, path, scopes)
+	}
+	size, err := r.eval(f.size, scopes)
+	if err != nil {
+		return fmt.Errorf("line %d: size of %s: %w", f.line, f.name, err)
+	}
+	start := r.pos
+	if size < 0 || size > int64(r.size-start) {
+		return fmt.Errorf("%s at 0x%X runs past the end of the buffer", path, start)
+	}
+	err = r.structFields(s, path, scopes)
+	r.pos = start + int(size)
+	return err
+}
+
+// structFields lays out the fields of a struct
+func (r *templateRun) structFields(s *templateStruct, path string, scopes []map[string]int64) error {
+	if r.depth == maxTemplateDepth {
+		return fmt.Errorf("structs nest more than %d deep at %s", maxTemplateDepth, path)
+	}
+	r.depth++
+	defer func() { r.depth-- }()
+	scopes = append(scopes[:len(scopes):len(scopes)], map[string]int64{})
+	for _, f := range s.fields {
+		if err := r.field(f, path, scopes); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// field lays out a field of the struct at path, recording its value in the
+// innermost scope for the lengths of later arrays
+func (r *templateRun) field(f templateField, path string, scopes []map[string]int64) error {
+	n, err := r.count(f, scopes)
+	if err != nil {
+		return err
+	}
+	path += "." + f.name
+	if s, ok := r.t.structs[f.typ]; ok {
+		return r.repeat(f, n, path, func(p string) error { return r.structField(f, s, p, scopes) })
+	}
+
+	size := templateSizes[f.typ]
+	blob := f.typ == "char" || f.typ == "bytes"
+	switch {
+	case blob:
+		// Strings and byte arrays are one field
+		if n < 0 {
+			n = r.size - r.pos
+		}
+		size, n = n, 1
+	case n < 0 && f.typ != "strz":
+		n = (r.size - r.pos) / size
+	}
+	if n > 0 && r.pos+size*n > r.size {
+		return fmt.Errorf("%s at 0x%X runs past the end of the buffer", path, r.pos)
+	}
+	return r.repeat(f, n, path, func(label string) error {
+		if blob {
+			label = path
+		}
+		if f.typ == "strz" {
+			end := bytes.IndexByte(r.read(r.pos, min(r.size-r.pos, maxTemplateString)), 0)
+			if end < 0 {
+				return fmt.Errorf("%s at 0x%X is not terminated", label, r.pos)
+			}
+			size = end + 1
+		}
+		if len(r.fields) == maxTemplateFields {
+			return fmt.Errorf("more than %d fields at %s", maxTemplateFields, label)
+		}
+		value, number := templateValue(f, r.read(r.pos, size), r.order)
+		if name, ok := f.enum[number]; ok {
+			value = name + " (" + value + ")"
+		}
+		if f.count == "" && !blob && f.typ != "strz" {
+			scopes[len(scopes)-1][f.name] = number
+		}
+		r.fields = append(r.fields, region{start: r.pos, end: r.pos + size, label: label + " = " + value})
+		r.pos += size
+		return nil
+	})
+}
+
+// templateValue formats the value of a field, read in the given byte order
+// unless it sets its own, and returns it as a number for integer fields
+func templateValue(f templateField, raw []byte, order binary.ByteOrder) (string, int64) {
+	order = cmp.Or(f.order, order)
+	var u uint64
+	switch len(raw) {
+	case 1:
+		u = uint64(raw[0])
+	case 2:
+		u = uint64(order.Uint16(raw))
+	case 4:
+		u = uint64(order.Uint32(raw))
+	case 8:
+		u = order.Uint64(raw)
+	}
+	switch f.typ {
+	case "char", "strz":
+		return strconv.Quote(cString(raw)), 0
+	case "bytes":
+		preview := formatHexBytes(raw[:min(decodedPreviewBytes, len(raw))], min(decodedPreviewBytes, len(raw)))
+		if len(raw) > decodedPreviewBytes {
+			preview += " ..."
+		}
+		return preview, 0
+	case "f32":
+		return strconv.FormatFloat(float64(math.Float32frombits(uint32(u))), 'g', -1, 32), 0
+	case "f64":
+		return strconv.FormatFloat(math.Float64frombits(u), 'g', -1, 64), 0
+	case "i8", "i16", "i32", "i64":
+		// Sign-extend from the size of the field
+		shift := 64 - 8*len(raw)
+		v := int64(u<<shift) >> shift
+		return strconv.FormatInt(v, 10), v
+	}
+	if u < 10 {
+		return strconv.FormatUint(u, 10), int64(u)
+	}
+	return fmt.Sprintf("%d (0x%X)", u, u), int64(u)
+}
+
+// applyTemplate overlays the structures of the template at offset, laid out
+// again whenever the buffer changes
+func (m *model) applyTemplate(t *Template, offset int) error {
+	if offset < 0 || offset >= m.size() {
+		return fmt.Errorf("offset %d is outside the buffer", offset)
+	}
+	structures, err := t.apply(m.window, m.size(), offset, m.byteOrder)
+	if len(structures) == 0 {
+		if err == nil {
+			err = fmt.Errorf("template %s lays out no fields", t.root.name)
+		}
+		return err
+	}
+	m.overlays = append(m.overlays, func(read func(off, n int) []byte, size int, order binary.ByteOrder) []structure {
+		structures, _ := t.apply(read, size, offset, order)
+		return structures
+	})
+	m.parseStructures()
+	fields := 0
+	for _, s := range structures {
+		fields += len(s.fields)
+	}
+	m.status = fmt.Sprintf("Template %s applied at 0x%08X: %d fields up to 0x%08X", t.root.name, offset, fields,
+		structures[len(structures)-1].end)
+	return err
+}
+
+// cmdTemplate applies the template in a file, at the given offset or the
+// start of the buffer. Files ending in .ksy are Kaitai Struct definitions.
+func cmdTemplate(m *model, args string) (tea.Cmd, error) {
+	path, at, _ := strings.Cut(args, " ")
+	switch path {
+	case "":
+		return nil, fmt.Errorf("usage: template <path> [offset] | template clear")
+	case "clear":
+		m.overlays = nil
+		m.parseStructures()
+		return nil, nil
+	}
+	offset := 0
+	if at = strings.TrimSpace(at); at != "" {
+		var err error
+		if offset, err = parseOffset(at); err != nil {
+			return nil, err
+		}
+	}
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	parse := ParseTemplate
+	if strings.HasSuffix(path, ".ksy") {
+		parse = ParseKaitai
+	}
+	t, err := parse(string(src))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return nil, m.applyTemplate(t, offset)
+}
+
+// ApplyTemplate lays the template out over the buffer of this viewer from
+// offset, annotating it with the fields and their values. The template stays
+// applied as the buffer changes, until ClearOverlays is called. An error is
+// returned if it can't be laid out completely, such as when it runs past the
+// end of the buffer.
+func (v *Viewer) ApplyTemplate(t *Template, offset int) error {
+	var err error
+	v.inspect(func(m *model) {
+		err = m.applyTemplate(t, offset)
+	})
+	return err
+}
+
+// ClearOverlays removes the templates and structs overlaid on this viewer
+func (v *Viewer) ClearOverlays() {
+	v.inspect(func(m *model) {
+		m.overlays = nil
+		m.parseStructures()
+	})
+}
+
+// ApplyTemplate applies a template in the TUI started by StartTUI, see
+// Viewer.ApplyTemplate
+func ApplyTemplate(t *Template, offset int) error {
+	v := defaultViewer()
+	if v == nil {
+		return ErrNoViewer
+	}
+	return v.ApplyTemplate(t, offset)
+}
+
+// ClearOverlays removes the templates and structs overlaid in the TUI
+// started by StartTUI
+func ClearOverlays() {
+	if v := defaultViewer(); v != nil {
+		v.ClearOverlays()
+	}
+}
+
+// evalTemplateExpr evaluates an expression of numbers and names joined by
+// + - * / and parentheses, looking up the values of names
+func evalTemplateExpr(expr string, lookup func(name string) (int64, bool)) (int64, error) {
+	p := exprParser{lookup: lookup}
+	for i := 0; i < len(expr); {
+		c := expr[i]
+		switch {
+		case c == ' ':
+			i++
+		case strings.IndexByte("+-*/()", c) >= 0:
+			p.tokens = append(p.tokens, expr[i:i+1])
+			i++
+		default:
+			j := i
+			for j < len(expr) && (isIdentifier(expr[j:j+1]) || expr[j] >= '0' && expr[j] <= '9' || expr[j] == '.') {
+				j++
+			}
+			if j == i {
+				return 0, fmt.Errorf("unexpected %q in %q", c, expr)
+			}
+			p.tokens = append(p.tokens, expr[i:j])
+			i = j
+		}
+	}
+	v, err := p.sum()
+	if err == nil && p.pos < len(p.tokens) {
+		err = fmt.Errorf("unexpected %q in %q", p.tokens[p.pos], expr)
+	}
+	return v, err
+}
+
+// exprParser evaluates the tokens of an expression by recursive descent
+type exprParser struct {
+	tokens []string
+	pos    int
+	lookup func(name string) (int64, bool)
+}
+
+// next returns the next token, or "" at the end
+func (p *exprParser) next() string {
+	if p.pos == len(p.tokens) {
+		return ""
+	}
+	return p.tokens[p.pos]
+}
+
+// sum evaluates terms joined by + and -
+func (p *exprParser) sum() (int64, error) {
+	v, err := p.product()
+	for err == nil && (p.next() == "+" || p.next() == "-") {
+		op := p.next()
+		p.pos++
+		var w int64
+		if w, err = p.product(); err != nil {
+			break
+		}
+		if op == "+" {
+			v += w
+		} else {
+			v -= w
+		}
+	}
+	return v, err
+}
+
+// product evaluates factors joined by * and /
+func (p *exprParser) product() (int64, error) {
+	v, err := p.factor()
+	for err == nil && (p.next() == "*" || p.next() == "/") {
+		op := p.next()
+		p.pos++
+		var w int64
+		if w, err = p.factor(); err != nil {
+			break
+		}
+		switch {
+		case op == "*":
+			v *= w
+		case w == 0:
+			err = fmt.Errorf("division by zero")
+		default:
+			v /= w
+		}
+	}
+	return v, err
+}
+
+// factor evaluates a number, a name, a negation or a parenthesized sum
+func (p *exprParser) factor() (int64, error) {
+	tok := p.next()
+	p.pos++
+	switch {
+	case tok == "":
+		return 0, fmt.Errorf("unexpected end of expression")
+	case tok == "-":
+		v, err := p.factor()
+		return -v, err
+	case tok == "(":
+		v, err := p.sum()
+		if err == nil && p.next() != ")" {
+			err = fmt.Errorf("missing )")
+		}
+		p.pos++
+		return v, err
+	case tok[0] >= '0' && tok[0] <= '9':
+		return strconv.ParseInt(tok, 0, 64)
+	}
+	v, ok := p.lookup(tok)
+	if !ok {
+		return 0, fmt.Errorf("no field %s", tok)
+	}
+	return v, nil
+}
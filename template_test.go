@@ -0,0 +1,189 @@
+package prettybuffers
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+	"testing"
+	"time"
+)
+
+// readBytes returns a read function over data, as structure parsers get
+func readBytes(data []byte) func(off, n int) []byte {
+	return func(off, n int) []byte {
+		return data[min(off, len(data)):min(off+n, len(data))]
+	}
+}
+
+// templateLabels returns the labels of the fields of the structures
+func templateLabels(structures []structure) []string {
+	var labels []string
+	for _, s := range structures {
+		for _, f := range s.fields {
+			labels = append(labels, f.label)
+		}
+	}
+	return labels
+}
+
+func TestParseTemplate(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		err  string // part of the error, "" for none
+	}{
+		{"struct", "struct s {\n  u8 a\n  u16le b[a]\n}", ""},
+		{"comments and semicolons", "# header\nstruct s { // s\n  u8 a; # a\n}", ""},
+		{"nested struct", "struct e {\n u8 x\n}\nstruct s {\n e items[eos]\n}", ""},
+		{"no struct", "endian big\n", "declares no struct"},
+		{"not closed", "struct s {\n  u8 a\n", "struct s is not closed"},
+		{"empty struct", "struct s {\n}", "line 2: struct s has no fields"},
+		{"field outside", "u8 a\n", "line 1: field outside of a struct"},
+		{"struct inside struct", "struct s {\nstruct t {\n", "line 2: struct inside struct s"},
+		{"unknown type", "struct s {\n  u24 a\n}", "line 2: unknown type u24"},
+		{"byte order of u8", "struct s {\n  u8le a\n}", "unknown type u8le"},
+		{"redefined", "struct u8 {\n", "type u8 is already defined"},
+		{"unknown byte order", "endian middle\n", "unknown byte order"},
+		{"unclosed length", "struct s {\n  u8 a[4\n}", "expected ] after the length of a"},
+		{"invalid length", "struct s {\n  u8 a[4+]\n}", "length of a"},
+		{"invalid name", "struct s {\n  u8 1a\n}", "invalid field name"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseTemplate(tt.src)
+			switch {
+			case tt.err == "" && err != nil:
+				t.Fatalf("error %v", err)
+			case tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)):
+				t.Fatalf("error is %v, want one with %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestTemplateApply(t *testing.T) {
+	var deep []string // fields of a struct nesting itself
+	for path := "s.first"; len(deep) < maxTemplateDepth; path += ".next" {
+		deep = append(deep, path+".x = 1")
+	}
+	tests := []struct {
+		name   string
+		src    string
+		data   []byte
+		offset int
+		want   []string // labels of the fields laid out
+		err    string   // part of the error, "" for none
+	}{
+		{"byte orders", "endian big\nstruct s {\n u16 a\n u16le b\n i8 c\n}", []byte{0x01, 0x02, 0x01, 0x02, 0xFF}, 0,
+			[]string{"s.a = 258 (0x102)", "s.b = 513 (0x201)", "s.c = -1"}, ""},
+		{"length from a field", "struct s {\n u8 n\n char name[n]\n u8 rest[n-1]\n}", []byte("\x03abc\x01\x02"), 0,
+			[]string{"s.n = 3", `s.name = "abc"`, "s.rest[0] = 1", "s.rest[1] = 2"}, ""},
+		{"structs", "struct e {\n u8 k\n u8 v\n}\nstruct s {\n u8 n\n e items[n]\n}", []byte{2, 1, 2, 3, 4}, 0,
+			[]string{"s.n = 2", "s.items[0].k = 1", "s.items[0].v = 2", "s.items[1].k = 3", "s.items[1].v = 4"}, ""},
+		{"eos", "struct s {\n u16le words[eos]\n}", []byte{1, 0, 2, 0, 3}, 0,
+			[]string{"s.words[0] = 1", "s.words[1] = 2"}, ""},
+		{"strz", "struct s {\n strz a\n strz b\n}", []byte("hi\x00there\x00"), 0,
+			[]string{`s.a = "hi"`, `s.b = "there"`}, ""},
+		{"at an offset", "struct s {\n u8 a\n}", []byte{9, 7}, 1, []string{"s.a = 7"}, ""},
+		{"truncated", "struct s {\n u8 a\n u32 b\n}", []byte{1, 2, 3}, 0,
+			[]string{"s.a = 1"}, "s.b at 0x1 runs past the end of the buffer"},
+		{"truncated array", "struct s {\n u8 n\n u16 a[n]\n}", []byte{200, 1, 2}, 0,
+			[]string{"s.n = 200 (0xC8)"}, "s.a at 0x1 runs past the end"},
+		{"unterminated string", "struct s {\n strz a\n}", []byte("abc"), 0, nil, "s.a at 0x0 is not terminated"},
+		{"unknown field", "struct s {\n u8 a[b]\n}", []byte{1}, 0, nil, "line 2: length of a: no field b"},
+		{"negative length", "struct s {\n u8 n\n u8 a[n-2]\n}", []byte{1}, 0, []string{"s.n = 1"}, "invalid length -1 of a"},
+		{"recursive", "struct n {\n u8 x\n n next\n}\nstruct s {\n n first\n}", bytes.Repeat([]byte{1}, 64), 0,
+			deep, "structs nest more than 32 deep"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpl, err := ParseTemplate(tt.src)
+			if err != nil {
+				t.Fatal(err)
+			}
+			structures, err := tmpl.apply(readBytes(tt.data), len(tt.data), tt.offset, binary.LittleEndian)
+			switch {
+			case tt.err == "" && err != nil:
+				t.Errorf("error %v", err)
+			case tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)):
+				t.Errorf("error is %v, want one with %q", err, tt.err)
+			}
+			got := templateLabels(structures)
+			if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+				t.Errorf("laid out %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEvalTemplateExpr(t *testing.T) {
+	fields := map[string]int64{"n": 6, "_io.size": 100}
+	lookup := func(name string) (int64, bool) {
+		v, ok := fields[name]
+		return v, ok
+	}
+	tests := []struct {
+		expr string
+		want int64
+		err  string
+	}{
+		{"4", 4, ""},
+		{"0x10", 16, ""},
+		{"n * 2 + 1", 13, ""},
+		{"(n + 2) * 2", 16, ""},
+		{"_io.size - n / 4", 99, ""},
+		{"-n", -6, ""},
+		{"n / 0", 0, "division by zero"},
+		{"n +", 0, "unexpected end"},
+		{"(n", 0, "missing )"},
+		{"n n", 0, `unexpected "n"`},
+		{"m", 0, "no field m"},
+		{"n % 2", 0, "unexpected '%'"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			v, err := evalTemplateExpr(tt.expr, lookup)
+			switch {
+			case tt.err == "" && err != nil:
+				t.Fatalf("error %v", err)
+			case tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)):
+				t.Fatalf("error is %v, want one with %q", err, tt.err)
+			}
+			if err == nil && v != tt.want {
+				t.Errorf("%s = %d, want %d", tt.expr, v, tt.want)
+			}
+		})
+	}
+}
+
+// TestTemplateApplyLarge makes sure that arrays whose length is read from
+// the buffer stop at maxTemplateFields or the end of the buffer quickly
+func TestTemplateApplyLarge(t *testing.T) {
+	data := make([]byte, 4<<20)
+	binary.LittleEndian.PutUint32(data, 1<<30)
+	tests := []struct {
+		name string
+		src  string
+	}{
+		{"eos", "struct s {\n u8 all[eos]\n}"},
+		{"huge length", "struct s {\n u32 n\n u8 a[n]\n}"},
+		{"strings", "struct s {\n strz names[eos]\n}"},
+		{"empty structs", "struct e {\n u8 none[0]\n}\nstruct s {\n e items[eos]\n}"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpl, err := ParseTemplate(tt.src)
+			if err != nil {
+				t.Fatal(err)
+			}
+			start := time.Now()
+			structures, _ := tmpl.apply(readBytes(data), len(data), 0, binary.LittleEndian)
+			if n := len(templateLabels(structures)); n > maxTemplateFields {
+				t.Errorf("laid out %d fields", n)
+			}
+			if elapsed := time.Since(start); elapsed > 5*time.Second {
+				t.Errorf("applying took %v", elapsed)
+			}
+		})
+	}
+}
@@ -0,0 +1,105 @@
+package prettybuffers
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/charmbracelet/lipgloss"
+)
+
+// TextColumn shows the row decoded as UTF-8. Each byte takes one cell, so a
+// multi-byte character is followed by blank cells for its remaining bytes,
+// and invalid or unprintable bytes are shown as '.'.
+type TextColumn struct{}
+
+// Header implements ColumnRenderer
+func (TextColumn) Header() string { return "Text" }
+
+// Width implements ColumnRenderer
+func (TextColumn) Width(bytesPerRow int) int { return bytesPerRow }
+
+// RenderRow implements ColumnRenderer. Characters split across rows are
+// shown as '.', as the neighbouring rows are not known.
+func (TextColumn) RenderRow(data []byte, _ int) string {
+	return strings.Join(textCells(data, 0, len(data)), "")
+}
+
+func (TextColumn) renderStyled(m model, data []byte, offset int) string {
+	// Look around the row for characters crossing its edges
+	before := min(offset, utf8.UTFMax-1)
+	context := m.window(offset-before, before+len(data)+utf8.UTFMax-1)
+	cells := textCells(context, before, len(data))
+
+	var sb strings.Builder
+	for col := 0; col < m.bytesPerRow; col++ {
+		cell := " "
+		if col < len(cells) {
+			cell = cells[col]
+		}
+		sb.WriteString(m.highlight(offset+col, cell, m.theme.ASCII))
+	}
+	return sb.String()
+}
+
+// textCells returns the cells for the n bytes of data starting at start. The
+// bytes before start and after start+n only help decode the characters
+// crossing the edges. The cells of all bytes add up to n cells in width.
+func textCells(data []byte, start, n int) []string {
+	cells := make([]string, n)
+	for i := range cells {
+		cells[i] = "."
+	}
+
+	// Find the first character starting at or before the row, skipping back
+	// over continuation bytes
+	pos := start
+	for back := 0; back < utf8.UTFMax-1 && pos > 0 && !utf8.RuneStart(data[pos]); back++ {
+		pos--
+	}
+	if r, size := utf8.DecodeRune(data[pos:]); r == utf8.RuneError || pos+size <= start {
+		pos = start
+	}
+
+	for pos < start+n {
+		r, size := utf8.DecodeRune(data[pos:])
+		if r == utf8.RuneError && size <= 1 {
+			pos++
+			continue
+		}
+		width := lipgloss.Width(string(r))
+		first := pos - start
+		switch {
+		case first < 0:
+			// Shown at the end of the previous row, unless it didn't fit there
+			for i := 0; i < min(first+size, n); i++ {
+				cells[i] = " "
+			}
+			if unicode.IsPrint(r) && width > -first && width <= min(first+size, n) {
+				cells[0] = string(r)
+				for i := 1; i < width; i++ {
+					cells[i] = ""
+				}
+			}
+		case !unicode.IsPrint(r) || width == 0:
+			// Leave the bytes as dots
+		case width > min(size, n-first):
+			// The character would not fit in the cells of its bytes
+			// within the row
+			for i := first; i < min(first+size, n); i++ {
+				cells[i] = "."
+			}
+		default:
+			cells[first] = string(r)
+			for i := 1; i < size && first+i < n; i++ {
+				if i < width {
+					cells[first+i] = ""
+				} else {
+					cells[first+i] = " "
+				}
+			}
+		}
+		pos += size
+	}
+	return cells
+}
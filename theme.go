@@ -0,0 +1,203 @@
+package prettybuffers
+
+import "github.com/charmbracelet/lipgloss"
+
+// Theme holds the styles used to render the viewer
+type Theme struct {
+	Name string
+
+	Offset lipgloss.Style // offset column
+	Hex    lipgloss.Style // hexadecimal column
+	ASCII  lipgloss.Style // ASCII column
+	JSON   lipgloss.Style // prettified JSON in the Smart View
+	Header lipgloss.Style // title line and column headings
+	Footer lipgloss.Style // help text, status messages and prompts
+
+	Match        lipgloss.Style // every search match
+	CurrentMatch lipgloss.Style // the match that was jumped to last
+	Selection    lipgloss.Style // the selected bytes
+	Cursor       lipgloss.Style // the byte under the cursor
+	Modified     lipgloss.Style // bytes changed in edit mode
+
+	// Tokens of JSON in the Smart View. Whatever they leave unset, such as the
+	// color in MonochromeTheme, comes from JSON.
+	JSONKey    lipgloss.Style // member names
+	JSONString lipgloss.Style // string values
+	JSONNumber lipgloss.Style // numbers
+	JSONBool   lipgloss.Style // true and false
+	JSONNull   lipgloss.Style // null
+
+	DiffChanged  lipgloss.Style // bytes that differ in a two-way diff
+	DiffLeft     lipgloss.Style // bytes changed only on the left side of a three-way diff
+	DiffRight    lipgloss.Style // bytes changed only on the right side of a three-way diff
+	DiffBoth     lipgloss.Style // bytes changed the same way on both sides
+	DiffConflict lipgloss.Style // bytes changed differently on both sides
+	DiffAdded    lipgloss.Style // values only in the right side of a JSON diff
+	DiffRemoved  lipgloss.Style // values only in the left side of a JSON diff
+
+	Scrollbar       lipgloss.Style // track of the scrollbar
+	ScrollbarThumb  lipgloss.Style // part of the scrollbar showing the rows in view
+	ScrollbarMatch  lipgloss.Style // ticks marking search matches
+	ScrollbarObject lipgloss.Style // ticks marking detected JSON objects
+
+	EntropyHeat []lipgloss.Style // entropy from low to high, in equal steps
+	Structure   []lipgloss.Style // alternating between the headers of a file format, e.g. ELF
+	ByteClasses []lipgloss.Style // null, whitespace, printable, other ASCII and non-ASCII bytes in Sdump
+}
+
+// fg returns a style with the given foreground color
+func fg(color string) lipgloss.Style {
+	return lipgloss.NewStyle().Foreground(lipgloss.Color(color))
+}
+
+// onColor returns a style with the given background and foreground colors
+func onColor(background, foreground string) lipgloss.Style {
+	return fg(foreground).Background(lipgloss.Color(background))
+}
+
+// DarkTheme is meant for terminals with a dark background. It is the default.
+var DarkTheme = Theme{
+	Name:   "Dark",
+	Offset: fg("6"),
+	Hex:    fg("7"),
+	ASCII:  fg("2"),
+	JSON:   fg("3"),
+	Header: fg("12").Bold(true),
+	Footer: fg("8"),
+
+	Match:        lipgloss.NewStyle().Reverse(true),
+	CurrentMatch: onColor("3", "0"),
+	Selection:    onColor("4", "15"),
+	Cursor:       onColor("15", "0"),
+	Modified:     fg("1").Bold(true),
+
+	JSONKey:    fg("14"),
+	JSONString: fg("2"),
+	JSONNumber: fg("13"),
+	JSONBool:   fg("11"),
+	JSONNull:   fg("8"),
+
+	DiffChanged:  fg("1").Bold(true),
+	DiffLeft:     fg("3").Bold(true),
+	DiffRight:    fg("5").Bold(true),
+	DiffBoth:     fg("2").Bold(true),
+	DiffConflict: onColor("1", "15"),
+	DiffAdded:    fg("2"),
+	DiffRemoved:  fg("1"),
+
+	Scrollbar:       fg("8"),
+	ScrollbarThumb:  onColor("8", "15"),
+	ScrollbarMatch:  fg("3"),
+	ScrollbarObject: fg("6"),
+
+	EntropyHeat: []lipgloss.Style{fg("4"), fg("6"), fg("2"), fg("3"), fg("1")},
+	Structure:   []lipgloss.Style{fg("14"), fg("13")},
+	ByteClasses: []lipgloss.Style{fg("8"), fg("2"), fg("6"), fg("5"), fg("3")},
+}
+
+// LightTheme is meant for terminals with a light background
+var LightTheme = Theme{
+	Name:   "Light",
+	Offset: fg("4"),
+	Hex:    fg("0"),
+	ASCII:  fg("2"),
+	JSON:   fg("5"),
+	Header: fg("4").Bold(true),
+	Footer: fg("8"),
+
+	Match:        lipgloss.NewStyle().Reverse(true),
+	CurrentMatch: onColor("11", "0"),
+	Selection:    onColor("12", "15"),
+	Cursor:       onColor("0", "15"),
+	Modified:     fg("1").Bold(true),
+
+	JSONKey:    fg("4"),
+	JSONString: fg("2"),
+	JSONNumber: fg("1"),
+	JSONBool:   fg("6"),
+	JSONNull:   fg("8"),
+
+	DiffChanged:  fg("1").Bold(true),
+	DiffLeft:     fg("4").Bold(true),
+	DiffRight:    fg("5").Bold(true),
+	DiffBoth:     fg("2").Bold(true),
+	DiffConflict: onColor("1", "15"),
+	DiffAdded:    fg("2"),
+	DiffRemoved:  fg("1"),
+
+	Scrollbar:       fg("7"),
+	ScrollbarThumb:  onColor("7", "0"),
+	ScrollbarMatch:  fg("1"),
+	ScrollbarObject: fg("4"),
+
+	EntropyHeat: []lipgloss.Style{fg("4"), fg("6"), fg("2"), fg("3"), fg("1")},
+	Structure:   []lipgloss.Style{fg("4"), fg("5")},
+	ByteClasses: []lipgloss.Style{fg("8"), fg("2"), fg("4"), fg("5"), fg("1")},
+}
+
+// MonochromeTheme uses text attributes only, for terminals without color
+var MonochromeTheme = Theme{
+	Name:   "Monochrome",
+	Header: lipgloss.NewStyle().Bold(true),
+	Footer: lipgloss.NewStyle().Faint(true),
+
+	Match:        lipgloss.NewStyle().Underline(true),
+	CurrentMatch: lipgloss.NewStyle().Underline(true).Bold(true),
+	Selection:    lipgloss.NewStyle().Reverse(true),
+	Cursor:       lipgloss.NewStyle().Reverse(true).Bold(true),
+	Modified:     lipgloss.NewStyle().Bold(true),
+
+	JSONKey:  lipgloss.NewStyle().Bold(true),
+	JSONNull: lipgloss.NewStyle().Faint(true),
+
+	DiffChanged:  lipgloss.NewStyle().Bold(true),
+	DiffLeft:     lipgloss.NewStyle().Underline(true),
+	DiffRight:    lipgloss.NewStyle().Italic(true),
+	DiffBoth:     lipgloss.NewStyle().Bold(true),
+	DiffConflict: lipgloss.NewStyle().Reverse(true),
+	DiffAdded:    lipgloss.NewStyle().Bold(true),
+	DiffRemoved:  lipgloss.NewStyle().Strikethrough(true),
+
+	ScrollbarThumb:  lipgloss.NewStyle().Reverse(true),
+	ScrollbarMatch:  lipgloss.NewStyle().Bold(true),
+	ScrollbarObject: lipgloss.NewStyle(),
+
+	Structure:   []lipgloss.Style{lipgloss.NewStyle().Bold(true), lipgloss.NewStyle()},
+	ByteClasses: []lipgloss.Style{lipgloss.NewStyle().Faint(true), {}, {}, lipgloss.NewStyle().Bold(true), lipgloss.NewStyle().Bold(true)},
+}
+
+// PredefinedThemes contains the built-in themes, cycled through with 't'
+var PredefinedThemes = []Theme{DarkTheme, LightTheme, MonochromeTheme}
+
+// themeMsg switches the theme at runtime
+type themeMsg Theme
+
+// setTheme switches to theme, remembering its place among PredefinedThemes
+// so that cycling continues from there
+func (m *model) setTheme(theme Theme) {
+	m.theme = theme
+	m.themeIndex = -1
+	for i, t := range PredefinedThemes {
+		if t.Name == theme.Name {
+			m.themeIndex = i
+		}
+	}
+}
+
+// nextTheme switches to the next predefined theme
+func (m *model) nextTheme() {
+	m.setTheme(PredefinedThemes[(m.themeIndex+1)%len(PredefinedThemes)])
+	m.status = "Theme: " + m.theme.Name
+}
+
+// SetTheme switches this viewer to theme
+func (v *Viewer) SetTheme(theme Theme) {
+	v.program.Send(themeMsg(theme))
+}
+
+// SetTheme switches the theme of the TUI started by StartTUI
+func SetTheme(theme Theme) {
+	if v := defaultViewer(); v != nil {
+		v.SetTheme(theme)
+	}
+}
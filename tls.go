@@ -0,0 +1,250 @@
+package prettybuffers
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/binary"
+	"fmt"
+)
+
+const (
+	// tlsHeaderSize is the size of a TLS record header
+	tlsHeaderSize = 5
+	// maxTLSRecord is the largest record payload allowed, for ciphertext
+	maxTLSRecord = 1<<14 + 2048
+)
+
+// tlsContentTypes names the record content types
+var tlsContentTypes = map[byte]string{
+	20: "ChangeCipherSpec",
+	21: "Alert",
+	22: "Handshake",
+	23: "ApplicationData",
+	24: "Heartbeat",
+}
+
+// tlsHandshakeTypes names the handshake message types
+var tlsHandshakeTypes = map[byte]string{
+	0:  "HelloRequest",
+	1:  "ClientHello",
+	2:  "ServerHello",
+	4:  "NewSessionTicket",
+	8:  "EncryptedExtensions",
+	11: "Certificate",
+	12: "ServerKeyExchange",
+	13: "CertificateRequest",
+	14: "ServerHelloDone",
+	15: "CertificateVerify",
+	16: "ClientKeyExchange",
+	20: "Finished",
+	24: "KeyUpdate",
+}
+
+// tlsVersion names a protocol version such as 0x0303
+func tlsVersion(v uint16) string {
+	switch {
+	case v == 0x0300:
+		return "SSL 3.0"
+	case v > 0x0300 && v <= 0x0304:
+		return fmt.Sprintf("TLS 1.%d", v-0x0301)
+	}
+	return fmt.Sprintf("version 0x%04X", v)
+}
+
+// tlsRecordAt checks for a record header at the start of data and returns
+// the length of its payload
+func tlsRecordAt(data []byte) (int, bool) {
+	if len(data) < tlsHeaderSize {
+		return 0, false
+	}
+	_, known := tlsContentTypes[data[0]]
+	n := int(binary.BigEndian.Uint16(data[3:]))
+	return n, known && data[1] == 3 && data[2] <= 4 && n > 0 && n <= maxTLSRecord
+}
+
+// scanTLSObjects finds runs of TLS records in data starting at from,
+// skipping the ranges of the given objects. A single record is only taken
+// for a handshake or alert that parses, as five bytes match easily by chance.
+// Like scanJSONObjects it returns the offset of records cut off by the end
+// of data.
+func scanTLSObjects(data []byte, from int, skip []jsonObject) ([]jsonObject, int) {
+	var objects []jsonObject
+	resume := len(data)
+	next := 0 // index into skip of the next object at or after i
+	for i := from; i < len(data); i++ {
+		for next < len(skip) && skip[next].endOffset < i {
+			next++
+		}
+		end := len(data)
+		if next < len(skip) {
+			if skip[next].startOffset <= i {
+				i = skip[next].endOffset
+				continue
+			}
+			end = skip[next].startOffset
+		}
+		if _, ok := tlsRecordAt(data[i:end]); !ok {
+			continue
+		}
+
+		obj := jsonObject{startOffset: i, kind: objectTLS}
+		pos, records, plausible, encrypted := i, 0, false, false
+		for {
+			n, ok := tlsRecordAt(data[pos:end])
+			if !ok {
+				break
+			}
+			if pos+tlsHeaderSize+n > end {
+				if end == len(data) {
+					resume = min(resume, i)
+				}
+				break
+			}
+			plausible = obj.addTLSRecord(data[pos:pos+tlsHeaderSize+n], pos, &encrypted) || plausible
+			records++
+			pos += tlsHeaderSize + n
+		}
+		if records == 0 || (records == 1 && !plausible) {
+			continue
+		}
+		obj.endOffset = pos - 1
+		obj.data = data[i:pos]
+		objects = append(objects, obj)
+		i = pos - 1
+	}
+	return objects, resume
+}
+
+// addTLSRecord describes a record starting at off in the summary and regions
+// of the object. Records after a ChangeCipherSpec are encrypted, until a new
+// hello starts a handshake in the other direction. It reports whether the
+// record parsed as a handshake or alert.
+func (o *jsonObject) addTLSRecord(record []byte, off int, encrypted *bool) bool {
+	typ := tlsContentTypes[record[0]]
+	version := tlsVersion(binary.BigEndian.Uint16(record[1:]))
+	payload := record[tlsHeaderSize:]
+	o.summary = append(o.summary, fmt.Sprintf("%s %s record, %d bytes", version, typ, len(payload)))
+	o.regions = append(o.regions,
+		region{start: off, end: off + tlsHeaderSize, label: fmt.Sprintf("TLS record header: %s, %s, %d bytes", typ, version, len(payload))},
+		region{start: off + tlsHeaderSize, end: off + len(record), label: typ})
+
+	switch record[0] {
+	case 20:
+		*encrypted = true
+	case 21:
+		if *encrypted {
+			break
+		}
+		if len(payload) == 2 && (payload[0] == 1 || payload[0] == 2) {
+			level := map[byte]string{1: "warning", 2: "fatal"}[payload[0]]
+			o.summary = append(o.summary, fmt.Sprintf("  %s alert %d", level, payload[1]))
+			return true
+		}
+	case 22:
+		if len(payload) > 0 && (payload[0] == 1 || payload[0] == 2) {
+			*encrypted = false
+		}
+		if *encrypted || !tlsHandshakesFit(payload) {
+			o.summary = append(o.summary, "  encrypted")
+			break
+		}
+		return o.addTLSHandshakes(payload, off+tlsHeaderSize)
+	}
+	return false
+}
+
+// tlsHandshakesFit reports whether a record payload is made up of whole
+// handshake messages of known types, which encrypted ones rarely are
+func tlsHandshakesFit(payload []byte) bool {
+	pos := 0
+	for pos+4 <= len(payload) {
+		if _, known := tlsHandshakeTypes[payload[pos]]; !known {
+			return false
+		}
+		pos += 4 + (int(payload[pos+1])<<16 | int(payload[pos+2])<<8 | int(payload[pos+3]))
+	}
+	return pos == len(payload)
+}
+
+// addTLSHandshakes describes the handshake messages in a record payload
+// starting at off, which must fit as checked by tlsHandshakesFit
+func (o *jsonObject) addTLSHandshakes(payload []byte, off int) bool {
+	parsed := false
+	for pos := 0; pos+4 <= len(payload); {
+		name := tlsHandshakeTypes[payload[pos]]
+		n := int(payload[pos+1])<<16 | int(payload[pos+2])<<8 | int(payload[pos+3])
+		body := payload[pos+4 : pos+4+n]
+		line := fmt.Sprintf("  %s, %d bytes", name, n)
+		switch payload[pos] {
+		case 1:
+			if sni := tlsServerName(body); sni != "" {
+				line += ", SNI " + sni
+			}
+		case 2:
+			// version and random, then the session ID and the chosen cipher suite
+			if len(body) > 34 && 35+int(body[34])+2 <= len(body) {
+				suite := binary.BigEndian.Uint16(body[35+int(body[34]):])
+				line += fmt.Sprintf(", %s, cipher suite %s", tlsVersion(binary.BigEndian.Uint16(body)), tls.CipherSuiteName(suite))
+			}
+		case 11:
+			if subject := tlsCertificateSubject(body); subject != "" {
+				line += ", " + subject
+			}
+		}
+		o.summary = append(o.summary, line)
+		o.regions = append(o.regions, region{start: off + pos, end: off + pos + 4 + n, label: name})
+		parsed = true
+		pos += 4 + n
+	}
+	return parsed
+}
+
+// tlsServerName returns the server name indication of a ClientHello body
+func tlsServerName(body []byte) string {
+	// version and random, then the session ID, cipher suites and compression methods
+	pos := 2 + 32
+	for _, lenSize := range []int{1, 2, 1} {
+		if pos+lenSize > len(body) {
+			return ""
+		}
+		n := int(body[pos])
+		if lenSize == 2 {
+			n = int(binary.BigEndian.Uint16(body[pos:]))
+		}
+		pos += lenSize + n
+	}
+	if pos+2 > len(body) {
+		return ""
+	}
+	end := min(len(body), pos+2+int(binary.BigEndian.Uint16(body[pos:])))
+	for pos += 2; pos+4 <= end; {
+		typ := binary.BigEndian.Uint16(body[pos:])
+		n := int(binary.BigEndian.Uint16(body[pos+2:]))
+		ext := body[pos+4 : min(end, pos+4+n)]
+		// server_name: list length, name type 0 (host_name), name length, name
+		if typ == 0 && len(ext) >= 5 && ext[2] == 0 {
+			if nameLen := int(binary.BigEndian.Uint16(ext[3:])); 5+nameLen <= len(ext) {
+				return sanitizeString(string(ext[5 : 5+nameLen]))
+			}
+		}
+		pos += 4 + n
+	}
+	return ""
+}
+
+// tlsCertificateSubject returns the subject of the first certificate in a
+// Certificate message body, as sent before TLS 1.3 encrypted it
+func tlsCertificateSubject(body []byte) string {
+	if len(body) < 6 {
+		return ""
+	}
+	n := int(body[3])<<16 | int(body[4])<<8 | int(body[5])
+	if 6+n > len(body) {
+		return ""
+	}
+	cert, err := x509.ParseCertificate(body[6 : 6+n])
+	if err != nil {
+		return ""
+	}
+	return "subject " + cert.Subject.String()
+}
@@ -0,0 +1,252 @@
+package prettybuffers
+
+import (
+	"encoding/binary"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf16"
+
+	"github.com/charmbracelet/lipgloss"
+)
+
+const (
+	// minUTF16Units is the shortest run of UTF-16 code units shown as text
+	minUTF16Units = 6
+	// minUTF16BOMUnits is the shortest run after a byte order mark
+	minUTF16BOMUnits = 2
+)
+
+// utf16Run is a run of text decoded from UTF-16
+type utf16Run struct {
+	encoding string // UTF-16LE or UTF-16BE
+	bom      bool
+	length   int // in bytes, including the BOM
+	text     []rune
+}
+
+// utf16Text is the printable text decoded from start in one byte order, up
+// to the first code unit that isn't. Text decoded from any of its characters
+// ends at the same unit, so runs starting there are read off it rather than
+// decoded again, which keeps scanning linear.
+type utf16Text struct {
+	start   int // of the first character, after the BOM if any
+	end     int // exclusive
+	limit   int // end of the data decoded
+	offsets []int
+	ascii   []int // ASCII characters before each one, and in all
+	text    []rune
+}
+
+// decodeUTF16 decodes the printable text from start in data[:limit]. Without
+// a byte order mark, characters whose bytes both read as ASCII end the text.
+func decodeUTF16(data []byte, start, limit int, order binary.ByteOrder, bom bool) utf16Text {
+	t := utf16Text{start: start, limit: limit, ascii: []int{0}}
+	pos := start
+	for pos+2 <= limit {
+		unit := order.Uint16(data[pos:])
+		r, size := rune(unit), 2
+		if utf16.IsSurrogate(r) {
+			if pos+4 > limit {
+				break
+			}
+			r = utf16.DecodeRune(r, rune(order.Uint16(data[pos+2:])))
+			size = 4
+		}
+		if r == unicode.ReplacementChar || !(unicode.IsPrint(r) || r == '\t' || r == '\n' || r == '\r') ||
+			(!bom && r >= 0x100 && isPrintableASCII(data[pos]) && isPrintableASCII(data[pos+1])) {
+			// Both bytes being ASCII more likely means ASCII text than UTF-16
+			break
+		}
+		ascii := t.ascii[len(t.ascii)-1]
+		if r < 0x80 {
+			ascii++
+		}
+		t.offsets = append(t.offsets, pos)
+		t.ascii = append(t.ascii, ascii)
+		t.text = append(t.text, r)
+		pos += size
+	}
+	t.end = pos
+	return t
+}
+
+// run returns the run of the text from its character k. Without a byte order
+// mark, at least half of the characters must be ASCII, as random bytes are
+// often valid UTF-16. Too short runs are no runs either.
+func (t utf16Text) run(k int, encoding string, bom bool) utf16Run {
+	text := t.text[k:]
+	minUnits := minUTF16Units
+	if bom {
+		minUnits = minUTF16BOMUnits
+	}
+	if len(text) < minUnits || (!bom && (t.ascii[len(t.text)]-t.ascii[k])*2 < len(text)) {
+		return utf16Run{}
+	}
+	run := utf16Run{encoding: encoding, bom: bom, length: t.end - t.offsets[k], text: text}
+	if bom {
+		run.length += 2
+	}
+	return run
+}
+
+// isPrintableASCII reports whether b is a printable ASCII character
+func isPrintableASCII(b byte) bool {
+	return b >= 32 && b <= 126
+}
+
+// utf16Decoder reads UTF-16 runs from the positions of a scan, remembering
+// the text last decoded in each byte order and alignment
+type utf16Decoder struct {
+	data  []byte
+	texts [2][2]utf16Text // by byte order, little-endian first, and alignment
+}
+
+// readRun decodes the longest run of printable UTF-16 text from i in
+// data[:limit] in the given byte order, see utf16Text.run
+func (d *utf16Decoder) readRun(i, limit int, bigEndian bool) utf16Run {
+	var order binary.ByteOrder = binary.LittleEndian
+	encoding, o := "UTF-16LE", 0
+	if bigEndian {
+		order, encoding, o = binary.BigEndian, "UTF-16BE", 1
+	}
+	if i+2 <= limit && order.Uint16(d.data[i:]) == 0xFEFF {
+		return decodeUTF16(d.data, i+2, limit, order, true).run(0, encoding, true)
+	}
+	t := &d.texts[o][i%2]
+	if t.limit != limit || i < t.start || i >= t.end {
+		*t = decodeUTF16(d.data, i, limit, order, false)
+	}
+	k := sort.SearchInts(t.offsets, i)
+	if k == len(t.offsets) || t.offsets[k] != i {
+		// i is the low half of a surrogate pair, where no text starts
+		return utf16Run{}
+	}
+	return t.run(k, encoding, false)
+}
+
+// detect returns the UTF-16 text run from i in data[:limit] in whichever
+// byte order gives the longer run
+func (d *utf16Decoder) detect(i, limit int) utf16Run {
+	data := d.data[i:limit]
+	// ASCII in UTF-16 has a zero byte in every code unit
+	if len(data) < 2 || (data[0] != 0 && data[1] != 0 && !(data[0] == 0xFF && data[1] == 0xFE) &&
+		!(data[0] == 0xFE && data[1] == 0xFF)) {
+		// Without a zero byte or BOM up front only non-ASCII text could
+		// start here, which isn't accepted without a BOM anyway
+		return utf16Run{}
+	}
+	le := d.readRun(i, limit, false)
+	be := d.readRun(i, limit, true)
+	if be.length > le.length {
+		return be
+	}
+	return le
+}
+
+// scanUTF16Objects finds runs of UTF-16 text in data starting at from,
+// skipping the ranges of the given objects. Like scanJSONObjects it returns
+// the offset of a run that may continue in appended data.
+func scanUTF16Objects(data []byte, from int, skip []jsonObject) ([]jsonObject, int) {
+	var objects []jsonObject
+	resume := len(data)
+	d := utf16Decoder{data: data}
+	next := 0 // index into skip of the next object at or after i
+	for i := from; i < len(data); i++ {
+		for next < len(skip) && skip[next].endOffset < i {
+			next++
+		}
+		end := len(data)
+		if next < len(skip) {
+			if skip[next].startOffset <= i {
+				i = skip[next].endOffset
+				continue
+			}
+			end = skip[next].startOffset
+		}
+		run := d.detect(i, end)
+		if run.length == 0 {
+			continue
+		}
+		if !run.bom && run.encoding == "UTF-16BE" && i+1 < end {
+			// A zero byte before little-endian text also reads as big-endian
+			// text; prefer little-endian as it's far more common
+			if le := d.readRun(i+1, end, false); len(le.text) >= len(run.text) {
+				continue
+			}
+		}
+		if i+run.length >= len(data)-1 {
+			resume = min(resume, i)
+		}
+		objects = append(objects, jsonObject{
+			startOffset: i,
+			endOffset:   i + run.length - 1,
+			data:        data[i : i+run.length],
+			parsed:      string(run.text),
+			kind:        objectUTF16,
+			encoding:    run.label(),
+		})
+		i += run.length - 1
+	}
+	return objects, resume
+}
+
+// label names the encoding of the run and whether it has a BOM
+func (r utf16Run) label() string {
+	if r.bom {
+		return r.encoding + " with BOM"
+	}
+	return r.encoding
+}
+
+// utf16Lines splits the text of a UTF-16 run into quoted lines, the first
+// one labelled with the encoding. Each line is about as wide as the code
+// units of bytesPerLine bytes, so that wide characters and escapes take more
+// lines rather than wider ones.
+func (o jsonObject) utf16Lines(bytesPerLine int) []string {
+	text, _ := o.parsed.(string)
+	label := o.encoding + " "
+	perLine := max(1, bytesPerLine/2)
+	if strings.HasSuffix(o.encoding, "BOM") {
+		// The BOM takes the first code unit of the first line
+		perLine = max(1, perLine-1)
+	}
+
+	var lines []string
+	var line strings.Builder
+	width := 0
+	flush := func() {
+		prefix := label
+		if len(lines) > 0 {
+			prefix = strings.Repeat(" ", len(label))
+		}
+		lines = append(lines, prefix+`"`+line.String()+`"`)
+		line.Reset()
+		width = 0
+		perLine = max(1, bytesPerLine/2)
+	}
+	for _, r := range text {
+		quoted := strconv.Quote(string(r))
+		quoted = quoted[1 : len(quoted)-1]
+		w := lipgloss.Width(quoted)
+		if line.Len() > 0 && width+w > perLine {
+			flush()
+		}
+		line.WriteString(quoted)
+		width += w
+	}
+	if line.Len() > 0 {
+		flush()
+	}
+	return lines
+}
+
+// displayLine makes a line of the object safe to show. Text runs are quoted
+// already, escaping what isn't printable, so they keep their characters.
+func (o jsonObject) displayLine(line string) string {
+	if o.kind == objectUTF16 {
+		return line
+	}
+	return sanitizeString(line)
+}
@@ -0,0 +1,90 @@
+package prettybuffers
+
+import (
+	"bytes"
+	"testing"
+	"time"
+	"unicode/utf16"
+)
+
+// utf16LE encodes s as UTF-16LE
+func utf16LE(s string) []byte {
+	var b []byte
+	for _, u := range utf16.Encode([]rune(s)) {
+		b = append(b, byte(u), byte(u>>8))
+	}
+	return b
+}
+
+// utf16BE encodes s as UTF-16BE
+func utf16BE(s string) []byte {
+	var b []byte
+	for _, u := range utf16.Encode([]rune(s)) {
+		b = append(b, byte(u>>8), byte(u))
+	}
+	return b
+}
+
+func TestScanUTF16Objects(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     []byte
+		text     string // of the run found, "" for none
+		start    int
+		encoding string
+		resume   int // -1 for len(data)
+	}{
+		{"little-endian", append(append([]byte("\x01\x02"), utf16LE("Hello world")...), 0xFF, 0xFF), "Hello world", 2, "UTF-16LE", -1},
+		{"big-endian", append([]byte("\x01\x02"), utf16BE("Hello world")...), "Hello world", 2, "UTF-16BE", 2},
+		{"BOM", append([]byte{0xFF, 0xFE}, utf16LE("Hi")...), "Hi", 0, "UTF-16LE with BOM", 0},
+		{"surrogate pair", append(utf16LE("Smile 😀 please"), 0xFF, 0xFF), "Smile 😀 please", 0, "UTF-16LE", -1},
+		{"truncated", append(utf16LE("Hello world"), 'x'), "Hello world", 0, "UTF-16LE", 0},
+		{"too short", append(utf16LE("Hey"), 0xFF, 0xFF), "", 0, "", -1},
+		{"mostly not ASCII", append(utf16LE("日本語の文字列 ab"), 0xFF, 0xFF), "", 0, "", -1},
+		{"ASCII text", []byte("plain ASCII text"), "", 0, "", -1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			objects, resume := scanUTF16Objects(tt.data, 0, nil)
+			if tt.text == "" {
+				if len(objects) != 0 {
+					t.Fatalf("found %q, want nothing", objects[0].parsed)
+				}
+			} else {
+				if len(objects) != 1 {
+					t.Fatalf("found %d runs, want 1", len(objects))
+				}
+				o := objects[0]
+				if o.parsed != tt.text || o.startOffset != tt.start || o.encoding != tt.encoding {
+					t.Errorf("found %q at %d as %s, want %q at %d as %s", o.parsed, o.startOffset, o.encoding,
+						tt.text, tt.start, tt.encoding)
+				}
+			}
+			want := tt.resume
+			if want < 0 {
+				want = len(tt.data)
+			}
+			if resume != want {
+				t.Errorf("resume is %d, want %d", resume, want)
+			}
+		})
+	}
+}
+
+// TestScanUTF16ObjectsRejectedRuns makes sure that long runs rejected for
+// not being mostly ASCII aren't decoded again from every byte, which took
+// minutes for a MiB
+func TestScanUTF16ObjectsRejectedRuns(t *testing.T) {
+	inputs := map[string][]byte{
+		"gzip headers": bytes.Repeat([]byte{0x1f, 0x8b, 0x08, 0x00}, 1<<18),
+		"CJK":          bytes.Repeat(utf16LE("日本"), 1<<18),
+	}
+	for name, data := range inputs {
+		start := time.Now()
+		scanUTF16Objects(data, 0, nil)
+		// Linear scans take well under a second; allow for slow machines
+		if elapsed := time.Since(start); elapsed > 5*time.Second {
+			t.Errorf("%s: scanning %d bytes took %v", name, len(data), elapsed)
+		}
+	}
+}
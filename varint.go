@@ -0,0 +1,146 @@
+package prettybuffers
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// varint is an unsigned LEB128 value, as used by protobuf and WASM
+type varint struct {
+	start int // offset of the first byte
+	size  int // in bytes
+	value uint64
+	ok    bool // false when the varint overflows 64 bits or is cut off
+}
+
+// signedLEB128 returns the value sign-extended from its encoded size, as
+// WASM and DWARF encode signed numbers
+func (v varint) signedLEB128() int64 {
+	if bits := 7 * v.size; bits < 64 && v.value&(1<<(bits-1)) != 0 {
+		return int64(v.value) - 1<<bits
+	}
+	return int64(v.value)
+}
+
+// zigzag returns the value decoded as a zigzag varint, as protobuf encodes
+// sint32 and sint64
+func (v varint) zigzag() int64 {
+	return int64(v.value>>1) ^ -int64(v.value&1)
+}
+
+// readVarint decodes the varint at the start of data
+func readVarint(data []byte) varint {
+	value, n := binary.Uvarint(data)
+	switch {
+	case n > 0:
+		return varint{size: n, value: value, ok: true}
+	case n == 0:
+		// Cut off by the end of data
+		return varint{size: len(data)}
+	}
+	// Overflow; the varint still ends at the first byte without the high bit
+	size := -n
+	for size < len(data) && data[size-1]&0x80 != 0 {
+		size++
+	}
+	return varint{size: size}
+}
+
+// rowVarints returns the varints starting in the n bytes of data from start.
+// The bytes before and after only help find where varints begin and end.
+func rowVarints(data []byte, start, n int) []varint {
+	// Varints end at the first byte without the high bit, so skip the bytes
+	// continuing one from before the row
+	pos := start
+	for pos > 0 && pos < start+n && data[pos-1]&0x80 != 0 {
+		pos++
+	}
+	var varints []varint
+	for pos < start+n {
+		v := readVarint(data[pos:])
+		v.start = pos
+		varints = append(varints, v)
+		pos += v.size
+	}
+	return varints
+}
+
+// String shows the value, or "?" when it doesn't decode
+func (v varint) String() string {
+	if !v.ok {
+		return "?"
+	}
+	return strconv.FormatUint(v.value, 10)
+}
+
+// VarintColumn shows the values of the LEB128 varints starting in each row,
+// as used by protobuf, WASM and other compact encodings. Values that don't
+// fit are cut off with "…".
+type VarintColumn struct{}
+
+// Header implements ColumnRenderer
+func (VarintColumn) Header() string { return "Varints" }
+
+// Width implements ColumnRenderer
+func (VarintColumn) Width(bytesPerRow int) int { return bytesPerRow * 3 }
+
+// RenderRow implements ColumnRenderer. A varint continued from the previous
+// row is read as if it started the row, as that row is not known.
+func (c VarintColumn) RenderRow(data []byte, _ int) string {
+	return c.join(rowVarints(data, 0, len(data)), len(data), func(_ varint, text string) string { return text })
+}
+
+func (c VarintColumn) renderStyled(m model, data []byte, offset int) string {
+	before := min(offset, binary.MaxVarintLen64-1)
+	context := m.window(offset-before, before+len(data)+binary.MaxVarintLen64-1)
+	return c.join(rowVarints(context, before, len(data)), m.bytesPerRow, func(v varint, text string) string {
+		pos := offset - before + v.start
+		if m.cursorActive() && m.cursor >= pos && m.cursor < pos+v.size {
+			return m.theme.Cursor.Render(text)
+		}
+		return m.highlight(pos, text, m.theme.JSON)
+	})
+}
+
+// join renders the varints separated by spaces within the column width
+func (c VarintColumn) join(varints []varint, bytesPerRow int, render func(v varint, text string) string) string {
+	width := c.Width(bytesPerRow)
+	var sb strings.Builder
+	used := 0
+	for i, v := range varints {
+		text := v.String()
+		sep := min(i, 1)
+		// Leave room for the "…" unless this is the last value
+		room := width - used - sep
+		if i < len(varints)-1 {
+			room--
+		}
+		if len(text) > room {
+			sb.WriteString("…")
+			break
+		}
+		if sep > 0 {
+			sb.WriteRune(' ')
+		}
+		sb.WriteString(render(v, text))
+		used += sep + len(text)
+	}
+	return sb.String()
+}
+
+// decodeVarintAtCursor shows the varint starting at the cursor in the status
+// line, read as unsigned, zigzag and signed LEB128
+func (m *model) decodeVarintAtCursor() error {
+	if m.cursor >= m.size() {
+		return fmt.Errorf("no byte at the cursor")
+	}
+	v := readVarint(m.window(m.cursor, binary.MaxVarintLen64))
+	if !v.ok {
+		return fmt.Errorf("no valid varint at 0x%08X", m.cursor)
+	}
+	m.status = fmt.Sprintf("Varint at 0x%08X, %d bytes: %d, zigzag %d, signed LEB128 %d",
+		m.cursor, v.size, v.value, v.zigzag(), v.signedLEB128())
+	return nil
+}
@@ -0,0 +1,235 @@
+package prettybuffers
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+const (
+	// maxWebSocketHeader is the size of the longest frame header: two bytes,
+	// an eight byte extended length and a masking key
+	maxWebSocketHeader = 14
+	// webSocketPreviewBytes is how much of a payload its field shows unmasked
+	webSocketPreviewBytes = 48
+)
+
+// webSocketOpcodes names the frame opcodes
+var webSocketOpcodes = map[byte]string{
+	0:  "continuation",
+	1:  "text",
+	2:  "binary",
+	8:  "close",
+	9:  "ping",
+	10: "pong",
+}
+
+// webSocketHeader is the decoded header of a WebSocket frame
+type webSocketHeader struct {
+	fin     bool
+	rsv     byte // extension bits, RSV1 being set for compressed messages
+	opcode  byte
+	masked  bool
+	key     []byte
+	length  uint64 // of the payload
+	lenSize int    // bytes of the length: one, or three or nine when extended
+	size    int    // of the whole header
+}
+
+// webSocketHeaderAt decodes the frame header at the start of data. ok is
+// false if it isn't a valid header, which takes only its first two bytes to
+// tell. The header is incomplete if data is shorter than its size.
+func webSocketHeaderAt(data []byte) (h webSocketHeader, ok bool) {
+	if len(data) < 2 {
+		return h, false
+	}
+	h.fin = data[0]&0x80 != 0
+	h.rsv = data[0] >> 4 & 7
+	h.opcode = data[0] & 0x0F
+	h.masked = data[1]&0x80 != 0
+	h.length = uint64(data[1] & 0x7F)
+	h.lenSize = 1
+	switch h.length {
+	case 126:
+		h.lenSize = 3
+	case 127:
+		h.lenSize = 9
+	}
+	h.size = 1 + h.lenSize
+	if h.masked {
+		h.size += 4
+	}
+	if _, known := webSocketOpcodes[h.opcode]; !known {
+		return h, false
+	}
+	if h.opcode >= 8 && (!h.fin || h.length > 125) {
+		// Control frames are never fragmented and have short payloads
+		return h, false
+	}
+	if len(data) < h.size {
+		return h, true
+	}
+	switch h.lenSize {
+	case 3:
+		h.length = uint64(binary.BigEndian.Uint16(data[2:]))
+	case 9:
+		h.length = binary.BigEndian.Uint64(data[2:])
+	}
+	if h.masked {
+		h.key = data[1+h.lenSize : h.size]
+	}
+	return h, h.length < 1<<62
+}
+
+// unmask returns the start of a payload unmasked with the key of h
+func (h webSocketHeader) unmask(payload []byte) []byte {
+	if !h.masked {
+		return payload
+	}
+	unmasked := make([]byte, len(payload))
+	for i, b := range payload {
+		unmasked[i] = b ^ h.key[i%4]
+	}
+	return unmasked
+}
+
+// webSocketPayload describes the start of a payload, unmasked. Text is shown
+// as text and close frames by their status code and reason.
+func webSocketPayload(opcode byte, compressed bool, preview []byte, length uint64) string {
+	more := uint64(len(preview)) < length
+	switch {
+	case compressed:
+	case opcode == 1:
+		text := fmt.Sprintf("%q", sanitizeString(string(preview)))
+		if more {
+			text += "…"
+		}
+		return text
+	case opcode == 8 && len(preview) >= 2:
+		status := fmt.Sprintf("status %d", binary.BigEndian.Uint16(preview))
+		if len(preview) > 2 {
+			status += fmt.Sprintf(" %q", sanitizeString(string(preview[2:])))
+		}
+		return status
+	}
+	hex := formatHexBytes(preview, len(preview))
+	if more {
+		hex += " ..."
+	}
+	return hex
+}
+
+// parseWebSocket lays out the WebSocket frames following each other from
+// offset, up to the first that is invalid or not yet complete
+func parseWebSocket(read func(off, n int) []byte, size, offset int) []structure {
+	var frames []structure
+	pos := offset
+	message := byte(0) // opcode of the fragmented message going on, 0 for none
+	for len(frames) < maxStructures {
+		h, ok := webSocketHeaderAt(read(pos, maxWebSocketHeader))
+		if !ok || h.size > size-pos || h.length > uint64(size-pos-h.size) {
+			break
+		}
+		opcode := h.opcode
+		if opcode == 0 {
+			opcode = message
+		} else if opcode < 8 {
+			message = opcode
+		}
+		if h.fin && h.opcode < 8 {
+			message = 0
+		}
+
+		name := fmt.Sprintf("WebSocket frame %d", len(frames)+1)
+		b, _ := newStructBuilder(read, pos, h.size, binary.BigEndian, name)
+		flags := webSocketOpcodes[h.opcode]
+		if h.fin {
+			flags = "FIN, " + flags
+		}
+		if h.rsv&4 != 0 {
+			flags += ", compressed"
+		}
+		b.add("flags and opcode", 1, flags)
+		masking := "unmasked"
+		if h.masked {
+			masking = "masked"
+		}
+		b.add("mask and payload length", h.lenSize, fmt.Sprintf("%s, %d bytes", masking, h.length))
+		if h.masked {
+			b.add("masking key", 4, formatHexBytes(h.key, 4))
+		}
+		s := b.done()
+		if h.length > 0 {
+			n := webSocketPreviewBytes
+			if h.length < uint64(n) {
+				n = int(h.length)
+			}
+			preview := h.unmask(read(s.end, n))
+			s.fields = append(s.fields, region{start: s.end, end: s.end + int(h.length),
+				label: name + " payload = " + webSocketPayload(opcode, h.rsv&4 != 0, preview, h.length)})
+			s.end += int(h.length)
+		}
+		frames = append(frames, s)
+		pos = s.end
+	}
+	return frames
+}
+
+// decodeWebSocket overlays the WebSocket frames from offset, laid out again
+// as the buffer changes so that frames are added as they are streamed in
+func (m *model) decodeWebSocket(offset int) error {
+	if offset < 0 || offset >= m.size() {
+		return fmt.Errorf("offset %d is outside the buffer", offset)
+	}
+	if _, ok := webSocketHeaderAt(m.window(offset, 2)); !ok {
+		return fmt.Errorf("no WebSocket frame header at 0x%08X", offset)
+	}
+	m.overlays = append(m.overlays, func(read func(off, n int) []byte, size int, _ binary.ByteOrder) []structure {
+		return parseWebSocket(read, size, offset)
+	})
+	m.parseStructures()
+	frames := parseWebSocket(m.window, m.size(), offset)
+	m.status = fmt.Sprintf("%d WebSocket frames at 0x%08X", len(frames), offset)
+	if len(frames) > 0 {
+		m.status += fmt.Sprintf(" up to 0x%08X", frames[len(frames)-1].end)
+	}
+	return nil
+}
+
+// cmdWebSocket decodes the WebSocket frames at the given offset or the cursor
+func cmdWebSocket(m *model, args string) (tea.Cmd, error) {
+	offset := m.cursor
+	if args = strings.TrimSpace(args); args != "" {
+		var err error
+		if offset, err = parseOffset(args); err != nil {
+			return nil, err
+		}
+	}
+	return nil, m.decodeWebSocket(offset)
+}
+
+// DecodeWebSocket annotates the WebSocket frames following each other from
+// offset in the buffer of this viewer, such as the traffic of a connection
+// after the upgrade handshake. Each frame's header fields are labelled, and
+// its payload with the start of its content unmasked. Frames appended later
+// are decoded as they complete, until ClearOverlays is called. An error is
+// returned if there is no frame header at offset.
+func (v *Viewer) DecodeWebSocket(offset int) error {
+	var err error
+	v.inspect(func(m *model) {
+		err = m.decodeWebSocket(offset)
+	})
+	return err
+}
+
+// DecodeWebSocket decodes WebSocket frames in the TUI started by StartTUI,
+// see Viewer.DecodeWebSocket
+func DecodeWebSocket(offset int) error {
+	v := defaultViewer()
+	if v == nil {
+		return ErrNoViewer
+	}
+	return v.DecodeWebSocket(offset)
+}
@@ -0,0 +1,238 @@
+package prettybuffers
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"io"
+	"strings"
+)
+
+const (
+	// minXMLBytes is the shortest fragment detected as XML, so that stray
+	// tags such as <br/> in text don't count
+	minXMLBytes = 8
+	// maxXMLBytes limits how far a document is parsed from a start tag
+	maxXMLBytes = 1 << 20
+)
+
+// scanXMLObjects finds XML documents and fragments in data starting at from,
+// skipping the ranges of the given objects: a root element with balanced tags,
+// optionally preceded by an XML declaration, comments and a doctype. The start
+// of the first document still open at the end of data is returned as the
+// offset to rescan appended data from.
+func scanXMLObjects(data []byte, from int, skip []jsonObject) ([]jsonObject, int) {
+	var objects []jsonObject
+	resume := len(data)
+	// Where the elements nested in fragments that weren't kept end, so that
+	// trying them next doesn't parse the same bytes again
+	var nested []xmlSpan
+	parsed := map[int]xmlSpan{}
+	next := 0 // index into skip of the next object at or after i
+	for i := from; i < len(data); i++ {
+		if data[i] != '<' || i+1 == len(data) || !isXMLStart(data[i+1]) {
+			continue
+		}
+		for next < len(skip) && skip[next].endOffset < i {
+			next++
+		}
+		end := min(len(data), i+maxXMLBytes)
+		if next < len(skip) {
+			if skip[next].startOffset <= i {
+				i = skip[next].endOffset
+				continue
+			}
+			end = min(end, skip[next].startOffset)
+		}
+		span, ok := parsed[i]
+		if !ok {
+			nested = nested[:0]
+			span.length, span.open = parseXMLFragment(data[i:end], func(n xmlSpan) {
+				// Where an element is still open depends on where the data
+				// parsed stops, so only the end of data is certain
+				if !n.open || end == len(data) {
+					n.start += i
+					nested = append(nested, n)
+				}
+			})
+			if span.open || span.length < minXMLBytes {
+				for _, n := range nested {
+					parsed[n.start] = n
+				}
+			}
+		}
+		if span.open && end == len(data) {
+			resume = min(resume, i)
+			continue
+		}
+		if span.length < minXMLBytes {
+			continue
+		}
+		length := span.length
+		objects = append(objects, jsonObject{
+			startOffset: i,
+			endOffset:   i + length - 1,
+			data:        data[i : i+length],
+			kind:        objectXML,
+			summary:     prettyXML(data[i : i+length]),
+		})
+		i += length - 1
+	}
+	return objects, resume
+}
+
+// xmlSpan is what parsing from an element nested in a fragment gives, see
+// parseXMLFragment
+type xmlSpan struct {
+	start  int
+	length int  // 0 if it isn't XML or still open
+	open   bool // the data parsed ended inside it
+}
+
+// isXMLStart reports whether c may follow the < starting a document: a
+// letter or underscore of a tag name, or the ? or ! of a declaration
+func isXMLStart(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '_' || c == '?' || c == '!'
+}
+
+// parseXMLFragment returns the length of the XML document at the start of
+// data, or 0 if there is none. open reports whether data ended inside it.
+// The elements nested in it are passed to nested along the way, as parsing
+// from their start tags would give the same as the parse tells.
+func parseXMLFragment(data []byte, nested func(xmlSpan)) (length int, open bool) {
+	d := xml.NewDecoder(bytes.NewReader(data))
+	var starts []int // offsets of the open elements, innermost last
+	for first := true; ; first = false {
+		at := int(d.InputOffset())
+		tok, err := d.Token()
+		if err != nil {
+			var syntax *xml.SyntaxError
+			open = err == io.EOF || errors.As(err, &syntax) && syntax.Msg == "unexpected EOF"
+			for _, start := range starts {
+				if start > 0 {
+					nested(xmlSpan{start: start, open: open})
+				}
+			}
+			return 0, open
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			starts = append(starts, at)
+		case xml.EndElement:
+			start, end := starts[len(starts)-1], int(d.InputOffset())
+			if starts = starts[:len(starts)-1]; len(starts) == 0 {
+				return end, false
+			}
+			nested(xmlSpan{start: start, length: end - start})
+		case xml.CharData:
+			if len(starts) == 0 && len(bytes.TrimSpace(t)) > 0 {
+				// Text before the root element
+				return 0, false
+			}
+		case xml.ProcInst:
+			if first && t.Target != "xml" {
+				// Only an XML declaration may start a document
+				return 0, false
+			}
+		}
+	}
+}
+
+// prettyXML indents the tags of an XML document by their depth, with an
+// element holding only text on one line
+func prettyXML(data []byte) []string {
+	d := xml.NewDecoder(bytes.NewReader(data))
+	var tokens []xml.Token
+	for {
+		tok, err := d.RawToken()
+		if err != nil {
+			break
+		}
+		if text, ok := tok.(xml.CharData); ok && len(bytes.TrimSpace(text)) == 0 {
+			continue
+		}
+		tokens = append(tokens, xml.CopyToken(tok))
+	}
+
+	var lines []string
+	depth := 0
+	for i := 0; i < len(tokens); i++ {
+		indent := strings.Repeat("  ", depth)
+		switch t := tokens[i].(type) {
+		case xml.StartElement:
+			line := indent + xmlStartTag(t)
+			// Join the text and end tag of a simple element
+			if i+1 < len(tokens) {
+				if _, ok := tokens[i+1].(xml.EndElement); ok {
+					lines = append(lines, strings.TrimSuffix(line, ">")+"/>")
+					i++
+					continue
+				}
+			}
+			if i+2 < len(tokens) {
+				text, isText := tokens[i+1].(xml.CharData)
+				end, isEnd := tokens[i+2].(xml.EndElement)
+				if isText && isEnd {
+					lines = append(lines, line+xmlText(text)+xmlEndTag(end))
+					i += 2
+					continue
+				}
+			}
+			lines = append(lines, line)
+			depth++
+		case xml.EndElement:
+			depth = max(0, depth-1)
+			lines = append(lines, strings.Repeat("  ", depth)+xmlEndTag(t))
+		case xml.CharData:
+			lines = append(lines, indent+xmlText(t))
+		case xml.Comment:
+			lines = append(lines, indent+"<!--"+string(t)+"-->")
+		case xml.ProcInst:
+			line := indent + "<?" + t.Target
+			if len(t.Inst) > 0 {
+				line += " " + string(t.Inst)
+			}
+			lines = append(lines, line+"?>")
+		case xml.Directive:
+			lines = append(lines, indent+"<!"+string(t)+">")
+		}
+	}
+	return lines
+}
+
+// xmlName formats a name with its namespace prefix as written
+func xmlName(n xml.Name) string {
+	if n.Space != "" {
+		return n.Space + ":" + n.Local
+	}
+	return n.Local
+}
+
+// xmlStartTag formats a start tag with its attributes
+func xmlStartTag(t xml.StartElement) string {
+	var sb strings.Builder
+	sb.WriteString("<" + xmlName(t.Name))
+	for _, a := range t.Attr {
+		sb.WriteString(" " + xmlName(a.Name) + "=\"" + xmlAttrEscaper.Replace(a.Value) + "\"")
+	}
+	sb.WriteString(">")
+	return sb.String()
+}
+
+// xmlEndTag formats an end tag
+func xmlEndTag(t xml.EndElement) string {
+	return "</" + xmlName(t.Name) + ">"
+}
+
+// xmlText formats text content with its lines joined and surrounding space
+// trimmed
+func xmlText(text xml.CharData) string {
+	return xmlTextEscaper.Replace(string(bytes.Join(bytes.Fields(text), []byte(" "))))
+}
+
+// xmlTextEscaper and xmlAttrEscaper escape only what has to be in text and
+// attribute values, keeping quotes in text readable
+var (
+	xmlTextEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+	xmlAttrEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", "\"", "&quot;")
+)
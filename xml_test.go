@@ -0,0 +1,90 @@
+package prettybuffers
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestScanXMLObjects(t *testing.T) {
+	tests := []struct {
+		name   string
+		data   string
+		want   []string // documents found
+		resume int      // -1 for len(data)
+	}{
+		{"document", "\x00\x01<?xml version=\"1.0\"?><note><to>Tove</to></note>\x00",
+			[]string{"<?xml version=\"1.0\"?><note><to>Tove</to></note>"}, -1},
+		{"fragment", "id=7 <item id=\"7\">text</item> rest", []string{"<item id=\"7\">text</item>"}, -1},
+		{"two fragments", "<a>first</a>\x00<b>second</b>", []string{"<a>first</a>", "<b>second</b>"}, -1},
+		{"comment and doctype", "<!-- c --><!DOCTYPE html><html></html>", []string{"<!-- c --><!DOCTYPE html><html></html>"}, -1},
+		{"self-closing root", " <config debug=\"true\"/> ", []string{"<config debug=\"true\"/>"}, -1},
+		{"stray tag", "line<br/>break", nil, -1},
+		{"mismatched tags", "<a><b></a></b> ", nil, -1},
+		{"not a tag", "if a <b && c> d { return }", nil, -1},
+		{"other instruction", "<?php echo 1; ?><p>hi</p>", []string{"<p>hi</p>"}, -1},
+		{"truncated", "\x00<root><child>text</child>", []string{"<child>text</child>"}, 1},
+		{"truncated tag", "\x00<root attr=\"va", nil, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := []byte(tt.data)
+			objects, resume := scanXMLObjects(data, 0, nil)
+			var got []string
+			for _, o := range objects {
+				got = append(got, string(o.data))
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("found %q, want %q", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("document %d is %q, want %q", i, got[i], tt.want[i])
+				}
+			}
+			want := tt.resume
+			if want < 0 {
+				want = len(data)
+			}
+			if resume != want {
+				t.Errorf("resume is %d, want %d", resume, want)
+			}
+		})
+	}
+}
+
+func TestPrettyXML(t *testing.T) {
+	got := prettyXML([]byte("<?xml version=\"1.0\"?><a x=\"1\">\n  <b>some\n text</b><c/><d><e>&lt;</e></d></a>"))
+	want := []string{
+		`<?xml version="1.0"?>`,
+		`<a x="1">`,
+		`  <b>some text</b>`,
+		`  <c/>`,
+		`  <d>`,
+		`    <e>&lt;</e>`,
+		`  </d>`,
+		`</a>`,
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+// TestScanXMLObjectsLarge makes sure that start tags which are never closed
+// or fail to parse aren't parsed again from each of the tags nested in them
+func TestScanXMLObjectsLarge(t *testing.T) {
+	inputs := map[string][]byte{
+		"unclosed":           bytes.Repeat([]byte("<a>"), 1<<16),
+		"unclosed in binary": append(bytes.Repeat([]byte("<a>"), 1<<16), 0x00),
+		"broken":             append(bytes.Repeat([]byte("<a>x</a>"), 1<<15), "</b>"...),
+		"many":               bytes.Repeat([]byte("<item>value</item>\n"), 1<<15),
+	}
+	for name, data := range inputs {
+		start := time.Now()
+		scanXMLObjects(data, 0, nil)
+		if elapsed := time.Since(start); elapsed > 5*time.Second {
+			t.Errorf("%s: scanning %d bytes took %v", name, len(data), elapsed)
+		}
+	}
+}
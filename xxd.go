@@ -0,0 +1,81 @@
+package prettybuffers
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	// xxdBytesPerRow is how many bytes each line of an xxd dump holds
+	xxdBytesPerRow = 16
+	// xxdHexWidth is the width of the hex column of a full line: eight groups
+	// of two bytes separated by spaces
+	xxdHexWidth = xxdBytesPerRow/2*5 - 1
+	// maxXxdSize limits the size of the data a dump may describe, as its
+	// offsets may skip ahead arbitrarily far
+	maxXxdSize = 1 << 30
+)
+
+// Xxd formats data exactly like the default output of xxd, e.g.
+//
+//	00000000: 6865 6c6c 6f20 776f 726c 640a            hello world.
+func Xxd(data []byte) string {
+	var sb strings.Builder
+	for off := 0; off < len(data); off += xxdBytesPerRow {
+		row := data[off:min(off+xxdBytesPerRow, len(data))]
+		var groups strings.Builder
+		for i := 0; i < len(row); i += 2 {
+			if i > 0 {
+				groups.WriteByte(' ')
+			}
+			groups.WriteString(hex.EncodeToString(row[i:min(i+2, len(row))]))
+		}
+		fmt.Fprintf(&sb, "%08x: %-*s  ", off, xxdHexWidth, groups.String())
+		for _, c := range row {
+			if c < 0x20 || c > 0x7e {
+				c = '.'
+			}
+			sb.WriteByte(c)
+		}
+		sb.WriteByte('\n')
+	}
+	return sb.String()
+}
+
+// ParseXxd converts a dump in the format of Xxd back to bytes, like xxd -r.
+// The text column is ignored. Lines are placed at their offsets, so that gaps
+// between them are filled with zeros.
+func ParseXxd(dump string) ([]byte, error) {
+	var data []byte
+	for n, line := range strings.Split(dump, "\n") {
+		line = strings.TrimRight(line, "\r")
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		offsetText, rest, ok := strings.Cut(line, ":")
+		if !ok {
+			return nil, fmt.Errorf("line %d: no offset", n+1)
+		}
+		offset, err := strconv.ParseUint(strings.TrimSpace(offsetText), 16, 64)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: bad offset %q", n+1, offsetText)
+		}
+		// Two spaces separate the hex column from the text
+		hexText, _, _ := strings.Cut(strings.TrimPrefix(rest, " "), "  ")
+		row, err := hex.DecodeString(strings.ReplaceAll(hexText, " ", ""))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", n+1, err)
+		}
+		if offset+uint64(len(row)) > maxXxdSize {
+			return nil, fmt.Errorf("line %d: offset 0x%x is too large", n+1, offset)
+		}
+		end := int(offset) + len(row)
+		if end > len(data) {
+			data = append(data, make([]byte, end-len(data))...)
+		}
+		copy(data[offset:], row)
+	}
+	return data, nil
+}
@@ -0,0 +1,121 @@
+package prettybuffers
+
+import (
+	"bytes"
+	"math/rand"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestXxd(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want string
+	}{
+		{"empty", "", ""},
+		{"one byte", "a", "00000000: 61                                       a\n"},
+		{"odd length", "hello world\n", "00000000: 6865 6c6c 6f20 776f 726c 640a            hello world.\n"},
+		{"unprintable", "\x00\x1f\x20\x7e\x7f\x80\xff", "00000000: 001f 207e 7f80 ff                        .. ~...\n"},
+		{"full line", "0123456789abcdef", "00000000: 3031 3233 3435 3637 3839 6162 6364 6566  0123456789abcdef\n"},
+		{"second line", "0123456789abcdefg",
+			"00000000: 3031 3233 3435 3637 3839 6162 6364 6566  0123456789abcdef\n" +
+				"00000010: 67                                       g\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Xxd([]byte(tt.data)); got != tt.want {
+				t.Errorf("got\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestXxdMatchesXxd compares the output with that of the xxd installed, if
+// there is one
+func TestXxdMatchesXxd(t *testing.T) {
+	if _, err := exec.LookPath("xxd"); err != nil {
+		t.Skip("xxd is not installed")
+	}
+	data := make([]byte, 1000)
+	rand.New(rand.NewSource(1)).Read(data)
+	for _, n := range []int{0, 1, 15, 16, 17, 31, 1000} {
+		cmd := exec.Command("xxd")
+		cmd.Stdin = bytes.NewReader(data[:n])
+		want, err := cmd.Output()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := Xxd(data[:n]); got != string(want) {
+			t.Errorf("%d bytes: got\n%s\nwant\n%s", n, got, want)
+		}
+	}
+}
+
+func TestParseXxd(t *testing.T) {
+	tests := []struct {
+		name string
+		dump string
+		want string
+		err  string // part of the error, "" for none
+	}{
+		{"one line", "00000000: 6865 6c6c 6f0a                           hello.\n", "hello\n", ""},
+		{"two lines", "00000000: 3031 3233 3435 3637 3839 6162 6364 6566  0123456789abcdef\n" +
+			"00000010: 67                                       g\n", "0123456789abcdefg", ""},
+		{"text with two spaces", "00000000: 6120 2062                                a  b\n", "a  b", ""},
+		{"gap", "00000000: 6162  ab\n00000004: 6364  cd\n", "ab\x00\x00cd", ""},
+		{"out of order", "00000002: 6364  cd\n00000000: 6162  ab\n", "abcd", ""},
+		{"CRLF and blank lines", "\r\n00000000: 6162  ab\r\n\n", "ab", ""},
+		{"no text column", "00000000: 6162", "ab", ""},
+		{"empty", "", "", ""},
+		{"no offset", "6162 6364\n", "", "line 1: no offset"},
+		{"bad offset", "0000000g: 6162  ab\n", "", "line 1: bad offset"},
+		{"odd digits", "00000000: 616  a\n", "", "line 1:"},
+		{"not hex", "00000000: 61zz  a\n", "", "line 1:"},
+		{"offset too large", "40000000: 61  a\n", "", "line 1: offset 0x40000000 is too large"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseXxd(tt.dump)
+			switch {
+			case tt.err == "" && err != nil:
+				t.Fatalf("error %v", err)
+			case tt.err != "":
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("error is %v, want one with %q", err, tt.err)
+				}
+				return
+			}
+			if string(got) != tt.want {
+				t.Errorf("parsed %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestXxdRoundTrip parses dumps back to the bytes they were made of, of all
+// lengths around a line and of random data up to a MiB
+func TestXxdRoundTrip(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	data := make([]byte, 1<<20)
+	r.Read(data)
+	sizes := []int{len(data)}
+	for n := range 3 * xxdBytesPerRow {
+		sizes = append(sizes, n)
+	}
+	for _, n := range sizes {
+		start := time.Now()
+		got, err := ParseXxd(Xxd(data[:n]))
+		if err != nil {
+			t.Fatalf("%d bytes: %v", n, err)
+		}
+		if !bytes.Equal(got, data[:n]) {
+			t.Errorf("%d bytes: parsed %d different bytes", n, len(got))
+		}
+		if elapsed := time.Since(start); elapsed > 5*time.Second {
+			t.Errorf("%d bytes: the round trip took %v", n, elapsed)
+		}
+	}
+}
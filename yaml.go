@@ -0,0 +1,212 @@
+package prettybuffers
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// minYAMLKeys is how many key: value lines a document without a --- marker
+// needs, one of them nested, so that flat runs of headers or log lines don't
+// count as YAML
+const minYAMLKeys = 3
+
+// yamlDocument is what scanning the lines of a YAML document found
+type yamlDocument struct {
+	length int // in bytes, including the newline of the last line
+	keys   int
+	marker bool // starts with or contains a --- line
+	nested bool // has indented keys or list items
+}
+
+// accepted reports whether the lines scanned look enough like YAML
+func (d yamlDocument) accepted() bool {
+	return d.marker && d.keys > 0 || d.keys >= minYAMLKeys && d.nested
+}
+
+// isYAMLKeyLine reports whether text, without its indentation, starts with a
+// plain key followed by a colon, such as "name: value" or "items:"
+func isYAMLKeyLine(text string) bool {
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		switch {
+		case c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '_':
+		case i > 0 && (c >= '0' && c <= '9' || c == '-' || c == '.'):
+		case i > 0 && c == ':':
+			return i+1 == len(text) || text[i+1] == ' '
+		default:
+			return false
+		}
+	}
+	return false
+}
+
+// yamlLineEnd returns the end of the line starting at pos and whether it is
+// text, valid UTF-8 without control characters other than tabs. It stops at
+// the first byte that isn't, so that the many lines starting after control
+// characters in binary data or UTF-16 text are rejected without reading on
+// to the next newline.
+func yamlLineEnd(data []byte, pos int) (int, bool) {
+	for i := pos; i < len(data); {
+		c := data[i]
+		switch {
+		case c == '\n':
+			return i, true
+		case c == '\r' && (i+1 == len(data) || data[i+1] == '\n'):
+			i++
+		case c < 0x20 && c != '\t' || c == 0x7f:
+			return i, false
+		case c >= utf8.RuneSelf:
+			r, size := utf8.DecodeRune(data[i:])
+			if r == utf8.RuneError && size == 1 {
+				return i, false
+			}
+			i += size
+		default:
+			i++
+		}
+	}
+	return len(data), true
+}
+
+// scanYAMLDocument reads the lines of a YAML document starting at pos for as
+// long as they look like YAML: keys, list items, comments, document markers,
+// blank lines and lines indented more than the key or item before them
+func scanYAMLDocument(data []byte, pos int) yamlDocument {
+	var doc yamlDocument
+	start := pos
+	structIndent := -1 // indentation of the last key or list item
+	for pos < len(data) {
+		end, ok := yamlLineEnd(data, pos)
+		if !ok {
+			break
+		}
+		line := strings.TrimRight(string(data[pos:end]), " \t\r")
+		text := strings.TrimLeft(line, " ")
+		indent := len(line) - len(text)
+		switch {
+		case text == "" || strings.HasPrefix(text, "#"):
+		case indent == 0 && (text == "---" || strings.HasPrefix(text, "--- ")):
+			if pos > start && doc.keys > 0 {
+				// The next document
+				return doc
+			}
+			doc.marker = true
+			structIndent = -1
+		case indent == 0 && text == "...":
+			doc.length = min(end+1, len(data)) - start
+			return doc
+		case isYAMLKeyLine(text):
+			doc.keys++
+			doc.nested = doc.nested || indent > 0
+			structIndent = indent
+		case isYAMLItem(text):
+			if indent == 0 && doc.keys == 0 && !doc.marker {
+				// A list on its own is as likely to be plain text
+				return doc
+			}
+			doc.nested = doc.nested || indent > 0 || structIndent >= 0
+			structIndent = indent
+		case indent > structIndent && structIndent >= 0:
+			// A continued value or block scalar
+		default:
+			return doc
+		}
+		if text != "" && !strings.HasPrefix(text, "#") {
+			doc.length = min(end+1, len(data)) - start
+		}
+		pos = end + 1
+	}
+	return doc
+}
+
+// scanYAMLObjects finds YAML documents in data starting at from, skipping the
+// ranges of the given objects. A document starts at the start of a line,
+// with --- or a key at the start of the line. Like scanUTF16Objects it
+// returns the offset of a document that may continue in appended data.
+func scanYAMLObjects(data []byte, from int, skip []jsonObject) ([]jsonObject, int) {
+	var objects []jsonObject
+	resume := len(data)
+	next := 0 // index into skip of the next object at or after i
+	for i := from; i < len(data); i++ {
+		if i > 0 && data[i-1] != '\n' && (data[i-1] >= 0x20 || data[i-1] == '\t') || !isYAMLStart(data[i]) {
+			continue
+		}
+		for next < len(skip) && skip[next].endOffset < i {
+			next++
+		}
+		end := len(data)
+		if next < len(skip) {
+			if skip[next].startOffset <= i {
+				i = skip[next].endOffset
+				continue
+			}
+			end = skip[next].startOffset
+		}
+		doc := scanYAMLDocument(data[:end], i)
+		if !doc.accepted() {
+			// Documents starting at later lines of these wouldn't be accepted
+			// either
+			i += max(doc.length, 1) - 1
+			continue
+		}
+		if i+doc.length >= len(data)-1 {
+			resume = min(resume, i)
+		}
+		objects = append(objects, jsonObject{
+			startOffset: i,
+			endOffset:   i + doc.length - 1,
+			data:        data[i : i+doc.length],
+			kind:        objectYAML,
+			summary:     prettyYAML(data[i : i+doc.length]),
+		})
+		i += doc.length - 1
+	}
+	return objects, resume
+}
+
+// isYAMLStart reports whether a document may start with c: a key or ---
+func isYAMLStart(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '_' || c == '-'
+}
+
+// prettyYAML reindents the lines of a YAML document by two spaces a level,
+// keeping the relative indentation of block scalars and dropping blank lines
+func prettyYAML(data []byte) []string {
+	var lines []string
+	var stack []int   // indentation of the enclosing levels
+	prefix := ""      // indentation of the last line outside block scalars
+	block := -1       // indentation of the key of the block scalar being read
+	blockIndent := -1 // indentation of its first line of text
+	for _, raw := range strings.Split(string(data), "\n") {
+		line := strings.TrimRight(strings.ReplaceAll(raw, "\t", "    "), " \r")
+		text := strings.TrimLeft(line, " ")
+		indent := len(line) - len(text)
+		if text == "" {
+			continue
+		}
+		if block >= 0 && indent > block {
+			if blockIndent < 0 {
+				blockIndent = indent
+			}
+			lines = append(lines, prefix+"  "+strings.Repeat(" ", max(0, indent-blockIndent))+text)
+			continue
+		}
+		block, blockIndent = -1, -1
+
+		for len(stack) > 0 && stack[len(stack)-1] > indent {
+			stack = stack[:len(stack)-1]
+		}
+		if len(stack) == 0 || stack[len(stack)-1] < indent {
+			stack = append(stack, indent)
+		}
+		prefix = strings.Repeat("  ", len(stack)-1)
+		lines = append(lines, prefix+text)
+		// A value of | or > starts a block scalar, such as "key: |" or "- >-"
+		if fields := strings.Fields(text); len(fields) > 1 {
+			if v := fields[len(fields)-1]; (v[0] == '|' || v[0] == '>') && strings.Trim(v[1:], "+-0123456789") == "" {
+				block = indent
+			}
+		}
+	}
+	return lines
+}
@@ -0,0 +1,69 @@
+package prettybuffers
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestScanYAMLObjects(t *testing.T) {
+	tests := []struct {
+		name   string
+		data   string
+		want   []string // documents found
+		resume int      // -1 for len(data)
+	}{
+		{"nested keys", "\x00\x01server:\n  host: example.com\n  port: 80\nname: demo\n\x00\x00",
+			[]string{"server:\n  host: example.com\n  port: 80\nname: demo\n"}, -1},
+		{"marker", "\x00---\nkey: value\n\x00\x00", []string{"---\nkey: value\n"}, -1},
+		{"document end", "\x00a:\n  b: 1\nc: 2\n...\nrest", []string{"a:\n  b: 1\nc: 2\n...\n"}, -1},
+		{"two documents", "---\na: 1\n---\nb: 2\n\x00\x00", []string{"---\na: 1\n", "---\nb: 2\n"}, -1},
+		{"list under key", "\x00items:\n- one\n- two\nname: x\nid: 7\n\x00\x00", []string{"items:\n- one\n- two\nname: x\nid: 7\n"}, -1},
+		{"flat keys", "\x00Host: example.com\nAccept: */*\nUser-Agent: curl\n\x00", nil, -1},
+		{"list alone", "\x00- one\n- two\n- three\n\x00", nil, -1},
+		{"control characters", "\x00a:\n  b: \x01\nc: 2\n", nil, -1},
+		{"truncated", "\x00---\nkey: value\nmore: of it", []string{"---\nkey: value\nmore: of it"}, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := []byte(tt.data)
+			objects, resume := scanYAMLObjects(data, 0, nil)
+			var got []string
+			for _, o := range objects {
+				got = append(got, string(o.data))
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("found %q, want %q", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("document %d is %q, want %q", i, got[i], tt.want[i])
+				}
+			}
+			want := tt.resume
+			if want < 0 {
+				want = len(data)
+			}
+			if resume != want {
+				t.Errorf("resume is %d, want %d", resume, want)
+			}
+		})
+	}
+}
+
+// TestScanYAMLObjectsWithoutNewlines makes sure that lines starting after
+// control characters are rejected without reading on to the next newline,
+// which took seconds for a MiB of UTF-16 text
+func TestScanYAMLObjectsWithoutNewlines(t *testing.T) {
+	inputs := map[string][]byte{
+		"UTF-16":          utf16LE(string(bytes.Repeat([]byte("key: value "), 1<<16))),
+		"control between": bytes.Repeat([]byte("a: b\x01"), 1<<18),
+	}
+	for name, data := range inputs {
+		start := time.Now()
+		scanYAMLObjects(data, 0, nil)
+		if elapsed := time.Since(start); elapsed > 5*time.Second {
+			t.Errorf("%s: scanning %d bytes took %v", name, len(data), elapsed)
+		}
+	}
+}